@@ -17,7 +17,9 @@
 package app
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net"
 	"os"
 	"os/user"
@@ -105,7 +107,11 @@ Run 'orchestrator help <command>' for detailed help on given command, e.g. 'orch
 
 Usage for most commands:
 	orchestrator -c <command> [-i <instance.fqdn>[,<instance.fqdn>]* ] [-d <destination.fqdn>] [--verbose|--debug]
-`, commandsListing())
+
+With RemoteAPI configured, commands run via the API of an orchestrator server. Only these are supported in remote mode:
+	%s
+Use orchestrator-client for any other command.
+`, commandsListing(), strings.Join(remoteCommands, ", "))
 }
 
 // getClusterName will make a best effort to deduce a cluster name using either a given alias
@@ -131,9 +137,50 @@ func validateInstanceIsFound(instanceKey *inst.InstanceKey) (instance *inst.Inst
 	return instance
 }
 
+// readDesiredTopologyFlag returns the --desired-topology flag value; a value of "@file.name" is read from given file
+func readDesiredTopologyFlag() string {
+	desiredTopology := *config.RuntimeCLIFlags.DesiredTopology
+	if strings.HasPrefix(desiredTopology, "@") {
+		content, err := ioutil.ReadFile(desiredTopology[1:])
+		if err != nil {
+			log.Fatale(err)
+		}
+		desiredTopology = string(content)
+	}
+	if desiredTopology == "" {
+		log.Fatal("--desired-topology expected")
+	}
+	return desiredTopology
+}
+
+// failOnRaftSetup refuses commands writing state which is replicated via raft, even with --ignore-raft-setup:
+// writing the backend database directly would leave other raft nodes unaware of the change
+func failOnRaftSetup(command string, apiEndpoint string) {
+	if config.Config.RaftEnabled {
+		log.Fatalf(`%s: orchestrator configured to run raft ("RaftEnabled": true). Use the web API of the leader (%s), or the command line with RemoteAPI configured`, command, apiEndpoint)
+	}
+}
+
+func printTopologyPlan(plan *inst.TopologyPlan) {
+	if plan.PlanId > 0 {
+		fmt.Println(fmt.Sprintf("plan %d: %s", plan.PlanId, plan.State))
+	}
+	for _, step := range plan.Steps {
+		fmt.Println(fmt.Sprintf("%d %s %s %s %s", step.StepIndex, step.Operation, step.Key.DisplayString(), step.TargetKey.DisplayString(), step.State))
+	}
+}
+
 // CliWrapper is called from main and allows for the instance parameter
 // to take multiple instance names separated by a comma or whitespace.
+// With RemoteAPI configured, commands run via the API; see RemoteCliWrapper.
 func CliWrapper(command string, strict bool, instances string, destination string, owner string, reason string, duration string, pattern string, clusterAlias string, pool string, hostnameFlag string) {
+	if synonym, ok := commandSynonyms[command]; ok {
+		command = synonym
+	}
+	if isRemoteCommand(command) {
+		RemoteCliWrapper(command, instances, destination, owner, reason, duration, pattern, clusterAlias)
+		return
+	}
 	if config.Config.RaftEnabled && !*config.RuntimeCLIFlags.IgnoreRaftSetup {
 		log.Fatalf(`Orchestrator configured to run raft ("RaftEnabled": true). All access must go through the web API of the active raft node. You may use the orchestrator-client script which has a similar interface to the command line invocation. You may override this with --ignore-raft-setup`)
 	}
@@ -167,6 +214,8 @@ func Cli(command string, strict bool, instance string, destination string, owner
 		skipDatabaseCommands = true
 	case "dump-config":
 		skipDatabaseCommands = true
+	case "validate-config":
+		skipDatabaseCommands = true
 	}
 
 	instanceKey, err := inst.ParseResolveInstanceKey(instance)
@@ -275,6 +324,45 @@ func Cli(command string, strict bool, instance string, destination string, owner
 				log.Fatale(err)
 			}
 		}
+	case registerCliCommand("plan-topology", "Smart relocation", `Show the plan of operations reshaping a cluster into a desired topology`):
+		{
+			clusterName := getClusterName(clusterAlias, instanceKey)
+			desired, err := inst.ParseDesiredTopology(readDesiredTopologyFlag())
+			if err != nil {
+				log.Fatale(err)
+			}
+			plan, err := inst.ComputeTopologyPlan(clusterName, desired)
+			if err != nil {
+				log.Fatale(err)
+			}
+			printTopologyPlan(plan)
+		}
+	case registerCliCommand("apply-topology", "Smart relocation", `Reshape a cluster into a desired topology`):
+		{
+			clusterName := getClusterName(clusterAlias, instanceKey)
+			desired, err := inst.ParseDesiredTopology(readDesiredTopologyFlag())
+			if err != nil {
+				log.Fatale(err)
+			}
+			plan, err := inst.ApplyTopology(clusterName, desired)
+			if plan != nil {
+				printTopologyPlan(plan)
+			}
+			if err != nil {
+				log.Fatale(err)
+			}
+		}
+	case registerCliCommand("resume-topology-plan", "Smart relocation", `Resume the latest unfinished topology plan of a cluster`):
+		{
+			clusterName := getClusterName(clusterAlias, instanceKey)
+			plan, err := inst.ResumeTopologyPlan(clusterName)
+			if plan != nil {
+				printTopologyPlan(plan)
+			}
+			if err != nil {
+				log.Fatale(err)
+			}
+		}
 		// General replication commands
 		// move, binlog file:pos
 	case registerCliCommand("move-up", "Classic file:pos relocation", `Move a replica one level up the topology`):
@@ -977,6 +1065,38 @@ func Cli(command string, strict bool, instance string, destination string, owner
 			}
 			fmt.Println(fmt.Sprintf("%+v", *coordinates))
 		}
+	case registerCliCommand("binlog-events", "Binary logs", `List binary log events of an instance starting given coordinates (--binlog=file:pos), optionally filtered by --event-type, --gtid, --pattern`), registerCliCommand("relaylog-events", "Binary logs", `List relay log events of an instance starting given coordinates (--binlog=file:pos), optionally filtered by --event-type, --gtid, --pattern`):
+		{
+			instanceKey, _ = inst.FigureInstanceKey(instanceKey, thisInstanceKey)
+			if instanceKey == nil {
+				log.Fatalf("Unresolved instance")
+			}
+			if *config.RuntimeCLIFlags.BinlogFile == "" {
+				log.Fatal("expecting --binlog value")
+			}
+			coordinates, err := inst.ParseBinlogCoordinates(*config.RuntimeCLIFlags.BinlogFile)
+			if err != nil {
+				log.Fatalf("Expecing --binlog argument as file:pos")
+			}
+			coordinates.Type = inst.BinaryLog
+			if command == "relaylog-events" {
+				coordinates.Type = inst.RelayLog
+			}
+			filter, err := inst.NewBinlogEventFilter(*config.RuntimeCLIFlags.EventType, *config.RuntimeCLIFlags.GTID, pattern)
+			if err != nil {
+				log.Fatale(err)
+			}
+			for coordinates != nil {
+				events, nextCoordinates, err := inst.ReadBinlogEvents(instanceKey, *coordinates, filter, 0)
+				if err != nil {
+					log.Fatale(err)
+				}
+				for _, event := range events {
+					fmt.Println(fmt.Sprintf("%+v\t%d\t%s\t%s", event.Coordinates, event.NextEventPos, event.EventType, event.Info))
+				}
+				coordinates = nextCoordinates
+			}
+		}
 		// Pool
 	case registerCliCommand("submit-pool-instances", "Pools", `Submit a pool name with a list of instances in that pool`):
 		{
@@ -1130,6 +1250,18 @@ func Cli(command string, strict bool, instance string, destination string, owner
 			}
 			fmt.Println(clusterInfo.ClusterAlias)
 		}
+	case registerCliCommand("cluster-config", "Information", `Output the per cluster overridable settings in effect for a cluster, and where their values come from`):
+		{
+			clusterName := getClusterName(clusterAlias, instanceKey)
+			clusterConfig := inst.ReadEffectiveClusterConfig(clusterName)
+			for _, setting := range clusterConfig.Settings {
+				value, err := json.Marshal(setting.Value)
+				if err != nil {
+					log.Fatale(err)
+				}
+				fmt.Println(fmt.Sprintf("%s\t%s\t%s", setting.Name, string(value), setting.Source))
+			}
+		}
 	case registerCliCommand("which-cluster-domain", "Information", `Output the domain name of the cluster an instance belongs to, or error if unknown to orchestrator`):
 		{
 			clusterName := getClusterName(clusterAlias, instanceKey)
@@ -1271,6 +1403,40 @@ func Cli(command string, strict bool, instance string, destination string, owner
 			}
 		}
 
+	case registerCliCommand("replica-pools", "Key-value", `List replica pools of a specific cluster, or of all clusters: replicas with lag, data center, status and traffic weight`):
+		{
+			clusterName := getClusterName(clusterAlias, instanceKey)
+			pools, err := inst.ReadReplicaPools(clusterName)
+			if err != nil {
+				log.Fatale(err)
+			}
+			for _, pool := range pools {
+				for _, member := range pool.Members {
+					fmt.Println(fmt.Sprintf("%s\t%s:%d\t%d\t%d\t%s\t%s", pool.ClusterAlias, member.Hostname, member.Port, member.Weight, member.LagSeconds, member.DataCenter, member.ExclusionReason))
+				}
+			}
+		}
+	case registerCliCommand("submit-replica-pools-to-kv-stores", "Key-value", `Submit replica pool of a specific cluster, or replica pools of all clusters to key-value stores`):
+		{
+			clusterName := getClusterName(clusterAlias, instanceKey)
+			kvPairs, _, err := logic.SubmitReplicaPoolsToKvStores(clusterName, true)
+			if err != nil {
+				log.Fatale(err)
+			}
+			for _, kvPair := range kvPairs {
+				fmt.Println(fmt.Sprintf("%s:%s", kvPair.Key, kvPair.Value))
+			}
+		}
+
+	case registerCliCommand("proxysql-sync-readers", "Recovery", `Update ProxySQL reader hostgroups to reflect clusters' healthy replicas, weighted by lag`):
+		{
+			syncedCount, err := logic.SyncProxySQLReaders(true)
+			if err != nil {
+				log.Fatale(err)
+			}
+			fmt.Println(syncedCount)
+		}
+
 	case registerCliCommand("tags", "tags", `List tags for a given instance`):
 		{
 			instanceKey, _ = inst.FigureInstanceKey(instanceKey, thisInstanceKey)
@@ -1381,6 +1547,42 @@ func Cli(command string, strict bool, instance string, destination string, owner
 			}
 			fmt.Println(instanceKey.DisplayString())
 		}
+	case registerCliCommand("garbage-report", "Instance management", `List instances not seen for given --duration, clusters with no valid master, and rows referencing forgotten instances`):
+		{
+			staleHours, err := inst.StaleHoursFromDuration(duration)
+			if err != nil {
+				log.Fatale(err)
+			}
+			report, err := inst.ReadGarbageReport(staleHours)
+			if err != nil {
+				log.Fatale(err)
+			}
+			for _, staleInstance := range report.StaleInstances {
+				fmt.Println(fmt.Sprintf("stale-instance\t%s\t%s\t%s", staleInstance.Key.DisplayString(), staleInstance.ClusterName, staleInstance.LastSeen))
+			}
+			for _, ghostCluster := range report.GhostClusters {
+				fmt.Println(fmt.Sprintf("ghost-cluster\t%s\t%s\t%d\t%s", ghostCluster.ClusterName, ghostCluster.ClusterAlias, ghostCluster.CountInstances, ghostCluster.LastSeen))
+			}
+			for _, orphanedRow := range report.OrphanedRows {
+				fmt.Println(fmt.Sprintf("orphaned-row\t%s\t%s", orphanedRow.Key.DisplayString(), orphanedRow.Table))
+			}
+		}
+	case registerCliCommand("forget-garbage", "Instance management", `Forget instances not seen for given --duration, and rows referencing forgotten instances`):
+		{
+			staleHours, err := inst.StaleHoursFromDuration(duration)
+			if err != nil {
+				log.Fatale(err)
+			}
+			report, err := inst.ReadGarbageReport(staleHours)
+			if err != nil {
+				log.Fatale(err)
+			}
+			forgottenCount, err := inst.ForgetGarbage(report)
+			if err != nil {
+				log.Fatale(err)
+			}
+			fmt.Println(forgottenCount)
+		}
 	case registerCliCommand("begin-maintenance", "Instance management", `Request a maintenance lock on an instance`):
 		{
 			instanceKey, _ = inst.FigureInstanceKey(instanceKey, thisInstanceKey)
@@ -1603,6 +1805,35 @@ func Cli(command string, strict bool, instance string, destination string, owner
 			}
 			fmt.Println(instanceKey.DisplayString())
 		}
+	case registerCliCommand("link-cluster", "Instance, meta", `Mark a replica as the master of a downstream cluster, linked to the cluster it replicates from`):
+		{
+			instanceKey, _ = inst.FigureInstanceKey(instanceKey, thisInstanceKey)
+			if clusterAlias == "" {
+				log.Fatal("--alias (downstream cluster alias) must be provided")
+			}
+			if _, err := inst.LinkCluster(instanceKey, clusterAlias); err != nil {
+				log.Fatale(err)
+			}
+			fmt.Println(instanceKey.DisplayString())
+		}
+	case registerCliCommand("unlink-cluster", "Instance, meta", `Remove a cluster link; the downstream cluster rejoins the upstream cluster`):
+		{
+			instanceKey, _ = inst.FigureInstanceKey(instanceKey, thisInstanceKey)
+			if err := inst.UnlinkCluster(instanceKey); err != nil {
+				log.Fatale(err)
+			}
+			fmt.Println(instanceKey.DisplayString())
+		}
+	case registerCliCommand("cluster-links", "Instance, meta", `List cluster links: downstream cluster masters, their aliases and upstream clusters`):
+		{
+			links, err := inst.ReadClusterLinks()
+			if err != nil {
+				log.Fatale(err)
+			}
+			for _, link := range links {
+				fmt.Println(fmt.Sprintf("%s\t%s\t%s", link.Key.DisplayString(), link.DownstreamClusterAlias, link.UpstreamClusterName))
+			}
+		}
 
 		// meta
 	case registerCliCommand("snapshot-topologies", "Meta", `Take a snapshot of existing topologies.`):
@@ -1634,6 +1865,60 @@ func Cli(command string, strict bool, instance string, destination string, owner
 			}
 			fmt.Println(publicToken)
 		}
+	case registerCliCommand("create-api-token", "Meta", `Create an API token for a service account`):
+		{
+			failOnRaftSetup(command, "POST /api/v2/api-tokens")
+			serviceAccount := *config.RuntimeCLIFlags.ServiceAccount
+			if serviceAccount == "" {
+				log.Fatal("--service-account option required")
+			}
+			clusterName := ""
+			if clusterAlias != "" {
+				clusterName, err = inst.FigureClusterName(clusterAlias, nil, nil)
+				if err != nil {
+					log.Fatale(err)
+				}
+			}
+			var durationSeconds int = 0
+			if duration != "" {
+				durationSeconds, err = util.SimpleTimeToSeconds(duration)
+				if err != nil {
+					log.Fatale(err)
+				}
+			}
+			token, apiToken, err := process.NewAPIToken(serviceAccount, *config.RuntimeCLIFlags.TokenScope, clusterName, owner, time.Duration(durationSeconds)*time.Second)
+			if err != nil {
+				log.Fatale(err)
+			}
+			if err := process.WriteAPIToken(apiToken); err != nil {
+				log.Fatale(err)
+			}
+			inst.AuditOperation("create-api-token", nil, fmt.Sprintf("Created API token %s for %s; scope: %s, cluster: %s, by %s", apiToken.TokenId, apiToken.Name, apiToken.Scope, apiToken.ClusterName, apiToken.CreatedBy))
+			fmt.Println(token)
+		}
+	case registerCliCommand("revoke-api-token", "Meta", `Revoke an API token`):
+		{
+			failOnRaftSetup(command, "DELETE /api/v2/api-tokens/:tokenId")
+			tokenId := *config.RuntimeCLIFlags.TokenId
+			if tokenId == "" {
+				log.Fatal("--token-id option required")
+			}
+			if err := process.RevokeAPIToken(tokenId); err != nil {
+				log.Fatale(err)
+			}
+			inst.AuditOperation("revoke-api-token", nil, fmt.Sprintf("Revoked API token %s, by %s", tokenId, owner))
+			fmt.Println(tokenId)
+		}
+	case registerCliCommand("api-tokens", "Meta", `List API tokens of service accounts`):
+		{
+			apiTokens, err := process.ReadAPITokens()
+			if err != nil {
+				log.Fatale(err)
+			}
+			for _, apiToken := range apiTokens {
+				fmt.Println(strings.Join([]string{apiToken.TokenId, apiToken.Name, apiToken.Scope, apiToken.ClusterName, apiToken.CreatedAtString, apiToken.ExpiresAtString, apiToken.CreatedBy}, "\t"))
+			}
+		}
 	case registerCliCommand("resolve", "Meta", `Resolve given hostname`):
 		{
 			if rawInstanceKey == nil {
@@ -1661,11 +1946,35 @@ func Cli(command string, strict bool, instance string, destination string, owner
 			}
 			fmt.Println("hostname resolve cache cleared")
 		}
-	case registerCliCommand("dump-config", "Meta", `Print out configuration in JSON format`):
+	case registerCliCommand("dump-config", "Meta", `Print out effective configuration (files and environment merged) in JSON format, with secrets redacted`):
 		{
-			jsonString := config.Config.ToJSONString()
+			jsonString := config.Config.ToRedactedJSONString()
 			fmt.Println(jsonString)
 		}
+	case registerCliCommand("validate-config", "Meta", `Validate configuration files, reporting unknown keys, type errors and unsafe settings in JSON format`):
+		{
+			fileNames := config.FileNames()
+			if len(fileNames) == 0 {
+				log.Fatalf("validate-config: no configuration file found")
+			}
+			validations := []*config.ConfigValidation{}
+			failed := false
+			for _, fileName := range fileNames {
+				validation := config.ValidateFile(fileName)
+				validations = append(validations, validation)
+				if !validation.Valid || (strict && validation.HasWarnings()) {
+					failed = true
+				}
+			}
+			jsonBytes, err := json.MarshalIndent(validations, "", "  ")
+			if err != nil {
+				log.Fatale(err)
+			}
+			fmt.Println(string(jsonBytes))
+			if failed {
+				os.Exit(1)
+			}
+		}
 	case registerCliCommand("show-resolve-hosts", "Meta", `Show the content of the hostname_resolve table. Generally used for debugging`):
 		{
 			resolves, err := inst.ReadAllHostnameResolves()
@@ -0,0 +1,679 @@
+/*
+   Copyright 2019 GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package app
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/user"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/github/orchestrator/go/client"
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/inst"
+	"github.com/github/orchestrator/go/ssl"
+	"github.com/openark/golib/log"
+	"github.com/openark/golib/util"
+)
+
+// localCommands run locally even when RemoteAPI is configured: they concern this process' own configuration
+var localCommands = map[string]bool{
+	"help":            true,
+	"dump-config":     true,
+	"validate-config": true,
+}
+
+// remoteCommands are the commands remoteCli supports, a subset of those orchestrator-client supports.
+// Any other command fails in remote mode.
+var remoteCommands = []string{
+	"relocate", "relocate-replicas", "move-up", "move-below",
+	"start-slave", "stop-slave", "set-read-only", "set-writeable",
+	"discover", "forget", "begin-maintenance", "end-maintenance", "begin-downtime", "end-downtime",
+	"recover", "recover-lite", "force-master-failover", "graceful-master-takeover", "replication-analysis",
+	"enable-global-recoveries", "disable-global-recoveries", "check-global-recoveries",
+	"clusters", "which-cluster", "which-cluster-instances", "which-master", "which-replicas", "which-downtimed-instances",
+	"instance-status", "tags", "tag", "untag",
+	"api-tokens", "create-api-token", "revoke-api-token",
+}
+
+// isRemoteCommand checks whether given command should run via RemoteAPI
+func isRemoteCommand(command string) bool {
+	return len(config.Config.RemoteAPI) > 0 && !localCommands[command]
+}
+
+// remoteCliArguments are the command line arguments a remote command may use
+type remoteCliArguments struct {
+	instance     string
+	destination  string
+	owner        string
+	reason       string
+	duration     string
+	pattern      string
+	clusterAlias string
+	tag          string
+	// API tokens
+	serviceAccount string
+	tokenScope     string
+	tokenId        string
+}
+
+// remoteCli runs CLI commands via the API of an orchestrator server, rather than against the backend
+// database. Output is that of the local CLI.
+type remoteCli struct {
+	client          *client.Client
+	out             io.Writer
+	thisInstanceKey *inst.InstanceKey
+}
+
+// newRemoteAPIClient creates an API client as configured by the RemoteAPI* settings
+func newRemoteAPIClient() (*client.Client, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: config.Config.RemoteAPISSLSkipVerify}
+	if config.Config.RemoteAPISSLCAFile != "" {
+		caPool, err := ssl.ReadCAFile(config.Config.RemoteAPISSLCAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = caPool
+	}
+	if config.Config.RemoteAPISSLCertFile != "" {
+		var sslPEMPassword []byte
+		if ssl.IsEncryptedPEM(config.Config.RemoteAPISSLPrivateKeyFile) {
+			sslPEMPassword = ssl.GetPEMPassword(config.Config.RemoteAPISSLPrivateKeyFile)
+		}
+		if err := ssl.AppendKeyPairWithPassword(tlsConfig, config.Config.RemoteAPISSLCertFile, config.Config.RemoteAPISSLPrivateKeyFile, sslPEMPassword); err != nil {
+			return nil, err
+		}
+	}
+	return client.NewClient(client.Config{
+		Endpoints:        config.Config.RemoteAPI,
+		HTTPAuthUser:     config.Config.RemoteAPIUser,
+		HTTPAuthPassword: config.Config.RemoteAPIPassword,
+		AuthToken:        config.Config.RemoteAPIToken,
+		TLSConfig:        tlsConfig,
+	})
+}
+
+func newRemoteCli(apiClient *client.Client, out io.Writer) *remoteCli {
+	remote := &remoteCli{client: apiClient, out: out}
+	if hostname, err := os.Hostname(); err == nil {
+		remote.thisInstanceKey = &inst.InstanceKey{Hostname: hostname, Port: int(config.Config.DefaultInstancePort)}
+	}
+	return remote
+}
+
+// RemoteCliWrapper is the remote mode counterpart of CliWrapper: it runs given command, for each of
+// given instances, via the API of the orchestrator servers listed by RemoteAPI. The backend database
+// is not accessed.
+func RemoteCliWrapper(command string, instances string, destination string, owner string, reason string, duration string, pattern string, clusterAlias string) {
+	apiClient, err := newRemoteAPIClient()
+	if err != nil {
+		log.Fatale(err)
+	}
+	remote := newRemoteCli(apiClient, os.Stdout)
+
+	if len(owner) == 0 {
+		// get os username as owner
+		usr, err := user.Current()
+		if err != nil {
+			log.Fatale(err)
+		}
+		owner = usr.Username
+	}
+	args := remoteCliArguments{
+		destination:  destination,
+		owner:        owner,
+		reason:       reason,
+		duration:     duration,
+		pattern:      pattern,
+		clusterAlias: clusterAlias,
+	}
+	if config.RuntimeCLIFlags.Tag != nil {
+		args.tag = *config.RuntimeCLIFlags.Tag
+	}
+	if config.RuntimeCLIFlags.ServiceAccount != nil {
+		args.serviceAccount = *config.RuntimeCLIFlags.ServiceAccount
+	}
+	if config.RuntimeCLIFlags.TokenScope != nil {
+		args.tokenScope = *config.RuntimeCLIFlags.TokenScope
+	}
+	if config.RuntimeCLIFlags.TokenId != nil {
+		args.tokenId = *config.RuntimeCLIFlags.TokenId
+	}
+	r := regexp.MustCompile(`[ ,\r\n\t]+`)
+	tokens := r.Split(instances, -1)
+	for _, instance := range tokens {
+		if instance != "" || len(tokens) == 1 {
+			args.instance = instance
+			if err := remote.run(command, args); err != nil {
+				log.Fatale(err)
+			}
+		}
+	}
+}
+
+// instanceKey is the key given by -i, or else this machine's
+func (this *remoteCli) instanceKey(instance string) (*inst.InstanceKey, error) {
+	if instance == "" {
+		if this.thisInstanceKey == nil {
+			return nil, fmt.Errorf("Cannot figure instance key")
+		}
+		return this.thisInstanceKey, nil
+	}
+	return inst.ParseRawInstanceKey(instance)
+}
+
+// destinationKey is the key given by -d, defaulting to DefaultInstancePort
+func (this *remoteCli) destinationKey(destination string) (*inst.InstanceKey, error) {
+	if destination == "" {
+		return nil, fmt.Errorf("Cannot deduce destination: %s", destination)
+	}
+	return inst.ParseRawInstanceKey(destination)
+}
+
+// clusterHint is the cluster given by --alias, or else the cluster of -i, or else of this machine.
+// The server makes out the cluster's name.
+func (this *remoteCli) clusterHint(args remoteCliArguments) string {
+	if args.clusterAlias != "" {
+		return args.clusterAlias
+	}
+	if args.instance != "" {
+		return args.instance
+	}
+	if this.thisInstanceKey != nil {
+		return this.thisInstanceKey.StringCode()
+	}
+	return ""
+}
+
+// durationOf parses a --duration value, as does the local CLI
+func durationOf(duration string) (time.Duration, error) {
+	if duration == "" {
+		return 0, nil
+	}
+	durationSeconds, err := util.SimpleTimeToSeconds(duration)
+	if err != nil {
+		return 0, err
+	}
+	if durationSeconds < 0 {
+		return 0, fmt.Errorf("Duration value must be non-negative. Given value: %d", durationSeconds)
+	}
+	return time.Duration(durationSeconds) * time.Second, nil
+}
+
+// isConflict checks whether given error is an API conflict, i.e. an operation which was not attempted
+func isConflict(err error) bool {
+	apiError, ok := err.(*client.Error)
+	return ok && apiError.StatusCode == http.StatusConflict
+}
+
+func (this *remoteCli) println(a ...interface{}) {
+	fmt.Fprintln(this.out, a...)
+}
+
+// run runs a single command, writing its output
+func (this *remoteCli) run(command string, args remoteCliArguments) error {
+	if synonym, ok := commandSynonyms[command]; ok {
+		command = synonym
+	}
+	switch command {
+	// smart mode
+	case "relocate", "relocate-below":
+		{
+			instanceKey, err := this.instanceKey(args.instance)
+			if err != nil {
+				return err
+			}
+			destinationKey, err := this.destinationKey(args.destination)
+			if err != nil {
+				return err
+			}
+			instance, err := this.client.Relocate(instanceKey, destinationKey)
+			if err != nil {
+				return err
+			}
+			this.println(fmt.Sprintf("%s<%s", instance.Key.DisplayString(), destinationKey.DisplayString()))
+		}
+	case "relocate-replicas":
+		{
+			instanceKey, err := this.instanceKey(args.instance)
+			if err != nil {
+				return err
+			}
+			destinationKey, err := this.destinationKey(args.destination)
+			if err != nil {
+				return err
+			}
+			response, err := this.client.RelocateReplicas(instanceKey, destinationKey, args.pattern)
+			if err != nil {
+				return err
+			}
+			for _, e := range response.Errors {
+				log.Errorf("%s", e)
+			}
+			for _, replica := range response.Replicas {
+				this.println(replica.Key.DisplayString())
+			}
+		}
+		// Classic file:pos relocation
+	case "move-up":
+		{
+			instanceKey, err := this.instanceKey(args.instance)
+			if err != nil {
+				return err
+			}
+			instance, err := this.client.MoveUp(instanceKey)
+			if err != nil {
+				return err
+			}
+			this.println(fmt.Sprintf("%s<%s", instance.Key.DisplayString(), instance.MasterKey.DisplayString()))
+		}
+	case "move-below":
+		{
+			instanceKey, err := this.instanceKey(args.instance)
+			if err != nil {
+				return err
+			}
+			destinationKey, err := this.destinationKey(args.destination)
+			if err != nil {
+				return err
+			}
+			instance, err := this.client.MoveBelow(instanceKey, destinationKey)
+			if err != nil {
+				return err
+			}
+			this.println(fmt.Sprintf("%s<%s", instance.Key.DisplayString(), destinationKey.DisplayString()))
+		}
+		// Replication, general
+	case "start-slave", "stop-slave", "set-read-only", "set-writeable":
+		{
+			instanceKey, err := this.instanceKey(args.instance)
+			if err != nil {
+				return err
+			}
+			var instance *inst.Instance
+			switch command {
+			case "start-slave":
+				instance, err = this.client.StartReplica(instanceKey)
+			case "stop-slave":
+				instance, err = this.client.StopReplica(instanceKey)
+			default:
+				instance, err = this.client.SetReadOnly(instanceKey, command == "set-read-only")
+			}
+			if err != nil {
+				return err
+			}
+			this.println(instance.Key.DisplayString())
+		}
+		// Information
+	case "clusters":
+		{
+			clusters, err := this.client.Clusters()
+			if err != nil {
+				return err
+			}
+			clusterNames := []string{}
+			for _, cluster := range clusters {
+				clusterNames = append(clusterNames, cluster.ClusterName)
+			}
+			this.println(strings.Join(clusterNames, "\n"))
+		}
+	case "which-cluster":
+		{
+			clusterInfo, err := this.client.Cluster(this.clusterHint(args))
+			if err != nil && !client.IsNotFound(err) {
+				return err
+			}
+			clusterName := ""
+			if clusterInfo != nil {
+				clusterName = clusterInfo.ClusterName
+			}
+			this.println(clusterName)
+		}
+	case "which-cluster-instances":
+		{
+			instances, err := this.client.ClusterInstances(this.clusterHint(args))
+			if err != nil {
+				return err
+			}
+			for _, clusterInstance := range instances {
+				this.println(clusterInstance.Key.DisplayString())
+			}
+		}
+	case "which-master":
+		{
+			instanceKey, err := this.instanceKey(args.instance)
+			if err != nil {
+				return err
+			}
+			instance, err := this.client.Instance(instanceKey)
+			if err != nil {
+				return err
+			}
+			if instance.MasterKey.IsValid() {
+				this.println(instance.MasterKey.DisplayString())
+			}
+		}
+	case "which-downtimed-instances":
+		{
+			clusterName := ""
+			if args.clusterAlias != "" || args.instance != "" {
+				clusterInfo, err := this.client.Cluster(this.clusterHint(args))
+				if err != nil && !client.IsNotFound(err) {
+					return err
+				}
+				if clusterInfo != nil {
+					clusterName = clusterInfo.ClusterName
+				}
+			}
+			instances, err := this.client.Downtimed()
+			if err != nil {
+				return err
+			}
+			for _, downtimedInstance := range instances {
+				if clusterName == "" || downtimedInstance.ClusterName == clusterName {
+					this.println(downtimedInstance.Key.DisplayString())
+				}
+			}
+		}
+	case "which-replicas":
+		{
+			instanceKey, err := this.instanceKey(args.instance)
+			if err != nil {
+				return err
+			}
+			replicas, err := this.client.Replicas(instanceKey)
+			if err != nil {
+				return err
+			}
+			for _, replica := range replicas {
+				this.println(replica.Key.DisplayString())
+			}
+		}
+	case "instance-status":
+		{
+			instanceKey, err := this.instanceKey(args.instance)
+			if err != nil {
+				return err
+			}
+			instance, err := this.client.Instance(instanceKey)
+			if err != nil {
+				return err
+			}
+			this.println(instance.HumanReadableDescription())
+		}
+		// Tags
+	case "tags":
+		{
+			instanceKey, err := this.instanceKey(args.instance)
+			if err != nil {
+				return err
+			}
+			tags, err := this.client.Tags(instanceKey)
+			if err != nil {
+				return err
+			}
+			for _, tag := range tags {
+				this.println(tag)
+			}
+		}
+	case "tag":
+		{
+			instanceKey, err := this.instanceKey(args.instance)
+			if err != nil {
+				return err
+			}
+			tag, err := inst.ParseTag(args.tag)
+			if err != nil {
+				return err
+			}
+			if _, err := this.client.Tag(instanceKey, tag.TagName, tag.TagValue); err != nil {
+				return err
+			}
+			this.println(instanceKey.DisplayString())
+		}
+	case "untag":
+		{
+			instanceKey, err := this.instanceKey(args.instance)
+			if err != nil {
+				return err
+			}
+			tag, err := inst.ParseTag(args.tag)
+			if err != nil {
+				return err
+			}
+			if tag.HasValue {
+				// The API removes tags by name; only do so if the value matches, as does the local CLI
+				tags, err := this.client.Tags(instanceKey)
+				if err != nil {
+					return err
+				}
+				tagged := false
+				for _, instanceTag := range tags {
+					tagged = tagged || instanceTag == tag.String()
+				}
+				if !tagged {
+					return nil
+				}
+			}
+			err = this.client.Untag(instanceKey, tag.TagName)
+			if client.IsNotFound(err) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			this.println(instanceKey.DisplayString())
+		}
+		// Instance management
+	case "discover":
+		{
+			instanceKey, err := this.instanceKey(args.instance)
+			if err != nil {
+				return err
+			}
+			instance, err := this.client.Discover(instanceKey)
+			if err != nil {
+				return err
+			}
+			this.println(instance.Key.DisplayString())
+		}
+	case "forget":
+		{
+			if args.instance == "" {
+				return fmt.Errorf("Cannot deduce instance: %s", args.instance)
+			}
+			instanceKey, err := this.instanceKey(args.instance)
+			if err != nil {
+				return err
+			}
+			if err := this.client.Forget(instanceKey); err != nil {
+				return err
+			}
+			this.println(instanceKey.DisplayString())
+		}
+	case "begin-maintenance", "begin-downtime":
+		{
+			instanceKey, err := this.instanceKey(args.instance)
+			if err != nil {
+				return err
+			}
+			if args.reason == "" {
+				return fmt.Errorf("--reason option required")
+			}
+			duration, err := durationOf(args.duration)
+			if err != nil {
+				return err
+			}
+			if command == "begin-maintenance" {
+				maintenanceKey, err := this.client.BeginMaintenance(instanceKey, args.owner, args.reason, duration)
+				if err != nil {
+					return err
+				}
+				log.Infof("Maintenance key: %+v", maintenanceKey)
+			} else {
+				if _, err := this.client.BeginDowntime(instanceKey, args.owner, args.reason, duration); err != nil {
+					return err
+				}
+			}
+			this.println(instanceKey.DisplayString())
+		}
+	case "end-maintenance", "end-downtime":
+		{
+			instanceKey, err := this.instanceKey(args.instance)
+			if err != nil {
+				return err
+			}
+			if command == "end-maintenance" {
+				err = this.client.EndMaintenance(instanceKey)
+			} else {
+				err = this.client.EndDowntime(instanceKey)
+			}
+			if err != nil {
+				return err
+			}
+			this.println(instanceKey.DisplayString())
+		}
+		// Recovery & analysis
+	case "recover", "recover-lite":
+		{
+			instanceKey, err := this.instanceKey(args.instance)
+			if err != nil {
+				return err
+			}
+			var candidateKey *inst.InstanceKey
+			if args.destination != "" {
+				if candidateKey, err = this.destinationKey(args.destination); err != nil {
+					return err
+				}
+			}
+			promotedInstanceKey, err := this.client.Recover(instanceKey, candidateKey, command == "recover-lite")
+			if isConflict(err) {
+				// Recovery not attempted
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			this.println(promotedInstanceKey.DisplayString())
+		}
+	case "force-master-failover":
+		{
+			topologyRecovery, err := this.client.ForceMasterFailover(this.clusterHint(args))
+			if err != nil {
+				return err
+			}
+			this.println(topologyRecovery.SuccessorKey.DisplayString())
+		}
+	case "graceful-master-takeover":
+		{
+			var designatedKey *inst.InstanceKey
+			if args.destination != "" {
+				var err error
+				if designatedKey, err = this.destinationKey(args.destination); err != nil {
+					return err
+				}
+			}
+			topologyRecovery, promotedMasterCoordinates, err := this.client.GracefulMasterTakeover(this.clusterHint(args), designatedKey)
+			if err != nil {
+				return err
+			}
+			this.println(topologyRecovery.SuccessorKey.DisplayString())
+			if promotedMasterCoordinates != nil {
+				this.println(*promotedMasterCoordinates)
+			}
+		}
+	case "replication-analysis":
+		{
+			analysis, err := this.client.ReplicationAnalysis("")
+			if err != nil {
+				return err
+			}
+			for _, entry := range analysis {
+				if entry.SkippableDueToDowntime {
+					// The API includes downtimed instances; the local CLI does not
+					continue
+				}
+				this.println(fmt.Sprintf("%s (cluster %s): %s", entry.AnalyzedInstanceKey.DisplayString(), entry.ClusterDetails.ClusterName, entry.AnalysisString()))
+			}
+		}
+	case "disable-global-recoveries":
+		{
+			if err := this.client.SetGlobalRecoveries(false); err != nil {
+				return fmt.Errorf("ERROR: Failed to disable recoveries globally: %v", err)
+			}
+			this.println("OK: Orchestrator recoveries DISABLED globally")
+		}
+	case "enable-global-recoveries":
+		{
+			if err := this.client.SetGlobalRecoveries(true); err != nil {
+				return fmt.Errorf("ERROR: Failed to enable recoveries globally: %v", err)
+			}
+			this.println("OK: Orchestrator recoveries ENABLED globally")
+		}
+	case "check-global-recoveries":
+		{
+			enabled, err := this.client.GlobalRecoveriesEnabled()
+			if err != nil {
+				return fmt.Errorf("ERROR: Failed to determine if recoveries are disabled globally: %v", err)
+			}
+			fmt.Fprintf(this.out, "OK: Global recoveries disabled: %v\n", !enabled)
+		}
+	case "create-api-token":
+		{
+			if args.serviceAccount == "" {
+				return fmt.Errorf("--service-account option required")
+			}
+			duration, err := durationOf(args.duration)
+			if err != nil {
+				return err
+			}
+			response, err := this.client.CreateAPIToken(args.serviceAccount, args.tokenScope, args.clusterAlias, duration)
+			if err != nil {
+				return err
+			}
+			this.println(response.Token)
+		}
+	case "revoke-api-token":
+		{
+			if args.tokenId == "" {
+				return fmt.Errorf("--token-id option required")
+			}
+			if err := this.client.RevokeAPIToken(args.tokenId); err != nil {
+				return err
+			}
+			this.println(args.tokenId)
+		}
+	case "api-tokens":
+		{
+			apiTokens, err := this.client.APITokens()
+			if err != nil {
+				return err
+			}
+			for _, apiToken := range apiTokens {
+				this.println(strings.Join([]string{apiToken.TokenId, apiToken.Name, apiToken.Scope, apiToken.ClusterName, apiToken.CreatedAtString, apiToken.ExpiresAtString, apiToken.CreatedBy}, "\t"))
+			}
+		}
+	default:
+		return fmt.Errorf("%s: not supported in remote mode", command)
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/go-martini/martini"
+	"github.com/martini-contrib/auth"
+	"github.com/martini-contrib/render"
+
+	"github.com/github/orchestrator/go/client"
+	"github.com/github/orchestrator/go/config"
+	orchttp "github.com/github/orchestrator/go/http"
+	"github.com/github/orchestrator/go/inst"
+	"github.com/github/orchestrator/go/logic"
+	"github.com/github/orchestrator/go/simulation"
+	test "github.com/openark/golib/tests"
+)
+
+// newRemoteCliTest creates a remote CLI served by a mock API, answering "METHOD path" requests by given responses
+func newRemoteCliTest(t *testing.T, responses map[string]interface{}) (remote *remoteCli, out *bytes.Buffer, served *[]string, closeFunc func()) {
+	served = &[]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := r.Method + " " + r.URL.Path
+		*served = append(*served, request)
+		response, ok := responses[request]
+		switch {
+		case !ok:
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(orchttp.APIError{Code: "not_found", Message: request})
+		case response == nil:
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			if status, ok := response.(int); ok {
+				w.WriteHeader(status)
+				json.NewEncoder(w).Encode(orchttp.APIError{Code: http.StatusText(status), Message: request})
+				return
+			}
+			json.NewEncoder(w).Encode(response)
+		}
+	}))
+	apiClient, err := client.NewClient(client.Config{Endpoints: []string{server.URL}})
+	test.S(t).ExpectNil(err)
+	out = &bytes.Buffer{}
+	return newRemoteCli(apiClient, out), out, served, server.Close
+}
+
+func TestRemoteCliRelocate(t *testing.T) {
+	instance := inst.NewInstance()
+	instance.Key = inst.InstanceKey{Hostname: "db-2", Port: 3306}
+	remote, out, served, closeFunc := newRemoteCliTest(t, map[string]interface{}{
+		"POST /api/v2/instances/db-2/3306/relocate": instance,
+	})
+	defer closeFunc()
+
+	err := remote.run("relocate", remoteCliArguments{instance: "db-2", destination: "db-1:3306"})
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(out.String(), "db-2:3306<db-1:3306\n")
+	test.S(t).ExpectEquals(len(*served), 1)
+
+	err = remote.run("relocate", remoteCliArguments{instance: "db-2"})
+	test.S(t).ExpectNotNil(err)
+}
+
+func TestRemoteCliRecover(t *testing.T) {
+	remote, out, _, closeFunc := newRemoteCliTest(t, map[string]interface{}{
+		"POST /api/v2/instances/db-1/3306/recover":                 orchttp.RecoverResponse{SuccessorKey: inst.InstanceKey{Hostname: "db-2", Port: 3306}},
+		"POST /api/v2/instances/db-3/3306/recover":                 http.StatusConflict,
+		"POST /api/v2/clusters/db-1:3306/graceful-master-takeover": orchttp.GracefulMasterTakeoverResponse{Recovery: &logic.TopologyRecovery{SuccessorKey: &inst.InstanceKey{Hostname: "db-2", Port: 3306}}, PromotedMasterCoordinates: &inst.BinlogCoordinates{LogFile: "mysql-bin.000002", LogPos: 4}},
+	})
+	defer closeFunc()
+
+	test.S(t).ExpectNil(remote.run("recover", remoteCliArguments{instance: "db-1"}))
+	// Not attempted: no output
+	test.S(t).ExpectNil(remote.run("recover", remoteCliArguments{instance: "db-3"}))
+	test.S(t).ExpectNil(remote.run("graceful-master-takeover", remoteCliArguments{instance: "db-1:3306"}))
+	test.S(t).ExpectEquals(out.String(), "db-2:3306\ndb-2:3306\nmysql-bin.000002:4\n")
+}
+
+func TestRemoteCliUntag(t *testing.T) {
+	remote, out, served, closeFunc := newRemoteCliTest(t, map[string]interface{}{
+		"GET /api/v2/instances/db-1/3306/tags":           []string{"role=backup"},
+		"DELETE /api/v2/instances/db-1/3306/tags/role":   nil,
+		"DELETE /api/v2/instances/db-2/3306/tags/region": http.StatusNotFound,
+	})
+	defer closeFunc()
+
+	// Value differs: not untagged
+	test.S(t).ExpectNil(remote.run("untag", remoteCliArguments{instance: "db-1", tag: "role=analytics"}))
+	test.S(t).ExpectEquals(strings.Join(*served, ","), "GET /api/v2/instances/db-1/3306/tags")
+	test.S(t).ExpectNil(remote.run("untag", remoteCliArguments{instance: "db-1", tag: "role=backup"}))
+	// Not tagged: no output
+	test.S(t).ExpectNil(remote.run("untag", remoteCliArguments{instance: "db-2", tag: "region"}))
+	test.S(t).ExpectEquals(out.String(), "db-1:3306\n")
+}
+
+func TestRemoteCliUnsupported(t *testing.T) {
+	remote, out, served, closeFunc := newRemoteCliTest(t, map[string]interface{}{
+		"GET /api/v2/global-recoveries": orchttp.GlobalRecoveries{Enabled: true},
+	})
+	defer closeFunc()
+
+	err := remote.run("ack-all-recoveries", remoteCliArguments{reason: "done"})
+	test.S(t).ExpectNotNil(err)
+	test.S(t).ExpectTrue(strings.Contains(err.Error(), "not supported in remote mode"))
+	err = remote.run("begin-downtime", remoteCliArguments{instance: "db-1"})
+	test.S(t).ExpectNotNil(err)
+	test.S(t).ExpectEquals(len(*served), 0)
+
+	test.S(t).ExpectNil(remote.run("check-global-recoveries", remoteCliArguments{}))
+	test.S(t).ExpectEquals(out.String(), "OK: Global recoveries disabled: false\n")
+}
+
+func TestRemoteCommands(t *testing.T) {
+	remote, _, _, closeFunc := newRemoteCliTest(t, map[string]interface{}{})
+	defer closeFunc()
+
+	// Listed commands are all handled, if failing against an empty API
+	for _, command := range remoteCommands {
+		err := remote.run(command, remoteCliArguments{instance: "db-1", destination: "db-2"})
+		test.S(t).ExpectTrue(err == nil || !strings.Contains(err.Error(), "not supported in remote mode"))
+	}
+}
+
+// captureStdout returns what given function writes to standard output
+func captureStdout(t *testing.T, f func()) string {
+	reader, writer, err := os.Pipe()
+	test.S(t).ExpectNil(err)
+	stdout := os.Stdout
+	os.Stdout = writer
+	f()
+	os.Stdout = stdout
+	writer.Close()
+	captured, err := ioutil.ReadAll(reader)
+	test.S(t).ExpectNil(err)
+	return string(captured)
+}
+
+func TestRemoteCliRelocateMatchesLocal(t *testing.T) {
+	relocate := func(remoteMode bool) string {
+		scenario := simulation.NewScenario(t)
+		defer scenario.Close()
+		defer func(skip bool) { *config.RuntimeCLIFlags.SkipContinuousRegistration = skip }(*config.RuntimeCLIFlags.SkipContinuousRegistration)
+		*config.RuntimeCLIFlags.SkipContinuousRegistration = true
+
+		scenario.Build(`
+			db-1
+			  db-2
+			  db-3
+		`)
+		scenario.Discover()
+		output := ""
+		if remoteMode {
+			router := martini.NewRouter()
+			m := &martini.ClassicMartini{Martini: martini.New(), Router: router}
+			m.Use(func(c martini.Context) {
+				c.Map(auth.User(""))
+			})
+			m.Use(render.Renderer())
+			m.Action(router.Handle)
+			orchttp.API.RegisterRequests(m)
+			server := httptest.NewServer(m)
+			defer server.Close()
+
+			apiClient, err := client.NewClient(client.Config{Endpoints: []string{server.URL}})
+			test.S(t).ExpectNil(err)
+			out := &bytes.Buffer{}
+			test.S(t).ExpectNil(newRemoteCli(apiClient, out).run("relocate", remoteCliArguments{instance: "db-3:3306", destination: "db-2:3306"}))
+			output = out.String()
+		} else {
+			output = captureStdout(t, func() {
+				Cli("relocate", false, "db-3:3306", "db-2:3306", "orc", "", "", "", "", "", "")
+			})
+		}
+		scenario.ExpectReplicating("db-3", "db-2")
+		return output
+	}
+	localOutput := relocate(false)
+	test.S(t).ExpectEquals(localOutput, "db-3:3306<db-2:3306\n")
+	test.S(t).ExpectEquals(relocate(true), localOutput)
+}
+
+func TestIsRemoteCommand(t *testing.T) {
+	test.S(t).ExpectFalse(isRemoteCommand("relocate"))
+	defer func() { config.Config.RemoteAPI = []string{} }()
+	config.Config.RemoteAPI = []string{"http://orchestrator:3000"}
+	test.S(t).ExpectTrue(isRemoteCommand("relocate"))
+	test.S(t).ExpectFalse(isRemoteCommand("dump-config"))
+}
+
+func TestRemoteCliAPITokens(t *testing.T) {
+	remote, out, served, closeFunc := newRemoteCliTest(t, map[string]interface{}{
+		"POST /api/v2/api-tokens":            orchttp.CreateAPITokenResponse{Token: "0123abcd.secret"},
+		"DELETE /api/v2/api-tokens/0123abcd": nil,
+		"DELETE /api/v2/api-tokens/deadbeef": http.StatusNotFound,
+	})
+	defer closeFunc()
+
+	test.S(t).ExpectNotNil(remote.run("create-api-token", remoteCliArguments{tokenScope: "write"}))
+	test.S(t).ExpectNil(remote.run("create-api-token", remoteCliArguments{serviceAccount: "deploy-bot", tokenScope: "write", duration: "90d"}))
+	test.S(t).ExpectNil(remote.run("revoke-api-token", remoteCliArguments{tokenId: "0123abcd"}))
+	test.S(t).ExpectNotNil(remote.run("revoke-api-token", remoteCliArguments{tokenId: "deadbeef"}))
+	test.S(t).ExpectEquals(out.String(), "0123abcd.secret\n0123abcd\n")
+	test.S(t).ExpectEquals(len(*served), 3)
+}
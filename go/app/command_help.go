@@ -264,6 +264,30 @@ func init() {
 
   --debug is your friend.
 	`
+	CommandHelp["plan-topology"] = `
+  Show the ordered list of operations (move-up, move-below, relocate) that would reshape a cluster into a
+  desired topology. The desired topology lists replicas and the masters they should replicate from; replicas
+  not listed remain below their current masters. The cluster master cannot be changed this way.
+  Nothing is executed. Examples:
+
+  orchestrator -c plan-topology -alias mycluster --desired-topology "replica1:3306>replica2:3306,replica3:3306>master:3306"
+
+  orchestrator -c plan-topology -i instance.in.cluster --desired-topology @/path/to/desired-topology.json
+      where file content is e.g. {"replica1:3306": "replica2:3306"}
+	`
+	CommandHelp["apply-topology"] = `
+  Compute and execute the plan that reshapes a cluster into a desired topology (see plan-topology). Each step is
+  checkpointed in the backend database. Execution stops on the first failing step; the plan may then be
+  resumed via resume-topology-plan. Example:
+
+  orchestrator -c apply-topology -alias mycluster --desired-topology "replica1:3306>replica2:3306"
+	`
+	CommandHelp["resume-topology-plan"] = `
+  Resume the latest unfinished topology plan of a cluster (see apply-topology). Steps which completed are not
+  repeated; steps whose instance is already in place are skipped. Example:
+
+  orchestrator -c resume-topology-plan -alias mycluster
+	`
 
 	CommandHelp["enable-gtid"] = `
   If possible, enable GTID replication. This works on Oracle (>= 5.6, gtid-mode=1) and MariaDB (>= 10.0).
@@ -417,6 +441,27 @@ func init() {
 
       Prints out correlated coordinates, e.g.: "mysql-bin.002302:14220", or errors out.
 	`
+	CommandHelp["binlog-events"] = `
+  List binary log events of a given instance, starting at given coordinates (--binlog=file:pos) and up to the end of
+  that binary log. Output is tab delimited: coordinates, end log pos, event type, info.
+  Events may be filtered by:
+  --event-type: event type, e.g. Query, Gtid, Table_map, Write_rows
+  --gtid: only list events of the transaction identified by given GTID
+  --pattern: regular expression matched against event info
+  Examples:
+
+  orchestrator -c binlog-events -i instance.with.binary.logs.com --binlog=mysql-bin.002366:4
+
+  orchestrator -c binlog-events -i instance.with.binary.logs.com --binlog=mysql-bin.002366:4 --event-type=Query --pattern="drop table"
+
+  orchestrator -c binlog-events -i instance.with.binary.logs.com --binlog=mysql-bin.002366:4 --gtid=00020192-1111-1111-1111-111111111111:830
+	`
+	CommandHelp["relaylog-events"] = `
+  List relay log events of a given instance, starting at given coordinates (--binlog=file:pos) and up to the end of
+  that relay log. Filtering and output are as with binlog-events. Example:
+
+  orchestrator -c relaylog-events -i replica.com --binlog=mysql-relay.000012:4 --event-type=Query
+	`
 
 	CommandHelp["submit-pool-instances"] = `
   Submit a pool name with a list of instances in that pool. This removes any previous instances associated with
@@ -516,6 +561,14 @@ func init() {
 
   orchestrator -c which-cluster-instances -alias some_alias
       assuming some_alias is a known cluster alias (see ClusterNameToAlias or DetectClusterAliasQuery configuration)
+	`
+	CommandHelp["cluster-config"] = `
+  Output the per cluster overridable settings in effect for a cluster (see ClusterConfigOverrides), one per line:
+  setting name, JSON value, and source: "global", or the override setting the value. Examples:
+
+  orchestrator -c cluster-config -alias some_alias
+
+  orchestrator -c cluster-config -i instance.of.some.cluster
 	`
 	CommandHelp["which-cluster-domain"] = `
   Output the domain name of given cluster, indicated by instance or alias. This depends on
@@ -652,6 +705,26 @@ func init() {
   orchestrator -c forget -i instance.to.forget.com
 
   Orchestrator will *not* resolve CNAMEs and VIPs for given instance.
+	`
+	CommandHelp["garbage-report"] = `
+  List what orchestrator's repository may be cleaned of, for review prior to forget-garbage:
+  - instances not seen for given --duration (default: 24h)
+  - clusters with no valid master: no master is known, or the known master's last check is invalid
+  - downtime, candidate, tag and pool rows referencing forgotten instances, or instances not seen for --duration
+  Example:
+
+  orchestrator -c garbage-report --duration=7d
+
+  Output is tab delimited, one line per finding.
+	`
+	CommandHelp["forget-garbage"] = `
+  Forget instances not seen for given --duration (default: 24h), and remove downtime, candidate, tag and
+  pool rows referencing forgotten instances, as listed by garbage-report. Ghost clusters are not forgotten;
+  use the forget-cluster API for these. Each removal is audited. Example:
+
+  orchestrator -c forget-garbage --duration=7d
+
+  Outputs the number of forgotten instances and removed orphaned rows.
 	`
 	CommandHelp["begin-maintenance"] = `
   Request a maintenance lock on an instance. Topology changes require placing locks on the minimal set of
@@ -853,6 +926,26 @@ func init() {
 	orchestrator -c set-heuristic-domain-instance -i instance.of.some.cluster
 			Cluster is inferred by a member instance (the instance is not necessarily the master)
 	`
+	CommandHelp["link-cluster"] = `
+	Marks given replica as the boundary between the cluster it replicates from (upstream) and a downstream cluster,
+	of which the replica becomes the master. The downstream cluster is analyzed and recovered separately from the
+	upstream cluster; upstream master failovers re-point the boundary below the promoted master, and downstream
+	master failovers have the promoted replica take over the link. Example:
+
+	orchestrator -c link-cluster -i boundary.replica.com --alias downstream_alias
+	`
+	CommandHelp["unlink-cluster"] = `
+	Removes the cluster link whose boundary is given instance. The boundary and its replicas rejoin the upstream
+	cluster upon next poll. Example:
+
+	orchestrator -c unlink-cluster -i boundary.replica.com
+	`
+	CommandHelp["cluster-links"] = `
+	Lists cluster links: the downstream cluster masters, the downstream cluster aliases, and the upstream cluster names.
+	Example:
+
+	orchestrator -c cluster-links
+	`
 
 	CommandHelp["continuous"] = `
   Enter continuous mode, and actively poll for instances, diagnose problems, do maintenance etc.
@@ -883,6 +976,32 @@ func init() {
   Clear the hostname resolve cache; it will be refilled by following host discoveries
 
   orchestrator -c reset-hostname-resolve-cache
+	`
+	CommandHelp["create-api-token"] = `
+  Create an API token for a service account, and print it out. The token authenticates HTTP requests via an
+  "Authorization: Bearer <token>" header, with the service account as the authenticated user. This is the
+  only time the token is shown; orchestrator only keeps a hash of it. Flags:
+  --service-account: required, the service account name
+  --scope: "read" (the default) or "write"
+  --alias: optional; a write token may then only change the given cluster
+  --duration: optional expiry, e.g. "90d"; by default the token does not expire
+  Examples:
+
+  orchestrator -c create-api-token --service-account deploy-bot
+
+  orchestrator -c create-api-token --service-account failover-bot --scope write --alias mycluster --duration 90d
+	`
+	CommandHelp["revoke-api-token"] = `
+  Revoke an API token, given by its id (the token's prefix, up to the "."). Requests bearing the token are
+  no longer authenticated. Example:
+
+  orchestrator -c revoke-api-token --token-id 5d1e8e0a2c3f4b69
+	`
+	CommandHelp["api-tokens"] = `
+  List API tokens, expired ones included, tab separated: id, service account, scope, cluster, creation time,
+  expiry time (empty if none) and creator. Tokens themselves are not shown. Example:
+
+  orchestrator -c api-tokens
 	`
 	CommandHelp["resolve"] = `
   Utility command to resolve a CNAME and return resolved hostname name. Example:
@@ -895,6 +1014,25 @@ func init() {
 	this command, and it is provided mostly for building and testing purposes. Nonetheless it is safe to
 	use and at most it wastes some cycles.
 	`
+	CommandHelp["dump-config"] = `
+  Print out the effective configuration: configuration files merged, with ORCHESTRATOR_* environment
+  variables applied. Passwords, secrets and tokens are redacted. Example:
+
+  orchestrator -c dump-config --config /etc/orchestrator.conf.yaml
+	`
+	CommandHelp["validate-config"] = `
+  Validate configuration files without reading them into effect: the file given by --config, or else
+  the default configuration files which exist. All issues are reported, rather than the first: unknown
+  keys (with suggestions), deprecated keys, type errors, settings rejected when reading configuration,
+  regular expressions which do not compile, unknown recovery hook placeholders and raft setups which
+  cannot keep quorum. Output is a JSON list, one entry per file, with FileName, Valid and Issues; each
+  issue has Severity ("error" or "warning"), Key and Message. Exit code is 1 when errors are found, or
+  with --strict, when warnings are found. Examples:
+
+  orchestrator -c validate-config --config /etc/orchestrator.conf.json
+
+  orchestrator -c validate-config --config /etc/orchestrator.conf.json --strict
+	`
 
 	for key := range CommandHelp {
 		CommandHelp[key] = strings.Trim(CommandHelp[key], "\n")
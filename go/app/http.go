@@ -82,7 +82,7 @@ func standardHttp(continuousDiscovery bool) {
 				// Still allowed; may be disallowed in future versions
 				log.Warning("AuthenticationMethod is configured as 'basic' but HTTPAuthUser undefined. Running without authentication.")
 			}
-			m.Use(auth.Basic(config.Config.HTTPAuthUser, config.Config.HTTPAuthPassword))
+			m.Use(http.AuthenticateAPIToken(auth.Basic(config.Config.HTTPAuthUser, config.Config.HTTPAuthPassword)))
 		}
 	case "multi":
 		{
@@ -91,21 +91,34 @@ func standardHttp(continuousDiscovery bool) {
 				log.Fatal("AuthenticationMethod is configured as 'multi' but HTTPAuthUser undefined")
 			}
 
-			m.Use(auth.BasicFunc(func(username, password string) bool {
+			m.Use(http.AuthenticateAPIToken(auth.BasicFunc(func(username, password string) bool {
 				if username == "readonly" {
 					// Will be treated as "read-only"
 					return true
 				}
 				return auth.SecureCompare(username, config.Config.HTTPAuthUser) && auth.SecureCompare(password, config.Config.HTTPAuthPassword)
-			}))
+			})))
+		}
+	case "oidc":
+		{
+			http.OIDC.URLPrefix = config.Config.URLPrefix
+			m.Use(http.AuthenticateAPIToken(http.OIDC.Authenticate))
 		}
 	default:
 		{
 			// We inject a dummy User object because we have function signatures with User argument in api.go
-			m.Map(auth.User(""))
+			m.Use(http.AuthenticateAPIToken(func(c martini.Context) {
+				c.Map(auth.User(""))
+			}))
 		}
 	}
 
+	// Event streams are flushed as events occur, and must not be buffered by compression
+	m.Use(func(req *nethttp.Request) {
+		if http.IsEventStreamRequest(req) {
+			req.Header.Del("Accept-Encoding")
+		}
+	})
 	m.Use(gzip.All())
 	// Render html templates from templates directory
 	m.Use(render.Renderer(render.Options{
@@ -134,6 +147,9 @@ func standardHttp(continuousDiscovery bool) {
 	http.Web.URLPrefix = config.Config.URLPrefix
 	http.API.RegisterRequests(m)
 	http.Web.RegisterRequests(m)
+	if strings.ToLower(config.Config.AuthenticationMethod) == "oidc" {
+		http.OIDC.RegisterRequests(m)
+	}
 
 	// Serve
 	if config.Config.ListenSocket != "" {
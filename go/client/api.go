@@ -0,0 +1,362 @@
+/*
+   Copyright 2019 GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	orchttp "github.com/github/orchestrator/go/http"
+	"github.com/github/orchestrator/go/inst"
+	"github.com/github/orchestrator/go/logic"
+	"github.com/github/orchestrator/go/process"
+)
+
+// instancePath is the API path of given instance, optionally followed by a sub-resource
+func instancePath(instanceKey *inst.InstanceKey, resource ...string) string {
+	path := fmt.Sprintf("instances/%s/%d", url.PathEscape(instanceKey.Hostname), instanceKey.Port)
+	for _, token := range resource {
+		path = fmt.Sprintf("%s/%s", path, token)
+	}
+	return path
+}
+
+// clusterPath is the API path of given cluster (name, alias, or member instance), optionally followed by a sub-resource
+func clusterPath(clusterHint string, resource ...string) string {
+	return strings.Join(append([]string{"clusters", url.PathEscape(clusterHint)}, resource...), "/")
+}
+
+// durationString formats a duration as the API expects it, in seconds; zero stands for the server's default
+func durationString(duration time.Duration) string {
+	if duration <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("%ds", int64(duration.Seconds()))
+}
+
+func instanceKeyRequest(instanceKey *inst.InstanceKey) *orchttp.InstanceKeyRequest {
+	if instanceKey == nil {
+		return nil
+	}
+	return &orchttp.InstanceKeyRequest{Hostname: instanceKey.Hostname, Port: instanceKey.Port}
+}
+
+// Topology reads
+
+// Clusters lists known clusters
+func (this *Client) Clusters() (clusters []inst.ClusterInfo, err error) {
+	err = this.get("clusters", &clusters)
+	return clusters, err
+}
+
+// Cluster reads a cluster, given its name, alias, or a member instance
+func (this *Client) Cluster(clusterHint string) (clusterInfo *inst.ClusterInfo, err error) {
+	err = this.get(clusterPath(clusterHint), &clusterInfo)
+	return clusterInfo, err
+}
+
+// ClusterInstances lists a cluster's instances
+func (this *Client) ClusterInstances(clusterHint string) (instances [](*inst.Instance), err error) {
+	err = this.get(clusterPath(clusterHint, "instances"), &instances)
+	return instances, err
+}
+
+// ClusterDashboard reads a cluster's topology tree, analysis and recoveries
+func (this *Client) ClusterDashboard(clusterHint string) (dashboard *logic.ClusterDashboard, err error) {
+	err = this.get(clusterPath(clusterHint, "dashboard"), &dashboard)
+	return dashboard, err
+}
+
+// Instance reads an instance. A not found instance is an error satisfying IsNotFound.
+func (this *Client) Instance(instanceKey *inst.InstanceKey) (instance *inst.Instance, err error) {
+	err = this.get(instancePath(instanceKey), &instance)
+	return instance, err
+}
+
+// Replicas lists an instance's replicas
+func (this *Client) Replicas(instanceKey *inst.InstanceKey) (replicas [](*inst.Instance), err error) {
+	err = this.get(instancePath(instanceKey, "replicas"), &replicas)
+	return replicas, err
+}
+
+// ReplicationAnalysis analyzes replication problems of given cluster, or of all clusters when clusterHint is empty
+func (this *Client) ReplicationAnalysis(clusterHint string) (analysis []inst.ReplicationAnalysis, err error) {
+	if clusterHint == "" {
+		err = this.get("analysis", &analysis)
+	} else {
+		err = this.get(clusterPath(clusterHint, "analysis"), &analysis)
+	}
+	return analysis, err
+}
+
+// Refactoring
+
+// Discover discovers, or re-reads, an instance
+func (this *Client) Discover(instanceKey *inst.InstanceKey) (instance *inst.Instance, err error) {
+	err = this.post(instancePath(instanceKey, "discover"), nil, &instance)
+	return instance, err
+}
+
+// Forget forgets an instance
+func (this *Client) Forget(instanceKey *inst.InstanceKey) error {
+	return this.delete(instancePath(instanceKey))
+}
+
+// Relocate relocates an instance below another, by any means available
+func (this *Client) Relocate(instanceKey *inst.InstanceKey, belowKey *inst.InstanceKey) (instance *inst.Instance, err error) {
+	if belowKey == nil {
+		return nil, fmt.Errorf("Relocate: no target instance given")
+	}
+	request := orchttp.RelocateRequest{Below: *instanceKeyRequest(belowKey)}
+	err = this.post(instancePath(instanceKey, "relocate"), request, &instance)
+	return instance, err
+}
+
+// RelocateReplicas relocates an instance's replicas, optionally only those matching pattern, below another instance
+func (this *Client) RelocateReplicas(instanceKey *inst.InstanceKey, belowKey *inst.InstanceKey, pattern string) (response *orchttp.RelocateReplicasResponse, err error) {
+	if belowKey == nil {
+		return nil, fmt.Errorf("RelocateReplicas: no target instance given")
+	}
+	request := orchttp.RelocateReplicasRequest{Below: *instanceKeyRequest(belowKey), Pattern: pattern}
+	err = this.post(instancePath(instanceKey, "relocate-replicas"), request, &response)
+	return response, err
+}
+
+// MoveUp moves an instance up, to replicate from its grandparent
+func (this *Client) MoveUp(instanceKey *inst.InstanceKey) (instance *inst.Instance, err error) {
+	err = this.post(instancePath(instanceKey, "move-up"), nil, &instance)
+	return instance, err
+}
+
+// MoveBelow moves an instance below its sibling
+func (this *Client) MoveBelow(instanceKey *inst.InstanceKey, siblingKey *inst.InstanceKey) (instance *inst.Instance, err error) {
+	if siblingKey == nil {
+		return nil, fmt.Errorf("MoveBelow: no sibling instance given")
+	}
+	request := orchttp.MoveBelowRequest{Sibling: *instanceKeyRequest(siblingKey)}
+	err = this.post(instancePath(instanceKey, "move-below"), request, &instance)
+	return instance, err
+}
+
+// StartReplica starts replication on an instance
+func (this *Client) StartReplica(instanceKey *inst.InstanceKey) (instance *inst.Instance, err error) {
+	err = this.post(instancePath(instanceKey, "start-replica"), nil, &instance)
+	return instance, err
+}
+
+// StopReplica stops replication on an instance
+func (this *Client) StopReplica(instanceKey *inst.InstanceKey) (instance *inst.Instance, err error) {
+	err = this.post(instancePath(instanceKey, "stop-replica"), nil, &instance)
+	return instance, err
+}
+
+// SetReadOnly sets an instance read-only, or writeable
+func (this *Client) SetReadOnly(instanceKey *inst.InstanceKey, readOnly bool) (instance *inst.Instance, err error) {
+	err = this.post(instancePath(instanceKey, "read-only"), orchttp.ReadOnlyRequest{ReadOnly: readOnly}, &instance)
+	return instance, err
+}
+
+// Downtime and maintenance
+
+// Downtimed lists downtimed instances
+func (this *Client) Downtimed() (instances [](*inst.Instance), err error) {
+	err = this.get("downtimes", &instances)
+	return instances, err
+}
+
+// BeginDowntime downtimes an instance, silencing its recoveries. An empty owner stands for the
+// authenticated user; a zero duration for the server's default.
+func (this *Client) BeginDowntime(instanceKey *inst.InstanceKey, owner string, reason string, duration time.Duration) (downtime *inst.Downtime, err error) {
+	request := orchttp.DowntimeRequest{Owner: owner, Reason: reason, Duration: durationString(duration)}
+	err = this.post(instancePath(instanceKey, "downtime"), request, &downtime)
+	return downtime, err
+}
+
+// EndDowntime ends an instance's downtime
+func (this *Client) EndDowntime(instanceKey *inst.InstanceKey) error {
+	return this.delete(instancePath(instanceKey, "downtime"))
+}
+
+// BeginMaintenance begins maintenance on an instance, blocking topology changes on it. An empty owner
+// stands for the authenticated user; a zero duration for the server's default. It returns the maintenance key.
+func (this *Client) BeginMaintenance(instanceKey *inst.InstanceKey, owner string, reason string, duration time.Duration) (int64, error) {
+	response := orchttp.MaintenanceResponse{}
+	request := orchttp.MaintenanceRequest{Owner: owner, Reason: reason, Duration: durationString(duration)}
+	err := this.post(instancePath(instanceKey, "maintenance"), request, &response)
+	return response.MaintenanceKey, err
+}
+
+// EndMaintenance ends maintenance on an instance
+func (this *Client) EndMaintenance(instanceKey *inst.InstanceKey) error {
+	return this.delete(instancePath(instanceKey, "maintenance"))
+}
+
+// Tags
+
+// Tags lists an instance's tags, in "name=value" format
+func (this *Client) Tags(instanceKey *inst.InstanceKey) (tags []string, err error) {
+	err = this.get(instancePath(instanceKey, "tags"), &tags)
+	return tags, err
+}
+
+// Tag tags an instance, returning its tags
+func (this *Client) Tag(instanceKey *inst.InstanceKey, tagName string, tagValue string) (tags []string, err error) {
+	err = this.post(instancePath(instanceKey, "tags"), orchttp.TagRequest{Name: tagName, Value: tagValue}, &tags)
+	return tags, err
+}
+
+// Untag removes a tag from an instance. It is a not_found error if the instance is not so tagged.
+func (this *Client) Untag(instanceKey *inst.InstanceKey, tagName string) error {
+	return this.delete(instancePath(instanceKey, "tags", url.PathEscape(tagName)))
+}
+
+// Recovery
+
+// Recover recovers a failed instance, if analysis agrees it has failed, optionally promoting given candidate.
+// It returns the promoted instance.
+func (this *Client) Recover(instanceKey *inst.InstanceKey, candidateKey *inst.InstanceKey, skipProcesses bool) (*inst.InstanceKey, error) {
+	response := orchttp.RecoverResponse{}
+	request := orchttp.RecoverRequest{Candidate: instanceKeyRequest(candidateKey), SkipProcesses: skipProcesses}
+	if err := this.post(instancePath(instanceKey, "recover"), request, &response); err != nil {
+		return nil, err
+	}
+	return &response.SuccessorKey, nil
+}
+
+// GracefulMasterTakeover gracefully promotes a replica in place of the cluster's master. designatedKey is
+// required when the master has more than one replica. It returns the recovery, and the promoted master's
+// binary log coordinates at time of promotion.
+func (this *Client) GracefulMasterTakeover(clusterHint string, designatedKey *inst.InstanceKey) (*logic.TopologyRecovery, *inst.BinlogCoordinates, error) {
+	response := orchttp.GracefulMasterTakeoverResponse{}
+	request := orchttp.GracefulMasterTakeoverRequest{Designated: instanceKeyRequest(designatedKey)}
+	if err := this.post(clusterPath(clusterHint, "graceful-master-takeover"), request, &response); err != nil {
+		return nil, nil, err
+	}
+	return response.Recovery, response.PromotedMasterCoordinates, nil
+}
+
+// ForceMasterFailover forcibly fails over the cluster's master, even if healthy
+func (this *Client) ForceMasterFailover(clusterHint string) (topologyRecovery *logic.TopologyRecovery, err error) {
+	err = this.post(clusterPath(clusterHint, "force-master-failover"), nil, &topologyRecovery)
+	return topologyRecovery, err
+}
+
+// Recoveries lists recent recoveries, of given cluster or of all clusters when clusterHint is empty, by page
+func (this *Client) Recoveries(clusterHint string, unacknowledgedOnly bool, page int) (recoveries []logic.TopologyRecovery, err error) {
+	path := "recoveries"
+	if clusterHint != "" {
+		path = clusterPath(clusterHint, "recoveries")
+	}
+	err = this.get(fmt.Sprintf("%s?page=%d&unacknowledged=%t", path, page, unacknowledgedOnly), &recoveries)
+	return recoveries, err
+}
+
+// ActiveRecoveries lists active recoveries
+func (this *Client) ActiveRecoveries() (recoveries []logic.TopologyRecovery, err error) {
+	err = this.get("recoveries/active", &recoveries)
+	return recoveries, err
+}
+
+// Recovery reads a recovery, by id
+func (this *Client) Recovery(recoveryId int64) (topologyRecovery *logic.TopologyRecovery, err error) {
+	err = this.get(fmt.Sprintf("recoveries/%d", recoveryId), &topologyRecovery)
+	return topologyRecovery, err
+}
+
+// AcknowledgeRecovery acknowledges a recovery, by id
+func (this *Client) AcknowledgeRecovery(recoveryId int64, comment string) error {
+	return this.post(fmt.Sprintf("recoveries/%d/acknowledge", recoveryId), orchttp.AcknowledgeRequest{Comment: comment}, nil)
+}
+
+// AcknowledgeClusterRecoveries acknowledges all of a cluster's recoveries, unblocking further recoveries
+func (this *Client) AcknowledgeClusterRecoveries(clusterHint string, comment string) error {
+	return this.post(clusterPath(clusterHint, "acknowledge-recoveries"), orchttp.AcknowledgeRequest{Comment: comment}, nil)
+}
+
+// GlobalRecoveriesEnabled checks whether recoveries are globally enabled
+func (this *Client) GlobalRecoveriesEnabled() (bool, error) {
+	response := orchttp.GlobalRecoveries{}
+	err := this.get("global-recoveries", &response)
+	return response.Enabled, err
+}
+
+// SetGlobalRecoveries globally enables or disables recoveries
+func (this *Client) SetGlobalRecoveries(enabled bool) error {
+	return this.post("global-recoveries", orchttp.GlobalRecoveries{Enabled: enabled}, nil)
+}
+
+// API tokens
+
+// APITokens lists the API tokens of service accounts. Tokens themselves are not given.
+func (this *Client) APITokens() (apiTokens [](*process.APIToken), err error) {
+	err = this.get("api-tokens", &apiTokens)
+	return apiTokens, err
+}
+
+// CreateAPIToken creates an API token for given service account, of scope "read" or "write". A non empty
+// cluster hint limits the token to changing that cluster, and a non zero duration makes it expire.
+// The response holds the token, which is not given again.
+func (this *Client) CreateAPIToken(name string, scope string, clusterHint string, duration time.Duration) (response *orchttp.CreateAPITokenResponse, err error) {
+	request := orchttp.CreateAPITokenRequest{Name: name, Scope: scope, Cluster: clusterHint, Duration: durationString(duration)}
+	err = this.post("api-tokens", request, &response)
+	return response, err
+}
+
+// RevokeAPIToken revokes an API token by its id
+func (this *Client) RevokeAPIToken(tokenId string) error {
+	return this.delete(fmt.Sprintf("api-tokens/%s", url.PathEscape(tokenId)))
+}
+
+// Status and raft
+
+// Status reads the health of the leader node, including its view of raft. An unhealthy node
+// is an error of status 503.
+func (this *Client) Status() (health *process.HealthStatus, err error) {
+	err = this.get("status", &health)
+	return health, err
+}
+
+// RaftNodeStatus is the raft status of an orchestrator node, as seen by that node
+type RaftNodeStatus struct {
+	Endpoint string
+	State    string // e.g. "Leader", "Follower", "Candidate"
+	Leader   string // The leader's raft address
+	Healthy  bool
+	Error    string // Why the node's status could not be read
+}
+
+// RaftStatus reads the raft status of each node given by the client's endpoints. Unlike other
+// requests, these are not routed to the leader.
+func (this *Client) RaftStatus() []RaftNodeStatus {
+	statuses := []RaftNodeStatus{}
+	for _, endpoint := range this.endpoints {
+		status := RaftNodeStatus{Endpoint: endpoint}
+		var health string
+		if _, err := this.send(http.MethodGet, endpoint, "raft-state", nil, &status.State); err != nil {
+			status.Error = err.Error()
+		} else if _, err := this.send(http.MethodGet, endpoint, "raft-leader", nil, &status.Leader); err != nil {
+			status.Error = err.Error()
+		} else if _, err := this.send(http.MethodGet, endpoint, "raft-health", nil, &health); err == nil {
+			status.Healthy = (health == "healthy")
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
@@ -0,0 +1,295 @@
+/*
+   Copyright 2019 GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package client is a Go client of the orchestrator HTTP API (v2). Given the API endpoints of
+// all nodes of an orchestrator/raft setup, it routes requests to the leader, as orchestrator-client does.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LeaderCheckTimeout bounds each leader-check request made while looking for the leader
+const LeaderCheckTimeout = time.Second
+
+// Config configures a Client
+type Config struct {
+	// Endpoints are API URLs of orchestrator nodes, e.g. "http://orchestrator1:3000/api". A missing
+	// "/api" suffix is added. With more than one endpoint, requests are routed to the leader.
+	Endpoints []string
+	// HTTPAuthUser and HTTPAuthPassword are used for basic authentication, when set
+	HTTPAuthUser     string
+	HTTPAuthPassword string
+	// AuthToken, when set, is sent as a bearer token
+	AuthToken string
+	// Timeout bounds each request. Zero means no timeout: recoveries may take long.
+	Timeout time.Duration
+	// TLSConfig is used for https endpoints, when set
+	TLSConfig *tls.Config
+	// HTTPClient, when set, is used as is, and Timeout and TLSConfig are ignored
+	HTTPClient *http.Client
+}
+
+// Error is an error response of the API. Code is one of the API's error codes, e.g. "not_found".
+type Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (this *Error) Error() string {
+	return fmt.Sprintf("%d %s: %s", this.StatusCode, this.Code, this.Message)
+}
+
+// IsNotFound checks whether given error is a not_found API error
+func IsNotFound(err error) bool {
+	apiError, ok := err.(*Error)
+	return ok && apiError.StatusCode == http.StatusNotFound
+}
+
+// Client is an orchestrator API client. It is safe for concurrent use.
+type Client struct {
+	endpoints  []string
+	httpClient *http.Client
+	user       string
+	password   string
+	authToken  string
+
+	leaderMutex    sync.Mutex
+	leaderEndpoint string
+}
+
+// normalizeEndpoint trims a trailing slash, and makes sure the endpoint ends with "/api"
+func normalizeEndpoint(endpoint string) string {
+	endpoint = strings.TrimRight(strings.TrimSpace(endpoint), "/")
+	if !strings.HasSuffix(endpoint, "/api") {
+		endpoint = endpoint + "/api"
+	}
+	return endpoint
+}
+
+// NewClient creates a client of given configuration
+func NewClient(clientConfig Config) (*Client, error) {
+	client := &Client{
+		httpClient: clientConfig.HTTPClient,
+		user:       clientConfig.HTTPAuthUser,
+		password:   clientConfig.HTTPAuthPassword,
+		authToken:  clientConfig.AuthToken,
+	}
+	for _, endpoint := range clientConfig.Endpoints {
+		if strings.TrimSpace(endpoint) == "" {
+			continue
+		}
+		endpoint = normalizeEndpoint(endpoint)
+		if _, err := url.Parse(endpoint); err != nil {
+			return nil, fmt.Errorf("NewClient: invalid endpoint %s: %+v", endpoint, err)
+		}
+		client.endpoints = append(client.endpoints, endpoint)
+	}
+	if len(client.endpoints) == 0 {
+		return nil, fmt.Errorf("NewClient: no endpoints given")
+	}
+	if client.httpClient == nil {
+		client.httpClient = &http.Client{
+			Timeout:   clientConfig.Timeout,
+			Transport: &http.Transport{TLSClientConfig: clientConfig.TLSConfig, Proxy: http.ProxyFromEnvironment},
+		}
+	}
+	return client, nil
+}
+
+// Endpoints returns the normalized API endpoints of this client
+func (this *Client) Endpoints() []string {
+	return this.endpoints
+}
+
+// newRequest creates a request to given endpoint, authenticated as configured
+func (this *Client) newRequest(ctx context.Context, method string, endpoint string, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, fmt.Sprintf("%s/%s", endpoint, path), body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if this.user != "" {
+		req.SetBasicAuth(this.user, this.password)
+	}
+	if this.authToken != "" {
+		req.Header.Set("Authorization", "Bearer "+this.authToken)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	return req, nil
+}
+
+// checkEndpoint checks whether given endpoint responds 200 to given leader check
+func (this *Client) checkEndpoint(endpoint string, leaderCheck string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), LeaderCheckTimeout)
+	defer cancel()
+	req, err := this.newRequest(ctx, http.MethodGet, endpoint, leaderCheck, nil)
+	if err != nil {
+		return false
+	}
+	resp, err := this.httpClient.Do(req)
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	return resp.StatusCode == http.StatusOK
+}
+
+// Leader returns the endpoint of the leader. With a single endpoint, that endpoint is assumed to be,
+// or to route to, the leader. Otherwise, the first endpoint passing leader-check is the leader; failing
+// that, the first endpoint passing routed-leader-check, i.e. proxying to the leader. The leader is
+// remembered until a request to it fails to connect.
+func (this *Client) Leader() (string, error) {
+	return this.leader(false)
+}
+
+func (this *Client) leader(refresh bool) (string, error) {
+	if len(this.endpoints) == 1 {
+		return this.endpoints[0], nil
+	}
+	this.leaderMutex.Lock()
+	defer this.leaderMutex.Unlock()
+
+	if this.leaderEndpoint != "" && !refresh {
+		return this.leaderEndpoint, nil
+	}
+	this.leaderEndpoint = ""
+	for _, leaderCheck := range []string{"leader-check", "routed-leader-check"} {
+		for _, endpoint := range this.endpoints {
+			if this.checkEndpoint(endpoint, leaderCheck) {
+				this.leaderEndpoint = endpoint
+				return endpoint, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("Cannot determine leader from %s", strings.Join(this.endpoints, " "))
+}
+
+// isConnectError checks whether given error is a failure to connect, in which case the request
+// certainly did not reach the server, and is safe to retry elsewhere
+func isConnectError(err error) bool {
+	if urlError, ok := err.(*url.Error); ok {
+		err = urlError.Err
+	}
+	opError, ok := err.(*net.OpError)
+	return ok && opError.Op == "dial"
+}
+
+// send sends a request to given endpoint and decodes its response into result, unless nil
+func (this *Client) send(method string, endpoint string, path string, content []byte, result interface{}) (transportErr error, err error) {
+	var body io.Reader
+	if content != nil {
+		body = bytes.NewReader(content)
+	}
+	req, err := this.newRequest(context.Background(), method, endpoint, path, body)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := this.httpClient.Do(req)
+	if err != nil {
+		return err, err
+	}
+	defer resp.Body.Close()
+
+	responseContent, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err, err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		apiError := &Error{StatusCode: resp.StatusCode}
+		if json.Unmarshal(responseContent, apiError) != nil || apiError.Code == "" {
+			apiError.Code = http.StatusText(resp.StatusCode)
+			apiError.Message = strings.TrimSpace(string(responseContent))
+		}
+		return nil, apiError
+	}
+	if result == nil || resp.StatusCode == http.StatusNoContent {
+		return nil, nil
+	}
+	if err := json.Unmarshal(responseContent, result); err != nil {
+		return nil, fmt.Errorf("%s %s: cannot decode response: %+v", method, req.URL, err)
+	}
+	return nil, nil
+}
+
+// do sends an API request, routed to the leader. Should the leader be unknown or unreachable, reads
+// fall back to any node; mutations are retried once, on a newly found leader, if they failed to connect.
+func (this *Client) do(method string, path string, request interface{}, result interface{}) error {
+	var content []byte
+	if request != nil {
+		var err error
+		if content, err = json.Marshal(request); err != nil {
+			return err
+		}
+	}
+	leaderEndpoint, err := this.leader(false)
+	if err == nil {
+		var transportErr error
+		transportErr, err = this.send(method, leaderEndpoint, path, content, result)
+		if transportErr == nil || (method != http.MethodGet && !isConnectError(transportErr)) {
+			return err
+		}
+		// Leader unreachable; it may have changed
+		if leaderEndpoint, err = this.leader(true); err == nil {
+			transportErr, err = this.send(method, leaderEndpoint, path, content, result)
+			if transportErr == nil || method != http.MethodGet {
+				return err
+			}
+		}
+	}
+	if method != http.MethodGet {
+		return err
+	}
+	for _, endpoint := range this.endpoints {
+		var transportErr error
+		if transportErr, err = this.send(method, endpoint, path, content, result); transportErr == nil {
+			return err
+		}
+	}
+	return err
+}
+
+// get reads from the API v2 path
+func (this *Client) get(path string, result interface{}) error {
+	return this.do(http.MethodGet, "v2/"+path, nil, result)
+}
+
+// post mutates via the API v2 path
+func (this *Client) post(path string, request interface{}, result interface{}) error {
+	return this.do(http.MethodPost, "v2/"+path, request, result)
+}
+
+// delete deletes via the API v2 path
+func (this *Client) delete(path string) error {
+	return this.do(http.MethodDelete, "v2/"+path, nil, nil)
+}
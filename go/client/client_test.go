@@ -0,0 +1,175 @@
+package client
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	orchttp "github.com/github/orchestrator/go/http"
+	"github.com/github/orchestrator/go/inst"
+	test "github.com/openark/golib/tests"
+)
+
+// mockNode is a fake orchestrator node, recording requests it serves
+type mockNode struct {
+	*httptest.Server
+	mutex        sync.Mutex
+	isLeader     bool
+	routesLeader bool
+	requests     []string
+	bodies       []string
+}
+
+func newMockNode(isLeader bool) *mockNode {
+	node := &mockNode{isLeader: isLeader}
+	node.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		node.mutex.Lock()
+		defer node.mutex.Unlock()
+		body, _ := ioutil.ReadAll(r.Body)
+		node.requests = append(node.requests, r.Method+" "+r.URL.RequestURI())
+		node.bodies = append(node.bodies, string(body))
+		switch r.URL.Path {
+		case "/api/leader-check":
+			if node.isLeader {
+				w.WriteHeader(http.StatusOK)
+			} else {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		case "/api/routed-leader-check":
+			if node.isLeader || node.routesLeader {
+				w.WriteHeader(http.StatusOK)
+			} else {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		case "/api/v2/instances/db-1/3306":
+			json.NewEncoder(w).Encode(inst.NewInstance())
+		case "/api/v2/instances/db-1/3306/downtime":
+			json.NewEncoder(w).Encode(inst.NewDowntime(&inst.InstanceKey{Hostname: "db-1", Port: 3306}, "me", "test", time.Hour))
+		case "/api/v2/instances/db-1/3306/maintenance":
+			w.WriteHeader(http.StatusNoContent)
+		case "/api/raft-state":
+			json.NewEncoder(w).Encode("Leader")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"Code": "not_found", "Message": "no such thing"})
+		}
+	}))
+	return node
+}
+
+func (this *mockNode) served() []string {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return append([]string{}, this.requests...)
+}
+
+func TestNewClient(t *testing.T) {
+	{
+		_, err := NewClient(Config{})
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		client, err := NewClient(Config{Endpoints: []string{"http://orc1:3000", "http://orc2:3000/api/", " ", "http://orc3/orchestrator/api"}})
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(strings.Join(client.Endpoints(), " "), "http://orc1:3000/api http://orc2:3000/api http://orc3/orchestrator/api")
+	}
+}
+
+func TestLeaderRouting(t *testing.T) {
+	follower := newMockNode(false)
+	defer follower.Close()
+	leader := newMockNode(true)
+	defer leader.Close()
+
+	client, err := NewClient(Config{Endpoints: []string{follower.URL, leader.URL}})
+	test.S(t).ExpectNil(err)
+
+	instanceKey := &inst.InstanceKey{Hostname: "db-1", Port: 3306}
+	downtime, err := client.BeginDowntime(instanceKey, "", "upgrade", 90*time.Minute)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(downtime.Owner, "me")
+	test.S(t).ExpectEquals(leader.served()[1], "POST /api/v2/instances/db-1/3306/downtime")
+	request := orchttp.DowntimeRequest{}
+	test.S(t).ExpectNil(json.Unmarshal([]byte(leader.bodies[1]), &request))
+	test.S(t).ExpectEquals(request.Duration, "5400s")
+	test.S(t).ExpectEquals(request.Reason, "upgrade")
+
+	// Leader is remembered
+	_, err = client.Instance(instanceKey)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(leader.served()), 3)
+	test.S(t).ExpectEquals(len(follower.served()), 1)
+
+	// Leader gone: reads fall back to any node; mutations go to the node routing to a new leader
+	leader.Close()
+	_, err = client.Instance(instanceKey)
+	test.S(t).ExpectNil(err)
+	follower.mutex.Lock()
+	follower.routesLeader = true
+	follower.mutex.Unlock()
+	err = client.EndMaintenance(instanceKey)
+	test.S(t).ExpectNil(err)
+	served := follower.served()
+	test.S(t).ExpectEquals(served[len(served)-1], "DELETE /api/v2/instances/db-1/3306/maintenance")
+	endpoint, err := client.Leader()
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(endpoint, follower.URL+"/api")
+}
+
+func TestNoLeader(t *testing.T) {
+	node1 := newMockNode(false)
+	defer node1.Close()
+	node2 := newMockNode(false)
+	defer node2.Close()
+
+	client, err := NewClient(Config{Endpoints: []string{node1.URL, node2.URL}})
+	test.S(t).ExpectNil(err)
+
+	instanceKey := &inst.InstanceKey{Hostname: "db-1", Port: 3306}
+	err = client.EndDowntime(instanceKey)
+	test.S(t).ExpectNotNil(err)
+	test.S(t).ExpectTrue(strings.Contains(err.Error(), "Cannot determine leader"))
+
+	// Reads are served by any node
+	instance, err := client.Instance(instanceKey)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectNotNil(instance)
+}
+
+func TestErrorResponse(t *testing.T) {
+	node := newMockNode(true)
+	defer node.Close()
+
+	client, err := NewClient(Config{Endpoints: []string{node.URL + "/api"}})
+	test.S(t).ExpectNil(err)
+
+	_, err = client.Instance(&inst.InstanceKey{Hostname: "db-2", Port: 3306})
+	test.S(t).ExpectTrue(IsNotFound(err))
+	apiError := err.(*Error)
+	test.S(t).ExpectEquals(apiError.Code, "not_found")
+	test.S(t).ExpectEquals(apiError.Message, "no such thing")
+
+	statuses := client.RaftStatus()
+	test.S(t).ExpectEquals(len(statuses), 1)
+	test.S(t).ExpectEquals(statuses[0].State, "Leader")
+	test.S(t).ExpectEquals(statuses[0].Healthy, false)
+	test.S(t).ExpectNotEquals(statuses[0].Error, "")
+}
+
+func TestMissingTargetInstance(t *testing.T) {
+	client, err := NewClient(Config{Endpoints: []string{"http://orc1:3000"}})
+	test.S(t).ExpectNil(err)
+
+	instanceKey := &inst.InstanceKey{Hostname: "db-2", Port: 3306}
+	_, err = client.Relocate(instanceKey, nil)
+	test.S(t).ExpectNotNil(err)
+	_, err = client.RelocateReplicas(instanceKey, nil, "")
+	test.S(t).ExpectNotNil(err)
+	_, err = client.MoveBelow(instanceKey, nil)
+	test.S(t).ExpectNotNil(err)
+}
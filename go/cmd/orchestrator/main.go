@@ -20,6 +20,8 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
+	"unicode"
 
 	"github.com/github/orchestrator/go/app"
 	"github.com/github/orchestrator/go/config"
@@ -45,6 +47,7 @@ func main() {
 	pool := flag.String("pool", "", "Pool logical name (applies for pool-related commands)")
 	hostnameFlag := flag.String("hostname", "", "Hostname/fqdn/CNAME/VIP (applies for hostname/resolve related commands)")
 	discovery := flag.Bool("discovery", true, "auto discovery mode")
+	remoteAPI := flag.String("api", "", "API endpoints of orchestrator nodes (comma or space delimited), e.g. 'http://orchestrator.example.com:3000/api'. Runs the command via the API, rather than against the backend database. Overrides RemoteAPI")
 	quiet := flag.Bool("quiet", false, "quiet")
 	verbose := flag.Bool("verbose", false, "verbose")
 	debug := flag.Bool("debug", false, "debug mode (very verbose)")
@@ -62,6 +65,12 @@ func main() {
 	config.RuntimeCLIFlags.EnableDatabaseUpdate = flag.Bool("enable-database-update", false, "Enable database update, overrides SkipOrchestratorDatabaseUpdate")
 	config.RuntimeCLIFlags.IgnoreRaftSetup = flag.Bool("ignore-raft-setup", false, "Override RaftEnabled for CLI invocation (CLI by default not allowed for raft setups). NOTE: operations by CLI invocation may not reflect in all raft nodes.")
 	config.RuntimeCLIFlags.Tag = flag.String("tag", "", "tag to add ('tagname' or 'tagname=tagvalue') or to search ('tagname' or 'tagname=tagvalue' or comma separated 'tag0,tag1=val1,tag2' for intersection of all)")
+	config.RuntimeCLIFlags.EventType = flag.String("event-type", "", "Binary log event type to filter by (applies for binlog-events and relaylog-events commands), e.g. 'Query', 'Gtid', 'Write_rows'")
+	config.RuntimeCLIFlags.GTID = flag.String("gtid", "", "GTID to filter binary log events by (applies for binlog-events and relaylog-events commands)")
+	config.RuntimeCLIFlags.DesiredTopology = flag.String("desired-topology", "", "Desired topology (applies for plan-topology and apply-topology commands): comma delimited 'replica>master' entries, or a JSON object of replica:master entries. Use '@file.name' to read from file")
+	config.RuntimeCLIFlags.ServiceAccount = flag.String("service-account", "", "Service account name (applies for create-api-token)")
+	config.RuntimeCLIFlags.TokenScope = flag.String("scope", "read", "API token scope (applies for create-api-token): read|write")
+	config.RuntimeCLIFlags.TokenId = flag.String("token-id", "", "API token id (applies for revoke-api-token)")
 	flag.Parse()
 
 	if *destination != "" && *sibling != "" {
@@ -106,10 +115,29 @@ func main() {
 	}
 	log.Info(startText)
 
-	if len(*configFile) > 0 {
+	defaultConfigFileNames := []string{
+		"/etc/orchestrator.conf.json", "conf/orchestrator.conf.json", "orchestrator.conf.json",
+		"/etc/orchestrator.conf.yaml", "conf/orchestrator.conf.yaml", "orchestrator.conf.yaml",
+	}
+	switch {
+	case *command == "validate-config" && len(*configFile) > 0:
+		// validate-config reports on configuration files, rather than bail out reading them
+		config.Locate(*configFile)
+	case *command == "validate-config":
+		existingConfigFileNames := []string{}
+		for _, fileName := range defaultConfigFileNames {
+			if _, err := os.Stat(fileName); err == nil {
+				existingConfigFileNames = append(existingConfigFileNames, fileName)
+			}
+		}
+		config.Locate(existingConfigFileNames...)
+	case len(*configFile) > 0:
 		config.ForceRead(*configFile)
-	} else {
-		config.Read("/etc/orchestrator.conf.json", "conf/orchestrator.conf.json", "orchestrator.conf.json")
+	default:
+		config.Read(defaultConfigFileNames...)
+	}
+	if *remoteAPI != "" {
+		config.Config.RemoteAPI = strings.FieldsFunc(*remoteAPI, func(r rune) bool { return r == ',' || unicode.IsSpace(r) })
 	}
 	if *config.RuntimeCLIFlags.EnableDatabaseUpdate {
 		config.Config.SkipOrchestratorDatabaseUpdate = false
@@ -32,6 +32,12 @@ type CLIFlags struct {
 	EnableDatabaseUpdate       *bool
 	IgnoreRaftSetup            *bool
 	Tag                        *string
+	EventType                  *string
+	GTID                       *string
+	DesiredTopology            *string
+	ServiceAccount             *string
+	TokenScope                 *string
+	TokenId                    *string
 }
 
 var RuntimeCLIFlags CLIFlags
@@ -0,0 +1,231 @@
+/*
+   Copyright 2019 GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sync"
+
+	"github.com/openark/golib/log"
+)
+
+// ClusterOverridableSettings are the settings which may be overridden per cluster via ClusterConfigOverrides
+var ClusterOverridableSettings = append([]string{
+	"PreventCrossDataCenterMasterFailover",
+	"ApplyMySQLPromotionAfterMasterFailover",
+	"FailMasterPromotionIfSQLThreadNotUpToDate",
+	"DelayMasterPromotionIfSQLThreadNotUpToDate",
+	"DetachLostReplicasAfterMasterFailover",
+	"MasterFailoverDetachReplicaMasterHost",
+	"ReasonableReplicationLagSeconds",
+	"RecoveryPeriodBlockSeconds",
+	"ReplicaPoolMaxLagSeconds",
+	"PostTakeMasterProcesses",
+	"RecoveryHookTimeoutSeconds",
+	"RecoveryHookRetries",
+	"RecoveryHookRetryIntervalSeconds",
+	"RecoveryHookPolicies",
+}, RecoveryHookTypes...)
+
+// ClusterConfigOverride overrides settings for clusters matching either an alias or a cluster name pattern.
+// Exactly one of ClusterAlias, ClusterNamePattern must be set.
+type ClusterConfigOverride struct {
+	ClusterAlias       string                     // Cluster alias, matched exactly
+	ClusterNamePattern string                     // Regular expression, matched against cluster name
+	Settings           map[string]json.RawMessage // Setting name to value, e.g. {"PreventCrossDataCenterMasterFailover": true}
+
+	clusterNameRegexp *regexp.Regexp
+}
+
+// Name describes which clusters this override applies to
+func (this *ClusterConfigOverride) Name() string {
+	if this.ClusterAlias != "" {
+		return fmt.Sprintf("ClusterAlias=%s", this.ClusterAlias)
+	}
+	return fmt.Sprintf("ClusterNamePattern=%s", this.ClusterNamePattern)
+}
+
+// Matches checks whether this override applies to given cluster
+func (this *ClusterConfigOverride) Matches(clusterName string, clusterAlias string) bool {
+	if this.ClusterAlias != "" {
+		return this.ClusterAlias == clusterAlias
+	}
+	if this.clusterNameRegexp != nil {
+		return this.clusterNameRegexp.MatchString(clusterName)
+	}
+	matched, _ := regexp.MatchString(this.ClusterNamePattern, clusterName)
+	return matched
+}
+
+// applyTo sets overridden settings onto given configuration. Values are decoded into fresh
+// variables, such that slices and maps of the configuration this one was copied from are untouched.
+func (this *ClusterConfigOverride) applyTo(configuration *Configuration) error {
+	configurationValue := reflect.ValueOf(configuration).Elem()
+	for settingName, rawValue := range this.Settings {
+		field := configurationValue.FieldByName(settingName)
+		if !field.IsValid() {
+			return fmt.Errorf("unknown setting %s", settingName)
+		}
+		value := reflect.New(field.Type())
+		if err := json.Unmarshal(rawValue, value.Interface()); err != nil {
+			return fmt.Errorf("%s: %+v", settingName, err)
+		}
+		field.Set(value.Elem())
+	}
+	return nil
+}
+
+func isClusterOverridableSetting(settingName string) bool {
+	for _, overridableSetting := range ClusterOverridableSettings {
+		if overridableSetting == settingName {
+			return true
+		}
+	}
+	return false
+}
+
+func (this *ClusterConfigOverride) postReadAdjustments(configuration *Configuration) error {
+	if (this.ClusterAlias == "") == (this.ClusterNamePattern == "") {
+		return fmt.Errorf("ClusterConfigOverrides: exactly one of ClusterAlias, ClusterNamePattern must be set")
+	}
+	if this.ClusterNamePattern != "" {
+		clusterNameRegexp, err := regexp.Compile(this.ClusterNamePattern)
+		if err != nil {
+			return fmt.Errorf("ClusterConfigOverrides: %s: %+v", this.Name(), err)
+		}
+		this.clusterNameRegexp = clusterNameRegexp
+	}
+	for settingName := range this.Settings {
+		if !isClusterOverridableSetting(settingName) {
+			return fmt.Errorf("ClusterConfigOverrides: %s: %s cannot be overridden per cluster. Overridable settings: %+v", this.Name(), settingName, ClusterOverridableSettings)
+		}
+	}
+	validated := *configuration
+	if err := this.applyTo(&validated); err != nil {
+		return fmt.Errorf("ClusterConfigOverrides: %s: %+v", this.Name(), err)
+	}
+	if err := validated.validateClusterOverridableSettings(); err != nil {
+		return fmt.Errorf("ClusterConfigOverrides: %s: %+v", this.Name(), err)
+	}
+	return nil
+}
+
+// validateClusterOverridableSettings validates the settings which may be overridden per cluster. It applies
+// to the global configuration as well as to the configuration in effect for any cluster.
+func (this *Configuration) validateClusterOverridableSettings() error {
+	if this.RecoveryHookTimeoutSeconds < 0 || this.RecoveryHookRetries < 0 || this.RecoveryHookRetryIntervalSeconds < 0 {
+		return fmt.Errorf("RecoveryHookTimeoutSeconds, RecoveryHookRetries, RecoveryHookRetryIntervalSeconds must not be negative")
+	}
+	for hookType, policy := range this.RecoveryHookPolicies {
+		knownHookType := false
+		for _, recoveryHookType := range RecoveryHookTypes {
+			knownHookType = knownHookType || (hookType == recoveryHookType)
+		}
+		if !knownHookType {
+			return fmt.Errorf("RecoveryHookPolicies: unknown hook type %s. Expected one of %+v", hookType, RecoveryHookTypes)
+		}
+		if err := policy.postReadAdjustments(hookType); err != nil {
+			return err
+		}
+	}
+	if this.FailMasterPromotionIfSQLThreadNotUpToDate && this.DelayMasterPromotionIfSQLThreadNotUpToDate {
+		return fmt.Errorf("Cannot have both FailMasterPromotionIfSQLThreadNotUpToDate and DelayMasterPromotionIfSQLThreadNotUpToDate enabled")
+	}
+	if this.ReplicaPoolMaxLagSeconds < 0 {
+		return fmt.Errorf("ReplicaPoolMaxLagSeconds must be non-negative")
+	}
+	return nil
+}
+
+// clusterConfigsMutex guards the effective configurations cached per cluster
+var clusterConfigsMutex sync.Mutex
+
+// resetClusterConfigs discards cached per cluster configurations, as when configuration is (re)read
+func (this *Configuration) resetClusterConfigs() {
+	clusterConfigsMutex.Lock()
+	defer clusterConfigsMutex.Unlock()
+
+	this.clusterConfigs = nil
+}
+
+// ForCluster returns the configuration in effect for given cluster: this configuration, with matching
+// ClusterConfigOverrides applied in order of appearance. The result is shared and must not be modified.
+func (this *Configuration) ForCluster(clusterName string, clusterAlias string) *Configuration {
+	clusterConfigsMutex.Lock()
+	defer clusterConfigsMutex.Unlock()
+
+	if len(this.ClusterConfigOverrides) == 0 {
+		return this
+	}
+
+	cacheKey := fmt.Sprintf("%s/%s", clusterName, clusterAlias)
+	if clusterConfig, found := this.clusterConfigs[cacheKey]; found {
+		return clusterConfig
+	}
+	clusterConfig := *this
+	clusterConfig.ClusterConfigOverrides = nil
+	clusterConfig.clusterConfigs = nil
+	for i := range this.ClusterConfigOverrides {
+		override := &this.ClusterConfigOverrides[i]
+		if override.Matches(clusterName, clusterAlias) {
+			// Validated upon reading configuration
+			override.applyTo(&clusterConfig)
+		}
+	}
+	// Each override is valid on its own; several overrides matching a cluster may still combine into an invalid configuration
+	if err := clusterConfig.validateClusterOverridableSettings(); err != nil {
+		log.Errorf("ClusterConfigOverrides: invalid configuration for cluster %s (alias: %s), using global configuration: %+v", clusterName, clusterAlias, err)
+		clusterConfig = *this
+		clusterConfig.ClusterConfigOverrides = nil
+		clusterConfig.clusterConfigs = nil
+	}
+	if this.clusterConfigs == nil {
+		this.clusterConfigs = make(map[string]*Configuration)
+	}
+	this.clusterConfigs[cacheKey] = &clusterConfig
+	return &clusterConfig
+}
+
+// ClusterConfigSetting is an overridable setting in effect for a cluster
+type ClusterConfigSetting struct {
+	Name   string
+	Value  interface{}
+	Source string // "global", or the name of the last override setting the value
+}
+
+// GetClusterConfigSettings lists the overridable settings in effect for given cluster, and where their values come from
+func (this *Configuration) GetClusterConfigSettings(clusterName string, clusterAlias string) (settings []ClusterConfigSetting) {
+	clusterConfigValue := reflect.ValueOf(this.ForCluster(clusterName, clusterAlias)).Elem()
+	for _, settingName := range ClusterOverridableSettings {
+		setting := ClusterConfigSetting{
+			Name:   settingName,
+			Value:  clusterConfigValue.FieldByName(settingName).Interface(),
+			Source: "global",
+		}
+		for i := range this.ClusterConfigOverrides {
+			override := &this.ClusterConfigOverrides[i]
+			if _, found := override.Settings[settingName]; found && override.Matches(clusterName, clusterAlias) {
+				setting.Source = override.Name()
+			}
+		}
+		settings = append(settings, setting)
+	}
+	return settings
+}
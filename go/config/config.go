@@ -19,9 +19,11 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/url"
 	"os"
 	"regexp"
+	"sort"
 	"strings"
 
 	"gopkg.in/gcfg.v1"
@@ -43,6 +45,8 @@ const (
 	HealthPollSeconds                            = 1
 	RaftHealthPollSeconds                        = 10
 	RecoveryPollSeconds                          = 1
+	ReplicaPoolsPollSeconds                      = 10
+	ProxySQLSyncReadersPollSeconds               = 10
 	ActiveNodeExpireSeconds                      = 5
 	BinlogFileHistoryDays                        = 1
 	MaintenanceOwner                             = "orchestrator"
@@ -93,18 +97,21 @@ type Configuration struct {
 	MySQLTopologyUser                          string
 	MySQLTopologyPassword                      string // my.cnf style configuration file from where to pick credentials. Expecting `user`, `password` under `[client]` section
 	MySQLTopologyCredentialsConfigFile         string
-	MySQLTopologySSLPrivateKeyFile             string // Private key file used to authenticate with a Topology mysql instance with TLS
-	MySQLTopologySSLCertFile                   string // Certificate PEM file used to authenticate with a Topology mysql instance with TLS
-	MySQLTopologySSLCAFile                     string // Certificate Authority PEM file used to authenticate with a Topology mysql instance with TLS
-	MySQLTopologySSLSkipVerify                 bool   // If true, do not strictly validate mutual TLS certs for Topology mysql instances
-	MySQLTopologyUseMutualTLS                  bool   // Turn on TLS authentication with the Topology MySQL instances
-	MySQLTopologyUseMixedTLS                   bool   // Mixed TLS and non-TLS authentication with the Topology MySQL instances
-	TLSCacheTTLFactor                          uint   // Factor of InstancePollSeconds that we set as TLS info cache expiry
-	BackendDB                                  string // EXPERIMENTAL: type of backend db; either "mysql" or "sqlite3"
-	SQLite3DataFile                            string // when BackendDB == "sqlite3", full path to sqlite3 datafile
-	SkipOrchestratorDatabaseUpdate             bool   // When true, do not check backend database schema nor attempt to update it. Useful when you may be running multiple versions of orchestrator, and you only wish certain boxes to dictate the db structure (or else any time a different orchestrator version runs it will rebuild database schema)
-	PanicIfDifferentDatabaseDeploy             bool   // When true, and this process finds the orchestrator backend DB was provisioned by a different version, panic
-	RaftEnabled                                bool   // When true, setup orchestrator in a raft consensus layout. When false (default) all Raft* variables are ignored
+	MySQLTopologyCredentialsProvider           string                      // Source of topology credentials: "" (MySQLTopologyUser/MySQLTopologyPassword), "file", "exec" or "http"
+	MySQLTopologyCredentialsProviderSource     string                      // File name, shell command or URL from which to fetch topology credentials as JSON. See docs
+	MySQLTopologySSLPrivateKeyFile             string                      // Private key file used to authenticate with a Topology mysql instance with TLS
+	MySQLTopologySSLCertFile                   string                      // Certificate PEM file used to authenticate with a Topology mysql instance with TLS
+	MySQLTopologySSLCAFile                     string                      // Certificate Authority PEM file used to authenticate with a Topology mysql instance with TLS
+	MySQLTopologySSLSkipVerify                 bool                        // If true, do not strictly validate mutual TLS certs for Topology mysql instances
+	MySQLTopologyUseMutualTLS                  bool                        // Turn on TLS authentication with the Topology MySQL instances
+	MySQLTopologyUseMixedTLS                   bool                        // Mixed TLS and non-TLS authentication with the Topology MySQL instances
+	MySQLTopologyConnectionProfiles            []TopologyConnectionProfile // Per hostname/cluster pattern overrides of topology credentials, TLS, timeouts and pool size. First matching profile applies
+	TLSCacheTTLFactor                          uint                        // Factor of InstancePollSeconds that we set as TLS info cache expiry
+	BackendDB                                  string                      // EXPERIMENTAL: type of backend db; either "mysql" or "sqlite3"
+	SQLite3DataFile                            string                      // when BackendDB == "sqlite3", full path to sqlite3 datafile
+	SkipOrchestratorDatabaseUpdate             bool                        // When true, do not check backend database schema nor attempt to update it. Useful when you may be running multiple versions of orchestrator, and you only wish certain boxes to dictate the db structure (or else any time a different orchestrator version runs it will rebuild database schema)
+	PanicIfDifferentDatabaseDeploy             bool                        // When true, and this process finds the orchestrator backend DB was provisioned by a different version, panic
+	RaftEnabled                                bool                        // When true, setup orchestrator in a raft consensus layout. When false (default) all Raft* variables are ignored
 	RaftBind                                   string
 	RaftAdvertise                              string
 	RaftDataDir                                string
@@ -118,6 +125,11 @@ type Configuration struct {
 	MySQLOrchestratorUser                      string
 	MySQLOrchestratorPassword                  string
 	MySQLOrchestratorCredentialsConfigFile     string   // my.cnf style configuration file from where to pick credentials. Expecting `user`, `password` under `[client]` section
+	MySQLOrchestratorCredentialsProvider       string   // Source of backend credentials: "" (MySQLOrchestratorUser/MySQLOrchestratorPassword), "file", "exec" or "http"
+	MySQLOrchestratorCredentialsProviderSource string   // File name, shell command or URL from which to fetch backend credentials as JSON. See docs
+	CredentialsProviderHTTPTokenFile           string   // File holding a token sent as Authorization bearer (and X-Vault-Token) to the "http" credentials provider
+	CredentialsProviderHTTPTimeoutSeconds      int      // Timeout for "http" credentials provider requests
+	CredentialsRefreshSeconds                  int      // Interval at which provided credentials are re-fetched. Credentials with a lease duration are re-fetched ahead of expiry
 	MySQLOrchestratorSSLPrivateKeyFile         string   // Private key file used to authenticate with the Orchestrator mysql instance with TLS
 	MySQLOrchestratorSSLCertFile               string   // Certificate PEM file used to authenticate with the Orchestrator mysql instance with TLS
 	MySQLOrchestratorSSLCAFile                 string   // Certificate Authority PEM file used to authenticate with the Orchestrator mysql instance with TLS
@@ -147,12 +159,22 @@ type Configuration struct {
 	DiscoveryCollectionRetentionSeconds        uint     // Number of seconds to retain the discovery collection information
 	DiscoverySeeds                             []string // Hard coded array of hostname:port, ensuring orchestrator discovers these hosts upon startup, assuming not already known to orchestrator
 	InstanceBulkOperationsWaitTimeoutSeconds   uint     // Time to wait on a single instance when doing bulk (many instances) operation
-	HostnameResolveMethod                      string   // Method by which to "normalize" hostname ("none"/"default"/"cname")
+	HostnameResolveMethod                      string   // Method by which to "normalize" hostname ("none"/"default"/"cname"/"ip"/"srv"/"static"/"http")
 	MySQLHostnameResolveMethod                 string   // Method by which to "normalize" hostname via MySQL server. ("none"/"@@hostname"/"@@report_host"; default "@@hostname")
+	// Map between regex matching hostname to a resolve method overriding HostnameResolveMethod ("none"/"default"/"cname"/"ip"/"srv"/"static"/"http")
+	HostnameResolveMethodsByPattern            map[string]string
+	HostnameResolveStaticMapFile               string   // JSON file mapping hostname to resolved hostname, used by "static" resolve method. Reloaded on SIGHUP
+	HostnameResolveHTTPURL                     string   // URL used by "http" resolve method, e.g. "http://resolver/resolve?host={hostname}". A 200 response body is the resolved hostname; 404 means "unchanged"
+	HostnameUnresolveHTTPURL                   string   // URL used by "http" resolve method to unresolve a hostname, same semantics as HostnameResolveHTTPURL. Optional
+	HostnameResolveHTTPTimeoutSeconds          int      // Timeout for "http" resolve method requests
 	SkipBinlogServerUnresolveCheck             bool     // Skip the double-check that an unresolved hostname resolves back to same hostname for binlog servers
 	ExpiryHostnameResolvesMinutes              int      // Number of minutes after which to expire hostname-resolves
 	RejectHostnameResolvePattern               string   // Regexp pattern for resolved hostname that will not be accepted (not cached, not written to db). This is done to avoid storing wrong resolves due to network glitches.
 	ReasonableReplicationLagSeconds            int      // Above this value is considered a problem
+	LongRunningQueriesSampleIntervalSeconds    int      // Interval at which processlists of masters, intermediate masters and lagging replicas are sampled for long running queries. 0 to disable
+	LongRunningQueriesThresholdSeconds         int      // Queries and transactions running at least this long are recorded
+	LongRunningQueriesUserFilters              []string // When non empty, only record processes of users matching any of these regexps
+	LongRunningQueriesIgnoreUserFilters        []string // Do not record processes of users matching any of these regexps
 	ProblemIgnoreHostnameFilters               []string // Will minimize problem visualization for hostnames matching given regexp filters
 	VerifyReplicationFilters                   bool     // Include replication filters check before approving topology refactoring
 	ReasonableMaintenanceReplicationLagSeconds int      // Above this value move-up and move-below are blocked
@@ -163,15 +185,22 @@ type Configuration struct {
 	AuditPurgeDays                             uint     // Days after which audit entries are purged from the database
 	RemoveTextFromHostnameDisplay              string   // Text to strip off the hostname on cluster/clusters pages
 	ReadOnly                                   bool
-	AuthenticationMethod                       string // Type of autherntication to use, if any. "" for none, "basic" for BasicAuth, "multi" for advanced BasicAuth, "proxy" for forwarded credentials via reverse proxy, "token" for token based access
-	OAuthClientId                              string
-	OAuthClientSecret                          string
-	OAuthScopes                                []string
+	AuthenticationMethod                       string            // Type of autherntication to use, if any. "" for none, "basic" for BasicAuth, "multi" for advanced BasicAuth, "proxy" for forwarded credentials via reverse proxy, "token" for token based access, "oidc" for OpenID Connect
+	OAuthClientId                              string            // Client ID registered with the OpenID Connect provider, when AuthenticationMethod is "oidc"
+	OAuthClientSecret                          string            // Client secret registered with the OpenID Connect provider. Optional: PKCE is always used
+	OAuthScopes                                []string          // Scopes requested on OpenID Connect login; "openid" is always requested
+	OIDCIssuerURL                              string            // OpenID Connect provider issuer URL; its discovery document is read from <issuer>/.well-known/openid-configuration
+	OIDCRedirectURL                            string            // URL of orchestrator's /oidc/callback, as registered with the provider, e.g. https://orchestrator.example.com/oidc/callback
+	OIDCUsernameClaim                          string            // ID token claim naming the authenticated user (default: "preferred_username"; "sub" when missing)
+	OIDCGroupsClaim                            string            // ID token claim listing the user's groups, which PowerAuthGroups are matched against (default: "groups")
+	OIDCSessionSecret                          string            // Key signing web UI session cookies; at least 32 characters, and the same on all orchestrator nodes
+	OIDCSessionExpirySeconds                   int               // Time after which a web UI session expires and the user logs in again
+	OIDCAPIAudiences                           []string          // Audiences accepted on JWT bearer tokens of API calls, besides OAuthClientId
 	HTTPAuthUser                               string            // Username for HTTP Basic authentication (blank disables authentication)
 	HTTPAuthPassword                           string            // Password for HTTP Basic authentication
 	AuthUserHeader                             string            // HTTP header indicating auth user, when AuthenticationMethod is "proxy"
-	PowerAuthUsers                             []string          // On AuthenticationMethod == "proxy", list of users that can make changes. All others are read-only.
-	PowerAuthGroups                            []string          // list of unix groups the authenticated user must be a member of to make changes.
+	PowerAuthUsers                             []string          // On AuthenticationMethod == "proxy" or "oidc", list of users that can make changes. All others are read-only.
+	PowerAuthGroups                            []string          // list of unix groups ("proxy") or OIDCGroupsClaim groups ("oidc") the authenticated user must be a member of to make changes.
 	AccessTokenUseExpirySeconds                uint              // Time by which an issued token must be used
 	AccessTokenExpiryMinutes                   uint              // Time after which HTTP access token expires
 	ClusterNameToAlias                         map[string]string // map between regex matching cluster name to a human friendly alias
@@ -206,6 +235,14 @@ type Configuration struct {
 	SSLValidOUs                                []string          // Valid organizational units when using mutual TLS
 	StatusEndpoint                             string            // Override the status endpoint.  Defaults to '/api/status'
 	StatusOUVerify                             bool              // If true, try to verify OUs when Mutual TLS is on.  Defaults to false
+	RemoteAPI                                  []string          // API endpoints of orchestrator nodes, e.g. "https://orchestrator.example.com:3000/api". When given, CLI commands run via the API rather than against the backend database
+	RemoteAPIUser                              string            // Username for HTTP Basic authentication with RemoteAPI
+	RemoteAPIPassword                          string            // Password for HTTP Basic authentication with RemoteAPI
+	RemoteAPIToken                             string            // Bearer token authenticating with RemoteAPI
+	RemoteAPISSLCAFile                         string            // Certificate Authority PEM file used to authenticate RemoteAPI servers
+	RemoteAPISSLCertFile                       string            // Client certificate file, for mutual TLS with RemoteAPI
+	RemoteAPISSLPrivateKeyFile                 string            // Client private key file, for mutual TLS with RemoteAPI
+	RemoteAPISSLSkipVerify                     bool              // If true, do not validate RemoteAPI server certificates
 	AgentPollMinutes                           uint              // Minutes between agent polling
 	UnseenAgentForgetHours                     uint              // Number of hours after which an unseen agent is forgotten
 	StaleSeedFailMinutes                       uint              // Number of minutes after which a stale (no progress) seed is considered failed.
@@ -227,6 +264,11 @@ type Configuration struct {
 	RecoverIntermediateMasterClusterFilters    []string          // Only do IM recovery on clusters matching these regexp patterns (of course the ".*" pattern matches everything)
 	ProcessesShellCommand                      string            // Shell that executes command scripts
 	OnFailureDetectionProcesses                []string          // Processes to execute when detecting a failover scenario (before making a decision whether to failover or not). May and should use some of these placeholders: {failureType}, {instanceType}, {isMaster}, {isCoMaster}, {failureDescription}, {command}, {failedHost}, {failureCluster}, {failureClusterAlias}, {failureClusterDomain}, {failedPort}, {successorHost}, {successorPort}, {successorAlias}, {countReplicas}, {replicaHosts}, {isDowntimed}, {autoMasterRecovery}, {autoIntermediateMasterRecovery}
+	GracefulMasterTakeoverDrainMode            string            // How to handle write transactions on the master before setting it read_only on graceful takeover: "" (do nothing), "wait" (wait for them, abort takeover on timeout), "kill" (wait, then kill remaining)
+	GracefulMasterTakeoverDrainTimeoutSeconds  int               // Max time to wait for write transactions to complete on graceful takeover
+	GracefulMasterTakeoverDrainMinSeconds      int               // Only write transactions running for at least this many seconds are waited for/killed on graceful takeover
+	GracefulMasterTakeoverSetSuperReadOnly     bool              // Set super_read_only on the demoted master on graceful takeover, regardless of UseSuperReadOnly
+	GracefulMasterTakeoverAutoRollback         bool              // On failure after promotion in graceful takeover, roll back to the original topology
 	PreGracefulTakeoverProcesses               []string          // Processes to execute before doing a failover (aborting operation should any once of them exits with non-zero code; order of execution undefined). May and should use some of these placeholders: {failureType}, {instanceType}, {isMaster}, {isCoMaster}, {failureDescription}, {command}, {failedHost}, {failureCluster}, {failureClusterAlias}, {failureClusterDomain}, {failedPort}, {successorHost}, {successorPort}, {countReplicas}, {replicaHosts}, {isDowntimed}
 	PreFailoverProcesses                       []string          // Processes to execute before doing a failover (aborting operation should any once of them exits with non-zero code; order of execution undefined). May and should use some of these placeholders: {failureType}, {instanceType}, {isMaster}, {isCoMaster}, {failureDescription}, {command}, {failedHost}, {failureCluster}, {failureClusterAlias}, {failureClusterDomain}, {failedPort}, {countReplicas}, {replicaHosts}, {isDowntimed}
 	PostFailoverProcesses                      []string          // Processes to execute after doing a failover (order of execution undefined). May and should use some of these placeholders: {failureType}, {instanceType}, {isMaster}, {isCoMaster}, {failureDescription}, {command}, {failedHost}, {failureCluster}, {failureClusterAlias}, {failureClusterDomain}, {failedPort}, {successorHost}, {successorPort}, {successorAlias}, {countReplicas}, {replicaHosts}, {isDowntimed}, {isSuccessful}, {lostReplicas}, {countLostReplicas}
@@ -235,36 +277,60 @@ type Configuration struct {
 	PostIntermediateMasterFailoverProcesses    []string          // Processes to execute after doing a master failover (order of execution undefined). Uses same placeholders as PostFailoverProcesses
 	PostGracefulTakeoverProcesses              []string          // Processes to execute after runnign a graceful master takeover. Uses same placeholders as PostFailoverProcesses
 	PostTakeMasterProcesses                    []string          // Processes to execute after a successful Take-Master event has taken place
-	CoMasterRecoveryMustPromoteOtherCoMaster   bool              // When 'false', anything can get promoted (and candidates are prefered over others). When 'true', orchestrator will promote the other co-master or else fail
-	DetachLostSlavesAfterMasterFailover        bool              // synonym to DetachLostReplicasAfterMasterFailover
-	DetachLostReplicasAfterMasterFailover      bool              // Should replicas that are not to be lost in master recovery (i.e. were more up-to-date than promoted replica) be forcibly detached
-	ApplyMySQLPromotionAfterMasterFailover     bool              // Should orchestrator take upon itself to apply MySQL master promotion: set read_only=0, detach replication, etc.
-	PreventCrossDataCenterMasterFailover       bool              // When true (default: false), cross-DC master failover are not allowed, orchestrator will do all it can to only fail over within same DC, or else not fail over at all.
-	PreventCrossRegionMasterFailover           bool              // When true (default: false), cross-region master failover are not allowed, orchestrator will do all it can to only fail over within same region, or else not fail over at all.
-	MasterFailoverLostInstancesDowntimeMinutes uint              // Number of minutes to downtime any server that was lost after a master failover (including failed master & lost replicas). 0 to disable
-	MasterFailoverDetachSlaveMasterHost        bool              // synonym to MasterFailoverDetachReplicaMasterHost
-	MasterFailoverDetachReplicaMasterHost      bool              // Should orchestrator issue a detach-replica-master-host on newly promoted master (this makes sure the new master will not attempt to replicate old master if that comes back to life). Defaults 'false'. Meaningless if ApplyMySQLPromotionAfterMasterFailover is 'true'.
-	FailMasterPromotionIfSQLThreadNotUpToDate  bool              // when true, and a master failover takes place, if candidate master has not consumed all relay logs, promotion is aborted with error
-	DelayMasterPromotionIfSQLThreadNotUpToDate bool              // when true, and a master failover takes place, if candidate master has not consumed all relay logs, delay promotion until the sql thread has caught up
-	PostponeSlaveRecoveryOnLagMinutes          uint              // Synonym to PostponeReplicaRecoveryOnLagMinutes
-	PostponeReplicaRecoveryOnLagMinutes        uint              // On crash recovery, replicas that are lagging more than given minutes are only resurrected late in the recovery process, after master/IM has been elected and processes executed. Value of 0 disables this feature
-	OSCIgnoreHostnameFilters                   []string          // OSC replicas recommendation will ignore replica hostnames matching given patterns
-	GraphiteAddr                               string            // Optional; address of graphite port. If supplied, metrics will be written here
-	GraphitePath                               string            // Prefix for graphite path. May include {hostname} magic placeholder
-	GraphiteConvertHostnameDotsToUnderscores   bool              // If true, then hostname's dots are converted to underscores before being used in graphite path
-	GraphitePollSeconds                        int               // Graphite writes interval. 0 disables.
-	URLPrefix                                  string            // URL prefix to run orchestrator on non-root web path, e.g. /orchestrator to put it behind nginx.
-	DiscoveryIgnoreReplicaHostnameFilters      []string          // Regexp filters to apply to prevent auto-discovering new replicas. Usage: unreachable servers due to firewalls, applications which trigger binlog dumps
-	DiscoveryIgnoreMasterHostnameFilters       []string          // Regexp filters to apply to prevent auto-discovering a master. Usage: pointing your master temporarily to replicate seom data from external host
-	DiscoveryIgnoreHostnameFilters             []string          // Regexp filters to apply to prevent discovering instances of any kind
-	ConsulAddress                              string            // Address where Consul HTTP api is found. Example: 127.0.0.1:8500
-	ConsulScheme                               string            // Scheme (http or https) for Consul
-	ConsulAclToken                             string            // ACL token used to write to Consul KV
-	ConsulCrossDataCenterDistribution          bool              // should orchestrator automatically auto-deduce all consul DCs and write KVs in all DCs
-	ZkAddress                                  string            // UNSUPPERTED YET. Address where (single or multiple) ZooKeeper servers are found, in `srv1[:port1][,srv2[:port2]...]` format. Default port is 2181. Example: srv-a,srv-b:12181,srv-c
-	KVClusterMasterPrefix                      string            // Prefix to use for clusters' masters entries in KV stores (internal, consul, ZK), default: "mysql/master"
-	WebMessage                                 string            // If provided, will be shown on all web pages below the title bar
-	MaxConcurrentReplicaOperations             int               // Maximum number of concurrent operations on replicas
+	RecoveryHookTimeoutSeconds                 int               // Timeout for recovery hooks (*Processes above). A hook running longer is killed (along with processes it spawned) and considered to have failed. 0 for no timeout
+	RecoveryHookRetries                        int               // Number of times a failed (or timed out) recovery hook is retried
+	RecoveryHookRetryIntervalSeconds           int               // Wait time between recovery hook retries
+	// Per hook type overrides of the above, e.g. {"PreFailoverProcesses": {"TimeoutSeconds": 30, "Retries": 2}}
+	RecoveryHookPolicies                       map[string]RecoveryHookPolicy
+	CoMasterRecoveryMustPromoteOtherCoMaster   bool                          // When 'false', anything can get promoted (and candidates are prefered over others). When 'true', orchestrator will promote the other co-master or else fail
+	DetachLostSlavesAfterMasterFailover        bool                          // synonym to DetachLostReplicasAfterMasterFailover
+	DetachLostReplicasAfterMasterFailover      bool                          // Should replicas that are not to be lost in master recovery (i.e. were more up-to-date than promoted replica) be forcibly detached
+	ApplyMySQLPromotionAfterMasterFailover     bool                          // Should orchestrator take upon itself to apply MySQL master promotion: set read_only=0, detach replication, etc.
+	PreventCrossDataCenterMasterFailover       bool                          // When true (default: false), cross-DC master failover are not allowed, orchestrator will do all it can to only fail over within same DC, or else not fail over at all.
+	PreventCrossRegionMasterFailover           bool                          // When true (default: false), cross-region master failover are not allowed, orchestrator will do all it can to only fail over within same region, or else not fail over at all.
+	MasterFailoverLostInstancesDowntimeMinutes uint                          // Number of minutes to downtime any server that was lost after a master failover (including failed master & lost replicas). 0 to disable
+	MasterFailoverDetachSlaveMasterHost        bool                          // synonym to MasterFailoverDetachReplicaMasterHost
+	MasterFailoverDetachReplicaMasterHost      bool                          // Should orchestrator issue a detach-replica-master-host on newly promoted master (this makes sure the new master will not attempt to replicate old master if that comes back to life). Defaults 'false'. Meaningless if ApplyMySQLPromotionAfterMasterFailover is 'true'.
+	FailMasterPromotionIfSQLThreadNotUpToDate  bool                          // when true, and a master failover takes place, if candidate master has not consumed all relay logs, promotion is aborted with error
+	DelayMasterPromotionIfSQLThreadNotUpToDate bool                          // when true, and a master failover takes place, if candidate master has not consumed all relay logs, delay promotion until the sql thread has caught up
+	PostponeSlaveRecoveryOnLagMinutes          uint                          // Synonym to PostponeReplicaRecoveryOnLagMinutes
+	PostponeReplicaRecoveryOnLagMinutes        uint                          // On crash recovery, replicas that are lagging more than given minutes are only resurrected late in the recovery process, after master/IM has been elected and processes executed. Value of 0 disables this feature
+	OSCIgnoreHostnameFilters                   []string                      // OSC replicas recommendation will ignore replica hostnames matching given patterns
+	GraphiteAddr                               string                        // Optional; address of graphite port. If supplied, metrics will be written here
+	GraphitePath                               string                        // Prefix for graphite path. May include {hostname} magic placeholder
+	GraphiteConvertHostnameDotsToUnderscores   bool                          // If true, then hostname's dots are converted to underscores before being used in graphite path
+	GraphitePollSeconds                        int                           // Graphite writes interval. 0 disables.
+	URLPrefix                                  string                        // URL prefix to run orchestrator on non-root web path, e.g. /orchestrator to put it behind nginx.
+	DiscoveryIgnoreReplicaHostnameFilters      []string                      // Regexp filters to apply to prevent auto-discovering new replicas. Usage: unreachable servers due to firewalls, applications which trigger binlog dumps
+	DiscoveryIgnoreMasterHostnameFilters       []string                      // Regexp filters to apply to prevent auto-discovering a master. Usage: pointing your master temporarily to replicate seom data from external host
+	DiscoveryIgnoreHostnameFilters             []string                      // Regexp filters to apply to prevent discovering instances of any kind
+	ConsulAddress                              string                        // Address where Consul HTTP api is found. Example: 127.0.0.1:8500
+	ConsulScheme                               string                        // Scheme (http or https) for Consul
+	ConsulAclToken                             string                        // ACL token used to write to Consul KV
+	ConsulCrossDataCenterDistribution          bool                          // should orchestrator automatically auto-deduce all consul DCs and write KVs in all DCs
+	ZkAddress                                  string                        // UNSUPPERTED YET. Address where (single or multiple) ZooKeeper servers are found, in `srv1[:port1][,srv2[:port2]...]` format. Default port is 2181. Example: srv-a,srv-b:12181,srv-c
+	KVClusterMasterPrefix                      string                        // Prefix to use for clusters' masters entries in KV stores (internal, consul, ZK), default: "mysql/master"
+	KVPublishReplicaPools                      bool                          // When true, orchestrator publishes each cluster's replica pool (replicas with lag, data center, status and traffic weight) to KV stores
+	KVClusterReplicasPrefix                    string                        // Prefix to use for clusters' replica pools entries in KV stores, default: "mysql/replicas"
+	ReplicaPoolMaxLagSeconds                   int                           // Replicas lagging more than this many seconds are excluded from replica pools (weight 0). When 0, ReasonableReplicationLagSeconds applies
+	ProxySQLAdminAddresses                     []string                      // ProxySQL admin interfaces (host:port) which orchestrator updates upon master failover. Empty disables ProxySQL integration
+	ProxySQLAdminUser                          string                        // User for ProxySQL admin interfaces
+	ProxySQLAdminPassword                      string                        // Password for ProxySQL admin interfaces
+	ProxySQLHostgroups                         map[string]ProxySQLHostgroups // Cluster alias to writer/reader hostgroups. Only clusters listed here are managed in ProxySQL
+	ProxySQLSyncReaderHostgroups               bool                          // When true, reader hostgroups are kept in sync with clusters' healthy replicas, weighted by lag (see ReplicaPoolMaxLagSeconds)
+	WebMessage                                 string                        // If provided, will be shown on all web pages below the title bar
+	MaxConcurrentReplicaOperations             int                           // Maximum number of concurrent operations on replicas
+	ClusterConfigOverrides                     []ClusterConfigOverride       // Per cluster (by alias or cluster name pattern) overrides of recovery settings; see ClusterOverridableSettings. Applied in order, such that later overrides win
+	StrictConfigValidation                     bool                          // When true, configuration files with unknown keys, unknown hook placeholders, uncompilable filters or unsafe raft setup fail reading, rather than be ignored. See validate-config command
+
+	clusterConfigs          map[string]*Configuration // Effective configuration per cluster, as resolved by ForCluster
+	hostnameResolvePatterns []HostnameResolvePattern  // HostnameResolveMethodsByPattern, compiled
+}
+
+// HostnameResolvePattern is a compiled HostnameResolveMethodsByPattern entry
+type HostnameResolvePattern struct {
+	Regexp *regexp.Regexp
+	Method string // Lower case
 }
 
 // ToJSONString will marshal this configuration as JSON
@@ -279,28 +345,36 @@ var readFileNames []string
 
 func newConfiguration() *Configuration {
 	return &Configuration{
-		Debug:                                      false,
-		EnableSyslog:                               false,
-		ListenAddress:                              ":3000",
-		ListenSocket:                               "",
-		HTTPAdvertise:                              "",
-		AgentsServerPort:                           ":3001",
-		StatusEndpoint:                             "/api/status",
-		StatusOUVerify:                             false,
-		BackendDB:                                  "mysql",
-		SQLite3DataFile:                            "",
-		SkipOrchestratorDatabaseUpdate:             false,
-		PanicIfDifferentDatabaseDeploy:             false,
-		RaftBind:                                   "127.0.0.1:10008",
-		RaftAdvertise:                              "",
-		RaftDataDir:                                "",
-		DefaultRaftPort:                            10008,
-		RaftNodes:                                  []string{},
-		ExpectFailureAnalysisConcensus:             true,
-		MySQLOrchestratorMaxPoolConnections:        128, // limit concurrent conns to backend DB
-		MySQLOrchestratorPort:                      3306,
-		MySQLTopologyUseMutualTLS:                  false,
-		MySQLTopologyUseMixedTLS:                   true,
+		Debug:                                  false,
+		EnableSyslog:                           false,
+		ListenAddress:                          ":3000",
+		ListenSocket:                           "",
+		HTTPAdvertise:                          "",
+		AgentsServerPort:                       ":3001",
+		StatusEndpoint:                         "/api/status",
+		StatusOUVerify:                         false,
+		BackendDB:                              "mysql",
+		SQLite3DataFile:                        "",
+		SkipOrchestratorDatabaseUpdate:         false,
+		PanicIfDifferentDatabaseDeploy:         false,
+		RaftBind:                               "127.0.0.1:10008",
+		RaftAdvertise:                          "",
+		RaftDataDir:                            "",
+		DefaultRaftPort:                        10008,
+		RaftNodes:                              []string{},
+		ExpectFailureAnalysisConcensus:         true,
+		MySQLOrchestratorMaxPoolConnections:    128, // limit concurrent conns to backend DB
+		MySQLOrchestratorPort:                  3306,
+		MySQLTopologyUseMutualTLS:              false,
+		MySQLTopologyUseMixedTLS:               true,
+		MySQLTopologyCredentialsProvider:       "",
+		MySQLTopologyCredentialsProviderSource: "",
+		MySQLOrchestratorCredentialsProvider:   "",
+		MySQLOrchestratorCredentialsProviderSource: "",
+		CredentialsProviderHTTPTokenFile:           "",
+		CredentialsProviderHTTPTimeoutSeconds:      5,
+		CredentialsRefreshSeconds:                  300,
+		MySQLTopologyConnectionProfiles:            []TopologyConnectionProfile{},
 		MySQLOrchestratorUseMutualTLS:              false,
 		MySQLConnectTimeoutSeconds:                 2,
 		MySQLOrchestratorReadTimeoutSeconds:        30,
@@ -326,10 +400,19 @@ func newConfiguration() *Configuration {
 		InstanceBulkOperationsWaitTimeoutSeconds:   10,
 		HostnameResolveMethod:                      "default",
 		MySQLHostnameResolveMethod:                 "@@hostname",
+		HostnameResolveMethodsByPattern:            make(map[string]string),
+		HostnameResolveStaticMapFile:               "",
+		HostnameResolveHTTPURL:                     "",
+		HostnameUnresolveHTTPURL:                   "",
+		HostnameResolveHTTPTimeoutSeconds:          2,
 		SkipBinlogServerUnresolveCheck:             true,
 		ExpiryHostnameResolvesMinutes:              60,
 		RejectHostnameResolvePattern:               "",
 		ReasonableReplicationLagSeconds:            10,
+		LongRunningQueriesSampleIntervalSeconds:    0,
+		LongRunningQueriesThresholdSeconds:         60,
+		LongRunningQueriesUserFilters:              []string{},
+		LongRunningQueriesIgnoreUserFilters:        []string{},
 		ProblemIgnoreHostnameFilters:               []string{},
 		VerifyReplicationFilters:                   false,
 		ReasonableMaintenanceReplicationLagSeconds: 20,
@@ -346,6 +429,11 @@ func newConfiguration() *Configuration {
 		AuthUserHeader:                             "X-Forwarded-User",
 		PowerAuthUsers:                             []string{"*"},
 		PowerAuthGroups:                            []string{},
+		OAuthScopes:                                []string{"openid", "profile", "email"},
+		OIDCUsernameClaim:                          "preferred_username",
+		OIDCGroupsClaim:                            "groups",
+		OIDCSessionExpirySeconds:                   8 * 60 * 60,
+		OIDCAPIAudiences:                           []string{},
 		AccessTokenUseExpirySeconds:                60,
 		AccessTokenExpiryMinutes:                   1440,
 		ClusterNameToAlias:                         make(map[string]string),
@@ -376,6 +464,14 @@ func newConfiguration() *Configuration {
 		SSLPrivateKeyFile:                          "",
 		SSLCertFile:                                "",
 		SSLCAFile:                                  "",
+		RemoteAPI:                                  []string{},
+		RemoteAPIUser:                              "",
+		RemoteAPIPassword:                          "",
+		RemoteAPIToken:                             "",
+		RemoteAPISSLCAFile:                         "",
+		RemoteAPISSLCertFile:                       "",
+		RemoteAPISSLPrivateKeyFile:                 "",
+		RemoteAPISSLSkipVerify:                     false,
 		AgentPollMinutes:                           60,
 		UnseenAgentForgetHours:                     6,
 		StaleSeedFailMinutes:                       60,
@@ -397,6 +493,11 @@ func newConfiguration() *Configuration {
 		RecoverIntermediateMasterClusterFilters:    []string{},
 		ProcessesShellCommand:                      "bash",
 		OnFailureDetectionProcesses:                []string{},
+		GracefulMasterTakeoverDrainMode:            "",
+		GracefulMasterTakeoverDrainTimeoutSeconds:  10,
+		GracefulMasterTakeoverDrainMinSeconds:      1,
+		GracefulMasterTakeoverSetSuperReadOnly:     false,
+		GracefulMasterTakeoverAutoRollback:         false,
 		PreGracefulTakeoverProcesses:               []string{},
 		PreFailoverProcesses:                       []string{},
 		PostMasterFailoverProcesses:                []string{},
@@ -405,6 +506,10 @@ func newConfiguration() *Configuration {
 		PostUnsuccessfulFailoverProcesses:          []string{},
 		PostGracefulTakeoverProcesses:              []string{},
 		PostTakeMasterProcesses:                    []string{},
+		RecoveryHookTimeoutSeconds:                 0,
+		RecoveryHookRetries:                        0,
+		RecoveryHookRetryIntervalSeconds:           1,
+		RecoveryHookPolicies:                       map[string]RecoveryHookPolicy{},
 		CoMasterRecoveryMustPromoteOtherCoMaster:   true,
 		DetachLostSlavesAfterMasterFailover:        true,
 		ApplyMySQLPromotionAfterMasterFailover:     true,
@@ -428,8 +533,18 @@ func newConfiguration() *Configuration {
 		ConsulCrossDataCenterDistribution:          false,
 		ZkAddress:                                  "",
 		KVClusterMasterPrefix:                      "mysql/master",
+		KVPublishReplicaPools:                      false,
+		KVClusterReplicasPrefix:                    "mysql/replicas",
+		ReplicaPoolMaxLagSeconds:                   0,
+		ProxySQLAdminAddresses:                     []string{},
+		ProxySQLAdminUser:                          "",
+		ProxySQLAdminPassword:                      "",
+		ProxySQLHostgroups:                         map[string]ProxySQLHostgroups{},
+		ProxySQLSyncReaderHostgroups:               false,
 		WebMessage:                                 "",
 		MaxConcurrentReplicaOperations:             5,
+		ClusterConfigOverrides:                     []ClusterConfigOverride{},
+		StrictConfigValidation:                     false,
 	}
 }
 
@@ -483,6 +598,44 @@ func (this *Configuration) postReadAdjustments() error {
 		}
 	}
 
+	for _, provider := range []string{this.MySQLTopologyCredentialsProvider, this.MySQLOrchestratorCredentialsProvider} {
+		switch strings.ToLower(provider) {
+		case "", "file", "exec", "http":
+		default:
+			return fmt.Errorf("Unknown credentials provider: %s. Expected one of \"\", \"file\", \"exec\", \"http\"", provider)
+		}
+	}
+	if this.MySQLTopologyCredentialsProvider != "" && this.MySQLTopologyCredentialsProviderSource == "" {
+		return fmt.Errorf("MySQLTopologyCredentialsProviderSource must be set when MySQLTopologyCredentialsProvider is %s", this.MySQLTopologyCredentialsProvider)
+	}
+	if this.MySQLOrchestratorCredentialsProvider != "" && this.MySQLOrchestratorCredentialsProviderSource == "" {
+		return fmt.Errorf("MySQLOrchestratorCredentialsProviderSource must be set when MySQLOrchestratorCredentialsProvider is %s", this.MySQLOrchestratorCredentialsProvider)
+	}
+	if this.CredentialsRefreshSeconds <= 0 {
+		this.CredentialsRefreshSeconds = 300
+	}
+	if this.CredentialsProviderHTTPTimeoutSeconds <= 0 {
+		this.CredentialsProviderHTTPTimeoutSeconds = 5
+	}
+
+	switch this.GracefulMasterTakeoverDrainMode {
+	case "", "wait", "kill":
+	default:
+		return fmt.Errorf("GracefulMasterTakeoverDrainMode must be one of \"\", \"wait\", \"kill\"; got %s", this.GracefulMasterTakeoverDrainMode)
+	}
+
+	profileNames := make(map[string]bool)
+	for i := range this.MySQLTopologyConnectionProfiles {
+		profile := &this.MySQLTopologyConnectionProfiles[i]
+		if err := profile.postReadAdjustments(); err != nil {
+			return err
+		}
+		if profileNames[profile.Name] {
+			return fmt.Errorf("MySQLTopologyConnectionProfiles: duplicate profile name %s", profile.Name)
+		}
+		profileNames[profile.Name] = true
+	}
+
 	if this.RecoveryPeriodBlockSeconds == 0 && this.RecoveryPeriodBlockMinutes > 0 {
 		// RecoveryPeriodBlockSeconds is a newer addition that overrides RecoveryPeriodBlockMinutes
 		// The code does not consider RecoveryPeriodBlockMinutes anymore, but RecoveryPeriodBlockMinutes
@@ -513,9 +666,6 @@ func (this *Configuration) postReadAdjustments() error {
 			this.MasterFailoverDetachReplicaMasterHost = true
 		}
 	}
-	if this.FailMasterPromotionIfSQLThreadNotUpToDate && this.DelayMasterPromotionIfSQLThreadNotUpToDate {
-		return fmt.Errorf("Cannot have both FailMasterPromotionIfSQLThreadNotUpToDate and DelayMasterPromotionIfSQLThreadNotUpToDate enabled")
-	}
 	{
 		if this.PostponeReplicaRecoveryOnLagMinutes != 0 && this.PostponeSlaveRecoveryOnLagMinutes != 0 &&
 			this.PostponeReplicaRecoveryOnLagMinutes != this.PostponeSlaveRecoveryOnLagMinutes {
@@ -533,6 +683,25 @@ func (this *Configuration) postReadAdjustments() error {
 		this.URLPrefix = "/" + this.URLPrefix
 	}
 
+	if err := this.SetHostnameResolveMethodsByPattern(this.HostnameResolveMethodsByPattern); err != nil {
+		return err
+	}
+	if this.HostnameResolveHTTPTimeoutSeconds <= 0 {
+		this.HostnameResolveHTTPTimeoutSeconds = 2
+	}
+
+	if this.LongRunningQueriesSampleIntervalSeconds < 0 {
+		return fmt.Errorf("LongRunningQueriesSampleIntervalSeconds must be non-negative")
+	}
+	if this.LongRunningQueriesThresholdSeconds <= 0 {
+		this.LongRunningQueriesThresholdSeconds = 60
+	}
+	for _, pattern := range append(this.LongRunningQueriesUserFilters, this.LongRunningQueriesIgnoreUserFilters...) {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("LongRunningQueries user filters: invalid pattern %s: %+v", pattern, err)
+		}
+	}
+
 	if this.IsSQLite() && this.SQLite3DataFile == "" {
 		return fmt.Errorf("SQLite3DataFile must be set when BackendDB is sqlite3")
 	}
@@ -555,12 +724,38 @@ func (this *Configuration) postReadAdjustments() error {
 		this.KVClusterMasterPrefix = strings.TrimRight(this.KVClusterMasterPrefix, "/")
 		this.KVClusterMasterPrefix = fmt.Sprintf("%s/", this.KVClusterMasterPrefix)
 	}
+	if this.KVClusterReplicasPrefix != "/" {
+		this.KVClusterReplicasPrefix = strings.TrimRight(this.KVClusterReplicasPrefix, "/")
+		this.KVClusterReplicasPrefix = fmt.Sprintf("%s/", this.KVClusterReplicasPrefix)
+	}
+	if err := this.validateClusterOverridableSettings(); err != nil {
+		return err
+	}
+	if len(this.ProxySQLAdminAddresses) > 0 && this.ProxySQLAdminUser == "" {
+		return fmt.Errorf("ProxySQLAdminUser must be defined since ProxySQLAdminAddresses is set")
+	}
+	for clusterAlias, hostgroups := range this.ProxySQLHostgroups {
+		if err := hostgroups.postReadAdjustments(clusterAlias); err != nil {
+			return err
+		}
+	}
+	for i := range this.ClusterConfigOverrides {
+		if err := this.ClusterConfigOverrides[i].postReadAdjustments(this); err != nil {
+			return err
+		}
+	}
+	this.resetClusterConfigs()
 	if this.AutoPseudoGTID {
 		this.PseudoGTIDPattern = "drop view if exists `_pseudo_gtid_`"
 		this.PseudoGTIDPatternIsFixedSubstring = true
 		this.PseudoGTIDMonotonicHint = "asc:"
 		this.DetectPseudoGTIDQuery = SelectTrueQuery
 	}
+	if strings.ToLower(this.AuthenticationMethod) == "oidc" {
+		if err := this.validateOIDC(); err != nil {
+			return err
+		}
+	}
 	if this.HTTPAdvertise != "" {
 		u, err := url.Parse(this.HTTPAdvertise)
 		if err != nil {
@@ -585,6 +780,64 @@ func (this *Configuration) postReadAdjustments() error {
 	return nil
 }
 
+// validateOIDC validates OpenID Connect settings, for AuthenticationMethod "oidc"
+func (this *Configuration) validateOIDC() error {
+	if this.OIDCIssuerURL == "" {
+		return fmt.Errorf("OIDCIssuerURL must be defined since AuthenticationMethod is oidc")
+	}
+	if this.OAuthClientId == "" {
+		return fmt.Errorf("OAuthClientId must be defined since AuthenticationMethod is oidc")
+	}
+	if u, err := url.Parse(this.OIDCRedirectURL); err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("OIDCRedirectURL must be an absolute URL since AuthenticationMethod is oidc; got %s", this.OIDCRedirectURL)
+	}
+	if len(this.OIDCSessionSecret) < 32 {
+		return fmt.Errorf("OIDCSessionSecret must be at least 32 characters long since AuthenticationMethod is oidc")
+	}
+	if this.OIDCSessionExpirySeconds <= 0 {
+		return fmt.Errorf("OIDCSessionExpirySeconds must be positive")
+	}
+	if this.OIDCUsernameClaim == "" {
+		this.OIDCUsernameClaim = "sub"
+	}
+	hasOpenIDScope := false
+	for _, scope := range this.OAuthScopes {
+		if scope == "openid" {
+			hasOpenIDScope = true
+		}
+	}
+	if !hasOpenIDScope {
+		this.OAuthScopes = append([]string{"openid"}, this.OAuthScopes...)
+	}
+	return nil
+}
+
+// SetHostnameResolveMethodsByPattern sets HostnameResolveMethodsByPattern, compiling its patterns once,
+// in lexical order, for HostnameResolvePatterns
+func (this *Configuration) SetHostnameResolveMethodsByPattern(methodsByPattern map[string]string) error {
+	patterns := []string{}
+	for pattern := range methodsByPattern {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	hostnameResolvePatterns := []HostnameResolvePattern{}
+	for _, pattern := range patterns {
+		compiledPattern, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("HostnameResolveMethodsByPattern: invalid pattern %s: %+v", pattern, err)
+		}
+		hostnameResolvePatterns = append(hostnameResolvePatterns, HostnameResolvePattern{Regexp: compiledPattern, Method: strings.ToLower(methodsByPattern[pattern])})
+	}
+	this.HostnameResolveMethodsByPattern = methodsByPattern
+	this.hostnameResolvePatterns = hostnameResolvePatterns
+	return nil
+}
+
+// HostnameResolvePatterns returns the compiled HostnameResolveMethodsByPattern, in lexical order of patterns
+func (this *Configuration) HostnameResolvePatterns() []HostnameResolvePattern {
+	return this.hostnameResolvePatterns
+}
+
 func (this *Configuration) IsSQLite() bool {
 	return strings.Contains(this.BackendDB, "sqlite")
 }
@@ -593,30 +846,77 @@ func (this *Configuration) IsMySQL() bool {
 	return this.BackendDB == "mysql" || this.BackendDB == ""
 }
 
+// GetReplicaPoolMaxLagSeconds returns the lag beyond which replicas are excluded from replica pools.
+// It is derived upon use, such that it follows ReasonableReplicationLagSeconds when not set.
+func (this *Configuration) GetReplicaPoolMaxLagSeconds() int {
+	if this.ReplicaPoolMaxLagSeconds == 0 {
+		return this.ReasonableReplicationLagSeconds
+	}
+	return this.ReplicaPoolMaxLagSeconds
+}
+
 // read reads configuration from given file, or silently skips if the file does not exist.
-// If the file does exist, then it is expected to be in valid JSON format or the function bails out.
+// If the file does exist, then it is expected to be in valid JSON or YAML (by .yaml/.yml extension)
+// format or the function bails out. ORCHESTRATOR_* environment variables override the file's settings.
 func read(fileName string) (*Configuration, error) {
-	file, err := os.Open(fileName)
+	content, err := ioutil.ReadFile(fileName)
 	if err == nil {
-		decoder := json.NewDecoder(file)
-		err := decoder.Decode(Config)
+		content, err := configurationContent(fileName, content)
+		if err == nil {
+			err = json.Unmarshal(content, Config)
+		}
 		if err == nil {
 			log.Infof("Read config: %s", fileName)
 		} else {
 			log.Fatal("Cannot read config file:", fileName, err)
 		}
-		if err := Config.postReadAdjustments(); err != nil {
-			log.Fatale(err)
+		readEnvironment()
+		if Config.StrictConfigValidation {
+			if err := validateRead(fileName, Config); err != nil {
+				log.Fatale(err)
+			}
 		}
 	}
 	return Config, err
 }
 
+// readEnvironment overrides configuration with ORCHESTRATOR_* environment variables, or bails out
+func readEnvironment() {
+	overridden, err := Config.applyEnvironment(os.Environ())
+	if err != nil {
+		log.Fatale(err)
+	}
+	if len(overridden) > 0 {
+		log.Infof("Read config from environment: %s", strings.Join(overridden, ", "))
+	}
+	if err := Config.postReadAdjustments(); err != nil {
+		log.Fatale(err)
+	}
+}
+
+// Locate sets given files as the configuration files, without reading them. Commands validating
+// configuration use it to get hold of configuration files which may well fail reading.
+func Locate(fileNames ...string) {
+	readFileNames = fileNames
+}
+
+// FileNames returns the configuration files, as given to Read, ForceRead or Locate
+func FileNames() []string {
+	return readFileNames
+}
+
 // Read reads configuration from zero, either, some or all given files, in order of input.
 // A file can override configuration provided in previous file.
 func Read(fileNames ...string) *Configuration {
+	anyRead := false
 	for _, fileName := range fileNames {
-		read(fileName)
+		if _, err := read(fileName); err == nil {
+			anyRead = true
+		}
+	}
+	if !anyRead {
+		// Configuration may well be provided by environment alone
+		readEnvironment()
 	}
 	readFileNames = fileNames
 	return Config
@@ -632,14 +932,6 @@ func ForceRead(fileName string) *Configuration {
 	return Config
 }
 
-// Reload re-reads configuration from last used files
-func Reload() *Configuration {
-	for _, fileName := range readFileNames {
-		read(fileName)
-	}
-	return Config
-}
-
 // MarkConfigurationLoaded is called once configuration has first been loaded.
 // Listeners on ConfigurationLoaded will get a notification
 func MarkConfigurationLoaded() {
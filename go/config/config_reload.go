@@ -0,0 +1,324 @@
+/*
+   Copyright 2019 GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/openark/golib/log"
+)
+
+// Statuses of a changed setting in a ReloadReport
+const (
+	SettingApplied         = "applied"
+	SettingRequiresRestart = "requires-restart"
+	SettingFailed          = "failed"
+)
+
+// RestartRequiredSettings are captured once at startup, by listeners, the backend database connection,
+// raft, authentication and others. A reload does not change them: the running value is kept, and the
+// change is reported as requiring restart.
+var RestartRequiredSettings = []string{
+	"Debug",
+	"EnableSyslog",
+	"ListenAddress",
+	"ListenSocket",
+	"HTTPAdvertise",
+	"AgentsServerPort",
+	"ServeAgentsHttp",
+	"AgentsUseSSL",
+	"AgentsUseMutualTLS",
+	"AgentSSLSkipVerify",
+	"AgentSSLPrivateKeyFile",
+	"AgentSSLCertFile",
+	"AgentSSLCAFile",
+	"AgentSSLValidOUs",
+	"UseSSL",
+	"UseMutualTLS",
+	"SSLSkipVerify",
+	"SSLPrivateKeyFile",
+	"SSLCertFile",
+	"SSLCAFile",
+	"SSLValidOUs",
+	"StatusEndpoint",
+	"StatusOUVerify",
+	"URLPrefix",
+	"AuthenticationMethod",
+	"OAuthClientId",
+	"OAuthClientSecret",
+	"OAuthScopes",
+	"OIDCIssuerURL",
+	"OIDCRedirectURL",
+	"OIDCUsernameClaim",
+	"OIDCGroupsClaim",
+	"OIDCSessionSecret",
+	"OIDCSessionExpirySeconds",
+	"OIDCAPIAudiences",
+	"HTTPAuthUser",
+	"HTTPAuthPassword",
+	"BackendDB",
+	"SQLite3DataFile",
+	"SkipOrchestratorDatabaseUpdate",
+	"PanicIfDifferentDatabaseDeploy",
+	"MySQLOrchestratorHost",
+	"MySQLOrchestratorPort",
+	"MySQLOrchestratorDatabase",
+	"MySQLOrchestratorMaxPoolConnections",
+	"MySQLOrchestratorReadTimeoutSeconds",
+	"MySQLOrchestratorSSLPrivateKeyFile",
+	"MySQLOrchestratorSSLCertFile",
+	"MySQLOrchestratorSSLCAFile",
+	"MySQLOrchestratorSSLSkipVerify",
+	"MySQLOrchestratorUseMutualTLS",
+	"RaftEnabled",
+	"RaftBind",
+	"RaftAdvertise",
+	"RaftDataDir",
+	"DefaultRaftPort",
+	"RaftNodes",
+	"BufferInstanceWrites",
+	"InstanceWriteBufferSize",
+	"InstanceFlushIntervalMilliseconds",
+	"ExpiryHostnameResolvesMinutes",
+	"TLSCacheTTLFactor",
+	"AuditToSyslog",
+}
+
+// ReloadedSetting tells what became of a setting changed by a reload
+type ReloadedSetting struct {
+	Name      string
+	Status    string // SettingApplied, SettingRequiresRestart or SettingFailed
+	Subsystem string // The subsystem re-initialized upon the change, if any
+	Error     string
+}
+
+// ReloadReport describes a configuration reload. Only names of changed settings are listed;
+// values are not, as they may be secrets.
+type ReloadReport struct {
+	Timestamp time.Time
+	Trigger   string
+	FileNames []string
+	Success   bool
+	Error     string
+	Settings  []ReloadedSetting
+}
+
+// reloadSubscription re-initializes a subsystem once any of its settings changes
+type reloadSubscription struct {
+	subsystem string
+	settings  []string
+	handler   func() error
+}
+
+// reloadMutex serializes reloads, and guards subscriptions and the last report
+var reloadMutex sync.Mutex
+var reloadSubscriptions []reloadSubscription
+var lastReloadReport *ReloadReport
+
+// SubscribeReload registers a handler, re-initializing given subsystem, to be called after a reload
+// changes any of given settings. The handler runs once per reload, with the new configuration in place.
+func SubscribeReload(subsystem string, settings []string, handler func() error) {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+
+	fields := configurationFields()
+	for _, setting := range settings {
+		if _, found := fields[setting]; !found {
+			log.Errorf("SubscribeReload: %s: unknown setting %s", subsystem, setting)
+		}
+	}
+	reloadSubscriptions = append(reloadSubscriptions, reloadSubscription{subsystem: subsystem, settings: settings, handler: handler})
+}
+
+// LastReloadReport returns the report of the last reload, or nil if configuration was not reloaded
+func LastReloadReport() *ReloadReport {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+
+	return lastReloadReport
+}
+
+// copyConfiguration returns a deep copy of given configuration, such that reading onto the copy does
+// not touch slices and maps of the original
+func copyConfiguration(configuration *Configuration) (*Configuration, error) {
+	copied := &Configuration{}
+	content, err := json.Marshal(configuration)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, copied); err != nil {
+		return nil, err
+	}
+	return copied, nil
+}
+
+// readReloaded reads configuration files onto a copy of given configuration, without touching it.
+// Unlike initial read, errors are returned rather than bail out.
+func readReloaded(configuration *Configuration, fileNames []string) (*Configuration, error) {
+	reloaded, err := copyConfiguration(configuration)
+	if err != nil {
+		return nil, err
+	}
+	for _, fileName := range fileNames {
+		content, err := ioutil.ReadFile(fileName)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err == nil {
+			content, err = configurationContent(fileName, content)
+		}
+		if err == nil {
+			err = json.Unmarshal(content, reloaded)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Cannot read config file %s: %+v", fileName, err)
+		}
+	}
+	if _, err := reloaded.applyEnvironment(os.Environ()); err != nil {
+		return nil, err
+	}
+	if err := reloaded.postReadAdjustments(); err != nil {
+		return nil, err
+	}
+	if reloaded.StrictConfigValidation {
+		for _, fileName := range fileNames {
+			if _, err := os.Stat(fileName); os.IsNotExist(err) {
+				continue
+			}
+			if err := validateRead(fileName, reloaded); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return reloaded, nil
+}
+
+// changedSettings lists, sorted, the settings whose values differ between given configurations
+func changedSettings(configuration *Configuration, other *Configuration) (changed []string) {
+	configurationValue := reflect.ValueOf(configuration).Elem()
+	otherConfigurationValue := reflect.ValueOf(other).Elem()
+	for settingName := range configurationFields() {
+		// Compared by JSON, ignoring internal state such as compiled regexps
+		value, _ := json.Marshal(configurationValue.FieldByName(settingName).Interface())
+		otherValue, _ := json.Marshal(otherConfigurationValue.FieldByName(settingName).Interface())
+		if !bytes.Equal(value, otherValue) {
+			changed = append(changed, settingName)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// applyReloaded copies given settings from a reloaded configuration onto this one, leaving any other setting
+// untouched. The copy is made under clusterConfigsMutex, such that per cluster configurations are never
+// resolved off a partial copy, and per cluster configurations resolved before the reload are discarded.
+func (this *Configuration) applyReloaded(reloaded *Configuration, settingNames []string) {
+	clusterConfigsMutex.Lock()
+	defer clusterConfigsMutex.Unlock()
+
+	configurationValue := reflect.ValueOf(this).Elem()
+	reloadedValue := reflect.ValueOf(reloaded).Elem()
+	for _, settingName := range settingNames {
+		configurationValue.FieldByName(settingName).Set(reloadedValue.FieldByName(settingName))
+	}
+	// Compiled patterns: MySQLTopologyConnectionProfiles carry theirs along, HostnameResolveMethodsByPattern does not
+	this.hostnameResolvePatterns = reloaded.hostnameResolvePatterns
+	this.clusterConfigs = nil
+}
+
+// Reload re-reads configuration from last used files, and from the environment. The files are
+// read onto a copy of the running configuration first, such that a broken file leaves configuration
+// intact. Changes to RestartRequiredSettings are not applied. Subsystems subscribed to changed
+// settings via SubscribeReload are then re-initialized. trigger describes what requested the reload.
+func Reload(trigger string) *ReloadReport {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+
+	report := &ReloadReport{
+		Timestamp: time.Now(),
+		Trigger:   trigger,
+		FileNames: readFileNames,
+		Settings:  []ReloadedSetting{},
+	}
+	lastReloadReport = report
+
+	reloaded, err := readReloaded(Config, readFileNames)
+	if err != nil {
+		report.Error = err.Error()
+		log.Errorf("Reload configuration: %s. Configuration is unchanged", report.Error)
+		return report
+	}
+	changed := changedSettings(Config, reloaded)
+
+	restartRequired := map[string]bool{}
+	for _, settingName := range RestartRequiredSettings {
+		restartRequired[settingName] = true
+	}
+	applied := []string{}
+	settings := map[string]*ReloadedSetting{}
+	for _, settingName := range changed {
+		setting := &ReloadedSetting{Name: settingName, Status: SettingApplied}
+		if restartRequired[settingName] {
+			setting.Status = SettingRequiresRestart
+		} else {
+			applied = append(applied, settingName)
+		}
+		settings[settingName] = setting
+	}
+	Config.applyReloaded(reloaded, applied)
+	for _, subscription := range reloadSubscriptions {
+		subscribed := []*ReloadedSetting{}
+		for _, settingName := range subscription.settings {
+			if setting, found := settings[settingName]; found {
+				subscribed = append(subscribed, setting)
+			}
+		}
+		if len(subscribed) == 0 {
+			continue
+		}
+		handlerErr := subscription.handler()
+		if handlerErr != nil {
+			log.Errorf("Reload configuration: %s: %+v", subscription.subsystem, handlerErr)
+		}
+		for _, setting := range subscribed {
+			setting.Subsystem = subscription.subsystem
+			if handlerErr != nil {
+				setting.Status = SettingFailed
+				setting.Error = handlerErr.Error()
+			}
+		}
+	}
+
+	report.Success = true
+	for _, settingName := range changed {
+		setting := settings[settingName]
+		if setting.Status == SettingFailed {
+			report.Success = false
+		}
+		report.Settings = append(report.Settings, *setting)
+	}
+	log.Infof("Reload configuration: %d settings changed", len(changed))
+	return report
+}
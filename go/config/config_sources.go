@@ -0,0 +1,236 @@
+/*
+   Copyright 2019 GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v2"
+)
+
+// EnvironmentVariablePrefix prefixes environment variables overriding configuration settings
+const EnvironmentVariablePrefix = "ORCHESTRATOR_"
+
+// redactedValue replaces secrets in dumped configuration
+const redactedValue = "<redacted>"
+
+// secretKeyRegexp matches configuration keys, at any depth, whose values are secrets
+var secretKeyRegexp = regexp.MustCompile(`(Password|Secret|Token)$`)
+
+// isYAMLFile checks whether a configuration file is in YAML format, based on its extension
+func isYAMLFile(fileName string) bool {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".yaml", ".yml":
+		return true
+	}
+	return false
+}
+
+// yamlValueToJSONValue converts a value decoded from YAML, whose maps may have any type of keys,
+// into a value JSON can encode
+func yamlValueToJSONValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[interface{}]interface{}:
+		jsonMap := map[string]interface{}{}
+		for key, mapValue := range value {
+			jsonMap[fmt.Sprintf("%v", key)] = yamlValueToJSONValue(mapValue)
+		}
+		return jsonMap
+	case []interface{}:
+		jsonSlice := []interface{}{}
+		for _, sliceValue := range value {
+			jsonSlice = append(jsonSlice, yamlValueToJSONValue(sliceValue))
+		}
+		return jsonSlice
+	}
+	return value
+}
+
+// yamlToJSON converts YAML configuration into JSON, such that it is decoded and validated
+// exactly as JSON configuration is
+func yamlToJSON(content []byte) ([]byte, error) {
+	var value interface{}
+	if err := yaml.Unmarshal(content, &value); err != nil {
+		return nil, err
+	}
+	if value == nil {
+		// Empty file
+		return []byte("{}"), nil
+	}
+	return json.Marshal(yamlValueToJSONValue(value))
+}
+
+// configurationContent returns the content of a configuration file as JSON
+func configurationContent(fileName string, content []byte) ([]byte, error) {
+	if isYAMLFile(fileName) {
+		return yamlToJSON(content)
+	}
+	return content, nil
+}
+
+// environmentVariableAcronyms are kept as whole words in environment variable names. Longer acronyms
+// are listed ahead of the acronyms they start with.
+var environmentVariableAcronyms = []string{"ProxySQL", "MySQL", "SQLite", "HTTP", "SQL", "TLS", "SSL", "API"}
+
+// acronymAt returns the acronym starting at given position, if any. An acronym followed by a lowercase
+// letter is part of a longer word.
+func acronymAt(runes []rune, i int) string {
+	for _, acronym := range environmentVariableAcronyms {
+		end := i + len(acronym)
+		if end <= len(runes) && string(runes[i:end]) == acronym && (end == len(runes) || !unicode.IsLower(runes[end])) {
+			return acronym
+		}
+	}
+	return ""
+}
+
+// EnvironmentVariableName returns the name of the environment variable overriding given setting,
+// e.g. ORCHESTRATOR_RECOVERY_PERIOD_BLOCK_SECONDS for RecoveryPeriodBlockSeconds. Words are split
+// on case changes, keeping acronyms whole: MySQLTopologyUser is ORCHESTRATOR_MYSQL_TOPOLOGY_USER.
+func EnvironmentVariableName(settingName string) string {
+	runes := []rune(settingName)
+	words := []string{}
+	wordStart := 0
+	for i := 0; i < len(runes); {
+		if acronym := acronymAt(runes, i); acronym != "" {
+			if i > wordStart {
+				words = append(words, string(runes[wordStart:i]))
+			}
+			wordStart = i
+			i += len(acronym)
+			if i < len(runes) && unicode.IsUpper(runes[i]) {
+				words = append(words, acronym)
+				wordStart = i
+			}
+			continue
+		}
+		if i > wordStart && unicode.IsUpper(runes[i]) {
+			previousIsLower := unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])
+			nextIsLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if previousIsLower || (unicode.IsUpper(runes[i-1]) && nextIsLower) {
+				words = append(words, string(runes[wordStart:i]))
+				wordStart = i
+			}
+		}
+		i++
+	}
+	words = append(words, string(runes[wordStart:]))
+	return EnvironmentVariablePrefix + strings.ToUpper(strings.Join(words, "_"))
+}
+
+// environmentValue decodes the value of an environment variable into a setting of given type.
+// Strings are taken as is; string lists are either a JSON list or comma delimited; any other
+// type is expected in JSON format.
+func environmentValue(value string, settingType reflect.Type) (reflect.Value, error) {
+	decoded := reflect.New(settingType)
+	switch {
+	case settingType.Kind() == reflect.String:
+		decoded.Elem().SetString(value)
+	case settingType.Kind() == reflect.Slice && settingType.Elem().Kind() == reflect.String && !strings.HasPrefix(strings.TrimSpace(value), "["):
+		tokens := []string{}
+		for _, token := range strings.Split(value, ",") {
+			if token = strings.TrimSpace(token); token != "" {
+				tokens = append(tokens, token)
+			}
+		}
+		decoded.Elem().Set(reflect.ValueOf(tokens).Convert(settingType))
+	default:
+		if err := json.Unmarshal([]byte(value), decoded.Interface()); err != nil {
+			return decoded, err
+		}
+	}
+	return decoded.Elem(), nil
+}
+
+// applyEnvironment overrides settings with ORCHESTRATOR_* variables found in given environment,
+// formatted as by os.Environ(). Variables not matching any setting are ignored. It returns the
+// names of overridden settings.
+func (this *Configuration) applyEnvironment(environ []string) (overridden []string, err error) {
+	variables := map[string]string{}
+	for _, variable := range environ {
+		tokens := strings.SplitN(variable, "=", 2)
+		if len(tokens) == 2 && strings.HasPrefix(tokens[0], EnvironmentVariablePrefix) {
+			variables[tokens[0]] = tokens[1]
+		}
+	}
+	if len(variables) == 0 {
+		return overridden, nil
+	}
+	fields := configurationFields()
+	settingNames := []string{}
+	for settingName := range fields {
+		settingNames = append(settingNames, settingName)
+	}
+	sort.Strings(settingNames)
+
+	configurationValue := reflect.ValueOf(this).Elem()
+	for _, settingName := range settingNames {
+		variableName := EnvironmentVariableName(settingName)
+		value, found := variables[variableName]
+		if !found {
+			continue
+		}
+		decoded, err := environmentValue(value, fields[settingName])
+		if err != nil {
+			return overridden, fmt.Errorf("%s: expected %s: %+v", variableName, fields[settingName].String(), err)
+		}
+		configurationValue.FieldByName(settingName).Set(decoded)
+		overridden = append(overridden, settingName)
+	}
+	return overridden, nil
+}
+
+// redact replaces non empty secret values, at any depth, of a JSON decoded value
+func redact(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, mapValue := range value {
+			if stringValue, ok := mapValue.(string); ok && stringValue != "" && secretKeyRegexp.MatchString(key) {
+				value[key] = redactedValue
+			} else {
+				value[key] = redact(mapValue)
+			}
+		}
+	case []interface{}:
+		for i := range value {
+			value[i] = redact(value[i])
+		}
+	}
+	return value
+}
+
+// ToRedactedJSONString marshals this configuration as JSON, with passwords, secrets and tokens redacted
+func (this *Configuration) ToRedactedJSONString() string {
+	var value interface{}
+	if err := json.Unmarshal([]byte(this.ToJSONString()), &value); err != nil {
+		return ""
+	}
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(redact(value))
+	return strings.TrimSpace(buffer.String())
+}
@@ -1,6 +1,11 @@
 package config
 
 import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
 	"testing"
 
 	"github.com/openark/golib/log"
@@ -215,3 +220,609 @@ func TestHttpAdvertise(t *testing.T) {
 		test.S(t).ExpectNotNil(err)
 	}
 }
+
+func TestTopologyConnectionProfiles(t *testing.T) {
+	{
+		c := newConfiguration()
+		c.MySQLTopologyConnectionProfiles = []TopologyConnectionProfile{
+			{Name: "wan", HostnamePattern: "[.]remote[.]example[.]com$", TLSMode: "Mutual", ReadTimeoutSeconds: 60},
+			{Name: "payments", ClusterNamePattern: "^payments", User: "payments_orc", Password: "secret"},
+		}
+		err := c.postReadAdjustments()
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(c.MySQLTopologyConnectionProfiles[0].TLSMode, TopologyTLSModeMutual)
+		test.S(t).ExpectTrue(c.HasClusterNameTopologyConnectionProfiles())
+
+		test.S(t).ExpectEquals(c.GetTopologyConnectionProfile("db1.remote.example.com", "").Name, "wan")
+		test.S(t).ExpectEquals(c.GetTopologyConnectionProfile("db1.example.com", "payments-main:3306").Name, "payments")
+		test.S(t).ExpectTrue(c.GetTopologyConnectionProfile("db1.example.com", "") == nil)
+		test.S(t).ExpectTrue(c.GetTopologyConnectionProfile("db1.example.com", "other:3306") == nil)
+	}
+	{
+		c := newConfiguration()
+		c.MySQLTopologyConnectionProfiles = []TopologyConnectionProfile{
+			{Name: "nopattern"},
+		}
+		err := c.postReadAdjustments()
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		c := newConfiguration()
+		c.MySQLTopologyConnectionProfiles = []TopologyConnectionProfile{
+			{Name: "dup", HostnamePattern: "a"},
+			{Name: "dup", HostnamePattern: "b"},
+		}
+		err := c.postReadAdjustments()
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		c := newConfiguration()
+		c.MySQLTopologyConnectionProfiles = []TopologyConnectionProfile{
+			{Name: "tls", HostnamePattern: "a", TLSMode: "sometimes"},
+		}
+		err := c.postReadAdjustments()
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		c := newConfiguration()
+		c.MySQLTopologyConnectionProfiles = []TopologyConnectionProfile{
+			{Name: "broken", ClusterNamePattern: "^payments("},
+		}
+		err := c.postReadAdjustments()
+		test.S(t).ExpectNotNil(err)
+	}
+}
+
+func TestGetReplicaPoolMaxLagSeconds(t *testing.T) {
+	c := newConfiguration()
+	c.ReasonableReplicationLagSeconds = 10
+	err := c.postReadAdjustments()
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(c.GetReplicaPoolMaxLagSeconds(), 10)
+
+	// Follows ReasonableReplicationLagSeconds as it changes, e.g. upon reload
+	c.ReasonableReplicationLagSeconds = 20
+	test.S(t).ExpectEquals(c.GetReplicaPoolMaxLagSeconds(), 20)
+
+	c.ReplicaPoolMaxLagSeconds = 5
+	test.S(t).ExpectEquals(c.GetReplicaPoolMaxLagSeconds(), 5)
+}
+
+func TestRecoveryHookPolicies(t *testing.T) {
+	intSetting := func(i int) *int { return &i }
+	{
+		c := newConfiguration()
+		c.RecoveryHookTimeoutSeconds = 60
+		c.RecoveryHookRetries = 1
+		c.RecoveryHookPolicies = map[string]RecoveryHookPolicy{
+			"PreFailoverProcesses":  {TimeoutSeconds: intSetting(10), Retries: intSetting(3)},
+			"PostFailoverProcesses": {TimeoutSeconds: intSetting(0), Retries: intSetting(0)},
+		}
+		err := c.postReadAdjustments()
+		test.S(t).ExpectNil(err)
+
+		policy := c.GetRecoveryHookPolicy("PreFailoverProcesses")
+		test.S(t).ExpectEquals(policy.TimeoutSeconds, 10)
+		test.S(t).ExpectEquals(policy.Retries, 3)
+		test.S(t).ExpectEquals(policy.RetryIntervalSeconds, 1)
+
+		// Explicit zero disables the timeout and retries
+		policy = c.GetRecoveryHookPolicy("PostFailoverProcesses")
+		test.S(t).ExpectEquals(policy.TimeoutSeconds, 0)
+		test.S(t).ExpectEquals(policy.Retries, 0)
+
+		policy = c.GetRecoveryHookPolicy("PostMasterFailoverProcesses")
+		test.S(t).ExpectEquals(policy.TimeoutSeconds, 60)
+		test.S(t).ExpectEquals(policy.Retries, 1)
+	}
+	{
+		c := newConfiguration()
+		c.RecoveryHookPolicies = map[string]RecoveryHookPolicy{
+			"NoSuchProcesses": {TimeoutSeconds: intSetting(10)},
+		}
+		err := c.postReadAdjustments()
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		c := newConfiguration()
+		c.RecoveryHookPolicies = map[string]RecoveryHookPolicy{
+			"PreFailoverProcesses": {Retries: intSetting(-1)},
+		}
+		err := c.postReadAdjustments()
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		c := newConfiguration()
+		c.RecoveryHookTimeoutSeconds = -1
+		err := c.postReadAdjustments()
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		// Policies read from JSON: an omitted setting inherits, a given zero applies
+		c := newConfiguration()
+		c.RecoveryHookRetries = 2
+		err := json.Unmarshal([]byte(`{"RecoveryHookPolicies": {"PreFailoverProcesses": {"Retries": 0}}}`), c)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(c.GetRecoveryHookPolicy("PreFailoverProcesses").Retries, 0)
+		test.S(t).ExpectEquals(c.GetRecoveryHookPolicy("PreFailoverProcesses").TimeoutSeconds, c.RecoveryHookTimeoutSeconds)
+	}
+}
+
+func TestProxySQLHostgroups(t *testing.T) {
+	{
+		c := newConfiguration()
+		c.ProxySQLAdminAddresses = []string{"proxysql-1:6032"}
+		c.ProxySQLAdminUser = "admin"
+		c.ProxySQLHostgroups = map[string]ProxySQLHostgroups{
+			"mycluster": {WriterHostgroup: 10, ReaderHostgroup: 20},
+		}
+		err := c.postReadAdjustments()
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectTrue(c.IsProxySQLEnabled())
+
+		hostgroups, found := c.GetProxySQLHostgroups("mycluster")
+		test.S(t).ExpectTrue(found)
+		test.S(t).ExpectEquals(hostgroups.WriterHostgroup, 10)
+		test.S(t).ExpectEquals(hostgroups.ReaderHostgroup, 20)
+
+		_, found = c.GetProxySQLHostgroups("othercluster")
+		test.S(t).ExpectFalse(found)
+	}
+	{
+		c := newConfiguration()
+		c.ProxySQLAdminAddresses = []string{"proxysql-1:6032"}
+		err := c.postReadAdjustments()
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		c := newConfiguration()
+		c.ProxySQLHostgroups = map[string]ProxySQLHostgroups{
+			"mycluster": {WriterHostgroup: 10},
+		}
+		err := c.postReadAdjustments()
+		test.S(t).ExpectNil(err)
+		c.ProxySQLHostgroups["mycluster"] = ProxySQLHostgroups{WriterHostgroup: 10, ReaderHostgroup: 10}
+		err = c.postReadAdjustments()
+		test.S(t).ExpectNotNil(err)
+		test.S(t).ExpectFalse(c.IsProxySQLEnabled())
+	}
+}
+
+func TestClusterConfigOverrides(t *testing.T) {
+	{
+		c := newConfiguration()
+		test.S(t).ExpectNil(c.postReadAdjustments())
+		test.S(t).ExpectTrue(c.ForCluster("db-1:3306", "mycluster") == c)
+	}
+	{
+		c := newConfiguration()
+		c.PreventCrossDataCenterMasterFailover = true
+		c.PostFailoverProcesses = []string{"global-hook"}
+		c.ClusterConfigOverrides = []ClusterConfigOverride{
+			{ClusterNamePattern: "^staging-", Settings: map[string]json.RawMessage{
+				"PreventCrossDataCenterMasterFailover": json.RawMessage(`false`),
+				"RecoveryPeriodBlockSeconds":           json.RawMessage(`600`),
+			}},
+			{ClusterAlias: "payments", Settings: map[string]json.RawMessage{
+				"RecoveryPeriodBlockSeconds": json.RawMessage(`60`),
+				"PostFailoverProcesses":      json.RawMessage(`["payments-hook"]`),
+			}},
+		}
+		test.S(t).ExpectNil(c.postReadAdjustments())
+
+		staging := c.ForCluster("staging-db-1:3306", "staging")
+		test.S(t).ExpectFalse(staging.PreventCrossDataCenterMasterFailover)
+		test.S(t).ExpectEquals(staging.RecoveryPeriodBlockSeconds, 600)
+		test.S(t).ExpectTrue(c.ForCluster("staging-db-1:3306", "staging") == staging)
+
+		payments := c.ForCluster("staging-db-2:3306", "payments")
+		test.S(t).ExpectFalse(payments.PreventCrossDataCenterMasterFailover)
+		test.S(t).ExpectEquals(payments.RecoveryPeriodBlockSeconds, 60)
+		test.S(t).ExpectEquals(len(payments.PostFailoverProcesses), 1)
+		test.S(t).ExpectEquals(payments.PostFailoverProcesses[0], "payments-hook")
+
+		other := c.ForCluster("db-3:3306", "other")
+		test.S(t).ExpectTrue(other.PreventCrossDataCenterMasterFailover)
+		test.S(t).ExpectEquals(other.RecoveryPeriodBlockSeconds, c.RecoveryPeriodBlockSeconds)
+		test.S(t).ExpectEquals(c.PostFailoverProcesses[0], "global-hook")
+
+		for _, setting := range c.GetClusterConfigSettings("staging-db-2:3306", "payments") {
+			switch setting.Name {
+			case "RecoveryPeriodBlockSeconds":
+				test.S(t).ExpectEquals(setting.Value, 60)
+				test.S(t).ExpectEquals(setting.Source, "ClusterAlias=payments")
+			case "PreventCrossDataCenterMasterFailover":
+				test.S(t).ExpectEquals(setting.Source, "ClusterNamePattern=^staging-")
+			case "ReasonableReplicationLagSeconds":
+				test.S(t).ExpectEquals(setting.Source, "global")
+			}
+		}
+	}
+	{
+		c := newConfiguration()
+		c.ClusterConfigOverrides = []ClusterConfigOverride{
+			{ClusterAlias: "payments", ClusterNamePattern: "^payments", Settings: map[string]json.RawMessage{}},
+		}
+		test.S(t).ExpectNotNil(c.postReadAdjustments())
+	}
+	{
+		c := newConfiguration()
+		c.ClusterConfigOverrides = []ClusterConfigOverride{
+			{ClusterNamePattern: "(", Settings: map[string]json.RawMessage{}},
+		}
+		test.S(t).ExpectNotNil(c.postReadAdjustments())
+	}
+	{
+		c := newConfiguration()
+		c.ClusterConfigOverrides = []ClusterConfigOverride{
+			{ClusterAlias: "payments", Settings: map[string]json.RawMessage{"MySQLTopologyUser": json.RawMessage(`"root"`)}},
+		}
+		test.S(t).ExpectNotNil(c.postReadAdjustments())
+	}
+	{
+		c := newConfiguration()
+		c.ClusterConfigOverrides = []ClusterConfigOverride{
+			{ClusterAlias: "payments", Settings: map[string]json.RawMessage{"RecoveryPeriodBlockSeconds": json.RawMessage(`"soon"`)}},
+		}
+		test.S(t).ExpectNotNil(c.postReadAdjustments())
+	}
+	{
+		c := newConfiguration()
+		c.ClusterConfigOverrides = []ClusterConfigOverride{
+			{ClusterAlias: "payments", Settings: map[string]json.RawMessage{"RecoveryHookRetries": json.RawMessage(`-1`)}},
+		}
+		test.S(t).ExpectNotNil(c.postReadAdjustments())
+	}
+	{
+		c := newConfiguration()
+		c.FailMasterPromotionIfSQLThreadNotUpToDate = true
+		c.ClusterConfigOverrides = []ClusterConfigOverride{
+			{ClusterAlias: "payments", Settings: map[string]json.RawMessage{"DelayMasterPromotionIfSQLThreadNotUpToDate": json.RawMessage(`true`)}},
+		}
+		test.S(t).ExpectNotNil(c.postReadAdjustments())
+	}
+	{
+		c := newConfiguration()
+		c.ClusterConfigOverrides = []ClusterConfigOverride{
+			{ClusterAlias: "payments", Settings: map[string]json.RawMessage{"FailMasterPromotionIfSQLThreadNotUpToDate": json.RawMessage(`true`)}},
+			{ClusterNamePattern: "^payments", Settings: map[string]json.RawMessage{"DelayMasterPromotionIfSQLThreadNotUpToDate": json.RawMessage(`true`)}},
+		}
+		test.S(t).ExpectNil(c.postReadAdjustments())
+
+		payments := c.ForCluster("payments-db-1:3306", "payments")
+		test.S(t).ExpectFalse(payments.FailMasterPromotionIfSQLThreadNotUpToDate)
+		test.S(t).ExpectFalse(payments.DelayMasterPromotionIfSQLThreadNotUpToDate)
+		test.S(t).ExpectTrue(c.ForCluster("db-1:3306", "payments").FailMasterPromotionIfSQLThreadNotUpToDate)
+	}
+}
+
+func writeTestConfigFile(t *testing.T, content string) string {
+	file, err := ioutil.TempFile("", "orchestrator-test-*.conf.json")
+	test.S(t).ExpectNil(err)
+	defer file.Close()
+	_, err = file.WriteString(content)
+	test.S(t).ExpectNil(err)
+	return file.Name()
+}
+
+func validationIssuesByKey(validation *ConfigValidation) map[string]ValidationIssue {
+	issues := map[string]ValidationIssue{}
+	for _, issue := range validation.Issues {
+		issues[issue.Key] = issue
+	}
+	return issues
+}
+
+func TestValidateFile(t *testing.T) {
+	{
+		fileName := writeTestConfigFile(t, `{"Debug": true, "InstancePollSeconds": 7}`)
+		defer os.Remove(fileName)
+		validation := ValidateFile(fileName)
+		test.S(t).ExpectTrue(validation.Valid)
+		test.S(t).ExpectEquals(len(validation.Issues), 0)
+	}
+	{
+		fileName := writeTestConfigFile(t, `{
+			"MySQLTopolgyUser": "orc",
+			"InstancePollSeconds": "7",
+			"BufferBinlogEvents": true,
+			"debug": true,
+			"NoSuchThingWhatsoever": 1
+		}`)
+		defer os.Remove(fileName)
+		validation := ValidateFile(fileName)
+		test.S(t).ExpectFalse(validation.Valid)
+		test.S(t).ExpectTrue(validation.HasWarnings())
+		issues := validationIssuesByKey(validation)
+		test.S(t).ExpectEquals(len(issues), 5)
+		test.S(t).ExpectEquals(issues["MySQLTopolgyUser"].Message, "unknown key; did you mean MySQLTopologyUser?")
+		test.S(t).ExpectEquals(issues["NoSuchThingWhatsoever"].Message, "unknown key")
+		test.S(t).ExpectEquals(issues["InstancePollSeconds"].Severity, ValidationError)
+		test.S(t).ExpectEquals(issues["BufferBinlogEvents"].Severity, ValidationWarning)
+		test.S(t).ExpectEquals(issues["debug"].Severity, ValidationWarning)
+	}
+	{
+		fileName := writeTestConfigFile(t, `{"RaftEnabled": true, "RaftDataDir": "/tmp/raft", "RaftBind": "10.0.0.1", "RaftNodes": ["10.0.0.1", "10.0.0.2"],
+			"DiscoveryIgnoreHostnameFilters": ["("],
+			"RecoverMasterClusterFilters": ["*", "alias=payments", "alias~=["],
+			"PostFailoverProcesses": ["echo {failedHost} {failedhost} ${HOME}"],
+			"PostTakeMasterProcesses": ["echo {successorHost}"],
+			"ClusterConfigOverrides": [{"ClusterAlias": "payments", "Settings": {"PostMasterFailoverProcesses": ["echo {sucessorHost}"]}}]}`)
+		defer os.Remove(fileName)
+		validation := ValidateFile(fileName)
+		test.S(t).ExpectFalse(validation.Valid)
+		issues := validationIssuesByKey(validation)
+		test.S(t).ExpectEquals(len(issues), 6)
+		test.S(t).ExpectEquals(issues["PostTakeMasterProcesses"].Message, `placeholder {successorHost} is not replaced in "echo {successorHost}"; use the ORC_* environment variables`)
+		test.S(t).ExpectEquals(issues["ClusterConfigOverrides: ClusterAlias=payments: PostMasterFailoverProcesses"].Message, `unknown placeholder {sucessorHost} in "echo {sucessorHost}"`)
+		test.S(t).ExpectEquals(issues["RaftNodes"].Severity, ValidationError)
+		test.S(t).ExpectEquals(issues["DiscoveryIgnoreHostnameFilters"].Severity, ValidationError)
+		test.S(t).ExpectEquals(issues["RecoverMasterClusterFilters"].Severity, ValidationError)
+		test.S(t).ExpectEquals(issues["PostFailoverProcesses"].Message, `unknown placeholder {failedhost} in "echo {failedHost} {failedhost} ${HOME}"`)
+	}
+	{
+		fileName := writeTestConfigFile(t, `{"ProxySQLAdminAddresses": ["proxysql-1:6032"]}`)
+		defer os.Remove(fileName)
+		validation := ValidateFile(fileName)
+		test.S(t).ExpectFalse(validation.Valid)
+		test.S(t).ExpectEquals(len(validation.Issues), 1)
+	}
+	{
+		fileName := writeTestConfigFile(t, "{\n\"Debug\": tru\n}")
+		defer os.Remove(fileName)
+		validation := ValidateFile(fileName)
+		test.S(t).ExpectFalse(validation.Valid)
+		test.S(t).ExpectEquals(len(validation.Issues), 1)
+		test.S(t).ExpectTrue(strings.HasPrefix(validation.Issues[0].Message, "invalid JSON at line 2"))
+	}
+	{
+		validation := ValidateFile("/no/such/orchestrator.conf.json")
+		test.S(t).ExpectFalse(validation.Valid)
+	}
+}
+
+func TestValidateRead(t *testing.T) {
+	fileName := writeTestConfigFile(t, `{"StrictConfigValidation": true, "MySQLTopolgyUser": "orc"}`)
+	defer os.Remove(fileName)
+
+	c := newConfiguration()
+	c.StrictConfigValidation = true
+	test.S(t).ExpectNil(c.postReadAdjustments())
+	err := validateRead(fileName, c)
+	test.S(t).ExpectNotNil(err)
+	test.S(t).ExpectTrue(strings.Contains(err.Error(), "MySQLTopolgyUser: unknown key; did you mean MySQLTopologyUser?"))
+}
+
+func TestEnvironmentVariableName(t *testing.T) {
+	test.S(t).ExpectEquals(EnvironmentVariableName("RecoveryPeriodBlockSeconds"), "ORCHESTRATOR_RECOVERY_PERIOD_BLOCK_SECONDS")
+	test.S(t).ExpectEquals(EnvironmentVariableName("MySQLTopologyUser"), "ORCHESTRATOR_MYSQL_TOPOLOGY_USER")
+	test.S(t).ExpectEquals(EnvironmentVariableName("MySQLTopologySSLCAFile"), "ORCHESTRATOR_MYSQL_TOPOLOGY_SSL_CA_FILE")
+	test.S(t).ExpectEquals(EnvironmentVariableName("MySQLTopologyUseMutualTLS"), "ORCHESTRATOR_MYSQL_TOPOLOGY_USE_MUTUAL_TLS")
+	test.S(t).ExpectEquals(EnvironmentVariableName("FailMasterPromotionIfSQLThreadNotUpToDate"), "ORCHESTRATOR_FAIL_MASTER_PROMOTION_IF_SQL_THREAD_NOT_UP_TO_DATE")
+	test.S(t).ExpectEquals(EnvironmentVariableName("RemoteAPISSLCAFile"), "ORCHESTRATOR_REMOTE_API_SSL_CA_FILE")
+	test.S(t).ExpectEquals(EnvironmentVariableName("ProxySQLAdminUser"), "ORCHESTRATOR_PROXYSQL_ADMIN_USER")
+	test.S(t).ExpectEquals(EnvironmentVariableName("SQLite3DataFile"), "ORCHESTRATOR_SQLITE3_DATA_FILE")
+	test.S(t).ExpectEquals(EnvironmentVariableName("HTTPAdvertise"), "ORCHESTRATOR_HTTP_ADVERTISE")
+	test.S(t).ExpectEquals(EnvironmentVariableName("Debug"), "ORCHESTRATOR_DEBUG")
+	test.S(t).ExpectEquals(EnvironmentVariableName("RaftNodes"), "ORCHESTRATOR_RAFT_NODES")
+}
+
+func TestApplyEnvironment(t *testing.T) {
+	{
+		c := newConfiguration()
+		overridden, err := c.applyEnvironment([]string{
+			"PATH=/usr/bin",
+			"ORCHESTRATOR_API=http://orchestrator:3000/api",
+			"ORCHESTRATOR_RECOVERY_PERIOD_BLOCK_SECONDS=77",
+			"ORCHESTRATOR_DEBUG=true",
+			"ORCHESTRATOR_MYSQL_TOPOLOGY_PASSWORD=a=b",
+			"ORCHESTRATOR_RAFT_NODES=node-1, node-2,node-3",
+			`ORCHESTRATOR_DISCOVERY_IGNORE_HOSTNAME_FILTERS=["a,b"]`,
+			`ORCHESTRATOR_PROXYSQL_HOSTGROUPS={"mycluster": {"WriterHostgroup": 10}}`,
+		})
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(len(overridden), 6)
+		test.S(t).ExpectEquals(c.RecoveryPeriodBlockSeconds, 77)
+		test.S(t).ExpectTrue(c.Debug)
+		test.S(t).ExpectEquals(c.MySQLTopologyPassword, "a=b")
+		test.S(t).ExpectEquals(strings.Join(c.RaftNodes, "/"), "node-1/node-2/node-3")
+		test.S(t).ExpectEquals(strings.Join(c.DiscoveryIgnoreHostnameFilters, "/"), "a,b")
+		test.S(t).ExpectEquals(c.ProxySQLHostgroups["mycluster"].WriterHostgroup, 10)
+	}
+	{
+		c := newConfiguration()
+		_, err := c.applyEnvironment([]string{"ORCHESTRATOR_INSTANCE_POLL_SECONDS=soon"})
+		test.S(t).ExpectNotNil(err)
+	}
+}
+
+func TestYAMLConfiguration(t *testing.T) {
+	content, err := yamlToJSON([]byte(`
+Debug: true
+RecoveryPeriodBlockSeconds: 60
+RaftNodes: [node-1, node-2, node-3]
+ProxySQLHostgroups:
+  mycluster:
+    WriterHostgroup: 10
+ClusterConfigOverrides:
+  - ClusterAlias: payments
+    Settings:
+      PreventCrossDataCenterMasterFailover: true
+`))
+	test.S(t).ExpectNil(err)
+	c := newConfiguration()
+	test.S(t).ExpectNil(json.Unmarshal(content, c))
+	test.S(t).ExpectNil(c.postReadAdjustments())
+	test.S(t).ExpectTrue(c.Debug)
+	test.S(t).ExpectEquals(c.RecoveryPeriodBlockSeconds, 60)
+	test.S(t).ExpectEquals(len(c.RaftNodes), 3)
+	test.S(t).ExpectEquals(c.ProxySQLHostgroups["mycluster"].WriterHostgroup, 10)
+	test.S(t).ExpectTrue(c.ForCluster("db-1:3306", "payments").PreventCrossDataCenterMasterFailover)
+
+	content, err = yamlToJSON([]byte(""))
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(string(content), "{}")
+
+	_, err = yamlToJSON([]byte("Debug: [true"))
+	test.S(t).ExpectNotNil(err)
+}
+
+func TestValidateYAMLFile(t *testing.T) {
+	file, err := ioutil.TempFile("", "orchestrator-test-*.conf.yaml")
+	test.S(t).ExpectNil(err)
+	defer os.Remove(file.Name())
+	file.WriteString("Debug: true\nMySQLTopolgyUser: orc\n")
+	file.Close()
+
+	validation := ValidateFile(file.Name())
+	test.S(t).ExpectFalse(validation.Valid)
+	test.S(t).ExpectEquals(len(validation.Issues), 1)
+	test.S(t).ExpectEquals(validation.Issues[0].Key, "MySQLTopolgyUser")
+}
+
+func TestToRedactedJSONString(t *testing.T) {
+	c := newConfiguration()
+	c.MySQLTopologyPassword = "topology-secret"
+	c.OAuthClientSecret = "oauth-secret"
+	c.ConsulAclToken = "consul-secret"
+	c.CredentialsProviderHTTPTokenFile = "/etc/orchestrator/token"
+	c.MySQLTopologyConnectionProfiles = []TopologyConnectionProfile{{Password: "profile-secret"}}
+	redacted := c.ToRedactedJSONString()
+	test.S(t).ExpectFalse(strings.Contains(redacted, "secret"))
+	test.S(t).ExpectTrue(strings.Contains(redacted, `"MySQLTopologyPassword": "<redacted>"`))
+	test.S(t).ExpectTrue(strings.Contains(redacted, `"MySQLOrchestratorPassword": ""`))
+	test.S(t).ExpectTrue(strings.Contains(redacted, "/etc/orchestrator/token"))
+}
+
+func TestRestartRequiredSettings(t *testing.T) {
+	fields := configurationFields()
+	for _, settingName := range RestartRequiredSettings {
+		_, found := fields[settingName]
+		test.S(t).ExpectTrue(found)
+	}
+}
+
+func TestReload(t *testing.T) {
+	runningConfig, runningFileNames, runningSubscriptions := Config, readFileNames, reloadSubscriptions
+	defer func() {
+		Config, readFileNames, reloadSubscriptions = runningConfig, runningFileNames, runningSubscriptions
+	}()
+	Config = newConfiguration()
+	Config.HostnameResolveMethod = "none"
+	test.S(t).ExpectNil(Config.postReadAdjustments())
+	reloadSubscriptions = nil
+
+	handlerCalls := 0
+	SubscribeReload("workers", []string{"DiscoveryMaxConcurrency", "DiscoveryQueueCapacity"}, func() error {
+		handlerCalls++
+		return nil
+	})
+	SubscribeReload("untouched", []string{"GraphiteAddr"}, func() error {
+		t.Errorf("unexpected reload of untouched subsystem")
+		return nil
+	})
+	{
+		fileName := writeTestConfigFile(t, `{"DiscoveryMaxConcurrency": 7, "DiscoveryQueueCapacity": 50, "ListenAddress": ":3333", "InstancePollSeconds": 11}`)
+		defer os.Remove(fileName)
+		readFileNames = []string{fileName}
+
+		report := Reload("test")
+		test.S(t).ExpectTrue(report.Success)
+		test.S(t).ExpectEquals(report.Error, "")
+		test.S(t).ExpectEquals(report.Trigger, "test")
+		test.S(t).ExpectEquals(handlerCalls, 1)
+		test.S(t).ExpectEquals(Config.DiscoveryMaxConcurrency, uint(7))
+		test.S(t).ExpectEquals(Config.InstancePollSeconds, uint(11))
+		test.S(t).ExpectEquals(Config.ListenAddress, ":3000")
+
+		test.S(t).ExpectEquals(len(report.Settings), 4)
+		settings := map[string]ReloadedSetting{}
+		for _, setting := range report.Settings {
+			settings[setting.Name] = setting
+		}
+		test.S(t).ExpectEquals(settings["DiscoveryMaxConcurrency"].Status, SettingApplied)
+		test.S(t).ExpectEquals(settings["DiscoveryMaxConcurrency"].Subsystem, "workers")
+		test.S(t).ExpectEquals(settings["InstancePollSeconds"].Status, SettingApplied)
+		test.S(t).ExpectEquals(settings["InstancePollSeconds"].Subsystem, "")
+		test.S(t).ExpectEquals(settings["ListenAddress"].Status, SettingRequiresRestart)
+		test.S(t).ExpectEquals(LastReloadReport(), report)
+
+		// Nothing changed since; ListenAddress still awaits restart
+		report = Reload("test")
+		test.S(t).ExpectTrue(report.Success)
+		test.S(t).ExpectEquals(len(report.Settings), 1)
+		test.S(t).ExpectEquals(report.Settings[0].Name, "ListenAddress")
+		test.S(t).ExpectEquals(handlerCalls, 1)
+	}
+	{
+		fileName := writeTestConfigFile(t, `{"DiscoveryMaxConcurrency": 3, "InstancePollSeconds": "often"}`)
+		defer os.Remove(fileName)
+		readFileNames = []string{fileName}
+
+		report := Reload("test")
+		test.S(t).ExpectFalse(report.Success)
+		test.S(t).ExpectTrue(strings.Contains(report.Error, fileName))
+		test.S(t).ExpectEquals(Config.DiscoveryMaxConcurrency, uint(7))
+		test.S(t).ExpectEquals(handlerCalls, 1)
+	}
+	{
+		fileName := writeTestConfigFile(t, `{"DiscoveryQueueCapacity": 60}`)
+		defer os.Remove(fileName)
+		readFileNames = []string{fileName}
+		reloadSubscriptions = nil
+		SubscribeReload("failing", []string{"DiscoveryQueueCapacity"}, func() error {
+			return fmt.Errorf("cannot resize")
+		})
+
+		report := Reload("test")
+		test.S(t).ExpectFalse(report.Success)
+		test.S(t).ExpectEquals(len(report.Settings), 1)
+		test.S(t).ExpectEquals(report.Settings[0].Status, SettingFailed)
+		test.S(t).ExpectEquals(report.Settings[0].Error, "cannot resize")
+		test.S(t).ExpectEquals(Config.DiscoveryQueueCapacity, uint(60))
+	}
+	{
+		fileName := writeTestConfigFile(t, `{"MySQLTopologyConnectionProfiles": [{"Name": "wan", "HostnamePattern": "[.]remote[.]example[.]com$"}]}`)
+		defer os.Remove(fileName)
+		readFileNames = []string{fileName}
+		reloadSubscriptions = nil
+
+		report := Reload("test")
+		test.S(t).ExpectTrue(report.Success)
+		test.S(t).ExpectEquals(Config.GetTopologyConnectionProfile("db1.remote.example.com", "").Name, "wan")
+		test.S(t).ExpectTrue(Config.GetTopologyConnectionProfile("db1.example.com", "") == nil)
+	}
+}
+
+func TestValidateOIDC(t *testing.T) {
+	oidcConfiguration := func() *Configuration {
+		c := newConfiguration()
+		c.AuthenticationMethod = "oidc"
+		c.OIDCIssuerURL = "https://idp.example.com"
+		c.OAuthClientId = "orchestrator"
+		c.OIDCRedirectURL = "https://orchestrator.example.com/oidc/callback"
+		c.OIDCSessionSecret = strings.Repeat("s", 32)
+		return c
+	}
+	{
+		c := oidcConfiguration()
+		c.OAuthScopes = []string{"profile", "groups"}
+		test.S(t).ExpectNil(c.postReadAdjustments())
+		test.S(t).ExpectEquals(strings.Join(c.OAuthScopes, " "), "openid profile groups")
+	}
+	{
+		c := oidcConfiguration()
+		c.OIDCIssuerURL = ""
+		test.S(t).ExpectNotNil(c.postReadAdjustments())
+	}
+	{
+		c := oidcConfiguration()
+		c.OIDCRedirectURL = "/oidc/callback"
+		test.S(t).ExpectNotNil(c.postReadAdjustments())
+	}
+	{
+		c := oidcConfiguration()
+		c.OIDCSessionSecret = "short"
+		test.S(t).ExpectNotNil(c.postReadAdjustments())
+	}
+}
@@ -0,0 +1,414 @@
+/*
+   Copyright 2019 GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	ValidationError   = "error"
+	ValidationWarning = "warning"
+)
+
+// RecoveryHookPlaceholders are the placeholders replaced in recovery hook commands. This is the one list of
+// placeholders: recovery substitutes these, and validation accepts these only.
+var RecoveryHookPlaceholders = []string{
+	"failureType",
+	"instanceType",
+	"isMaster",
+	"isCoMaster",
+	"failureDescription",
+	"command",
+	"failedHost",
+	"failedPort",
+	"failureCluster",
+	"failureClusterAlias",
+	"failureClusterDomain",
+	"countSlaves",
+	"countReplicas",
+	"isDowntimed",
+	"autoMasterRecovery",
+	"autoIntermediateMasterRecovery",
+	"orchestratorHost",
+	"recoveryUID",
+	"isSuccessful",
+	"successorHost",
+	"successorPort",
+	"successorAlias",
+	"lostSlaves",
+	"lostReplicas",
+	"countLostReplicas",
+	"slaveHosts",
+	"replicaHosts",
+}
+
+// hookPlaceholderRegexp matches "{placeholder}", but not shell variable expansion such as "${VARIABLE}"
+var hookPlaceholderRegexp = regexp.MustCompile(`(^|[^$])[{]([a-zA-Z_]+)[}]`)
+
+// ValidationIssue is a single problem found in a configuration file
+type ValidationIssue struct {
+	Severity string // "error" or "warning"
+	Key      string // Configuration key the issue relates to; empty when not specific to a key
+	Message  string
+}
+
+// ConfigValidation is the result of validating a configuration file
+type ConfigValidation struct {
+	FileName string
+	Valid    bool // false when any error is found; warnings do not invalidate a file
+	Issues   []ValidationIssue
+}
+
+func (this *ConfigValidation) addIssue(severity string, key string, format string, args ...interface{}) {
+	this.Issues = append(this.Issues, ValidationIssue{Severity: severity, Key: key, Message: fmt.Sprintf(format, args...)})
+	if severity == ValidationError {
+		this.Valid = false
+	}
+}
+
+// HasWarnings checks whether any warning was found
+func (this *ConfigValidation) HasWarnings() bool {
+	for _, issue := range this.Issues {
+		if issue.Severity == ValidationWarning {
+			return true
+		}
+	}
+	return false
+}
+
+// configurationFields maps the names of Configuration's exported fields to their types
+func configurationFields() map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	configurationType := reflect.TypeOf(Configuration{})
+	for i := 0; i < configurationType.NumField(); i++ {
+		field := configurationType.Field(i)
+		if field.PkgPath == "" {
+			fields[field.Name] = field.Type
+		}
+	}
+	return fields
+}
+
+func isDeprecatedConfigurationVariable(key string) bool {
+	for _, deprecated := range deprecatedConfigurationVariables {
+		if deprecated == key {
+			return true
+		}
+	}
+	return false
+}
+
+// levenshteinDistance is the number of single character edits turning one string into the other
+func levenshteinDistance(s string, t string) int {
+	previous := make([]int, len(t)+1)
+	current := make([]int, len(t)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		current[0] = i
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			current[j] = previous[j-1] + cost
+			if previous[j]+1 < current[j] {
+				current[j] = previous[j] + 1
+			}
+			if current[j-1]+1 < current[j] {
+				current[j] = current[j-1] + 1
+			}
+		}
+		previous, current = current, previous
+	}
+	return previous[len(t)]
+}
+
+// suggestConfigurationKey returns the known key closest to given unknown key, or empty when none is close enough
+func suggestConfigurationKey(key string, fields map[string]reflect.Type) (suggestion string) {
+	maxDistance := len(key) / 4
+	if maxDistance < 2 {
+		maxDistance = 2
+	}
+	bestDistance := maxDistance + 1
+	for fieldName := range fields {
+		distance := levenshteinDistance(strings.ToLower(key), strings.ToLower(fieldName))
+		if distance < bestDistance || (distance == bestDistance && fieldName < suggestion) {
+			bestDistance = distance
+			suggestion = fieldName
+		}
+	}
+	return suggestion
+}
+
+// jsonLineNumber returns the line number of a JSON syntax error, given the error's offset: the
+// number of bytes read, including the offending one
+func jsonLineNumber(content []byte, offset int64) int {
+	if offset > int64(len(content)) {
+		offset = int64(len(content))
+	}
+	if offset > 0 {
+		offset--
+	}
+	return bytes.Count(content[:offset], []byte("\n")) + 1
+}
+
+// validateKeys checks configuration keys are known, and their values are of the expected types.
+// It returns false when the content cannot be parsed at all.
+func (this *ConfigValidation) validateKeys(content []byte) bool {
+	values := map[string]json.RawMessage{}
+	if err := json.Unmarshal(content, &values); err != nil {
+		if syntaxError, ok := err.(*json.SyntaxError); ok {
+			this.addIssue(ValidationError, "", "invalid JSON at line %d: %+v", jsonLineNumber(content, syntaxError.Offset), err)
+		} else {
+			this.addIssue(ValidationError, "", "invalid JSON: %+v", err)
+		}
+		return false
+	}
+	keys := []string{}
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fields := configurationFields()
+	for _, key := range keys {
+		fieldType, found := fields[key]
+		if !found {
+			for fieldName := range fields {
+				if strings.EqualFold(fieldName, key) {
+					this.addIssue(ValidationWarning, key, "key is matched case insensitively to %s", fieldName)
+					fieldType, found = fields[fieldName], true
+				}
+			}
+		}
+		if !found {
+			if isDeprecatedConfigurationVariable(key) {
+				this.addIssue(ValidationWarning, key, "deprecated, and ignored")
+			} else if suggestion := suggestConfigurationKey(key, fields); suggestion != "" {
+				this.addIssue(ValidationError, key, "unknown key; did you mean %s?", suggestion)
+			} else {
+				this.addIssue(ValidationError, key, "unknown key")
+			}
+			continue
+		}
+		value := reflect.New(fieldType)
+		if err := json.Unmarshal(values[key], value.Interface()); err != nil {
+			this.addIssue(ValidationError, key, "expected %s: %+v", fieldType.String(), err)
+		}
+	}
+	return true
+}
+
+// validateRegexps checks given patterns compile
+func (this *ConfigValidation) validateRegexps(key string, patterns ...string) {
+	for _, pattern := range patterns {
+		if pattern == "" {
+			continue
+		}
+		if _, err := regexp.Compile(pattern); err != nil {
+			this.addIssue(ValidationError, key, "invalid regular expression %q: %+v", pattern, err)
+		}
+	}
+}
+
+// validateClusterFilters checks cluster filters, which are either "*", a cluster name or alias,
+// "alias=<alias>", "alias~=<regexp>" or a regexp matched against the cluster name
+func (this *ConfigValidation) validateClusterFilters(key string, filters []string) {
+	for _, filter := range filters {
+		switch {
+		case filter == "*":
+		case strings.HasPrefix(filter, "alias="):
+		case strings.HasPrefix(filter, "alias~="):
+			this.validateRegexps(key, strings.SplitN(filter, "~=", 2)[1])
+		default:
+			this.validateRegexps(key, filter)
+		}
+	}
+}
+
+// validateHookPlaceholders checks hook commands only use given known placeholders
+func (this *ConfigValidation) validateHookPlaceholders(key string, commands []string, knownPlaceholders []string) {
+	for _, command := range commands {
+		for _, submatch := range hookPlaceholderRegexp.FindAllStringSubmatch(command, -1) {
+			placeholder := submatch[2]
+			known := false
+			for _, knownPlaceholder := range knownPlaceholders {
+				if knownPlaceholder == placeholder {
+					known = true
+				}
+			}
+			switch {
+			case known:
+			case len(knownPlaceholders) == 0:
+				this.addIssue(ValidationError, key, "placeholder {%s} is not replaced in %q; use the ORC_* environment variables", placeholder, command)
+			default:
+				this.addIssue(ValidationError, key, "unknown placeholder {%s} in %q", placeholder, command)
+			}
+		}
+	}
+}
+
+// validateAllHookPlaceholders checks the placeholders of recovery hooks and of PostTakeMasterProcesses, which
+// gets no placeholders replaced, in the global configuration as well as in ClusterConfigOverrides
+func (this *ConfigValidation) validateAllHookPlaceholders(configuration *Configuration) {
+	hookPlaceholders := map[string][]string{"PostTakeMasterProcesses": nil}
+	hookTypes := append([]string{"PostTakeMasterProcesses"}, RecoveryHookTypes...)
+	for _, hookType := range RecoveryHookTypes {
+		hookPlaceholders[hookType] = RecoveryHookPlaceholders
+	}
+	configurationValue := reflect.ValueOf(configuration).Elem()
+	for _, hookType := range hookTypes {
+		this.validateHookPlaceholders(hookType, configurationValue.FieldByName(hookType).Interface().([]string), hookPlaceholders[hookType])
+	}
+	for _, override := range configuration.ClusterConfigOverrides {
+		for _, hookType := range hookTypes {
+			rawValue, found := override.Settings[hookType]
+			if !found {
+				continue
+			}
+			var commands []string
+			// Validated upon reading configuration
+			json.Unmarshal(rawValue, &commands)
+			this.validateHookPlaceholders(fmt.Sprintf("ClusterConfigOverrides: %s: %s", override.Name(), hookType), commands, hookPlaceholders[hookType])
+		}
+	}
+}
+
+// validateRaft checks a raft setup can form, and keep, a quorum
+func (this *ConfigValidation) validateRaft(configuration *Configuration) {
+	if !configuration.RaftEnabled {
+		return
+	}
+	switch countNodes := len(configuration.RaftNodes); {
+	case countNodes == 0:
+		this.addIssue(ValidationError, "RaftNodes", "RaftEnabled requires RaftNodes")
+	case countNodes == 1:
+		this.addIssue(ValidationWarning, "RaftNodes", "a single raft node has no failure tolerance")
+	case countNodes == 2:
+		this.addIssue(ValidationError, "RaftNodes", "2 raft nodes cannot keep quorum when either fails; use 1 or at least 3 nodes")
+	case countNodes%2 == 0:
+		this.addIssue(ValidationWarning, "RaftNodes", "%d raft nodes tolerate no more failures than %d nodes", countNodes, countNodes-1)
+	}
+	advertiseHost := strings.Split(configuration.RaftAdvertise, ":")[0]
+	listed := false
+	for _, node := range configuration.RaftNodes {
+		if strings.Split(node, ":")[0] == advertiseHost {
+			listed = true
+		}
+	}
+	if len(configuration.RaftNodes) > 0 && !listed {
+		this.addIssue(ValidationWarning, "RaftNodes", "RaftAdvertise (or RaftBind) host %s is not listed in RaftNodes", advertiseHost)
+	}
+}
+
+// validateSettings checks for unsafe combinations of settings of a configuration which passed postReadAdjustments()
+func (this *ConfigValidation) validateSettings(configuration *Configuration) {
+	this.validateRaft(configuration)
+
+	this.validateRegexps("DiscoveryIgnoreHostnameFilters", configuration.DiscoveryIgnoreHostnameFilters...)
+	this.validateRegexps("DiscoveryIgnoreMasterHostnameFilters", configuration.DiscoveryIgnoreMasterHostnameFilters...)
+	this.validateRegexps("DiscoveryIgnoreReplicaHostnameFilters", configuration.DiscoveryIgnoreReplicaHostnameFilters...)
+	this.validateRegexps("ProblemIgnoreHostnameFilters", configuration.ProblemIgnoreHostnameFilters...)
+	this.validateRegexps("PromotionIgnoreHostnameFilters", configuration.PromotionIgnoreHostnameFilters...)
+	this.validateRegexps("RecoveryIgnoreHostnameFilters", configuration.RecoveryIgnoreHostnameFilters...)
+	this.validateRegexps("OSCIgnoreHostnameFilters", configuration.OSCIgnoreHostnameFilters...)
+	this.validateRegexps("LongRunningQueriesUserFilters", configuration.LongRunningQueriesUserFilters...)
+	this.validateRegexps("LongRunningQueriesIgnoreUserFilters", configuration.LongRunningQueriesIgnoreUserFilters...)
+	this.validateRegexps("RejectHostnameResolvePattern", configuration.RejectHostnameResolvePattern)
+	this.validateRegexps("DataCenterPattern", configuration.DataCenterPattern)
+	this.validateRegexps("RegionPattern", configuration.RegionPattern)
+	this.validateRegexps("PhysicalEnvironmentPattern", configuration.PhysicalEnvironmentPattern)
+	for pattern := range configuration.HostnameResolveMethodsByPattern {
+		this.validateRegexps("HostnameResolveMethodsByPattern", pattern)
+	}
+	if !configuration.PseudoGTIDPatternIsFixedSubstring {
+		this.validateRegexps("PseudoGTIDPattern", configuration.PseudoGTIDPattern)
+	}
+	this.validateClusterFilters("RecoverMasterClusterFilters", configuration.RecoverMasterClusterFilters)
+	this.validateClusterFilters("RecoverIntermediateMasterClusterFilters", configuration.RecoverIntermediateMasterClusterFilters)
+	this.validateAllHookPlaceholders(configuration)
+}
+
+// ValidateFile validates a configuration file, reporting all issues found rather than the first.
+// The file is validated on its own, on top of the default configuration, with ORCHESTRATOR_*
+// environment variables applied.
+func ValidateFile(fileName string) *ConfigValidation {
+	validation := &ConfigValidation{FileName: fileName, Valid: true, Issues: []ValidationIssue{}}
+	content, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		validation.addIssue(ValidationError, "", "%+v", err)
+		return validation
+	}
+	if content, err = configurationContent(fileName, content); err != nil {
+		validation.addIssue(ValidationError, "", "invalid YAML: %+v", err)
+		return validation
+	}
+	if !validation.validateKeys(content) {
+		return validation
+	}
+	configuration := newConfiguration()
+	if err := json.Unmarshal(content, configuration); err != nil {
+		// Type errors are already reported by key
+		return validation
+	}
+	if _, err := configuration.applyEnvironment(os.Environ()); err != nil {
+		validation.addIssue(ValidationError, "", "%+v", err)
+		return validation
+	}
+	if err := configuration.postReadAdjustments(); err != nil {
+		validation.addIssue(ValidationError, "", "%+v", err)
+		return validation
+	}
+	validation.validateSettings(configuration)
+	return validation
+}
+
+// validateRead validates a configuration file as read in strict mode: the file's keys, and the
+// settings of the configuration read so far. It returns an error listing all errors found.
+func validateRead(fileName string, configuration *Configuration) error {
+	validation := &ConfigValidation{FileName: fileName, Valid: true, Issues: []ValidationIssue{}}
+	content, err := ioutil.ReadFile(fileName)
+	if err == nil {
+		content, err = configurationContent(fileName, content)
+	}
+	if err != nil {
+		return err
+	}
+	validation.validateKeys(content)
+	validation.validateSettings(configuration)
+	if validation.Valid {
+		return nil
+	}
+	errorMessages := []string{}
+	for _, issue := range validation.Issues {
+		if issue.Severity == ValidationError {
+			errorMessages = append(errorMessages, fmt.Sprintf("%s: %s", issue.Key, issue.Message))
+		}
+	}
+	return fmt.Errorf("StrictConfigValidation: %s: %s", fileName, strings.Join(errorMessages, "; "))
+}
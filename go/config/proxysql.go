@@ -0,0 +1,52 @@
+/*
+   Copyright 2019 GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+)
+
+// ProxySQLHostgroups are the ProxySQL hostgroups serving a cluster. Both must be set.
+type ProxySQLHostgroups struct {
+	WriterHostgroup int // The cluster's master is the only server in this hostgroup
+	ReaderHostgroup int // Healthy replicas, when ProxySQLSyncReaderHostgroups is set
+}
+
+func (this *ProxySQLHostgroups) postReadAdjustments(clusterAlias string) error {
+	if this.WriterHostgroup < 0 || this.ReaderHostgroup < 0 {
+		return fmt.Errorf("ProxySQLHostgroups: %s: hostgroups must not be negative", clusterAlias)
+	}
+	if this.WriterHostgroup == this.ReaderHostgroup {
+		return fmt.Errorf("ProxySQLHostgroups: %s: WriterHostgroup and ReaderHostgroup must differ", clusterAlias)
+	}
+	return nil
+}
+
+// IsProxySQLEnabled checks whether orchestrator is configured to update ProxySQL
+func (this *Configuration) IsProxySQLEnabled() bool {
+	return len(this.ProxySQLAdminAddresses) > 0 && len(this.ProxySQLHostgroups) > 0
+}
+
+// GetProxySQLHostgroups returns the hostgroups serving given cluster; false when the cluster
+// is not managed in ProxySQL
+func (this *Configuration) GetProxySQLHostgroups(clusterAlias string) (hostgroups ProxySQLHostgroups, found bool) {
+	if !this.IsProxySQLEnabled() || clusterAlias == "" {
+		return hostgroups, false
+	}
+	hostgroups, found = this.ProxySQLHostgroups[clusterAlias]
+	return hostgroups, found
+}
@@ -0,0 +1,89 @@
+/*
+   Copyright 2019 GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// RecoveryHookTypes are the hook types (configuration names) executed by the recovery flow
+var RecoveryHookTypes = []string{
+	"OnFailureDetectionProcesses",
+	"PreGracefulTakeoverProcesses",
+	"PreFailoverProcesses",
+	"PostMasterFailoverProcesses",
+	"PostIntermediateMasterFailoverProcesses",
+	"PostFailoverProcesses",
+	"PostUnsuccessfulFailoverProcesses",
+	"PostGracefulTakeoverProcesses",
+}
+
+// RecoveryHookPolicy overrides execution of recovery hooks of a given type. Settings not given inherit
+// the global settings; a given 0 applies as such, e.g. disabling retries or the timeout.
+type RecoveryHookPolicy struct {
+	TimeoutSeconds       *int // A hook running longer is killed, and considered to have failed
+	Retries              *int // Number of times a failed hook is retried
+	RetryIntervalSeconds *int
+}
+
+func (this *RecoveryHookPolicy) postReadAdjustments(hookType string) error {
+	for _, setting := range []*int{this.TimeoutSeconds, this.Retries, this.RetryIntervalSeconds} {
+		if setting != nil && *setting < 0 {
+			return fmt.Errorf("RecoveryHookPolicies: %s: settings must not be negative", hookType)
+		}
+	}
+	return nil
+}
+
+// RecoveryHookExecution is the effective execution policy of recovery hooks of a given type
+type RecoveryHookExecution struct {
+	TimeoutSeconds       int
+	Retries              int
+	RetryIntervalSeconds int
+}
+
+// Timeout returns the hook timeout; zero for no timeout
+func (this *RecoveryHookExecution) Timeout() time.Duration {
+	return time.Duration(this.TimeoutSeconds) * time.Second
+}
+
+// RetryInterval returns the wait time between attempts of a failed hook
+func (this *RecoveryHookExecution) RetryInterval() time.Duration {
+	return time.Duration(this.RetryIntervalSeconds) * time.Second
+}
+
+// GetRecoveryHookPolicy returns the effective policy of given hook type
+func (this *Configuration) GetRecoveryHookPolicy(hookType string) RecoveryHookExecution {
+	policy := RecoveryHookExecution{
+		TimeoutSeconds:       this.RecoveryHookTimeoutSeconds,
+		Retries:              this.RecoveryHookRetries,
+		RetryIntervalSeconds: this.RecoveryHookRetryIntervalSeconds,
+	}
+	if override, found := this.RecoveryHookPolicies[hookType]; found {
+		if override.TimeoutSeconds != nil {
+			policy.TimeoutSeconds = *override.TimeoutSeconds
+		}
+		if override.Retries != nil {
+			policy.Retries = *override.Retries
+		}
+		if override.RetryIntervalSeconds != nil {
+			policy.RetryIntervalSeconds = *override.RetryIntervalSeconds
+		}
+	}
+	return policy
+}
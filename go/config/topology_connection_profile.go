@@ -0,0 +1,144 @@
+/*
+   Copyright 2019 GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/gcfg.v1"
+
+	"github.com/openark/golib/log"
+)
+
+const (
+	TopologyTLSModeNone   = "none"
+	TopologyTLSModeMutual = "mutual"
+	TopologyTLSModeMixed  = "mixed"
+)
+
+// TopologyConnectionProfile overrides topology connection settings for instances whose hostname
+// or cluster name match the profile's patterns. Zero valued settings inherit the global settings.
+type TopologyConnectionProfile struct {
+	Name                        string // Unique name of the profile
+	HostnamePattern             string // Regexp matched against the instance's hostname
+	ClusterNamePattern          string // Regexp matched against the instance's cluster name, as known to orchestrator; only applies once the instance is discovered
+	User                        string
+	Password                    string // Accepts "${SOME_ENV_VARIABLE}" form
+	CredentialsConfigFile       string // my.cnf style configuration file from where to pick credentials. Expecting `user`, `password` under `[client]` section
+	TLSMode                     string // "none"/"mutual"/"mixed"; empty to inherit MySQLTopologyUseMutualTLS/MySQLTopologyUseMixedTLS
+	SSLPrivateKeyFile           string
+	SSLCertFile                 string
+	SSLCAFile                   string
+	SSLSkipVerify               bool
+	ConnectTimeoutSeconds       int
+	ReadTimeoutSeconds          int
+	DiscoveryReadTimeoutSeconds int
+	MaxPoolConnections          int
+
+	hostnameRegexp    *regexp.Regexp // HostnamePattern, compiled
+	clusterNameRegexp *regexp.Regexp // ClusterNamePattern, compiled
+}
+
+// HasTLSSettings returns true when this profile uses its own certificates rather than the global ones
+func (this *TopologyConnectionProfile) HasTLSSettings() bool {
+	return this.SSLCAFile != "" || this.SSLCertFile != "" || this.SSLPrivateKeyFile != "" || this.SSLSkipVerify
+}
+
+// Matches returns true when given hostname or cluster name match this profile
+func (this *TopologyConnectionProfile) Matches(hostname string, clusterName string) bool {
+	if this.hostnameRegexp != nil && this.hostnameRegexp.MatchString(hostname) {
+		return true
+	}
+	if this.clusterNameRegexp != nil && clusterName != "" && this.clusterNameRegexp.MatchString(clusterName) {
+		return true
+	}
+	return false
+}
+
+func (this *TopologyConnectionProfile) postReadAdjustments() error {
+	if this.Name == "" {
+		return fmt.Errorf("MySQLTopologyConnectionProfiles: profile must have a Name")
+	}
+	if this.HostnamePattern == "" && this.ClusterNamePattern == "" {
+		return fmt.Errorf("MySQLTopologyConnectionProfiles: profile %s must define HostnamePattern and/or ClusterNamePattern", this.Name)
+	}
+	// Patterns are compiled once, here; Matches runs for every topology connection
+	compilePattern := func(pattern string) (*regexp.Regexp, error) {
+		if pattern == "" {
+			return nil, nil
+		}
+		compiledPattern, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("MySQLTopologyConnectionProfiles: profile %s has invalid pattern %s: %+v", this.Name, pattern, err)
+		}
+		return compiledPattern, nil
+	}
+	var err error
+	if this.hostnameRegexp, err = compilePattern(this.HostnamePattern); err != nil {
+		return err
+	}
+	if this.clusterNameRegexp, err = compilePattern(this.ClusterNamePattern); err != nil {
+		return err
+	}
+	this.TLSMode = strings.ToLower(this.TLSMode)
+	switch this.TLSMode {
+	case "", TopologyTLSModeNone, TopologyTLSModeMutual, TopologyTLSModeMixed:
+	default:
+		return fmt.Errorf("MySQLTopologyConnectionProfiles: profile %s has unknown TLSMode %s", this.Name, this.TLSMode)
+	}
+	if this.CredentialsConfigFile != "" {
+		mySQLConfig := struct {
+			Client struct {
+				User     string
+				Password string
+			}
+		}{}
+		if err := gcfg.ReadFileInto(&mySQLConfig, this.CredentialsConfigFile); err != nil {
+			return fmt.Errorf("MySQLTopologyConnectionProfiles: profile %s: failed to parse gcfg data from file: %+v", this.Name, err)
+		}
+		log.Debugf("Parsed topology credentials for profile %s from %s", this.Name, this.CredentialsConfigFile)
+		this.User = mySQLConfig.Client.User
+		this.Password = mySQLConfig.Client.Password
+	}
+	if submatch := envVariableRegexp.FindStringSubmatch(this.Password); len(submatch) > 1 {
+		this.Password = os.Getenv(submatch[1])
+	}
+	return nil
+}
+
+// GetTopologyConnectionProfile returns the first profile matching given hostname or cluster name, or nil
+func (this *Configuration) GetTopologyConnectionProfile(hostname string, clusterName string) *TopologyConnectionProfile {
+	for i := range this.MySQLTopologyConnectionProfiles {
+		if profile := &this.MySQLTopologyConnectionProfiles[i]; profile.Matches(hostname, clusterName) {
+			return profile
+		}
+	}
+	return nil
+}
+
+// HasClusterNameTopologyConnectionProfiles returns true when any profile is matched by cluster name
+func (this *Configuration) HasClusterNameTopologyConnectionProfiles() bool {
+	for _, profile := range this.MySQLTopologyConnectionProfiles {
+		if profile.ClusterNamePattern != "" {
+			return true
+		}
+	}
+	return false
+}
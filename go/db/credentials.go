@@ -0,0 +1,327 @@
+/*
+   Copyright 2019 GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/openark/golib/log"
+	"github.com/openark/golib/math"
+)
+
+const (
+	CredentialsProviderConfig = ""
+	CredentialsProviderFile   = "file"
+	CredentialsProviderExec   = "exec"
+	CredentialsProviderHTTP   = "http"
+)
+
+// When credentials come with an expiry, they are refreshed this long before expiring
+const credentialsExpiryMarginSeconds = 30
+
+// Minimal interval between attempts following a failed credentials refresh
+const credentialsRetryIntervalSeconds = 5
+
+// Credentials is a MySQL user/password pair, possibly short lived
+type Credentials struct {
+	User      string
+	Password  string
+	ExpiresAt time.Time
+}
+
+// credentialsResponse is the document expected from file, exec and http providers.
+// It is compatible with Vault's database secrets engine responses, where the
+// credentials are nested under "data".
+type credentialsResponse struct {
+	User          string               `json:"user"`
+	Username      string               `json:"username"`
+	Password      string               `json:"password"`
+	LeaseDuration int64                `json:"lease_duration"`
+	Data          *credentialsResponse `json:"data"`
+}
+
+// ParseCredentials reads a credentials JSON document
+func ParseCredentials(content []byte) (*Credentials, error) {
+	response := &credentialsResponse{}
+	if err := json.Unmarshal(content, response); err != nil {
+		return nil, fmt.Errorf("Cannot parse credentials: %+v", err)
+	}
+	leaseDuration := response.LeaseDuration
+	if response.Data != nil {
+		if response.Data.LeaseDuration > 0 {
+			leaseDuration = response.Data.LeaseDuration
+		}
+		response = response.Data
+	}
+	credentials := &Credentials{User: response.User, Password: response.Password}
+	if credentials.User == "" {
+		credentials.User = response.Username
+	}
+	if credentials.User == "" {
+		return nil, fmt.Errorf("Credentials have no user")
+	}
+	if leaseDuration > 0 {
+		credentials.ExpiresAt = time.Now().Add(time.Duration(leaseDuration) * time.Second)
+	}
+	return credentials, nil
+}
+
+// CredentialsProvider fetches MySQL credentials
+type CredentialsProvider interface {
+	GetCredentials() (*Credentials, error)
+}
+
+// configCredentialsProvider returns credentials as read from the config file
+type configCredentialsProvider struct {
+	getCredentials func() *Credentials
+}
+
+func (this *configCredentialsProvider) GetCredentials() (*Credentials, error) {
+	return this.getCredentials(), nil
+}
+
+// fileCredentialsProvider reads a JSON credentials document from a local file, typically
+// written and rotated by an external agent
+type fileCredentialsProvider struct {
+	fileName string
+}
+
+func (this *fileCredentialsProvider) GetCredentials() (*Credentials, error) {
+	content, err := ioutil.ReadFile(this.fileName)
+	if err != nil {
+		return nil, err
+	}
+	return ParseCredentials(content)
+}
+
+// execCredentialsProvider runs a command which prints a JSON credentials document to stdout.
+// Output is deliberately not logged.
+type execCredentialsProvider struct {
+	command string
+}
+
+func (this *execCredentialsProvider) GetCredentials() (*Credentials, error) {
+	output, err := exec.Command(config.Config.ProcessesShellCommand, "-c", this.command).Output()
+	if err != nil {
+		return nil, fmt.Errorf("Credentials command failed: %+v", err)
+	}
+	return ParseCredentials(output)
+}
+
+// httpCredentialsProvider fetches a JSON credentials document from a secret service
+type httpCredentialsProvider struct {
+	url string
+}
+
+func (this *httpCredentialsProvider) GetCredentials() (*Credentials, error) {
+	request, err := http.NewRequest("GET", this.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if config.Config.CredentialsProviderHTTPTokenFile != "" {
+		token, err := ioutil.ReadFile(config.Config.CredentialsProviderHTTPTokenFile)
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", strings.TrimSpace(string(token))))
+		request.Header.Set("X-Vault-Token", strings.TrimSpace(string(token)))
+	}
+	client := &http.Client{Timeout: time.Duration(config.Config.CredentialsProviderHTTPTimeoutSeconds) * time.Second}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Credentials request to %s returned status %d", this.url, response.StatusCode)
+	}
+	return ParseCredentials(body)
+}
+
+// NewCredentialsProvider returns a provider by type; source is the file name, command or URL, respectively.
+// The "" type returns given static credentials
+func NewCredentialsProvider(providerType string, source string, getConfigCredentials func() *Credentials) (CredentialsProvider, error) {
+	switch strings.ToLower(providerType) {
+	case CredentialsProviderConfig:
+		return &configCredentialsProvider{getCredentials: getConfigCredentials}, nil
+	case CredentialsProviderFile:
+		return &fileCredentialsProvider{fileName: source}, nil
+	case CredentialsProviderExec:
+		return &execCredentialsProvider{command: source}, nil
+	case CredentialsProviderHTTP:
+		return &httpCredentialsProvider{url: source}, nil
+	}
+	return nil, fmt.Errorf("Unknown credentials provider: %s", providerType)
+}
+
+// cachedCredentials caches credentials of a provider, refreshing them upon expiry or every
+// CredentialsRefreshSeconds. Should a refresh fail, the last known credentials are returned.
+type cachedCredentials struct {
+	mutex       sync.Mutex
+	name        string
+	provider    func() (CredentialsProvider, error)
+	credentials *Credentials
+	fetchedAt   time.Time
+	failedAt    time.Time
+}
+
+func (this *cachedCredentials) expired() bool {
+	if this.credentials == nil {
+		return true
+	}
+	if !this.credentials.ExpiresAt.IsZero() && time.Now().Add(credentialsExpiryMarginSeconds*time.Second).After(this.credentials.ExpiresAt) {
+		return true
+	}
+	return time.Since(this.fetchedAt) >= time.Duration(config.Config.CredentialsRefreshSeconds)*time.Second
+}
+
+func (this *cachedCredentials) get() (*Credentials, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if !this.expired() {
+		return this.credentials, nil
+	}
+	if this.credentials != nil && time.Since(this.failedAt) < credentialsRetryIntervalSeconds*time.Second {
+		return this.credentials, nil
+	}
+	provider, err := this.provider()
+	if err != nil {
+		return nil, log.Errore(err)
+	}
+	credentials, err := provider.GetCredentials()
+	if err != nil {
+		this.failedAt = time.Now()
+		if this.credentials != nil {
+			log.Errorf("Failed refreshing %s credentials, using last known: %+v", this.name, err)
+			return this.credentials, nil
+		}
+		return nil, log.Errorf("Failed fetching %s credentials: %+v", this.name, err)
+	}
+	if this.credentials != nil && (credentials.User != this.credentials.User || credentials.Password != this.credentials.Password) {
+		log.Infof("%s credentials rotated", this.name)
+	}
+	this.credentials = credentials
+	this.fetchedAt = time.Now()
+	return this.credentials, nil
+}
+
+func (this *cachedCredentials) reset() {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.credentials = nil
+}
+
+var topologyCredentials = &cachedCredentials{
+	name: "topology",
+	provider: func() (CredentialsProvider, error) {
+		return NewCredentialsProvider(config.Config.MySQLTopologyCredentialsProvider, config.Config.MySQLTopologyCredentialsProviderSource, func() *Credentials {
+			return &Credentials{User: config.Config.MySQLTopologyUser, Password: config.Config.MySQLTopologyPassword}
+		})
+	},
+}
+
+var orchestratorCredentials = &cachedCredentials{
+	name: "orchestrator backend",
+	provider: func() (CredentialsProvider, error) {
+		return NewCredentialsProvider(config.Config.MySQLOrchestratorCredentialsProvider, config.Config.MySQLOrchestratorCredentialsProviderSource, func() *Credentials {
+			return &Credentials{User: config.Config.MySQLOrchestratorUser, Password: config.Config.MySQLOrchestratorPassword}
+		})
+	},
+}
+
+// GetTopologyCredentials returns current credentials for topology instances
+func GetTopologyCredentials() (*Credentials, error) {
+	return topologyCredentials.get()
+}
+
+// GetOrchestratorCredentials returns current credentials for the orchestrator backend
+func GetOrchestratorCredentials() (*Credentials, error) {
+	return orchestratorCredentials.get()
+}
+
+// ResetCredentials forces credentials to be re-fetched upon next use, e.g. following config reload
+func ResetCredentials() {
+	topologyCredentials.reset()
+	orchestratorCredentials.reset()
+}
+
+// credentialPool is a MySQL connection pool along with the URI, including credentials, it was opened with
+type credentialPool struct {
+	uri string
+	db  *sql.DB
+}
+
+// credentialPools caches MySQL connection pools by target, where the target is the URI stripped of
+// credentials. When credentials rotate, a pool is opened with the new URI and replaces the previous one,
+// which is retired: it keeps serving whoever still holds it, and is closed after a grace period.
+var credentialPools = make(map[string]*credentialPool)
+var credentialPoolsMutex sync.Mutex
+
+// poolTarget returns given URI without its credentials
+func poolTarget(uri string) string {
+	if i := strings.LastIndex(uri, "@tcp("); i >= 0 {
+		return uri[i+1:]
+	}
+	return uri
+}
+
+// retiredPoolGracePeriod is the time a superseded pool is kept open, long enough for any query issued on it
+// to complete or time out
+func retiredPoolGracePeriod() time.Duration {
+	seconds := math.MaxInt(config.Config.MySQLTopologyReadTimeoutSeconds, config.Config.MySQLOrchestratorReadTimeoutSeconds)
+	seconds = math.MaxInt(seconds, config.Config.MySQLConnectionLifetimeSeconds)
+	return time.Duration(seconds+config.Config.MySQLConnectTimeoutSeconds) * time.Second
+}
+
+// getMySQLPool returns a MySQL connection pool for given URI. fromCache is false when the pool is newly
+// opened, and its settings need be applied. rotated is true when the new pool replaces the pool of
+// the same target with different credentials; the target is then known to exist and be set up.
+func getMySQLPool(uri string) (db *sql.DB, fromCache bool, rotated bool, err error) {
+	credentialPoolsMutex.Lock()
+	defer credentialPoolsMutex.Unlock()
+
+	target := poolTarget(uri)
+	previous, found := credentialPools[target]
+	if found && previous.uri == uri {
+		return previous.db, true, false, nil
+	}
+	if db, err = sql.Open("mysql", uri); err != nil {
+		return db, false, false, err
+	}
+	credentialPools[target] = &credentialPool{uri: uri, db: db}
+	if found {
+		log.Debugf("Credentials changed for %s; retiring previous pool", target)
+		retiredDB := previous.db
+		retiredDB.SetMaxIdleConns(0)
+		time.AfterFunc(retiredPoolGracePeriod(), func() { retiredDB.Close() })
+	}
+	return db, false, found, nil
+}
@@ -0,0 +1,121 @@
+package db
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	test "github.com/openark/golib/tests"
+)
+
+func TestParseCredentials(t *testing.T) {
+	{
+		credentials, err := ParseCredentials([]byte(`{"user": "orc", "password": "secret"}`))
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(credentials.User, "orc")
+		test.S(t).ExpectEquals(credentials.Password, "secret")
+		test.S(t).ExpectTrue(credentials.ExpiresAt.IsZero())
+	}
+	{
+		credentials, err := ParseCredentials([]byte(`{"lease_duration": 3600, "data": {"username": "v-orc-1a2b", "password": "s3cr3t"}}`))
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(credentials.User, "v-orc-1a2b")
+		test.S(t).ExpectEquals(credentials.Password, "s3cr3t")
+		test.S(t).ExpectTrue(credentials.ExpiresAt.After(time.Now().Add(59 * time.Minute)))
+	}
+	{
+		_, err := ParseCredentials([]byte(`{"password": "secret"}`))
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		_, err := ParseCredentials([]byte(`not json`))
+		test.S(t).ExpectNotNil(err)
+	}
+}
+
+type countingCredentialsProvider struct {
+	count int
+	fail  bool
+}
+
+func (this *countingCredentialsProvider) GetCredentials() (*Credentials, error) {
+	if this.fail {
+		return nil, fmt.Errorf("unavailable")
+	}
+	this.count++
+	return &Credentials{User: "orc", Password: fmt.Sprintf("secret%d", this.count), ExpiresAt: time.Now().Add(time.Hour)}, nil
+}
+
+func TestCachedCredentials(t *testing.T) {
+	defer func(refreshSeconds int) {
+		config.Config.CredentialsRefreshSeconds = refreshSeconds
+	}(config.Config.CredentialsRefreshSeconds)
+	config.Config.CredentialsRefreshSeconds = 300
+
+	provider := &countingCredentialsProvider{}
+	cached := &cachedCredentials{
+		name:     "test",
+		provider: func() (CredentialsProvider, error) { return provider, nil },
+	}
+	credentials, err := cached.get()
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(credentials.Password, "secret1")
+
+	credentials, err = cached.get()
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(credentials.Password, "secret1")
+
+	// Expiring credentials are refreshed
+	cached.credentials.ExpiresAt = time.Now().Add(time.Second)
+	credentials, err = cached.get()
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(credentials.Password, "secret2")
+
+	// Failed refresh keeps last known credentials
+	cached.credentials.ExpiresAt = time.Now().Add(time.Second)
+	provider.fail = true
+	credentials, err = cached.get()
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(credentials.Password, "secret2")
+
+	cached.reset()
+	_, err = cached.get()
+	test.S(t).ExpectNotNil(err)
+}
+
+func TestGetMySQLPool(t *testing.T) {
+	discoveryURI := "orc:secret@tcp(db1:3306)/?timeout=1s&readTimeout=10s&interpolateParams=true"
+	topologyURI := "orc:secret@tcp(db1:3306)/?timeout=1s&readTimeout=600s&interpolateParams=true"
+	rotatedURI := "orc:rotated@tcp(db1:3306)/?timeout=1s&readTimeout=10s&interpolateParams=true"
+
+	test.S(t).ExpectEquals(poolTarget(discoveryURI), "tcp(db1:3306)/?timeout=1s&readTimeout=10s&interpolateParams=true")
+	test.S(t).ExpectEquals(poolTarget(rotatedURI), poolTarget(discoveryURI))
+	test.S(t).ExpectNotEquals(poolTarget(topologyURI), poolTarget(discoveryURI))
+
+	discoveryDB, fromCache, rotated, err := getMySQLPool(discoveryURI)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectFalse(fromCache)
+	test.S(t).ExpectFalse(rotated)
+
+	db, fromCache, rotated, err := getMySQLPool(discoveryURI)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectTrue(fromCache)
+	test.S(t).ExpectFalse(rotated)
+	test.S(t).ExpectTrue(db == discoveryDB)
+
+	_, fromCache, rotated, err = getMySQLPool(topologyURI)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectFalse(fromCache)
+	test.S(t).ExpectFalse(rotated)
+
+	rotatedDB, fromCache, rotated, err := getMySQLPool(rotatedURI)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectFalse(fromCache)
+	test.S(t).ExpectTrue(rotated)
+	test.S(t).ExpectFalse(rotatedDB == discoveryDB)
+
+	db, fromCache, _, _ = getMySQLPool(rotatedURI)
+	test.S(t).ExpectTrue(fromCache)
+	test.S(t).ExpectTrue(db == rotatedDB)
+}
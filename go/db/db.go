@@ -20,7 +20,6 @@ import (
 	"database/sql"
 	"fmt"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/github/orchestrator/go/config"
@@ -32,8 +31,15 @@ var (
 	EmptyArgs []interface{}
 )
 
-var mysqlURI string
-var dbMutex sync.Mutex
+// topologyConnector, when non nil, replaces actual connections to topology instances
+var topologyConnector func(host string, port int) (*sql.DB, error)
+
+// SetTopologyConnector overrides the way orchestrator connects to topology instances, such that all topology
+// reads and writes go through given function. This is how tests simulate topologies in memory.
+// Pass nil to restore normal connections.
+func SetTopologyConnector(connector func(host string, port int) (*sql.DB, error)) {
+	topologyConnector = connector
+}
 
 type DummySqlResult struct {
 }
@@ -46,15 +52,14 @@ func (this DummySqlResult) RowsAffected() (int64, error) {
 	return 1, nil
 }
 
-func getMySQLURI() string {
-	dbMutex.Lock()
-	defer dbMutex.Unlock()
-	if mysqlURI != "" {
-		return mysqlURI
+func getMySQLURI() (string, error) {
+	credentials, err := GetOrchestratorCredentials()
+	if err != nil {
+		return "", err
 	}
 	mysqlURI := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?timeout=%ds&readTimeout=%ds&interpolateParams=true",
-		config.Config.MySQLOrchestratorUser,
-		config.Config.MySQLOrchestratorPassword,
+		credentials.User,
+		credentials.Password,
 		config.Config.MySQLOrchestratorHost,
 		config.Config.MySQLOrchestratorPort,
 		config.Config.MySQLOrchestratorDatabase,
@@ -64,51 +69,99 @@ func getMySQLURI() string {
 	if config.Config.MySQLOrchestratorUseMutualTLS {
 		mysqlURI, _ = SetupMySQLOrchestratorTLS(mysqlURI)
 	}
-	return mysqlURI
+	return mysqlURI, nil
 }
 
 // OpenDiscovery returns a DB instance to access a topology instance.
 // It has lower read timeout than OpenTopology and is intended to
 // be used with low-latency discovery queries.
 func OpenDiscovery(host string, port int) (*sql.DB, error) {
-	return openTopology(host, port, config.Config.MySQLDiscoveryReadTimeoutSeconds)
+	profile := getTopologyConnectionProfile(host, port)
+	readTimeout := config.Config.MySQLDiscoveryReadTimeoutSeconds
+	if profile != nil && profile.DiscoveryReadTimeoutSeconds > 0 {
+		readTimeout = profile.DiscoveryReadTimeoutSeconds
+	}
+	return openTopology(host, port, readTimeout, profile)
 }
 
 // OpenTopology returns a DB instance to access a topology instance.
 func OpenTopology(host string, port int) (*sql.DB, error) {
-	return openTopology(host, port, config.Config.MySQLTopologyReadTimeoutSeconds)
+	profile := getTopologyConnectionProfile(host, port)
+	readTimeout := config.Config.MySQLTopologyReadTimeoutSeconds
+	if profile != nil && profile.ReadTimeoutSeconds > 0 {
+		readTimeout = profile.ReadTimeoutSeconds
+	}
+	return openTopology(host, port, readTimeout, profile)
 }
 
-func openTopology(host string, port int, readTimeout int) (db *sql.DB, err error) {
+// openTopology connects to a topology instance using global settings, overridden by given profile (may be nil)
+func openTopology(host string, port int, readTimeout int, profile *config.TopologyConnectionProfile) (db *sql.DB, err error) {
+	if topologyConnector != nil {
+		return topologyConnector(host, port)
+	}
+	credentials, err := GetTopologyCredentials()
+	if err != nil {
+		return nil, err
+	}
+	user := credentials.User
+	password := credentials.Password
+	connectTimeout := config.Config.MySQLConnectTimeoutSeconds
+	maxPoolConnections := config.MySQLTopologyMaxPoolConnections
+	useMutualTLS := config.Config.MySQLTopologyUseMutualTLS
+	useMixedTLS := config.Config.MySQLTopologyUseMixedTLS
+	if profile != nil {
+		if profile.User != "" {
+			user = profile.User
+			password = profile.Password
+		}
+		if profile.ConnectTimeoutSeconds > 0 {
+			connectTimeout = profile.ConnectTimeoutSeconds
+		}
+		if profile.MaxPoolConnections > 0 {
+			maxPoolConnections = profile.MaxPoolConnections
+		}
+		if profile.TLSMode != "" {
+			useMutualTLS = (profile.TLSMode == config.TopologyTLSModeMutual)
+			useMixedTLS = (profile.TLSMode == config.TopologyTLSModeMixed)
+		}
+	}
 	mysql_uri := fmt.Sprintf("%s:%s@tcp(%s:%d)/?timeout=%ds&readTimeout=%ds&interpolateParams=true",
-		config.Config.MySQLTopologyUser,
-		config.Config.MySQLTopologyPassword,
+		user,
+		password,
 		host, port,
-		config.Config.MySQLConnectTimeoutSeconds,
+		connectTimeout,
 		readTimeout,
 	)
 
-	if config.Config.MySQLTopologyUseMutualTLS ||
-		(config.Config.MySQLTopologyUseMixedTLS && requiresTLS(host, port, mysql_uri)) {
-		if mysql_uri, err = SetupMySQLTopologyTLS(mysql_uri); err != nil {
+	if useMutualTLS || (useMixedTLS && requiresTLS(host, port, mysql_uri)) {
+		if profile != nil && profile.HasTLSSettings() {
+			mysql_uri, err = SetupMySQLTopologyProfileTLS(mysql_uri, profile)
+		} else {
+			mysql_uri, err = SetupMySQLTopologyTLS(mysql_uri)
+		}
+		if err != nil {
 			return nil, err
 		}
 	}
-	if db, _, err = sqlutils.GetDB(mysql_uri); err != nil {
+	if db, _, _, err = getMySQLPool(mysql_uri); err != nil {
 		return nil, err
 	}
 	if config.Config.MySQLConnectionLifetimeSeconds > 0 {
 		db.SetConnMaxLifetime(time.Duration(config.Config.MySQLConnectionLifetimeSeconds) * time.Second)
 	}
-	db.SetMaxOpenConns(config.MySQLTopologyMaxPoolConnections)
-	db.SetMaxIdleConns(config.MySQLTopologyMaxPoolConnections)
+	db.SetMaxOpenConns(maxPoolConnections)
+	db.SetMaxIdleConns(maxPoolConnections)
 	return db, err
 }
 
-func openOrchestratorMySQLGeneric() (db *sql.DB, fromCache bool, err error) {
+func openOrchestratorMySQLGeneric() (db *sql.DB, fromCache bool, rotated bool, err error) {
+	credentials, err := GetOrchestratorCredentials()
+	if err != nil {
+		return nil, false, false, err
+	}
 	uri := fmt.Sprintf("%s:%s@tcp(%s:%d)/?timeout=%ds&readTimeout=%ds&interpolateParams=true",
-		config.Config.MySQLOrchestratorUser,
-		config.Config.MySQLOrchestratorPassword,
+		credentials.User,
+		credentials.Password,
 		config.Config.MySQLOrchestratorHost,
 		config.Config.MySQLOrchestratorPort,
 		config.Config.MySQLConnectTimeoutSeconds,
@@ -117,7 +170,7 @@ func openOrchestratorMySQLGeneric() (db *sql.DB, fromCache bool, err error) {
 	if config.Config.MySQLOrchestratorUseMutualTLS {
 		uri, _ = SetupMySQLOrchestratorTLS(uri)
 	}
-	return sqlutils.GetDB(uri)
+	return getMySQLPool(uri)
 }
 
 func IsSQLite() bool {
@@ -131,6 +184,8 @@ func isInMemorySQLite() bool {
 // OpenTopology returns the DB instance for the orchestrator backed database
 func OpenOrchestrator() (db *sql.DB, err error) {
 	var fromCache bool
+	// rotated indicates a new pool replacing that of previous credentials, where the schema is already set up
+	var rotated bool
 	if IsSQLite() {
 		db, fromCache, err = sqlutils.GetSQLiteDB(config.Config.SQLite3DataFile)
 		if err == nil && !fromCache {
@@ -139,16 +194,20 @@ func OpenOrchestrator() (db *sql.DB, err error) {
 		db.SetMaxOpenConns(1)
 		db.SetMaxIdleConns(1)
 	} else {
-		if db, fromCache, err := openOrchestratorMySQLGeneric(); err != nil {
+		if db, fromCache, rotated, err := openOrchestratorMySQLGeneric(); err != nil {
 			return db, log.Errore(err)
-		} else if !fromCache {
+		} else if !fromCache && !rotated {
 			// first time ever we talk to MySQL
 			query := fmt.Sprintf("create database if not exists %s", config.Config.MySQLOrchestratorDatabase)
 			if _, err := db.Exec(query); err != nil {
 				return db, log.Errore(err)
 			}
 		}
-		db, fromCache, err = sqlutils.GetDB(getMySQLURI())
+		var mysqlURI string
+		if mysqlURI, err = getMySQLURI(); err != nil {
+			return nil, log.Errore(err)
+		}
+		db, fromCache, rotated, err = getMySQLPool(mysqlURI)
 		if err == nil && !fromCache {
 			// do not show the password but do show what we connect to.
 			safeMySQLURI := fmt.Sprintf("%s:?@tcp(%s:%d)/%s?timeout=%ds", config.Config.MySQLOrchestratorUser,
@@ -164,7 +223,7 @@ func OpenOrchestrator() (db *sql.DB, err error) {
 		}
 	}
 	if err == nil && !fromCache {
-		if !config.Config.SkipOrchestratorDatabaseUpdate {
+		if !config.Config.SkipOrchestratorDatabaseUpdate && !rotated {
 			initOrchestratorDB(db)
 		}
 		// A low value here will trigger reconnects which could
@@ -838,4 +838,60 @@ var generateSQLBase = []string{
 	`
 		CREATE INDEX tag_name_idx_database_instance_tags ON database_instance_tags (tag_name)
 	`,
+	`
+		CREATE TABLE IF NOT EXISTS topology_plan (
+			plan_id bigint unsigned not null auto_increment,
+			cluster_name varchar(128) CHARACTER SET ascii NOT NULL,
+			desired_topology text CHARACTER SET ascii NOT NULL,
+			plan_state varchar(32) CHARACTER SET ascii NOT NULL,
+			created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			updated_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			processing_node_hostname varchar(128) CHARACTER SET ascii NOT NULL,
+			processing_node_token varchar(128) NOT NULL,
+			last_error text CHARACTER SET utf8 NOT NULL,
+			PRIMARY KEY (plan_id)
+		) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
+	`
+		CREATE INDEX cluster_name_idx_topology_plan ON topology_plan (cluster_name)
+	`,
+	`
+		CREATE TABLE IF NOT EXISTS topology_plan_step (
+			plan_id bigint unsigned not null,
+			step_index int unsigned not null,
+			operation varchar(32) CHARACTER SET ascii NOT NULL,
+			hostname varchar(128) CHARACTER SET ascii NOT NULL,
+			port smallint(5) unsigned NOT NULL,
+			target_hostname varchar(128) CHARACTER SET ascii NOT NULL,
+			target_port smallint(5) unsigned NOT NULL,
+			step_state varchar(32) CHARACTER SET ascii NOT NULL,
+			started_at timestamp NULL DEFAULT NULL,
+			completed_at timestamp NULL DEFAULT NULL,
+			message text CHARACTER SET utf8 NOT NULL,
+			PRIMARY KEY (plan_id, step_index)
+		) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
+	`
+		CREATE TABLE IF NOT EXISTS cluster_link (
+			hostname varchar(128) CHARACTER SET ascii NOT NULL,
+			port smallint(5) unsigned NOT NULL,
+			downstream_cluster_alias varchar(128) NOT NULL,
+			upstream_cluster_name varchar(128) CHARACTER SET ascii NOT NULL,
+			last_updated timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (hostname, port)
+		) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
+	`
+		CREATE TABLE IF NOT EXISTS api_token (
+			token_id varchar(32) CHARACTER SET ascii NOT NULL,
+			token_hash varchar(64) CHARACTER SET ascii NOT NULL,
+			name varchar(128) NOT NULL,
+			scope varchar(16) CHARACTER SET ascii NOT NULL,
+			cluster_name varchar(128) CHARACTER SET ascii NOT NULL,
+			created_by varchar(128) NOT NULL,
+			created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			expires_at timestamp NULL DEFAULT NULL,
+			PRIMARY KEY (token_id)
+		) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
 }
@@ -546,4 +546,56 @@ var generateSQLPatches = []string{
 			database_instance
 			ADD COLUMN region varchar(32) CHARACTER SET ascii NOT NULL AFTER data_center
 	`,
+	`
+		ALTER TABLE
+			database_instance
+			ADD COLUMN replication_filters text CHARACTER SET utf8 NOT NULL AFTER has_replication_filters
+	`,
+	`
+		ALTER TABLE
+			database_instance
+			ADD COLUMN sql_mode varchar(1024) CHARACTER SET ascii NOT NULL
+	`,
+	`
+		ALTER TABLE
+			database_instance
+			ADD COLUMN lower_case_table_names tinyint unsigned NOT NULL DEFAULT 0
+	`,
+	`
+		ALTER TABLE
+			database_instance
+			ADD COLUMN character_set_server varchar(32) CHARACTER SET ascii NOT NULL
+	`,
+	`
+		ALTER TABLE
+			database_instance
+			ADD COLUMN time_zone varchar(64) CHARACTER SET ascii NOT NULL
+	`,
+	`
+		ALTER TABLE database_instance_long_running_queries /* sqlite3-skip */
+			MODIFY process_user varchar(32) CHARACTER SET utf8 NOT NULL
+	`,
+	`
+		ALTER TABLE
+			database_instance_long_running_queries
+			ADD COLUMN in_transaction tinyint unsigned NOT NULL DEFAULT 0
+	`,
+	`
+		ALTER TABLE
+			database_instance_long_running_queries
+			ADD COLUMN sampled_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+	`,
+	`
+		CREATE INDEX sampled_at_idx_database_instance_long_running_queries ON database_instance_long_running_queries (sampled_at)
+	`,
+	`
+		ALTER TABLE
+			topology_recovery_steps
+			ADD COLUMN stdout text CHARACTER SET utf8 NOT NULL
+	`,
+	`
+		ALTER TABLE
+			topology_recovery_steps
+			ADD COLUMN stderr text CHARACTER SET utf8 NOT NULL
+	`,
 }
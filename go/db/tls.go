@@ -20,6 +20,7 @@ import (
 	"crypto/tls"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-sql-driver/mysql"
@@ -37,6 +38,7 @@ const Error1045 = "Access denied for user"
 
 // Track if a TLS has already been configured for topology
 var topologyTLSConfigured bool = false
+var topologyTLSMutex sync.Mutex
 
 // Track if a TLS has already been configured for Orchestrator
 var orchestratorTLSConfigured bool = false
@@ -53,6 +55,30 @@ func init() {
 	metrics.Register("instance_tls.write", writeInstanceTLSCounter)
 	metrics.Register("instance_tls.read_cache", readInstanceTLSCacheCounter)
 	metrics.Register("instance_tls.write_cache", writeInstanceTLSCacheCounter)
+	config.SubscribeReload("topology-tls", []string{
+		"MySQLTopologySSLPrivateKeyFile",
+		"MySQLTopologySSLCertFile",
+		"MySQLTopologySSLCAFile",
+		"MySQLTopologySSLSkipVerify",
+		"MySQLTopologyUseMutualTLS",
+		"MySQLTopologyUseMixedTLS",
+		"MySQLTopologyConnectionProfiles",
+	}, ResetTopologyTLS)
+}
+
+// ResetTopologyTLS discards TLS configurations registered for topology connections, and the cache of
+// which instances require TLS, such that new connections set up TLS anew from current configuration.
+func ResetTopologyTLS() error {
+	topologyTLSMutex.Lock()
+	topologyTLSConfigured = false
+	topologyTLSMutex.Unlock()
+
+	topologyProfileTLSMutex.Lock()
+	topologyProfileTLSConfigured = make(map[string]string)
+	topologyProfileTLSMutex.Unlock()
+
+	requireTLSCache.Flush()
+	return nil
 }
 
 func requiresTLS(host string, port int, mysql_uri string) bool {
@@ -94,6 +120,9 @@ func requiresTLS(host string, port int, mysql_uri string) bool {
 // Register the TLS config with the mysql drivers as the "topology" config
 // Modify the supplied URI to call the TLS config
 func SetupMySQLTopologyTLS(uri string) (string, error) {
+	topologyTLSMutex.Lock()
+	defer topologyTLSMutex.Unlock()
+
 	if !topologyTLSConfigured {
 		tlsConfig, err := ssl.NewTLSConfig(config.Config.MySQLTopologySSLCAFile, !config.Config.MySQLTopologySSLSkipVerify)
 		// Drop to TLS 1.0 for talking to MySQL
@@ -118,6 +147,42 @@ func SetupMySQLTopologyTLS(uri string) (string, error) {
 	return fmt.Sprintf("%s&tls=topology", uri), nil
 }
 
+// Track which connection profiles have had their TLS configured: profile name => TLS settings registered
+var topologyProfileTLSConfigured = make(map[string]string)
+var topologyProfileTLSMutex sync.Mutex
+
+// SetupMySQLTopologyProfileTLS creates a TLS configuration from the profile's CA, Certificate, and Private key.
+// Register the TLS config with the mysql drivers as a "topology-<profile name>" config, re-registering
+// whenever the profile's TLS settings change.
+// Modify the supplied URI to call the TLS config
+func SetupMySQLTopologyProfileTLS(uri string, profile *config.TopologyConnectionProfile) (string, error) {
+	topologyProfileTLSMutex.Lock()
+	defer topologyProfileTLSMutex.Unlock()
+
+	tlsConfigName := fmt.Sprintf("topology-%s", profile.Name)
+	tlsSettings := fmt.Sprintf("%s,%s,%s,%t", profile.SSLCAFile, profile.SSLCertFile, profile.SSLPrivateKeyFile, profile.SSLSkipVerify)
+	if topologyProfileTLSConfigured[profile.Name] != tlsSettings {
+		tlsConfig, err := ssl.NewTLSConfig(profile.SSLCAFile, !profile.SSLSkipVerify)
+		if err != nil {
+			return "", log.Errorf("Can't create TLS configuration for Topology connection profile %s: %s", profile.Name, err)
+		}
+		// Drop to TLS 1.0 for talking to MySQL
+		tlsConfig.MinVersion = tls.VersionTLS10
+		tlsConfig.InsecureSkipVerify = profile.SSLSkipVerify
+
+		if !profile.SSLSkipVerify && profile.SSLCertFile != "" && profile.SSLPrivateKeyFile != "" {
+			if err = ssl.AppendKeyPair(tlsConfig, profile.SSLCertFile, profile.SSLPrivateKeyFile); err != nil {
+				return "", log.Errorf("Can't setup TLS key pairs for Topology connection profile %s: %s", profile.Name, err)
+			}
+		}
+		if err = mysql.RegisterTLSConfig(tlsConfigName, tlsConfig); err != nil {
+			return "", log.Errorf("Can't register mysql TLS config for %s: %s", tlsConfigName, err)
+		}
+		topologyProfileTLSConfigured[profile.Name] = tlsSettings
+	}
+	return fmt.Sprintf("%s&tls=%s", uri, tlsConfigName), nil
+}
+
 // Create a TLS configuration from the config supplied CA, Certificate, and Private key.
 // Register the TLS config with the mysql drivers as the "orchestrator" config
 // Modify the supplied URI to call the TLS config
@@ -0,0 +1,71 @@
+/*
+   Copyright 2019 GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/openark/golib/log"
+	"github.com/openark/golib/sqlutils"
+	"github.com/patrickmn/go-cache"
+)
+
+var instanceClusterNameCache = cache.New(time.Minute, time.Minute)
+
+// readInstanceClusterName returns the cluster name orchestrator has recorded for given instance.
+// An instance not yet discovered has no cluster name.
+func readInstanceClusterName(host string, port int) string {
+	cacheKey := fmt.Sprintf("%s:%d", host, port)
+	if clusterName, found := instanceClusterNameCache.Get(cacheKey); found {
+		return clusterName.(string)
+	}
+	clusterName := ""
+	query := `
+		select
+			cluster_name
+		from
+			database_instance
+		where
+			hostname = ?
+			and port = ?
+		`
+	err := QueryOrchestrator(query, sqlutils.Args(host, port), func(m sqlutils.RowMap) error {
+		clusterName = m.GetString("cluster_name")
+		return nil
+	})
+	if err != nil {
+		log.Errore(err)
+		return ""
+	}
+	instanceClusterNameCache.Set(cacheKey, clusterName, cache.DefaultExpiration)
+	return clusterName
+}
+
+// getTopologyConnectionProfile returns the connection profile applying to given instance, or nil
+// if global topology connection settings apply
+func getTopologyConnectionProfile(host string, port int) *config.TopologyConnectionProfile {
+	if len(config.Config.MySQLTopologyConnectionProfiles) == 0 {
+		return nil
+	}
+	clusterName := ""
+	if config.Config.HasClusterNameTopologyConnectionProfiles() {
+		clusterName = readInstanceClusterName(host, port)
+	}
+	return config.Config.GetTopologyConnectionProfile(host, clusterName)
+}
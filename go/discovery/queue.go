@@ -60,6 +60,18 @@ var dcLock sync.Mutex
 
 func init() {
 	discoveryQueue = make(map[string](*Queue))
+	config.SubscribeReload("discovery-queue", []string{"DiscoveryQueueCapacity"}, ResizeQueues)
+}
+
+// ResizeQueues applies configured DiscoveryQueueCapacity to all queues
+func ResizeQueues() error {
+	dcLock.Lock()
+	defer dcLock.Unlock()
+
+	for _, q := range discoveryQueue {
+		q.Resize(config.Config.DiscoveryQueueCapacity)
+	}
+	return nil
 }
 
 // StopMonitoring stops monitoring all the queues
@@ -152,14 +164,47 @@ func (q *Queue) Push(key inst.InstanceKey) {
 	q.queue <- key
 }
 
+// Resize replaces the queue's buffer with one of given capacity. Queued keys are moved
+// to the new buffer; keys not fitting it are dropped, to be pushed again on a later poll.
+func (q *Queue) Resize(capacity uint) {
+	q.Lock()
+	defer q.Unlock()
+
+	if uint(cap(q.queue)) == capacity {
+		return
+	}
+	previousQueue := q.queue
+	q.queue = make(chan inst.InstanceKey, capacity)
+	// Consumers waiting on the previous buffer wake up and move over to the new one
+	close(previousQueue)
+
+	dropped := 0
+	for key := range previousQueue {
+		select {
+		case q.queue <- key:
+		default:
+			delete(q.queuedKeys, key)
+			dropped++
+		}
+	}
+	log.Infof("Queue.Resize(%s): capacity %d, dropped %d keys", q.name, capacity, dropped)
+}
+
 // Consume fetches a key to process; blocks if queue is empty.
 // Release must be called once after Consume.
 func (q *Queue) Consume() inst.InstanceKey {
-	q.Lock()
-	queue := q.queue
-	q.Unlock()
+	var key inst.InstanceKey
+	for {
+		q.Lock()
+		queue := q.queue
+		q.Unlock()
 
-	key := <-queue
+		var ok bool
+		if key, ok = <-queue; ok {
+			break
+		}
+		// The queue has been resized
+	}
 
 	q.Lock()
 	defer q.Unlock()
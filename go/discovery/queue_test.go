@@ -0,0 +1,56 @@
+package discovery
+
+import (
+	"testing"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/inst"
+	"github.com/openark/golib/log"
+	test "github.com/openark/golib/tests"
+)
+
+func init() {
+	config.Config.HostnameResolveMethod = "none"
+	log.SetLevel(log.ERROR)
+}
+
+func newTestQueue(capacity uint) *Queue {
+	return &Queue{
+		name:         "test",
+		queuedKeys:   make(map[inst.InstanceKey]time.Time),
+		consumedKeys: make(map[inst.InstanceKey]time.Time),
+		queue:        make(chan inst.InstanceKey, capacity),
+	}
+}
+
+func TestQueueResize(t *testing.T) {
+	q := newTestQueue(4)
+	for port := 3306; port < 3310; port++ {
+		q.Push(inst.InstanceKey{Hostname: "db", Port: port})
+	}
+	q.Resize(2)
+	// Keys not fitting the new capacity are dropped
+	test.S(t).ExpectEquals(len(q.queue), 2)
+	test.S(t).ExpectEquals(len(q.queuedKeys), 2)
+	test.S(t).ExpectEquals(q.Consume().Port, 3306)
+	test.S(t).ExpectEquals(q.Consume().Port, 3307)
+
+	consumed := make(chan inst.InstanceKey)
+	go func() {
+		consumed <- q.Consume()
+	}()
+	// A consumer waiting while the queue is resized moves over to the new buffer
+	time.Sleep(10 * time.Millisecond)
+	q.Resize(8)
+	q.Push(inst.InstanceKey{Hostname: "db", Port: 3310})
+	select {
+	case key := <-consumed:
+		test.S(t).ExpectEquals(key.Port, 3310)
+	case <-time.After(time.Second):
+		t.Errorf("Consume did not return after resize")
+	}
+	// Dropped keys may be pushed again
+	q.Push(inst.InstanceKey{Hostname: "db", Port: 3308})
+	test.S(t).ExpectEquals(len(q.queue), 1)
+}
@@ -0,0 +1,240 @@
+/*
+   Copyright 2019 GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package events distributes topology and recovery events, as they happen, to subscribers such as
+// the API's event stream. Events are local to this orchestrator node and are not persisted; on a raft
+// setup, the API streams the leader's events.
+package events
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+type EventType string
+
+const (
+	InstanceDiscovered EventType = "instance-discovered"
+	InstanceForgotten  EventType = "instance-forgotten"
+	AnalysisChanged    EventType = "analysis-changed"
+	RecoveryStarted    EventType = "recovery-started"
+	RecoveryStep       EventType = "recovery-step"
+	RecoveryFinished   EventType = "recovery-finished"
+	DowntimeBegun      EventType = "downtime-begun"
+	DowntimeEnded      EventType = "downtime-ended"
+)
+
+var EventTypes = []EventType{
+	InstanceDiscovered,
+	InstanceForgotten,
+	AnalysisChanged,
+	RecoveryStarted,
+	RecoveryStep,
+	RecoveryFinished,
+	DowntimeBegun,
+	DowntimeEnded,
+}
+
+const (
+	// recentEventsCapacity is the number of recent events kept for subscribers resuming a stream
+	recentEventsCapacity = 1000
+	// subscriptionBufferSize is the number of events a subscriber may lag behind before being dropped
+	subscriptionBufferSize = 256
+)
+
+// Event is a single topology or recovery event
+type Event struct {
+	Id          int64
+	Type        EventType
+	Timestamp   time.Time
+	ClusterName string
+	Hostname    string
+	Port        int
+	Message     string
+	Details     interface{}
+}
+
+// Filter selects the events a subscriber is interested in. Empty fields match all events.
+type Filter struct {
+	ClusterName string
+	Types       map[EventType]bool
+}
+
+// NewFilter creates a filter by cluster name and a comma delimited list of event types
+func NewFilter(clusterName string, types string) (*Filter, error) {
+	filter := &Filter{ClusterName: clusterName, Types: map[EventType]bool{}}
+	for _, token := range strings.Split(types, ",") {
+		token = strings.TrimSpace(token)
+		if token == "" {
+			continue
+		}
+		if !isEventType(token) {
+			return nil, fmt.Errorf("Unknown event type: %s", token)
+		}
+		filter.Types[EventType(token)] = true
+	}
+	return filter, nil
+}
+
+func isEventType(token string) bool {
+	for _, eventType := range EventTypes {
+		if string(eventType) == token {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches checks whether given event passes this filter
+func (this *Filter) Matches(event *Event) bool {
+	if this.ClusterName != "" && this.ClusterName != event.ClusterName {
+		return false
+	}
+	if len(this.Types) > 0 && !this.Types[event.Type] {
+		return false
+	}
+	return true
+}
+
+// Subscription receives published events matching its filter. The Events channel is closed
+// when the subscription ends, either by Unsubscribe or by the subscriber falling behind.
+type Subscription struct {
+	Events <-chan *Event
+	events chan *Event
+	filter *Filter
+	hub    *Hub
+}
+
+// Unsubscribe stops delivery of events to this subscription
+func (this *Subscription) Unsubscribe() {
+	this.hub.unsubscribe(this)
+}
+
+// Hub distributes published events to subscriptions, and keeps recent events so that a
+// subscriber can resume from the last event it has seen.
+type Hub struct {
+	mutex         sync.Mutex
+	lastId        int64
+	recent        []*Event
+	subscriptions map[*Subscription]bool
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		recent:        []*Event{},
+		subscriptions: map[*Subscription]bool{},
+	}
+}
+
+// Publish assigns an event its id and timestamp, and delivers it to matching subscriptions.
+// Publish never blocks: a subscription whose buffer is full is dropped.
+func (this *Hub) Publish(event *Event) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	this.lastId++
+	event.Id = this.lastId
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+	this.recent = append(this.recent, event)
+	if len(this.recent) > recentEventsCapacity {
+		this.recent = this.recent[len(this.recent)-recentEventsCapacity:]
+	}
+	for subscription := range this.subscriptions {
+		if !subscription.filter.Matches(event) {
+			continue
+		}
+		select {
+		case subscription.events <- event:
+		default:
+			this.closeSubscription(subscription)
+		}
+	}
+}
+
+// Subscribe starts delivery of events matching given filter. Recent events following afterId
+// (when positive) are returned as backlog, such that no event is missed between the two.
+func (this *Hub) Subscribe(filter *Filter, afterId int64) (subscription *Subscription, backlog []*Event) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	events := make(chan *Event, subscriptionBufferSize)
+	subscription = &Subscription{
+		Events: events,
+		events: events,
+		filter: filter,
+		hub:    this,
+	}
+	this.subscriptions[subscription] = true
+
+	backlog = []*Event{}
+	if afterId > 0 {
+		for _, event := range this.recent {
+			if event.Id > afterId && filter.Matches(event) {
+				backlog = append(backlog, event)
+			}
+		}
+	}
+	return subscription, backlog
+}
+
+func (this *Hub) unsubscribe(subscription *Subscription) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	this.closeSubscription(subscription)
+}
+
+// closeSubscription expects the hub to be locked
+func (this *Hub) closeSubscription(subscription *Subscription) {
+	if !this.subscriptions[subscription] {
+		return
+	}
+	delete(this.subscriptions, subscription)
+	close(subscription.events)
+}
+
+// CountSubscriptions returns the number of active subscriptions
+func (this *Hub) CountSubscriptions() int {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	return len(this.subscriptions)
+}
+
+var defaultHub = NewHub()
+
+// Publish publishes an event to this node's subscribers, and returns the published event
+func Publish(eventType EventType, clusterName string, hostname string, port int, message string, details interface{}) *Event {
+	event := &Event{
+		Type:        eventType,
+		ClusterName: clusterName,
+		Hostname:    hostname,
+		Port:        port,
+		Message:     message,
+		Details:     details,
+	}
+	defaultHub.Publish(event)
+	return event
+}
+
+// Subscribe subscribes to this node's events
+func Subscribe(filter *Filter, afterId int64) (subscription *Subscription, backlog []*Event) {
+	return defaultHub.Subscribe(filter, afterId)
+}
@@ -0,0 +1,77 @@
+package events
+
+import (
+	"testing"
+
+	test "github.com/openark/golib/tests"
+)
+
+func TestNewFilter(t *testing.T) {
+	{
+		filter, err := NewFilter("", "")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectTrue(filter.Matches(&Event{Type: RecoveryStarted, ClusterName: "c1"}))
+	}
+	{
+		filter, err := NewFilter("c1", "recovery-started, recovery-finished")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(len(filter.Types), 2)
+		test.S(t).ExpectTrue(filter.Matches(&Event{Type: RecoveryStarted, ClusterName: "c1"}))
+		test.S(t).ExpectFalse(filter.Matches(&Event{Type: RecoveryStep, ClusterName: "c1"}))
+		test.S(t).ExpectFalse(filter.Matches(&Event{Type: RecoveryStarted, ClusterName: "c2"}))
+	}
+	{
+		_, err := NewFilter("", "recovery-started,no-such-event")
+		test.S(t).ExpectNotNil(err)
+	}
+}
+
+func TestPublishSubscribe(t *testing.T) {
+	hub := NewHub()
+	filter, _ := NewFilter("c1", "")
+	subscription, backlog := hub.Subscribe(filter, 0)
+	test.S(t).ExpectEquals(len(backlog), 0)
+	test.S(t).ExpectEquals(hub.CountSubscriptions(), 1)
+
+	hub.Publish(&Event{Type: InstanceDiscovered, ClusterName: "c2"})
+	hub.Publish(&Event{Type: InstanceDiscovered, ClusterName: "c1", Hostname: "db-1", Port: 3306})
+
+	event := <-subscription.Events
+	test.S(t).ExpectEquals(event.Id, int64(2))
+	test.S(t).ExpectEquals(event.Hostname, "db-1")
+	test.S(t).ExpectFalse(event.Timestamp.IsZero())
+
+	subscription.Unsubscribe()
+	subscription.Unsubscribe()
+	test.S(t).ExpectEquals(hub.CountSubscriptions(), 0)
+	_, open := <-subscription.Events
+	test.S(t).ExpectFalse(open)
+}
+
+func TestSubscribeBacklog(t *testing.T) {
+	hub := NewHub()
+	for i := 0; i < recentEventsCapacity+10; i++ {
+		hub.Publish(&Event{Type: DowntimeBegun, ClusterName: "c1"})
+	}
+	test.S(t).ExpectEquals(len(hub.recent), recentEventsCapacity)
+
+	filter, _ := NewFilter("", "")
+	_, backlog := hub.Subscribe(filter, int64(recentEventsCapacity+5))
+	test.S(t).ExpectEquals(len(backlog), 5)
+	test.S(t).ExpectEquals(backlog[0].Id, int64(recentEventsCapacity+6))
+}
+
+func TestSlowSubscriberDropped(t *testing.T) {
+	hub := NewHub()
+	filter, _ := NewFilter("", "")
+	subscription, _ := hub.Subscribe(filter, 0)
+	for i := 0; i < subscriptionBufferSize+1; i++ {
+		hub.Publish(&Event{Type: RecoveryStep})
+	}
+	test.S(t).ExpectEquals(hub.CountSubscriptions(), 0)
+	count := 0
+	for range subscription.Events {
+		count++
+	}
+	test.S(t).ExpectEquals(count, subscriptionBufferSize)
+}
@@ -36,6 +36,7 @@ import (
 	"github.com/github/orchestrator/go/collection"
 	"github.com/github/orchestrator/go/config"
 	"github.com/github/orchestrator/go/discovery"
+	"github.com/github/orchestrator/go/events"
 	"github.com/github/orchestrator/go/inst"
 	"github.com/github/orchestrator/go/logic"
 	"github.com/github/orchestrator/go/metrics/query"
@@ -80,6 +81,9 @@ var apiSynonyms = map[string]string{
 var registeredPaths = []string{}
 var emptyInstanceKey inst.InstanceKey
 
+// eventsKeepaliveInterval is the interval of comments sent on an idle event stream, keeping proxies from closing it
+const eventsKeepaliveInterval = 15 * time.Second
+
 func (this *APIResponseCode) MarshalJSON() ([]byte, error) {
 	return json.Marshal(this.String())
 }
@@ -315,6 +319,50 @@ func (this *HttpAPI) ForgetCluster(params martini.Params, r render.Render, req *
 	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Cluster forgotten: %+v", clusterName)})
 }
 
+// GarbageReport lists instances not seen for a given duration (e.g. "24h", "7d"), clusters with no valid master,
+// and rows referencing forgotten or stale instances. This is a preview of ForgetGarbage.
+func (this *HttpAPI) GarbageReport(params martini.Params, r render.Render, req *http.Request) {
+	staleHours, err := inst.StaleHoursFromDuration(params["duration"])
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+	report, err := inst.ReadGarbageReport(staleHours)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	r.JSON(http.StatusOK, report)
+}
+
+// ForgetGarbage forgets instances not seen for a given duration, and removes rows referencing forgotten or stale instances
+func (this *HttpAPI) ForgetGarbage(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		return
+	}
+	staleHours, err := inst.StaleHoursFromDuration(params["duration"])
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+	report, err := inst.ReadGarbageReport(staleHours)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	if orcraft.IsRaftEnabled() {
+		_, err = orcraft.PublishCommand("forget-garbage", report)
+	} else {
+		_, err = inst.ForgetGarbage(report)
+	}
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Garbage forgotten: %d stale instances, %d orphaned rows", len(report.StaleInstances), len(report.OrphanedRows)), Details: report})
+}
+
 // Resolve tries to resolve hostname and then checks to see if port is open on that host.
 func (this *HttpAPI) Resolve(params martini.Params, r render.Render, req *http.Request) {
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
@@ -915,6 +963,105 @@ func (this *HttpAPI) RelocateBelow(params martini.Params, r render.Render, req *
 	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Instance %+v relocated below %+v", instanceKey, belowKey), Details: instance})
 }
 
+// PlanTopology computes, without executing, the plan reshaping a cluster into the desired topology
+// given in the "desired" query parameter
+func (this *HttpAPI) PlanTopology(params martini.Params, r render.Render, req *http.Request) {
+	clusterName, err := figureClusterName(getClusterHint(params))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	desired, err := inst.ParseDesiredTopology(req.URL.Query().Get("desired"))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+	plan, err := inst.ComputeTopologyPlan(clusterName, desired)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Topology plan for cluster %s: %d steps", clusterName, len(plan.Steps)), Details: plan})
+}
+
+// ApplyTopology reshapes a cluster into the desired topology given in the "desired" query parameter
+func (this *HttpAPI) ApplyTopology(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		return
+	}
+	clusterName, err := figureClusterName(getClusterHint(params))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	desired, err := inst.ParseDesiredTopology(req.URL.Query().Get("desired"))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+	plan, err := inst.ApplyTopology(clusterName, desired)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error(), Details: plan})
+		return
+	}
+
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Topology plan %d applied on cluster %s", plan.PlanId, clusterName), Details: plan})
+}
+
+// ResumeTopologyPlan resumes the latest unfinished topology plan of a cluster
+func (this *HttpAPI) ResumeTopologyPlan(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		return
+	}
+	clusterName, err := figureClusterName(getClusterHint(params))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	plan, err := inst.ResumeTopologyPlan(clusterName)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error(), Details: plan})
+		return
+	}
+
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Topology plan %d applied on cluster %s", plan.PlanId, clusterName), Details: plan})
+}
+
+// TopologyPlan returns a topology plan, with the state of its steps
+func (this *HttpAPI) TopologyPlan(params martini.Params, r render.Render, req *http.Request) {
+	planId, err := strconv.ParseInt(params["planId"], 10, 0)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+	plan, err := inst.ReadTopologyPlan(planId)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+
+	r.JSON(http.StatusOK, plan)
+}
+
+// TopologyPlans returns the most recent topology plans of a cluster
+func (this *HttpAPI) TopologyPlans(params martini.Params, r render.Render, req *http.Request) {
+	clusterName, err := figureClusterName(getClusterHint(params))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	plans, err := inst.ReadClusterTopologyPlans(clusterName)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+
+	r.JSON(http.StatusOK, plans)
+}
+
 // Relocates attempts to smartly relocate replicas of a given instance below another
 func (this *HttpAPI) RelocateReplicas(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
@@ -1419,6 +1566,148 @@ func (this *HttpAPI) RestartSlaveStatements(params martini.Params, r render.Rend
 	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("statements for: %+v", instanceKey), Details: statements})
 }
 
+// readBinlogEvents returns a page of filtered events from an instance's binary or relay log
+func (this *HttpAPI) readBinlogEvents(params martini.Params, r render.Render, req *http.Request, user auth.User, binlogType inst.BinlogType) {
+	if !isAuthorizedForAction(req, user) {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		return
+	}
+	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+	coordinates, err := this.getBinlogCoordinates(params["logFile"], params["logPos"])
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+	coordinates.Type = binlogType
+	filter, err := inst.NewBinlogEventFilter(req.URL.Query().Get("type"), req.URL.Query().Get("gtid"), req.URL.Query().Get("pattern"))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+	// Paging through a GTID filtered log, the previous page's InMatchingTransaction is passed back
+	filter.InMatchingTransaction = (req.URL.Query().Get("inMatchingTransaction") == "true")
+	limit := 0
+	if limitParam := req.URL.Query().Get("limit"); limitParam != "" {
+		if limit, err = strconv.Atoi(limitParam); err != nil {
+			Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Invalid limit: %s", limitParam)})
+			return
+		}
+	}
+
+	events, nextCoordinates, err := inst.ReadBinlogEvents(&instanceKey, coordinates, filter, limit)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+	details := struct {
+		Events                []inst.BinlogEvent
+		NextCoordinates       *inst.BinlogCoordinates
+		InMatchingTransaction bool
+	}{
+		Events:                events,
+		NextCoordinates:       nextCoordinates,
+		InMatchingTransaction: filter.InMatchingTransaction,
+	}
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Found %d events", len(events)), Details: details})
+}
+
+// BinlogEvents returns a page of events from an instance's binary log, optionally filtered by event type, GTID and text pattern
+func (this *HttpAPI) BinlogEvents(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	this.readBinlogEvents(params, r, req, user, inst.BinaryLog)
+}
+
+// RelaylogEvents returns a page of events from an instance's relay log, optionally filtered by event type, GTID and text pattern
+func (this *HttpAPI) RelaylogEvents(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	this.readBinlogEvents(params, r, req, user, inst.RelayLog)
+}
+
+// getCorrelationInstances reads the source and target instances of a coordinates correlation request
+func (this *HttpAPI) getCorrelationInstances(params martini.Params) (instance *inst.Instance, otherInstance *inst.Instance, coordinates inst.BinlogCoordinates, err error) {
+	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
+	if err != nil {
+		return instance, otherInstance, coordinates, err
+	}
+	otherKey, err := this.getInstanceKey(params["belowHost"], params["belowPort"])
+	if err != nil {
+		return instance, otherInstance, coordinates, err
+	}
+	if coordinates, err = this.getBinlogCoordinates(params["logFile"], params["logPos"]); err != nil {
+		return instance, otherInstance, coordinates, err
+	}
+	if instance, err = inst.ReadTopologyInstance(&instanceKey); err != nil {
+		return instance, otherInstance, coordinates, err
+	}
+	if instance == nil {
+		return instance, otherInstance, coordinates, fmt.Errorf("Instance not found: %+v", instanceKey)
+	}
+	if otherInstance, err = inst.ReadTopologyInstance(&otherKey); err != nil {
+		return instance, otherInstance, coordinates, err
+	}
+	if otherInstance == nil {
+		return instance, otherInstance, coordinates, fmt.Errorf("Instance not found: %+v", otherKey)
+	}
+	return instance, otherInstance, coordinates, nil
+}
+
+// CorrelateBinlogCoordinates finds the coordinates in another instance's binary logs correlated with given binlog coordinates of an instance
+func (this *HttpAPI) CorrelateBinlogCoordinates(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		return
+	}
+	instance, otherInstance, coordinates, err := this.getCorrelationInstances(params)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+	if !instance.LogBinEnabled {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Instance does not have binary logs: %+v", instance.Key)})
+		return
+	}
+	correlatedCoordinates, _, err := inst.CorrelateBinlogCoordinates(instance, &coordinates, otherInstance)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("%+v", *correlatedCoordinates), Details: correlatedCoordinates})
+}
+
+// CorrelateRelaylogCoordinates finds the coordinates in a sibling's relay logs correlated with given relay log coordinates of an instance
+func (this *HttpAPI) CorrelateRelaylogCoordinates(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		return
+	}
+	instance, otherInstance, coordinates, err := this.getCorrelationInstances(params)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+	instanceCoordinates, correlatedCoordinates, nextCoordinates, found, err := inst.CorrelateRelaylogCoordinates(instance, &coordinates, otherInstance)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+	if !found {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Cannot correlate %+v on %+v", coordinates, otherInstance.Key)})
+		return
+	}
+	details := struct {
+		InstanceCoordinates   *inst.BinlogCoordinates
+		CorrelatedCoordinates *inst.BinlogCoordinates
+		NextCoordinates       *inst.BinlogCoordinates
+	}{
+		InstanceCoordinates:   instanceCoordinates,
+		CorrelatedCoordinates: correlatedCoordinates,
+		NextCoordinates:       nextCoordinates,
+	}
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("%+v", *correlatedCoordinates), Details: details})
+}
+
 // MasterEquivalent provides (possibly empty) list of master coordinates equivalent to the given ones
 func (this *HttpAPI) MasterEquivalent(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
@@ -1752,6 +2041,44 @@ func (this *HttpAPI) ClusterInfo(params martini.Params, r render.Render, req *ht
 	r.JSON(http.StatusOK, clusterInfo)
 }
 
+// ClusterConfig shows the per cluster overridable settings in effect for given cluster, and where their values come from
+func (this *HttpAPI) ClusterConfig(params martini.Params, r render.Render, req *http.Request) {
+	clusterName, err := figureClusterName(getClusterHint(params))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	r.JSON(http.StatusOK, inst.ReadEffectiveClusterConfig(clusterName))
+}
+
+// ClusterDashboard returns, in one read, all a dashboard needs to render a cluster: the topology tree with per
+// instance health, downtime, maintenance, tags and pools, the cluster's analysis and active and recent recoveries.
+// The response carries an ETag; a request whose If-None-Match matches it gets 304 Not Modified.
+func (this *HttpAPI) ClusterDashboard(params martini.Params, r render.Render, req *http.Request) {
+	clusterName, err := figureClusterName(getClusterHint(params))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	dashboard, err := logic.ReadClusterDashboard(clusterName)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	etag, err := dashboard.ETag()
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	r.Header().Set("ETag", etag)
+	r.Header().Set("Cache-Control", "no-cache")
+	if etagMatches(req.Header.Get("If-None-Match"), etag) {
+		r.Status(http.StatusNotModified)
+		return
+	}
+	r.JSON(http.StatusOK, dashboard)
+}
+
 // Cluster provides list of instances in given cluster
 func (this *HttpAPI) ClusterInfoByAlias(params martini.Params, r render.Render, req *http.Request) {
 	clusterName, err := inst.GetClusterByAlias(params["clusterAlias"])
@@ -1781,6 +2108,23 @@ func (this *HttpAPI) ClusterOSCReplicas(params martini.Params, r render.Render,
 	r.JSON(http.StatusOK, instances)
 }
 
+// LongRunningQueries returns the long running queries and transactions last sampled on a given cluster
+func (this *HttpAPI) LongRunningQueries(params martini.Params, r render.Render, req *http.Request) {
+	clusterName, err := figureClusterName(getClusterHint(params))
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+
+	processes, err := inst.ReadClusterLongRunningQueries(clusterName)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+
+	r.JSON(http.StatusOK, processes)
+}
+
 // SetClusterAlias will change an alias for a given clustername
 func (this *HttpAPI) SetClusterAliasManualOverride(params martini.Params, r render.Render, req *http.Request, user auth.User) {
 	if !isAuthorizedForAction(req, user) {
@@ -1804,6 +2148,67 @@ func (this *HttpAPI) SetClusterAliasManualOverride(params martini.Params, r rend
 	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Cluster %s now has alias '%s'", clusterName, alias)})
 }
 
+// LinkCluster marks an instance as the master of a downstream cluster, linked to the cluster it replicates from
+func (this *HttpAPI) LinkCluster(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		return
+	}
+	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+	link, err := inst.NewClusterLink(&instanceKey, params["alias"])
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	if orcraft.IsRaftEnabled() {
+		_, err = orcraft.PublishCommand("link-cluster", link)
+	} else {
+		err = inst.WriteClusterLink(link)
+	}
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("%+v linked as master of downstream cluster %s", instanceKey, link.DownstreamClusterAlias), Details: link})
+}
+
+// UnlinkCluster removes a cluster link
+func (this *HttpAPI) UnlinkCluster(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		return
+	}
+	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+	if orcraft.IsRaftEnabled() {
+		_, err = orcraft.PublishCommand("unlink-cluster", instanceKey)
+	} else {
+		err = inst.UnlinkCluster(&instanceKey)
+	}
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("%+v unlinked", instanceKey), Details: instanceKey})
+}
+
+// ClusterLinks lists all cluster links
+func (this *HttpAPI) ClusterLinks(params martini.Params, r render.Render, req *http.Request) {
+	links, err := inst.ReadClusterLinks()
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	r.JSON(http.StatusOK, links)
+}
+
 // Clusters provides list of known clusters
 func (this *HttpAPI) Clusters(params martini.Params, r render.Render, req *http.Request) {
 	clusterNames, err := inst.ReadClusters()
@@ -1965,6 +2370,50 @@ func (this *HttpAPI) SubmitMastersToKvStores(params martini.Params, r render.Ren
 	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Submitted %d masters", submittedCount), Details: kvPairs})
 }
 
+// ReplicaPools returns a cluster's replica pool, or replica pools of all clusters
+func (this *HttpAPI) ReplicaPools(params martini.Params, r render.Render, req *http.Request) {
+	clusterName, err := getClusterNameIfExists(params)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	pools, err := inst.ReadReplicaPools(clusterName)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	r.JSON(http.StatusOK, pools)
+}
+
+// SubmitReplicaPoolsToKvStores writes a cluster's replica pool (or all clusters replica pools) to kv stores.
+func (this *HttpAPI) SubmitReplicaPoolsToKvStores(params martini.Params, r render.Render, req *http.Request) {
+	clusterName, err := getClusterNameIfExists(params)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	kvPairs, submittedCount, err := logic.SubmitReplicaPoolsToKvStores(clusterName, true)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Submitted %d replica pools", submittedCount), Details: kvPairs})
+}
+
+// SyncProxySQLReaders updates ProxySQL reader hostgroups to reflect clusters' healthy replicas
+func (this *HttpAPI) SyncProxySQLReaders(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !isAuthorizedForAction(req, user) {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		return
+	}
+	syncedCount, err := logic.SyncProxySQLReaders(true)
+	if err != nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Synced %d reader hostgroups", syncedCount), Details: syncedCount})
+}
+
 // Clusters provides list of known masters
 func (this *HttpAPI) Masters(params martini.Params, r render.Render, req *http.Request) {
 	instances, err := inst.ReadWriteableClustersMasters()
@@ -2961,10 +3410,26 @@ func (this *HttpAPI) ReloadConfiguration(params martini.Params, r render.Render,
 		Respond(r, &APIResponse{Code: ERROR, Message: "Unauthorized"})
 		return
 	}
-	config.Reload()
-	inst.AuditOperation("reload-configuration", nil, "Triggered via API")
+	report := logic.ReloadConfiguration("API")
+	if report.Error != "" {
+		Respond(r, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Config not reloaded: %s", report.Error), Details: report})
+		return
+	}
+	if !report.Success {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Config reloaded; some settings failed to apply", Details: report})
+		return
+	}
+	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Config reloaded"), Details: report})
+}
 
-	Respond(r, &APIResponse{Code: OK, Message: fmt.Sprintf("Config reloaded")})
+// ReloadReport shows which settings the last configuration reload changed, and whether they took effect
+func (this *HttpAPI) ReloadReport(params martini.Params, r render.Render, req *http.Request) {
+	report := config.LastReloadReport()
+	if report == nil {
+		Respond(r, &APIResponse{Code: ERROR, Message: "Config has not been reloaded"})
+		return
+	}
+	r.JSON(http.StatusOK, report)
 }
 
 // ReplicationAnalysis retuens list of issues
@@ -3225,6 +3690,85 @@ func (this *HttpAPI) AuditRecoverySteps(params martini.Params, r render.Render,
 	r.JSON(http.StatusOK, audits)
 }
 
+// Events streams this node's topology and recovery events as server-sent events, optionally filtered
+// by cluster and by a comma delimited list of event types. A client resumes a stream by passing the
+// id of the last event it has seen, via Last-Event-ID header or last-event-id query param.
+func (this *HttpAPI) Events(params martini.Params, w http.ResponseWriter, req *http.Request) {
+	clusterName, err := getClusterNameIfExists(params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter, err := events.NewFilter(clusterName, req.URL.Query().Get("types"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	lastEventId := req.Header.Get("Last-Event-ID")
+	if lastEventId == "" {
+		lastEventId = req.URL.Query().Get("last-event-id")
+	}
+	afterId, _ := strconv.ParseInt(lastEventId, 10, 64)
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	subscription, backlog := events.Subscribe(filter, afterId)
+	defer subscription.Unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	writeEvent := func(event *events.Event) error {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Id, event.Type, data)
+		return err
+	}
+	for _, event := range backlog {
+		if err := writeEvent(event); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	keepaliveTicker := time.NewTicker(eventsKeepaliveInterval)
+	defer keepaliveTicker.Stop()
+	for {
+		select {
+		case event, ok := <-subscription.Events:
+			if !ok {
+				// Fell behind; the client is expected to reconnect and resume
+				return
+			}
+			if err := writeEvent(event); err != nil {
+				return
+			}
+		case <-keepaliveTicker.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		case <-req.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// IsEventStreamRequest checks whether given request is for an event stream, which must not be buffered
+func IsEventStreamRequest(req *http.Request) bool {
+	if req.Header.Get("Accept") == "text/event-stream" {
+		return true
+	}
+	return strings.HasPrefix(req.URL.Path, fmt.Sprintf("%s/api/events", config.Config.URLPrefix))
+}
+
 // ReadReplicationAnalysisChangelog lists instances and their analysis changelog
 func (this *HttpAPI) ReadReplicationAnalysisChangelog(params martini.Params, r render.Render, req *http.Request) {
 	changelogs, err := inst.ReadReplicationAnalysisChangelog()
@@ -3583,6 +4127,11 @@ func (this *HttpAPI) RegisterRequests(m *martini.ClassicMartini) {
 	this.registerAPIRequest(m, "relocate-below/:host/:port/:belowHost/:belowPort", this.RelocateBelow)
 	this.registerAPIRequest(m, "relocate-slaves/:host/:port/:belowHost/:belowPort", this.RelocateReplicas)
 	this.registerAPIRequest(m, "regroup-slaves/:host/:port", this.RegroupReplicas)
+	this.registerAPIRequest(m, "plan-topology/:clusterHint", this.PlanTopology)
+	this.registerAPIRequest(m, "apply-topology/:clusterHint", this.ApplyTopology)
+	this.registerAPIRequest(m, "resume-topology-plan/:clusterHint", this.ResumeTopologyPlan)
+	this.registerAPIRequest(m, "topology-plan/:planId", this.TopologyPlan)
+	this.registerAPIRequest(m, "topology-plans/:clusterHint", this.TopologyPlans)
 
 	// Classic file:pos relocation:
 	this.registerAPIRequest(m, "move-up/:host/:port", this.MoveUp)
@@ -3650,6 +4199,10 @@ func (this *HttpAPI) RegisterRequests(m *martini.ClassicMartini) {
 
 	// Binary logs:
 	this.registerAPIRequest(m, "last-pseudo-gtid/:host/:port", this.LastPseudoGTID)
+	this.registerAPIRequest(m, "binlog-events/:host/:port/:logFile/:logPos", this.BinlogEvents)
+	this.registerAPIRequest(m, "relaylog-events/:host/:port/:logFile/:logPos", this.RelaylogEvents)
+	this.registerAPIRequest(m, "correlate-binlog-pos/:host/:port/:logFile/:logPos/:belowHost/:belowPort", this.CorrelateBinlogCoordinates)
+	this.registerAPIRequest(m, "correlate-relaylog-pos/:host/:port/:logFile/:logPos/:belowHost/:belowPort", this.CorrelateRelaylogCoordinates)
 
 	// Pools:
 	this.registerAPIRequest(m, "submit-pool-instances/:pool", this.SubmitPoolInstances)
@@ -3670,8 +4223,14 @@ func (this *HttpAPI) RegisterRequests(m *martini.ClassicMartini) {
 	this.registerAPIRequest(m, "cluster/instance/:host/:port", this.ClusterByInstance)
 	this.registerAPIRequest(m, "cluster-info/:clusterHint", this.ClusterInfo)
 	this.registerAPIRequest(m, "cluster-info/alias/:clusterAlias", this.ClusterInfoByAlias)
+	this.registerAPIRequest(m, "cluster-config/:clusterHint", this.ClusterConfig)
+	this.registerAPIRequest(m, "cluster-dashboard/:clusterHint", this.ClusterDashboard)
 	this.registerAPIRequest(m, "cluster-osc-slaves/:clusterHint", this.ClusterOSCReplicas)
+	this.registerAPIRequest(m, "long-running-queries/:clusterHint", this.LongRunningQueries)
 	this.registerAPIRequest(m, "set-cluster-alias/:clusterName", this.SetClusterAliasManualOverride)
+	this.registerAPIRequest(m, "link-cluster/:host/:port/:alias", this.LinkCluster)
+	this.registerAPIRequest(m, "unlink-cluster/:host/:port", this.UnlinkCluster)
+	this.registerAPIRequest(m, "cluster-links", this.ClusterLinks)
 	this.registerAPIRequest(m, "clusters", this.Clusters)
 	this.registerAPIRequest(m, "clusters-info", this.ClustersInfo)
 
@@ -3692,6 +4251,11 @@ func (this *HttpAPI) RegisterRequests(m *martini.ClassicMartini) {
 	// Key-value:
 	this.registerAPIRequest(m, "submit-masters-to-kv-stores", this.SubmitMastersToKvStores)
 	this.registerAPIRequest(m, "submit-masters-to-kv-stores/:clusterHint", this.SubmitMastersToKvStores)
+	this.registerAPIRequest(m, "replica-pools", this.ReplicaPools)
+	this.registerAPIRequest(m, "replica-pools/:clusterHint", this.ReplicaPools)
+	this.registerAPIRequest(m, "submit-replica-pools-to-kv-stores", this.SubmitReplicaPoolsToKvStores)
+	this.registerAPIRequest(m, "submit-replica-pools-to-kv-stores/:clusterHint", this.SubmitReplicaPoolsToKvStores)
+	this.registerAPIRequest(m, "proxysql-sync-readers", this.SyncProxySQLReaders)
 
 	// Tags:
 	this.registerAPIRequest(m, "tagged", this.Tagged)
@@ -3712,6 +4276,10 @@ func (this *HttpAPI) RegisterRequests(m *martini.ClassicMartini) {
 	this.registerAPIRequest(m, "refresh/:host/:port", this.Refresh)
 	this.registerAPIRequest(m, "forget/:host/:port", this.Forget)
 	this.registerAPIRequest(m, "forget-cluster/:clusterHint", this.ForgetCluster)
+	this.registerAPIRequest(m, "garbage-report", this.GarbageReport)
+	this.registerAPIRequest(m, "garbage-report/:duration", this.GarbageReport)
+	this.registerAPIRequest(m, "forget-garbage", this.ForgetGarbage)
+	this.registerAPIRequest(m, "forget-garbage/:duration", this.ForgetGarbage)
 	this.registerAPIRequest(m, "begin-maintenance/:host/:port/:owner/:reason", this.BeginMaintenance)
 	this.registerAPIRequest(m, "end-maintenance/:host/:port", this.EndMaintenanceByInstanceKey)
 	this.registerAPIRequest(m, "in-maintenance/:host/:port", this.InMaintenance)
@@ -3754,6 +4322,8 @@ func (this *HttpAPI) RegisterRequests(m *martini.ClassicMartini) {
 	this.registerAPIRequest(m, "audit-recovery/alias/:clusterAlias", this.AuditRecovery)
 	this.registerAPIRequest(m, "audit-recovery/alias/:clusterAlias/:page", this.AuditRecovery)
 	this.registerAPIRequest(m, "audit-recovery-steps/:uid", this.AuditRecoverySteps)
+	this.registerAPIRequest(m, "events", this.Events)
+	this.registerAPIRequest(m, "events/:clusterHint", this.Events)
 	this.registerAPIRequest(m, "active-cluster-recovery/:clusterName", this.ActiveClusterRecovery)
 	this.registerAPIRequest(m, "recently-active-cluster-recovery/:clusterName", this.RecentlyActiveClusterRecovery)
 	this.registerAPIRequest(m, "recently-active-instance-recovery/:host/:port", this.RecentlyActiveInstanceRecovery)
@@ -3795,6 +4365,7 @@ func (this *HttpAPI) RegisterRequests(m *martini.ClassicMartini) {
 	this.registerAPIRequestNoProxy(m, "raft-snapshot", this.RaftSnapshot)
 	this.registerAPIRequestNoProxy(m, "raft-follower-health-report/:authenticationToken/:raftBind/:raftAdvertise", this.RaftFollowerHealthReport)
 	this.registerAPIRequestNoProxy(m, "reload-configuration", this.ReloadConfiguration)
+	this.registerAPIRequestNoProxy(m, "reload-report", this.ReloadReport)
 	this.registerAPIRequestNoProxy(m, "hostname-resolve-cache", this.HostnameResolveCache)
 	this.registerAPIRequestNoProxy(m, "reset-hostname-resolve-cache", this.ResetHostnameResolveCache)
 	// Meta
@@ -3836,6 +4407,9 @@ func (this *HttpAPI) RegisterRequests(m *martini.ClassicMartini) {
 	this.registerAPIRequest(m, "agent-custom-command/:host/:command", this.AgentCustomCommand)
 	this.registerAPIRequest(m, "seeds", this.Seeds)
 
+	// Versioned API
+	this.registerAPIv2Requests(m)
+
 	// Configurable status check endpoint
 	m.Get(config.Config.StatusEndpoint, this.StatusCheck)
 }
@@ -1,12 +1,17 @@
 package http
 
 import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 
 	"github.com/go-martini/martini"
 
 	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/events"
 	"github.com/openark/golib/log"
 	test "github.com/openark/golib/tests"
 )
@@ -53,3 +58,64 @@ func TestKnownPaths(t *testing.T) {
 		test.S(t).ExpectTrue(pathsMap[synonym])
 	}
 }
+
+func TestEvents(t *testing.T) {
+	m := martini.Classic()
+	api := HttpAPI{}
+	m.Get("/api/events", api.Events)
+	server := httptest.NewServer(m)
+	defer server.Close()
+
+	{
+		resp, err := http.Get(server.URL + "/api/events?types=no-such-event")
+		test.S(t).ExpectNil(err)
+		resp.Body.Close()
+		test.S(t).ExpectEquals(resp.StatusCode, http.StatusBadRequest)
+	}
+	{
+		previous := events.Publish(events.DowntimeBegun, "c1", "db-1", 3306, "", nil)
+		event := events.Publish(events.DowntimeEnded, "c1", "db-1", 3306, "", nil)
+
+		req, _ := http.NewRequest("GET", server.URL+"/api/events?types=downtime-ended", nil)
+		req.Header.Set("Last-Event-ID", fmt.Sprintf("%d", previous.Id))
+		resp, err := http.DefaultClient.Do(req)
+		test.S(t).ExpectNil(err)
+		defer resp.Body.Close()
+		test.S(t).ExpectEquals(resp.Header.Get("Content-Type"), "text/event-stream")
+
+		reader := bufio.NewReader(resp.Body)
+		line, _ := reader.ReadString('\n')
+		test.S(t).ExpectEquals(line, fmt.Sprintf("id: %d\n", event.Id))
+		line, _ = reader.ReadString('\n')
+		test.S(t).ExpectEquals(line, "event: downtime-ended\n")
+		line, _ = reader.ReadString('\n')
+		test.S(t).ExpectTrue(strings.HasPrefix(line, "data: {"))
+		test.S(t).ExpectTrue(strings.Contains(line, `"Hostname":"db-1"`))
+	}
+}
+
+func TestIsEventStreamRequest(t *testing.T) {
+	{
+		req, _ := http.NewRequest("GET", "/api/events/mycluster", nil)
+		test.S(t).ExpectTrue(IsEventStreamRequest(req))
+	}
+	{
+		req, _ := http.NewRequest("GET", "/api/cluster/mycluster", nil)
+		test.S(t).ExpectFalse(IsEventStreamRequest(req))
+		req.Header.Set("Accept", "text/event-stream")
+		test.S(t).ExpectTrue(IsEventStreamRequest(req))
+	}
+}
+
+func TestETagMatches(t *testing.T) {
+	etag := `"0123abcd"`
+	test.S(t).ExpectTrue(etagMatches(`"0123abcd"`, etag))
+	test.S(t).ExpectTrue(etagMatches(`W/"0123abcd"`, etag))
+	test.S(t).ExpectTrue(etagMatches(`"ffff", "0123abcd"`, etag))
+	test.S(t).ExpectTrue(etagMatches(`*`, etag))
+	test.S(t).ExpectFalse(etagMatches(``, etag))
+	test.S(t).ExpectFalse(etagMatches(`"ffff"`, etag))
+	test.S(t).ExpectFalse(etagMatches(`0123abcd`, etag))
+	test.S(t).ExpectTrue(etagMatches(`W/"0123abcd"`, `W/"0123abcd"`))
+	test.S(t).ExpectTrue(etagMatches(`"0123abcd"`, `W/"0123abcd"`))
+}
@@ -0,0 +1,84 @@
+/*
+   Copyright 2019 GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package http
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/go-martini/martini"
+	"github.com/martini-contrib/auth"
+
+	"github.com/openark/golib/log"
+
+	"github.com/github/orchestrator/go/process"
+)
+
+const bearerAuthorizationPrefix = "Bearer "
+
+// apiTokenContextKey keys the API token authenticating a request in the request's context
+type apiTokenContextKey struct{}
+
+// bearerToken returns the token given by an "Authorization: Bearer" header, if any
+func bearerToken(req *http.Request) string {
+	authorization := req.Header.Get("Authorization")
+	if len(authorization) <= len(bearerAuthorizationPrefix) || !strings.EqualFold(authorization[:len(bearerAuthorizationPrefix)], bearerAuthorizationPrefix) {
+		return ""
+	}
+	return strings.TrimSpace(authorization[len(bearerAuthorizationPrefix):])
+}
+
+// isJWT checks whether given bearer token is a JWT, "<header>.<payload>.<signature>", rather than an API token
+func isJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// requestAPIToken returns the API token authenticating given request, or nil if the request is
+// otherwise authenticated
+func requestAPIToken(req *http.Request) *process.APIToken {
+	apiToken, _ := req.Context().Value(apiTokenContextKey{}).(*process.APIToken)
+	return apiToken
+}
+
+// AuthenticateAPIToken returns a handler authenticating requests which bear an "Authorization: Bearer"
+// header by API token: the token's service account is the authenticated user. Other requests, JWT
+// bearers included, are handed to given handler, that of the configured AuthenticationMethod.
+func AuthenticateAPIToken(authenticate martini.Handler) martini.Handler {
+	return func(w http.ResponseWriter, req *http.Request, c martini.Context) {
+		token := bearerToken(req)
+		if token == "" || isJWT(token) {
+			if _, err := c.Invoke(authenticate); err != nil {
+				log.Errore(err)
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}
+			return
+		}
+		apiToken, err := process.ValidateAPIToken(token)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		if apiToken == nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="orchestrator"`)
+			http.Error(w, "Not Authorized", http.StatusUnauthorized)
+			return
+		}
+		c.Map(auth.User(apiToken.Name))
+		c.Map(req.WithContext(context.WithValue(req.Context(), apiTokenContextKey{}, apiToken)))
+	}
+}
@@ -0,0 +1,78 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-martini/martini"
+	"github.com/martini-contrib/auth"
+
+	test "github.com/openark/golib/tests"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/process"
+)
+
+func TestBearerToken(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "/api/v2/clusters", nil)
+	test.S(t).ExpectEquals(bearerToken(req), "")
+	req.Header.Set("Authorization", "Basic dXNlcjpwYXNz")
+	test.S(t).ExpectEquals(bearerToken(req), "")
+	req.Header.Set("Authorization", "Bearer ")
+	test.S(t).ExpectEquals(bearerToken(req), "")
+	req.Header.Set("Authorization", "bearer 0123abcd.secret")
+	test.S(t).ExpectEquals(bearerToken(req), "0123abcd.secret")
+}
+
+func TestAuthenticateAPITokenFallback(t *testing.T) {
+	m := martini.Classic()
+	m.Use(AuthenticateAPIToken(auth.Basic("admin", "secret")))
+	m.Get("/whoami", func(user auth.User, req *http.Request) string {
+		test.S(t).ExpectTrue(requestAPIToken(req) == nil)
+		return string(user)
+	})
+	server := httptest.NewServer(m)
+	defer server.Close()
+
+	{
+		resp, err := http.Get(server.URL + "/whoami")
+		test.S(t).ExpectNil(err)
+		resp.Body.Close()
+		test.S(t).ExpectEquals(resp.StatusCode, http.StatusUnauthorized)
+	}
+	{
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/whoami", nil)
+		req.SetBasicAuth("admin", "secret")
+		resp, err := http.DefaultClient.Do(req)
+		test.S(t).ExpectNil(err)
+		resp.Body.Close()
+		test.S(t).ExpectEquals(resp.StatusCode, http.StatusOK)
+	}
+}
+
+func TestIsAuthorizedForClusterActionByAPIToken(t *testing.T) {
+	defer func(authenticationMethod string) { config.Config.AuthenticationMethod = authenticationMethod }(config.Config.AuthenticationMethod)
+	config.Config.AuthenticationMethod = "multi"
+
+	requestWithToken := func(apiToken *process.APIToken) *http.Request {
+		req, _ := http.NewRequest(http.MethodPost, "/api/v2/clusters/c1/graceful-master-takeover", nil)
+		return req.WithContext(context.WithValue(req.Context(), apiTokenContextKey{}, apiToken))
+	}
+	readToken := &process.APIToken{Name: "dashboard", Scope: process.APITokenScopeRead}
+	writeToken := &process.APIToken{Name: "deploy-bot", Scope: process.APITokenScopeWrite}
+	clusterToken := &process.APIToken{Name: "failover-bot", Scope: process.APITokenScopeWrite, ClusterName: "c1"}
+
+	test.S(t).ExpectFalse(isAuthorizedForClusterAction(requestWithToken(readToken), auth.User(readToken.Name), "c1"))
+	test.S(t).ExpectTrue(isAuthorizedForClusterAction(requestWithToken(writeToken), auth.User(writeToken.Name), "c1"))
+	test.S(t).ExpectTrue(isAuthorizedForClusterAction(requestWithToken(writeToken), auth.User(writeToken.Name), ""))
+	test.S(t).ExpectTrue(isAuthorizedForClusterAction(requestWithToken(clusterToken), auth.User(clusterToken.Name), "c1"))
+	test.S(t).ExpectFalse(isAuthorizedForClusterAction(requestWithToken(clusterToken), auth.User(clusterToken.Name), "c2"))
+	test.S(t).ExpectFalse(isAuthorizedForClusterAction(requestWithToken(clusterToken), auth.User(clusterToken.Name), ""))
+
+	// The token's service account is the user, even where the user name means otherwise
+	req := requestWithToken(&process.APIToken{Name: "readonly", Scope: process.APITokenScopeWrite})
+	test.S(t).ExpectTrue(isAuthorizedForClusterAction(req, auth.User("readonly"), "c1"))
+	test.S(t).ExpectEquals(getUserId(req, auth.User("readonly")), "readonly")
+}
@@ -0,0 +1,1115 @@
+/*
+   Copyright 2019 GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package http
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-martini/martini"
+	"github.com/martini-contrib/auth"
+	"github.com/martini-contrib/render"
+
+	"github.com/openark/golib/util"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/inst"
+	"github.com/github/orchestrator/go/logic"
+	"github.com/github/orchestrator/go/process"
+	orcraft "github.com/github/orchestrator/go/raft"
+)
+
+// APIVersion2 is the path, under /api, of the versioned API
+const APIVersion2 = "v2"
+
+// API v2 error codes, by HTTP status
+var apiErrorCodes = map[int]string{
+	http.StatusBadRequest:          "bad_request",
+	http.StatusUnauthorized:        "unauthorized",
+	http.StatusForbidden:           "forbidden",
+	http.StatusNotFound:            "not_found",
+	http.StatusConflict:            "conflict",
+	http.StatusInternalServerError: "internal_error",
+	http.StatusServiceUnavailable:  "unavailable",
+}
+
+// APIError is the body of an /api/v2 error response. Code is one of bad_request, unauthorized,
+// forbidden, not_found, conflict, internal_error or unavailable, matching the response's HTTP status.
+type APIError struct {
+	Code    string
+	Message string
+
+	status int
+}
+
+func newAPIError(status int, format string, args ...interface{}) *APIError {
+	return &APIError{Code: apiErrorCodes[status], Message: fmt.Sprintf(format, args...), status: status}
+}
+
+func (this *APIError) Error() string {
+	return this.Message
+}
+
+// Status returns the HTTP status of this error
+func (this *APIError) Status() int {
+	return this.status
+}
+
+// toAPIError returns given error as an APIError; errors not already so are internal errors
+func toAPIError(err error) *APIError {
+	if apiError, ok := err.(*APIError); ok {
+		return apiError
+	}
+	return newAPIError(http.StatusInternalServerError, "%+v", err)
+}
+
+// apiV2Parameter is a query parameter of an API v2 route
+type apiV2Parameter struct {
+	Name        string
+	Description string
+	Type        string // OpenAPI type: string, integer or boolean
+}
+
+// apiV2Handler serves an API v2 request. It returns the response body, or nil for 204 No Content.
+type apiV2Handler func(request *apiV2Request) (interface{}, error)
+
+// apiV2Route is a route of the versioned API. Routes are the source of both request registration
+// and the OpenAPI document.
+type apiV2Route struct {
+	Method     string
+	Path       string // martini pattern, under /api/v2, e.g. "instances/:host/:port"
+	Tag        string
+	Summary    string
+	Query      []apiV2Parameter
+	Request    interface{} // Zero value of the JSON request body, nil when none
+	Response   interface{} // Zero value of the response body, nil for 204 No Content
+	NoProxy    bool        // When false, authorized routes are proxied to the raft leader
+	Restricted bool        // When true, the route requires authorization even though it does not change state
+	Handler    apiV2Handler
+}
+
+// isMutation checks whether this route changes state
+func (this *apiV2Route) isMutation() bool {
+	return this.Method != http.MethodGet
+}
+
+// requiresAuthorization checks whether this route requires authorization: mutations and restricted reads do
+func (this *apiV2Route) requiresAuthorization() bool {
+	return this.isMutation() || this.Restricted
+}
+
+// apiV2Request is an API v2 request, as given to handlers
+type apiV2Request struct {
+	params martini.Params
+	req    *http.Request
+	user   auth.User
+}
+
+// instanceKey returns the instance key given by the host and port path parameters
+func (this *apiV2Request) instanceKey() (inst.InstanceKey, error) {
+	instanceKey, err := API.getInstanceKey(this.params["host"], this.params["port"])
+	if err != nil {
+		return instanceKey, newAPIError(http.StatusBadRequest, "%+v", err)
+	}
+	return instanceKey, nil
+}
+
+// resolveInstanceKey validates and resolves an instance key given in a request body. As such an instance,
+// e.g. the instance to relocate below, may be of another cluster than the path's, a cluster scoped API
+// token must be authorized for its cluster as well.
+func (this *apiV2Request) resolveInstanceKey(name string, instanceKey *inst.InstanceKey) (inst.InstanceKey, error) {
+	if instanceKey == nil || instanceKey.Hostname == "" {
+		return emptyInstanceKey, newAPIError(http.StatusBadRequest, "%s: expected Hostname and Port", name)
+	}
+	resolvedKey, err := API.getInstanceKey(instanceKey.Hostname, fmt.Sprintf("%d", instanceKey.Port))
+	if err != nil {
+		return resolvedKey, newAPIError(http.StatusBadRequest, "%s: %+v", name, err)
+	}
+	if apiToken := requestAPIToken(this.req); apiToken != nil && apiToken.ClusterName != "" {
+		clusterName, _ := inst.FigureClusterName("", &resolvedKey, nil)
+		if !apiToken.CanWrite(clusterName) {
+			return resolvedKey, newAPIError(http.StatusForbidden, "Unauthorized: %s: %+v is not in cluster %s", name, resolvedKey.StringCode(), apiToken.ClusterName)
+		}
+	}
+	return resolvedKey, nil
+}
+
+// clusterName returns the cluster name given by the cluster path parameter: a cluster name, alias, or instance
+func (this *apiV2Request) clusterName() (string, error) {
+	clusterName, err := figureClusterName(this.params["cluster"])
+	if err != nil {
+		return clusterName, newAPIError(http.StatusNotFound, "Cluster not found: %s", this.params["cluster"])
+	}
+	return clusterName, nil
+}
+
+// tokenScopeClusterName returns the name of the cluster this request acts on, by its cluster or instance
+// path parameters, for authorizing a cluster scoped API token. It is empty for other requests, and for
+// requests not acting on a known cluster.
+func (this *apiV2Request) tokenScopeClusterName() string {
+	if apiToken := requestAPIToken(this.req); apiToken == nil || apiToken.ClusterName == "" {
+		return ""
+	}
+	if this.params["cluster"] != "" {
+		clusterName, _ := figureClusterName(this.params["cluster"])
+		return clusterName
+	}
+	if this.params["host"] != "" {
+		instanceKey, err := this.instanceKey()
+		if err != nil {
+			return ""
+		}
+		clusterName, _ := inst.FigureClusterName("", &instanceKey, nil)
+		return clusterName
+	}
+	return ""
+}
+
+// decodeBody decodes the JSON request body into given value. An empty body leaves the value as is;
+// unknown fields are rejected.
+func (this *apiV2Request) decodeBody(value interface{}) error {
+	if this.req.Body == nil {
+		return nil
+	}
+	decoder := json.NewDecoder(this.req.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(value); err != nil && err != io.EOF {
+		return newAPIError(http.StatusBadRequest, "Invalid request body: %+v", err)
+	}
+	return nil
+}
+
+// queryInt returns an integer query parameter, or given default when missing
+func (this *apiV2Request) queryInt(name string, defaultValue int) (int, error) {
+	value := this.req.URL.Query().Get(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+	intValue, err := strconv.Atoi(value)
+	if err != nil || intValue < 0 {
+		return defaultValue, newAPIError(http.StatusBadRequest, "%s: expected non-negative integer, got %s", name, value)
+	}
+	return intValue, nil
+}
+
+// userId identifies the user making the request, for owning acknowledgements, downtime and maintenance
+func (this *apiV2Request) userId() string {
+	if userId := getUserId(this.req, this.user); userId != "" {
+		return userId
+	}
+	return inst.GetMaintenanceOwner()
+}
+
+// contentETag returns an entity tag for given response content
+func contentETag(content []byte) string {
+	hash := sha256.Sum256(content)
+	return fmt.Sprintf(`"%s"`, hex.EncodeToString(hash[:16]))
+}
+
+// respondV2 writes an API v2 response: the JSON result, with an ETag on reads, or an APIError
+func respondV2(route *apiV2Route, result interface{}, err error, w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if err != nil {
+		apiError := toAPIError(err)
+		w.WriteHeader(apiError.Status())
+		json.NewEncoder(w).Encode(apiError)
+		return
+	}
+	if result == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	content, err := json.Marshal(result)
+	if err != nil {
+		respondV2(route, nil, err, w, req)
+		return
+	}
+	if !route.isMutation() {
+		etag := contentETag(content)
+		w.Header().Set("ETag", etag)
+		if etagMatches(req.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(content)
+}
+
+// registerAPIv2Route registers an API v2 route, authorizing mutations and restricted reads
+func (this *HttpAPI) registerAPIv2Route(m *martini.ClassicMartini, route apiV2Route) {
+	fullPath := fmt.Sprintf("%s/api/%s/%s", this.URLPrefix, APIVersion2, route.Path)
+	handler := func(params martini.Params, w http.ResponseWriter, req *http.Request, user auth.User) {
+		request := &apiV2Request{params: params, req: req, user: user}
+		if route.requiresAuthorization() && !isAuthorizedForClusterAction(req, user, request.tokenScopeClusterName()) {
+			respondV2(&route, nil, newAPIError(http.StatusForbidden, "Unauthorized"), w, req)
+			return
+		}
+		result, err := route.Handler(request)
+		respondV2(&route, result, err, w, req)
+	}
+	if route.requiresAuthorization() && !route.NoProxy && config.Config.RaftEnabled {
+		m.AddRoute(route.Method, fullPath, raftReverseProxy, handler)
+	} else {
+		m.AddRoute(route.Method, fullPath, handler)
+	}
+}
+
+// registerAPIv2Requests registers all API v2 routes, and the OpenAPI document describing them
+func (this *HttpAPI) registerAPIv2Requests(m *martini.ClassicMartini) {
+	for _, route := range this.apiV2Routes() {
+		this.registerAPIv2Route(m, route)
+	}
+	m.Get(fmt.Sprintf("%s/api/%s/openapi.json", this.URLPrefix, APIVersion2), func(r render.Render) {
+		r.JSON(http.StatusOK, this.OpenAPIDocument())
+	})
+}
+
+// Request and response bodies of API v2 routes
+
+// InstanceKeyRequest names an instance, e.g. the instance to relocate below
+type InstanceKeyRequest struct {
+	Hostname string
+	Port     int
+}
+
+func (this *InstanceKeyRequest) instanceKey() *inst.InstanceKey {
+	if this == nil {
+		return nil
+	}
+	return &inst.InstanceKey{Hostname: this.Hostname, Port: this.Port}
+}
+
+// RelocateRequest is the body of instance relocation
+type RelocateRequest struct {
+	Below InstanceKeyRequest
+}
+
+// RelocateReplicasRequest is the body of replicas relocation
+type RelocateReplicasRequest struct {
+	Below   InstanceKeyRequest
+	Pattern string // Optional; only relocate replicas whose name matches this regular expression
+}
+
+// RelocateReplicasResponse lists relocated replicas, and errors relocating others
+type RelocateReplicasResponse struct {
+	Replicas [](*inst.Instance)
+	Errors   []string
+}
+
+// MoveBelowRequest is the body of moving an instance below its sibling
+type MoveBelowRequest struct {
+	Sibling InstanceKeyRequest
+}
+
+// ReadOnlyRequest is the body of setting an instance read-only or writeable
+type ReadOnlyRequest struct {
+	ReadOnly bool
+}
+
+// DowntimeRequest is the body of beginning downtime
+type DowntimeRequest struct {
+	Owner    string // Defaults to the authenticated user
+	Reason   string
+	Duration string // e.g. "30m", "4h", "2d"; defaults to MaintenanceExpireMinutes
+}
+
+// MaintenanceRequest is the body of beginning maintenance
+type MaintenanceRequest struct {
+	Owner    string // Defaults to the authenticated user
+	Reason   string
+	Duration string // e.g. "30m", "4h"; defaults to MaintenanceExpireMinutes
+}
+
+// MaintenanceResponse identifies begun maintenance
+type MaintenanceResponse struct {
+	MaintenanceKey int64
+}
+
+// TagRequest is the body of tagging an instance
+type TagRequest struct {
+	Name  string
+	Value string
+}
+
+// RecoverRequest is the body of recovering a failed instance
+type RecoverRequest struct {
+	Candidate     *InstanceKeyRequest // Optional; the instance to promote
+	SkipProcesses bool                // Skip recovery hooks
+}
+
+// RecoverResponse names the instance promoted by a recovery
+type RecoverResponse struct {
+	SuccessorKey inst.InstanceKey
+}
+
+// GracefulMasterTakeoverRequest is the body of a graceful master takeover
+type GracefulMasterTakeoverRequest struct {
+	Designated *InstanceKeyRequest // Optional; the replica to promote. Required when the master has more than one replica
+}
+
+// GracefulMasterTakeoverResponse is the recovery of a graceful master takeover, and the promoted
+// master's binary log coordinates at time of promotion
+type GracefulMasterTakeoverResponse struct {
+	Recovery                  *logic.TopologyRecovery
+	PromotedMasterCoordinates *inst.BinlogCoordinates
+}
+
+// AcknowledgeRequest is the body of acknowledging recoveries
+type AcknowledgeRequest struct {
+	Comment string
+}
+
+// GlobalRecoveries tells whether recoveries are globally enabled
+type GlobalRecoveries struct {
+	Enabled bool
+}
+
+// CreateAPITokenRequest is the body of creating an API token for a service account
+type CreateAPITokenRequest struct {
+	Name     string // The service account
+	Scope    string // "read" or "write"; defaults to "read"
+	Cluster  string // Optional; a cluster name, alias or instance. The token may then only change this cluster
+	Duration string // Optional expiry, e.g. "90d"; the token does not expire when empty
+}
+
+// CreateAPITokenResponse is a created API token. This is the only time the token is given.
+type CreateAPITokenResponse struct {
+	Token    string
+	APIToken *process.APIToken
+}
+
+var recoveriesQuery = []apiV2Parameter{
+	{Name: "page", Description: "Page number, starting with 0", Type: "integer"},
+	{Name: "unacknowledged", Description: "When true, only list unacknowledged recoveries", Type: "boolean"},
+}
+
+// apiV2Routes lists the routes of the versioned API
+func (this *HttpAPI) apiV2Routes() []apiV2Route {
+	return []apiV2Route{
+		{Method: http.MethodGet, Path: "status", Tag: "status", Summary: "Health of this orchestrator node", Response: process.HealthStatus{}, Handler: this.v2Status},
+
+		{Method: http.MethodGet, Path: "clusters", Tag: "clusters", Summary: "List clusters", Response: []inst.ClusterInfo{}, Handler: this.v2Clusters},
+		{Method: http.MethodGet, Path: "clusters/:cluster", Tag: "clusters", Summary: "Read a cluster, by name, alias or member instance", Response: inst.ClusterInfo{}, Handler: this.v2Cluster},
+		{Method: http.MethodGet, Path: "clusters/:cluster/instances", Tag: "clusters", Summary: "List a cluster's instances", Response: [](*inst.Instance){}, Handler: this.v2ClusterInstances},
+		{Method: http.MethodGet, Path: "clusters/:cluster/dashboard", Tag: "clusters", Summary: "Read a cluster's topology tree, analysis and recoveries, in one request", Response: logic.ClusterDashboard{}, Handler: this.v2ClusterDashboard},
+		{Method: http.MethodGet, Path: "clusters/:cluster/analysis", Tag: "clusters", Summary: "Analyze a cluster's replication problems", Response: []inst.ReplicationAnalysis{}, Handler: this.v2ClusterAnalysis},
+		{Method: http.MethodGet, Path: "clusters/:cluster/recoveries", Tag: "recoveries", Summary: "List a cluster's recent recoveries", Query: recoveriesQuery, Response: []logic.TopologyRecovery{}, Handler: this.v2ClusterRecoveries},
+		{Method: http.MethodPost, Path: "clusters/:cluster/graceful-master-takeover", Tag: "recoveries", Summary: "Gracefully promote a replica in place of the cluster's master", Request: GracefulMasterTakeoverRequest{}, Response: GracefulMasterTakeoverResponse{}, Handler: this.v2GracefulMasterTakeover},
+		{Method: http.MethodPost, Path: "clusters/:cluster/force-master-failover", Tag: "recoveries", Summary: "Forcibly fail over the cluster's master, even if healthy", Response: logic.TopologyRecovery{}, Handler: this.v2ForceMasterFailover},
+		{Method: http.MethodPost, Path: "clusters/:cluster/acknowledge-recoveries", Tag: "recoveries", Summary: "Acknowledge a cluster's recoveries, unblocking further recoveries", Request: AcknowledgeRequest{}, Handler: this.v2AcknowledgeClusterRecoveries},
+
+		{Method: http.MethodGet, Path: "instances/:host/:port", Tag: "instances", Summary: "Read an instance", Response: inst.Instance{}, Handler: this.v2Instance},
+		{Method: http.MethodDelete, Path: "instances/:host/:port", Tag: "instances", Summary: "Forget an instance", Handler: this.v2ForgetInstance},
+		{Method: http.MethodGet, Path: "instances/:host/:port/replicas", Tag: "instances", Summary: "List an instance's replicas", Response: [](*inst.Instance){}, Handler: this.v2InstanceReplicas},
+		{Method: http.MethodPost, Path: "instances/:host/:port/discover", Tag: "instances", Summary: "Discover an instance", Response: inst.Instance{}, Handler: this.v2Discover},
+		{Method: http.MethodPost, Path: "instances/:host/:port/relocate", Tag: "topology", Summary: "Relocate an instance below another, by any means available", Request: RelocateRequest{}, Response: inst.Instance{}, Handler: this.v2Relocate},
+		{Method: http.MethodPost, Path: "instances/:host/:port/relocate-replicas", Tag: "topology", Summary: "Relocate an instance's replicas below another instance", Request: RelocateReplicasRequest{}, Response: RelocateReplicasResponse{}, Handler: this.v2RelocateReplicas},
+		{Method: http.MethodPost, Path: "instances/:host/:port/move-up", Tag: "topology", Summary: "Move an instance up, to replicate from its grandparent", Response: inst.Instance{}, Handler: this.v2MoveUp},
+		{Method: http.MethodPost, Path: "instances/:host/:port/move-below", Tag: "topology", Summary: "Move an instance below its sibling", Request: MoveBelowRequest{}, Response: inst.Instance{}, Handler: this.v2MoveBelow},
+		{Method: http.MethodPost, Path: "instances/:host/:port/start-replica", Tag: "instances", Summary: "Start replication", Response: inst.Instance{}, Handler: this.v2StartReplica},
+		{Method: http.MethodPost, Path: "instances/:host/:port/stop-replica", Tag: "instances", Summary: "Stop replication", Response: inst.Instance{}, Handler: this.v2StopReplica},
+		{Method: http.MethodPost, Path: "instances/:host/:port/read-only", Tag: "instances", Summary: "Set an instance read-only or writeable", Request: ReadOnlyRequest{}, Response: inst.Instance{}, Handler: this.v2SetReadOnly},
+		{Method: http.MethodPost, Path: "instances/:host/:port/recover", Tag: "recoveries", Summary: "Recover a failed instance, if analysis agrees it has failed", Request: RecoverRequest{}, Response: RecoverResponse{}, Handler: this.v2Recover},
+
+		{Method: http.MethodGet, Path: "downtimes", Tag: "downtime", Summary: "List downtimed instances", Response: [](*inst.Instance){}, Handler: this.v2Downtimes},
+		{Method: http.MethodPost, Path: "instances/:host/:port/downtime", Tag: "downtime", Summary: "Begin downtime, silencing recoveries of an instance", Request: DowntimeRequest{}, Response: inst.Downtime{}, Handler: this.v2BeginDowntime},
+		{Method: http.MethodDelete, Path: "instances/:host/:port/downtime", Tag: "downtime", Summary: "End downtime", Handler: this.v2EndDowntime},
+
+		{Method: http.MethodGet, Path: "maintenance", Tag: "maintenance", Summary: "List active maintenance", Response: []inst.Maintenance{}, Handler: this.v2Maintenance},
+		{Method: http.MethodPost, Path: "instances/:host/:port/maintenance", Tag: "maintenance", Summary: "Begin maintenance, blocking topology changes on an instance", Request: MaintenanceRequest{}, Response: MaintenanceResponse{}, Handler: this.v2BeginMaintenance},
+		{Method: http.MethodDelete, Path: "instances/:host/:port/maintenance", Tag: "maintenance", Summary: "End maintenance", Handler: this.v2EndMaintenance},
+
+		{Method: http.MethodGet, Path: "instances/:host/:port/tags", Tag: "tags", Summary: "List an instance's tags", Response: []string{}, Handler: this.v2Tags},
+		{Method: http.MethodPost, Path: "instances/:host/:port/tags", Tag: "tags", Summary: "Tag an instance", Request: TagRequest{}, Response: []string{}, Handler: this.v2Tag},
+		{Method: http.MethodDelete, Path: "instances/:host/:port/tags/:tagName", Tag: "tags", Summary: "Remove a tag from an instance", Handler: this.v2Untag},
+
+		{Method: http.MethodGet, Path: "analysis", Tag: "recoveries", Summary: "Analyze replication problems of all clusters", Response: []inst.ReplicationAnalysis{}, Handler: this.v2Analysis},
+		{Method: http.MethodGet, Path: "recoveries", Tag: "recoveries", Summary: "List recent recoveries", Query: recoveriesQuery, Response: []logic.TopologyRecovery{}, Handler: this.v2Recoveries},
+		{Method: http.MethodGet, Path: "recoveries/active", Tag: "recoveries", Summary: "List active recoveries", Response: []logic.TopologyRecovery{}, Handler: this.v2ActiveRecoveries},
+		{Method: http.MethodGet, Path: "recoveries/:recoveryId", Tag: "recoveries", Summary: "Read a recovery, by id or uid", Response: logic.TopologyRecovery{}, Handler: this.v2Recovery},
+		{Method: http.MethodPost, Path: "recoveries/:recoveryId/acknowledge", Tag: "recoveries", Summary: "Acknowledge a recovery, by id or uid", Request: AcknowledgeRequest{}, Handler: this.v2AcknowledgeRecovery},
+		{Method: http.MethodGet, Path: "global-recoveries", Tag: "recoveries", Summary: "Check whether recoveries are globally enabled", Response: GlobalRecoveries{}, Handler: this.v2GlobalRecoveries},
+		{Method: http.MethodPost, Path: "global-recoveries", Tag: "recoveries", Summary: "Globally enable or disable recoveries", Request: GlobalRecoveries{}, Response: GlobalRecoveries{}, Handler: this.v2SetGlobalRecoveries},
+
+		{Method: http.MethodGet, Path: "api-tokens", Tag: "api-tokens", Summary: "List API tokens of service accounts", Response: [](*process.APIToken){}, Restricted: true, Handler: this.v2APITokens},
+		{Method: http.MethodPost, Path: "api-tokens", Tag: "api-tokens", Summary: "Create an API token for a service account", Request: CreateAPITokenRequest{}, Response: CreateAPITokenResponse{}, Handler: this.v2CreateAPIToken},
+		{Method: http.MethodDelete, Path: "api-tokens/:tokenId", Tag: "api-tokens", Summary: "Revoke an API token", Handler: this.v2RevokeAPIToken},
+	}
+}
+
+func (this *HttpAPI) v2Status(request *apiV2Request) (interface{}, error) {
+	health, err := process.HealthTest()
+	if err != nil {
+		return nil, newAPIError(http.StatusServiceUnavailable, "Application node is unhealthy: %+v", err)
+	}
+	return health, nil
+}
+
+func (this *HttpAPI) v2Clusters(request *apiV2Request) (interface{}, error) {
+	return inst.ReadClustersInfo("")
+}
+
+func (this *HttpAPI) v2Cluster(request *apiV2Request) (interface{}, error) {
+	clusterName, err := request.clusterName()
+	if err != nil {
+		return nil, err
+	}
+	return inst.ReadClusterInfo(clusterName)
+}
+
+func (this *HttpAPI) v2ClusterInstances(request *apiV2Request) (interface{}, error) {
+	clusterName, err := request.clusterName()
+	if err != nil {
+		return nil, err
+	}
+	return inst.ReadClusterInstances(clusterName)
+}
+
+func (this *HttpAPI) v2ClusterDashboard(request *apiV2Request) (interface{}, error) {
+	clusterName, err := request.clusterName()
+	if err != nil {
+		return nil, err
+	}
+	return logic.ReadClusterDashboard(clusterName)
+}
+
+func (this *HttpAPI) v2ClusterAnalysis(request *apiV2Request) (interface{}, error) {
+	clusterName, err := request.clusterName()
+	if err != nil {
+		return nil, err
+	}
+	return inst.GetReplicationAnalysis(clusterName, &inst.ReplicationAnalysisHints{IncludeDowntimed: true})
+}
+
+func (this *HttpAPI) readRecentRecoveries(request *apiV2Request, clusterName string) (interface{}, error) {
+	page, err := request.queryInt("page", 0)
+	if err != nil {
+		return nil, err
+	}
+	unacknowledgedOnly := (request.req.URL.Query().Get("unacknowledged") == "true")
+	recoveries, err := logic.ReadRecentRecoveries(clusterName, "", unacknowledgedOnly, page)
+	if recoveries == nil {
+		recoveries = []logic.TopologyRecovery{}
+	}
+	return recoveries, err
+}
+
+func (this *HttpAPI) v2ClusterRecoveries(request *apiV2Request) (interface{}, error) {
+	clusterName, err := request.clusterName()
+	if err != nil {
+		return nil, err
+	}
+	return this.readRecentRecoveries(request, clusterName)
+}
+
+func (this *HttpAPI) v2GracefulMasterTakeover(request *apiV2Request) (interface{}, error) {
+	clusterName, err := request.clusterName()
+	if err != nil {
+		return nil, err
+	}
+	body := GracefulMasterTakeoverRequest{}
+	if err := request.decodeBody(&body); err != nil {
+		return nil, err
+	}
+	designatedKey := emptyInstanceKey
+	if body.Designated != nil {
+		if designatedKey, err = request.resolveInstanceKey("Designated", body.Designated.instanceKey()); err != nil {
+			return nil, err
+		}
+	}
+	topologyRecovery, promotedMasterCoordinates, err := logic.GracefulMasterTakeover(clusterName, &designatedKey)
+	if err != nil {
+		return nil, newAPIError(http.StatusConflict, "%+v", err)
+	}
+	if topologyRecovery.SuccessorKey == nil {
+		return nil, newAPIError(http.StatusInternalServerError, "graceful-master-takeover: no successor promoted")
+	}
+	return GracefulMasterTakeoverResponse{Recovery: topologyRecovery, PromotedMasterCoordinates: promotedMasterCoordinates}, nil
+}
+
+func (this *HttpAPI) v2ForceMasterFailover(request *apiV2Request) (interface{}, error) {
+	clusterName, err := request.clusterName()
+	if err != nil {
+		return nil, err
+	}
+	topologyRecovery, err := logic.ForceMasterFailover(clusterName)
+	if err != nil {
+		return nil, newAPIError(http.StatusConflict, "%+v", err)
+	}
+	if topologyRecovery.SuccessorKey == nil {
+		return nil, newAPIError(http.StatusInternalServerError, "Master not failed over")
+	}
+	return topologyRecovery, nil
+}
+
+func (this *HttpAPI) decodeAcknowledgement(request *apiV2Request) (comment string, err error) {
+	body := AcknowledgeRequest{}
+	if err := request.decodeBody(&body); err != nil {
+		return "", err
+	}
+	if comment = strings.TrimSpace(body.Comment); comment == "" {
+		return "", newAPIError(http.StatusBadRequest, "No acknowledge comment given")
+	}
+	return comment, nil
+}
+
+func (this *HttpAPI) v2AcknowledgeClusterRecoveries(request *apiV2Request) (interface{}, error) {
+	clusterName, err := request.clusterName()
+	if err != nil {
+		return nil, err
+	}
+	comment, err := this.decodeAcknowledgement(request)
+	if err != nil {
+		return nil, err
+	}
+	if orcraft.IsRaftEnabled() {
+		ack := logic.NewRecoveryAcknowledgement(request.userId(), comment)
+		ack.ClusterName = clusterName
+		_, err = orcraft.PublishCommand("ack-recovery", ack)
+	} else {
+		_, err = logic.AcknowledgeClusterRecoveries(clusterName, request.userId(), comment)
+	}
+	return nil, err
+}
+
+// readInstance reads the instance given by path parameters, or fails with not_found
+func (this *HttpAPI) readInstance(request *apiV2Request) (*inst.Instance, error) {
+	instanceKey, err := request.instanceKey()
+	if err != nil {
+		return nil, err
+	}
+	instance, found, err := inst.ReadInstance(&instanceKey)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, newAPIError(http.StatusNotFound, "Instance not found: %+v", instanceKey)
+	}
+	return instance, nil
+}
+
+func (this *HttpAPI) v2Instance(request *apiV2Request) (interface{}, error) {
+	return this.readInstance(request)
+}
+
+func (this *HttpAPI) v2ForgetInstance(request *apiV2Request) (interface{}, error) {
+	instanceKey, err := API.getNoResolveInstanceKey(request.params["host"], request.params["port"])
+	if err != nil {
+		return nil, newAPIError(http.StatusBadRequest, "%+v", err)
+	}
+	if orcraft.IsRaftEnabled() {
+		_, err = orcraft.PublishCommand("forget", instanceKey)
+	} else {
+		err = inst.ForgetInstance(&instanceKey)
+	}
+	return nil, err
+}
+
+func (this *HttpAPI) v2InstanceReplicas(request *apiV2Request) (interface{}, error) {
+	instance, err := this.readInstance(request)
+	if err != nil {
+		return nil, err
+	}
+	return inst.ReadReplicaInstances(&instance.Key)
+}
+
+func (this *HttpAPI) v2Discover(request *apiV2Request) (interface{}, error) {
+	instanceKey, err := request.instanceKey()
+	if err != nil {
+		return nil, err
+	}
+	instance, err := inst.ReadTopologyInstance(&instanceKey)
+	if err != nil {
+		return nil, newAPIError(http.StatusConflict, "%+v", err)
+	}
+	if orcraft.IsRaftEnabled() {
+		orcraft.PublishCommand("discover", instanceKey)
+	} else {
+		logic.DiscoverInstance(instanceKey)
+	}
+	return instance, nil
+}
+
+// topologyOperation runs an operation on the instance given by path parameters. Failing
+// operations are conflicts: the topology does not allow them.
+func (this *HttpAPI) topologyOperation(request *apiV2Request, operation func(instanceKey *inst.InstanceKey) (*inst.Instance, error)) (interface{}, error) {
+	instanceKey, err := request.instanceKey()
+	if err != nil {
+		return nil, err
+	}
+	instance, err := operation(&instanceKey)
+	if err != nil {
+		return nil, newAPIError(http.StatusConflict, "%+v", err)
+	}
+	return instance, nil
+}
+
+func (this *HttpAPI) v2Relocate(request *apiV2Request) (interface{}, error) {
+	body := RelocateRequest{}
+	if err := request.decodeBody(&body); err != nil {
+		return nil, err
+	}
+	belowKey, err := request.resolveInstanceKey("Below", body.Below.instanceKey())
+	if err != nil {
+		return nil, err
+	}
+	return this.topologyOperation(request, func(instanceKey *inst.InstanceKey) (*inst.Instance, error) {
+		return inst.RelocateBelow(instanceKey, &belowKey)
+	})
+}
+
+func (this *HttpAPI) v2RelocateReplicas(request *apiV2Request) (interface{}, error) {
+	instanceKey, err := request.instanceKey()
+	if err != nil {
+		return nil, err
+	}
+	body := RelocateReplicasRequest{}
+	if err := request.decodeBody(&body); err != nil {
+		return nil, err
+	}
+	belowKey, err := request.resolveInstanceKey("Below", body.Below.instanceKey())
+	if err != nil {
+		return nil, err
+	}
+	replicas, _, err, errs := inst.RelocateReplicas(&instanceKey, &belowKey, body.Pattern)
+	if err != nil {
+		return nil, newAPIError(http.StatusConflict, "%+v", err)
+	}
+	response := RelocateReplicasResponse{Replicas: replicas, Errors: []string{}}
+	if response.Replicas == nil {
+		response.Replicas = [](*inst.Instance){}
+	}
+	for _, err := range errs {
+		response.Errors = append(response.Errors, err.Error())
+	}
+	return response, nil
+}
+
+func (this *HttpAPI) v2MoveUp(request *apiV2Request) (interface{}, error) {
+	return this.topologyOperation(request, inst.MoveUp)
+}
+
+func (this *HttpAPI) v2MoveBelow(request *apiV2Request) (interface{}, error) {
+	body := MoveBelowRequest{}
+	if err := request.decodeBody(&body); err != nil {
+		return nil, err
+	}
+	siblingKey, err := request.resolveInstanceKey("Sibling", body.Sibling.instanceKey())
+	if err != nil {
+		return nil, err
+	}
+	return this.topologyOperation(request, func(instanceKey *inst.InstanceKey) (*inst.Instance, error) {
+		return inst.MoveBelow(instanceKey, &siblingKey)
+	})
+}
+
+func (this *HttpAPI) v2StartReplica(request *apiV2Request) (interface{}, error) {
+	return this.topologyOperation(request, inst.StartSlave)
+}
+
+func (this *HttpAPI) v2StopReplica(request *apiV2Request) (interface{}, error) {
+	return this.topologyOperation(request, inst.StopSlave)
+}
+
+func (this *HttpAPI) v2SetReadOnly(request *apiV2Request) (interface{}, error) {
+	body := ReadOnlyRequest{}
+	if err := request.decodeBody(&body); err != nil {
+		return nil, err
+	}
+	return this.topologyOperation(request, func(instanceKey *inst.InstanceKey) (*inst.Instance, error) {
+		return inst.SetReadOnly(instanceKey, body.ReadOnly)
+	})
+}
+
+func (this *HttpAPI) v2Recover(request *apiV2Request) (interface{}, error) {
+	instanceKey, err := request.instanceKey()
+	if err != nil {
+		return nil, err
+	}
+	body := RecoverRequest{}
+	if err := request.decodeBody(&body); err != nil {
+		return nil, err
+	}
+	var candidateKey *inst.InstanceKey
+	if body.Candidate != nil {
+		key, err := request.resolveInstanceKey("Candidate", body.Candidate.instanceKey())
+		if err != nil {
+			return nil, err
+		}
+		candidateKey = &key
+	}
+	recoveryAttempted, promotedInstanceKey, err := logic.CheckAndRecover(&instanceKey, candidateKey, body.SkipProcesses)
+	if err != nil {
+		return nil, err
+	}
+	if !recoveryAttempted {
+		return nil, newAPIError(http.StatusConflict, "Recovery not attempted")
+	}
+	if promotedInstanceKey == nil {
+		return nil, newAPIError(http.StatusInternalServerError, "Recovery attempted but no instance promoted")
+	}
+	return RecoverResponse{SuccessorKey: *promotedInstanceKey}, nil
+}
+
+func (this *HttpAPI) v2Downtimes(request *apiV2Request) (interface{}, error) {
+	return inst.ReadDowntimedInstances("")
+}
+
+func (this *HttpAPI) v2BeginDowntime(request *apiV2Request) (interface{}, error) {
+	instanceKey, err := request.instanceKey()
+	if err != nil {
+		return nil, err
+	}
+	body := DowntimeRequest{}
+	if err := request.decodeBody(&body); err != nil {
+		return nil, err
+	}
+	durationSeconds, err := durationSecondsOf(body.Duration)
+	if err != nil {
+		return nil, err
+	}
+	if body.Owner == "" {
+		body.Owner = request.userId()
+	}
+	downtime := inst.NewDowntime(&instanceKey, body.Owner, body.Reason, time.Duration(durationSeconds)*time.Second)
+	if orcraft.IsRaftEnabled() {
+		_, err = orcraft.PublishCommand("begin-downtime", downtime)
+	} else {
+		err = inst.BeginDowntime(downtime)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return downtime, nil
+}
+
+// durationSecondsOf parses a duration given as e.g. "30m", "4h" or "2d"; an empty duration is 0
+func durationSecondsOf(duration string) (durationSeconds int, err error) {
+	if duration == "" {
+		return 0, nil
+	}
+	durationSeconds, err = util.SimpleTimeToSeconds(duration)
+	if err == nil && durationSeconds < 0 {
+		err = fmt.Errorf("Duration value must be non-negative. Given value: %d", durationSeconds)
+	}
+	if err != nil {
+		return 0, newAPIError(http.StatusBadRequest, "Duration: %+v", err)
+	}
+	return durationSeconds, nil
+}
+
+func (this *HttpAPI) v2EndDowntime(request *apiV2Request) (interface{}, error) {
+	instanceKey, err := request.instanceKey()
+	if err != nil {
+		return nil, err
+	}
+	if orcraft.IsRaftEnabled() {
+		_, err = orcraft.PublishCommand("end-downtime", instanceKey)
+	} else {
+		_, err = inst.EndDowntime(&instanceKey)
+	}
+	return nil, err
+}
+
+func (this *HttpAPI) v2Maintenance(request *apiV2Request) (interface{}, error) {
+	return inst.ReadActiveMaintenance()
+}
+
+func (this *HttpAPI) v2BeginMaintenance(request *apiV2Request) (interface{}, error) {
+	instanceKey, err := request.instanceKey()
+	if err != nil {
+		return nil, err
+	}
+	body := MaintenanceRequest{}
+	if err := request.decodeBody(&body); err != nil {
+		return nil, err
+	}
+	durationSeconds, err := durationSecondsOf(body.Duration)
+	if err != nil {
+		return nil, err
+	}
+	if body.Owner == "" {
+		body.Owner = request.userId()
+	}
+	maintenanceKey, err := inst.BeginBoundedMaintenance(&instanceKey, body.Owner, body.Reason, uint(durationSeconds), true)
+	if err != nil {
+		return nil, newAPIError(http.StatusConflict, "%+v", err)
+	}
+	return MaintenanceResponse{MaintenanceKey: maintenanceKey}, nil
+}
+
+func (this *HttpAPI) v2EndMaintenance(request *apiV2Request) (interface{}, error) {
+	instanceKey, err := request.instanceKey()
+	if err != nil {
+		return nil, err
+	}
+	wasMaintenance, err := inst.EndMaintenanceByInstanceKey(&instanceKey)
+	if err != nil {
+		return nil, err
+	}
+	if !wasMaintenance {
+		return nil, newAPIError(http.StatusNotFound, "Instance not in maintenance: %+v", instanceKey)
+	}
+	return nil, nil
+}
+
+func (this *HttpAPI) readTags(instanceKey *inst.InstanceKey) (interface{}, error) {
+	tags, err := inst.ReadInstanceTags(instanceKey)
+	if err != nil {
+		return nil, err
+	}
+	tagStrings := []string{}
+	for _, tag := range tags {
+		tagStrings = append(tagStrings, tag.String())
+	}
+	return tagStrings, nil
+}
+
+func (this *HttpAPI) v2Tags(request *apiV2Request) (interface{}, error) {
+	instanceKey, err := request.instanceKey()
+	if err != nil {
+		return nil, err
+	}
+	return this.readTags(&instanceKey)
+}
+
+func (this *HttpAPI) v2Tag(request *apiV2Request) (interface{}, error) {
+	instanceKey, err := request.instanceKey()
+	if err != nil {
+		return nil, err
+	}
+	body := TagRequest{}
+	if err := request.decodeBody(&body); err != nil {
+		return nil, err
+	}
+	tag, err := inst.NewTag(body.Name, body.Value)
+	if err != nil {
+		return nil, newAPIError(http.StatusBadRequest, "%+v", err)
+	}
+	if orcraft.IsRaftEnabled() {
+		_, err = orcraft.PublishCommand("put-instance-tag", inst.InstanceTag{Key: instanceKey, T: *tag})
+	} else {
+		err = inst.PutInstanceTag(&instanceKey, tag)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return this.readTags(&instanceKey)
+}
+
+func (this *HttpAPI) v2Untag(request *apiV2Request) (interface{}, error) {
+	instanceKey, err := request.instanceKey()
+	if err != nil {
+		return nil, err
+	}
+	tag, err := inst.NewTag(request.params["tagName"], "")
+	if err != nil {
+		return nil, newAPIError(http.StatusBadRequest, "%+v", err)
+	}
+	untagged, err := inst.Untag(&instanceKey, tag)
+	if err != nil {
+		return nil, err
+	}
+	if len(untagged.GetInstanceKeys()) == 0 {
+		return nil, newAPIError(http.StatusNotFound, "%+v not tagged with %s", instanceKey, tag.TagName)
+	}
+	return nil, nil
+}
+
+func (this *HttpAPI) v2Analysis(request *apiV2Request) (interface{}, error) {
+	return inst.GetReplicationAnalysis("", &inst.ReplicationAnalysisHints{IncludeDowntimed: true})
+}
+
+func (this *HttpAPI) v2Recoveries(request *apiV2Request) (interface{}, error) {
+	return this.readRecentRecoveries(request, "")
+}
+
+func (this *HttpAPI) v2ActiveRecoveries(request *apiV2Request) (interface{}, error) {
+	recoveries, err := logic.ReadActiveRecoveries()
+	if recoveries == nil {
+		recoveries = []logic.TopologyRecovery{}
+	}
+	return recoveries, err
+}
+
+func (this *HttpAPI) v2Recovery(request *apiV2Request) (interface{}, error) {
+	var recoveries []logic.TopologyRecovery
+	var err error
+	recoveryIdParam := request.params["recoveryId"]
+	if recoveryId, parseErr := strconv.ParseInt(recoveryIdParam, 10, 0); parseErr == nil {
+		recoveries, err = logic.ReadRecovery(recoveryId)
+	} else {
+		recoveries, err = logic.ReadRecoveryByUID(recoveryIdParam)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(recoveries) == 0 {
+		return nil, newAPIError(http.StatusNotFound, "Recovery not found: %s", recoveryIdParam)
+	}
+	return &recoveries[0], nil
+}
+
+func (this *HttpAPI) v2AcknowledgeRecovery(request *apiV2Request) (interface{}, error) {
+	comment, err := this.decodeAcknowledgement(request)
+	if err != nil {
+		return nil, err
+	}
+	recoveryIdParam := request.params["recoveryId"]
+	recoveryId, parseErr := strconv.ParseInt(recoveryIdParam, 10, 0)
+	recoveryUID := ""
+	if parseErr != nil {
+		recoveryUID = recoveryIdParam
+	}
+	if orcraft.IsRaftEnabled() {
+		ack := logic.NewRecoveryAcknowledgement(request.userId(), comment)
+		ack.Id = recoveryId
+		ack.UID = recoveryUID
+		_, err = orcraft.PublishCommand("ack-recovery", ack)
+		return nil, err
+	}
+	var countAcknowledged int64
+	if recoveryUID != "" {
+		countAcknowledged, err = logic.AcknowledgeRecoveryByUID(recoveryUID, request.userId(), comment)
+	} else {
+		countAcknowledged, err = logic.AcknowledgeRecovery(recoveryId, request.userId(), comment)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if countAcknowledged == 0 {
+		return nil, newAPIError(http.StatusNotFound, "No unacknowledged recovery found: %s", recoveryIdParam)
+	}
+	return nil, nil
+}
+
+func (this *HttpAPI) v2GlobalRecoveries(request *apiV2Request) (interface{}, error) {
+	isDisabled, err := logic.IsRecoveryDisabled()
+	if err != nil {
+		return nil, err
+	}
+	return GlobalRecoveries{Enabled: !isDisabled}, nil
+}
+
+func (this *HttpAPI) v2SetGlobalRecoveries(request *apiV2Request) (interface{}, error) {
+	body := GlobalRecoveries{}
+	if err := request.decodeBody(&body); err != nil {
+		return nil, err
+	}
+	var err error
+	switch {
+	case body.Enabled && orcraft.IsRaftEnabled():
+		_, err = orcraft.PublishCommand("enable-global-recoveries", 0)
+	case body.Enabled:
+		err = logic.EnableRecovery()
+	case orcraft.IsRaftEnabled():
+		_, err = orcraft.PublishCommand("disable-global-recoveries", 0)
+	default:
+		err = logic.DisableRecovery()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+func (this *HttpAPI) v2APITokens(request *apiV2Request) (interface{}, error) {
+	if err := forbidAPITokenManagement(request); err != nil {
+		return nil, err
+	}
+	return process.ReadAPITokens()
+}
+
+// forbidAPITokenManagement refuses requests managing API tokens when authenticated by an API token:
+// a token may not grant itself, or others, more than it has
+func forbidAPITokenManagement(request *apiV2Request) error {
+	if requestAPIToken(request.req) != nil {
+		return newAPIError(http.StatusForbidden, "API tokens cannot be managed when authenticated by an API token")
+	}
+	return nil
+}
+
+func (this *HttpAPI) v2CreateAPIToken(request *apiV2Request) (interface{}, error) {
+	if err := forbidAPITokenManagement(request); err != nil {
+		return nil, err
+	}
+	body := CreateAPITokenRequest{}
+	if err := request.decodeBody(&body); err != nil {
+		return nil, err
+	}
+	if body.Scope == "" {
+		body.Scope = process.APITokenScopeRead
+	}
+	clusterName := ""
+	if body.Cluster != "" {
+		var err error
+		if clusterName, err = figureClusterName(body.Cluster); err != nil {
+			return nil, newAPIError(http.StatusBadRequest, "Cluster not found: %s", body.Cluster)
+		}
+	}
+	durationSeconds, err := durationSecondsOf(body.Duration)
+	if err != nil {
+		return nil, err
+	}
+	token, apiToken, err := process.NewAPIToken(body.Name, body.Scope, clusterName, request.userId(), time.Duration(durationSeconds)*time.Second)
+	if err != nil {
+		return nil, newAPIError(http.StatusBadRequest, "%+v", err)
+	}
+	if orcraft.IsRaftEnabled() {
+		_, err = orcraft.PublishCommand("create-api-token", apiToken)
+	} else {
+		err = process.WriteAPIToken(apiToken)
+	}
+	if err != nil {
+		return nil, err
+	}
+	inst.AuditOperation("create-api-token", nil, fmt.Sprintf("Created API token %s for %s; scope: %s, cluster: %s, by %s", apiToken.TokenId, apiToken.Name, apiToken.Scope, apiToken.ClusterName, apiToken.CreatedBy))
+	apiToken.TokenHash = ""
+	return CreateAPITokenResponse{Token: token, APIToken: apiToken}, nil
+}
+
+func (this *HttpAPI) v2RevokeAPIToken(request *apiV2Request) (interface{}, error) {
+	if err := forbidAPITokenManagement(request); err != nil {
+		return nil, err
+	}
+	tokenId := request.params["tokenId"]
+	apiToken, err := process.ReadAPIToken(tokenId)
+	if err != nil {
+		return nil, err
+	}
+	if apiToken == nil {
+		return nil, newAPIError(http.StatusNotFound, "API token not found: %s", tokenId)
+	}
+	if orcraft.IsRaftEnabled() {
+		_, err = orcraft.PublishCommand("revoke-api-token", tokenId)
+	} else {
+		err = process.RevokeAPIToken(tokenId)
+	}
+	if err != nil {
+		return nil, err
+	}
+	inst.AuditOperation("revoke-api-token", nil, fmt.Sprintf("Revoked API token %s of %s, by %s", tokenId, apiToken.Name, request.userId()))
+	return nil, nil
+}
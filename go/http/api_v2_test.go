@@ -0,0 +1,197 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-martini/martini"
+	"github.com/martini-contrib/auth"
+
+	test "github.com/openark/golib/tests"
+
+	"github.com/github/orchestrator/go/config"
+)
+
+func TestOpenAPIDocument(t *testing.T) {
+	api := HttpAPI{URLPrefix: "/orc"}
+	document := api.OpenAPIDocument()
+
+	content, err := json.Marshal(document)
+	test.S(t).ExpectNil(err)
+	parsed := struct {
+		OpenAPI string
+		Servers []struct{ URL string }
+		Paths   map[string]map[string]struct {
+			OperationId string
+			Parameters  []struct{ Name, In string }
+			RequestBody interface{}
+			Responses   map[string]interface{}
+		}
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]map[string]interface{}
+			}
+		}
+	}{}
+	test.S(t).ExpectNil(json.Unmarshal(content, &parsed))
+	test.S(t).ExpectEquals(parsed.Servers[0].URL, "/orc/api/v2")
+
+	operationIds := map[string]bool{}
+	for _, route := range api.apiV2Routes() {
+		routePath, pathParameters := openAPIPath(route.Path)
+		operation, found := parsed.Paths[routePath][strings.ToLower(route.Method)]
+		test.S(t).ExpectTrue(found)
+		test.S(t).ExpectNotEquals(operation.OperationId, "")
+		test.S(t).ExpectFalse(operationIds[operation.OperationId])
+		operationIds[operation.OperationId] = true
+		test.S(t).ExpectEquals(len(operation.Parameters), len(pathParameters)+len(route.Query))
+		test.S(t).ExpectEquals(operation.RequestBody != nil, route.Request != nil)
+		_, found = operation.Responses["204"]
+		test.S(t).ExpectEquals(found, route.Response == nil)
+	}
+	test.S(t).ExpectEquals(parsed.Paths["/instances/{host}/{port}"]["delete"].OperationId, "forgetInstance")
+
+	// Recursive type
+	dashboardInstance, found := parsed.Components.Schemas["logic.DashboardInstance"]
+	test.S(t).ExpectTrue(found)
+	test.S(t).ExpectEquals(dashboardInstance.Properties["Replicas"]["items"].(map[string]interface{})["$ref"], "#/components/schemas/logic.DashboardInstance")
+	// Unexported fields left out; named structs referenced
+	_, found = parsed.Components.Schemas["http.APIError"].Properties["status"]
+	test.S(t).ExpectFalse(found)
+	test.S(t).ExpectEquals(parsed.Components.Schemas["inst.Instance"].Properties["Key"]["$ref"], "#/components/schemas/inst.InstanceKey")
+	test.S(t).ExpectEquals(parsed.Components.Schemas["inst.Instance"].Properties["SlaveHosts"]["type"], "array")
+}
+
+func TestOpenAPIPath(t *testing.T) {
+	openAPIPath, parameters := openAPIPath("instances/:host/:port/tags/:tagName")
+	test.S(t).ExpectEquals(openAPIPath, "/instances/{host}/{port}/tags/{tagName}")
+	test.S(t).ExpectEquals(strings.Join(parameters, ","), "host,port,tagName")
+}
+
+func TestToAPIError(t *testing.T) {
+	{
+		apiError := toAPIError(fmt.Errorf("oops"))
+		test.S(t).ExpectEquals(apiError.Status(), http.StatusInternalServerError)
+		test.S(t).ExpectEquals(apiError.Code, "internal_error")
+	}
+	{
+		apiError := toAPIError(newAPIError(http.StatusNotFound, "no such %s", "thing"))
+		test.S(t).ExpectEquals(apiError.Status(), http.StatusNotFound)
+		test.S(t).ExpectEquals(apiError.Code, "not_found")
+		test.S(t).ExpectEquals(apiError.Message, "no such thing")
+	}
+}
+
+func TestAPIv2Responses(t *testing.T) {
+	m := martini.Classic()
+	m.Map(auth.User(""))
+	api := HttpAPI{}
+	api.registerAPIv2Route(m, apiV2Route{Method: http.MethodPost, Path: "relocate", Handler: func(request *apiV2Request) (interface{}, error) {
+		body := RelocateRequest{}
+		if err := request.decodeBody(&body); err != nil {
+			return nil, err
+		}
+		if body.Below.Hostname == "" {
+			return nil, nil
+		}
+		return body, nil
+	}})
+	api.registerAPIv2Route(m, apiV2Route{Method: http.MethodGet, Path: "things/:name", Handler: func(request *apiV2Request) (interface{}, error) {
+		if request.params["name"] != "known" {
+			return nil, newAPIError(http.StatusNotFound, "unknown thing")
+		}
+		return GlobalRecoveries{Enabled: true}, nil
+	}})
+	server := httptest.NewServer(m)
+	defer server.Close()
+
+	post := func(body string) (*http.Response, APIError) {
+		resp, err := http.Post(server.URL+"/api/v2/relocate", "application/json", strings.NewReader(body))
+		test.S(t).ExpectNil(err)
+		defer resp.Body.Close()
+		apiError := APIError{}
+		json.NewDecoder(resp.Body).Decode(&apiError)
+		return resp, apiError
+	}
+	{
+		resp, apiError := post(`{"Below": `)
+		test.S(t).ExpectEquals(resp.StatusCode, http.StatusBadRequest)
+		test.S(t).ExpectEquals(apiError.Code, "bad_request")
+	}
+	{
+		resp, apiError := post(`{"Beneath": {"Hostname": "db-2", "Port": 3306}}`)
+		test.S(t).ExpectEquals(resp.StatusCode, http.StatusBadRequest)
+		test.S(t).ExpectTrue(strings.Contains(apiError.Message, "Beneath"))
+	}
+	{
+		resp, _ := post(``)
+		test.S(t).ExpectEquals(resp.StatusCode, http.StatusNoContent)
+	}
+	{
+		resp, _ := post(`{"Below": {"Hostname": "db-2", "Port": 3306}}`)
+		test.S(t).ExpectEquals(resp.StatusCode, http.StatusOK)
+		test.S(t).ExpectEquals(resp.Header.Get("ETag"), "")
+	}
+	{
+		resp, err := http.Get(server.URL + "/api/v2/things/unknown")
+		test.S(t).ExpectNil(err)
+		resp.Body.Close()
+		test.S(t).ExpectEquals(resp.StatusCode, http.StatusNotFound)
+	}
+	{
+		resp, err := http.Get(server.URL + "/api/v2/things/known")
+		test.S(t).ExpectNil(err)
+		resp.Body.Close()
+		test.S(t).ExpectEquals(resp.StatusCode, http.StatusOK)
+		etag := resp.Header.Get("ETag")
+		test.S(t).ExpectNotEquals(etag, "")
+
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/api/v2/things/known", nil)
+		req.Header.Set("If-None-Match", etag)
+		resp, err = http.DefaultClient.Do(req)
+		test.S(t).ExpectNil(err)
+		resp.Body.Close()
+		test.S(t).ExpectEquals(resp.StatusCode, http.StatusNotModified)
+	}
+	{
+		req, _ := http.NewRequest(http.MethodDelete, server.URL+"/api/v2/things/known", nil)
+		resp, err := http.DefaultClient.Do(req)
+		test.S(t).ExpectNil(err)
+		resp.Body.Close()
+		test.S(t).ExpectEquals(resp.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestAPIv2RestrictedRoute(t *testing.T) {
+	defer func(authenticationMethod string) { config.Config.AuthenticationMethod = authenticationMethod }(config.Config.AuthenticationMethod)
+	config.Config.AuthenticationMethod = "multi"
+
+	m := martini.Classic()
+	m.Use(func(c martini.Context, req *http.Request) {
+		c.Map(auth.User(req.Header.Get("X-Test-User")))
+	})
+	api := HttpAPI{}
+	handler := func(request *apiV2Request) (interface{}, error) {
+		return GlobalRecoveries{Enabled: true}, nil
+	}
+	api.registerAPIv2Route(m, apiV2Route{Method: http.MethodGet, Path: "things", Handler: handler})
+	api.registerAPIv2Route(m, apiV2Route{Method: http.MethodGet, Path: "secrets", Restricted: true, Handler: handler})
+	server := httptest.NewServer(m)
+	defer server.Close()
+
+	get := func(path string, user string) int {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/api/v2/"+path, nil)
+		req.Header.Set("X-Test-User", user)
+		resp, err := http.DefaultClient.Do(req)
+		test.S(t).ExpectNil(err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	test.S(t).ExpectEquals(get("things", "readonly"), http.StatusOK)
+	test.S(t).ExpectEquals(get("secrets", "readonly"), http.StatusForbidden)
+	test.S(t).ExpectEquals(get("secrets", "admin"), http.StatusOK)
+}
@@ -40,6 +40,13 @@ func getProxyAuthUser(req *http.Request) string {
 // isAuthorizedForAction checks req to see whether authenticated user has write-privileges.
 // This depends on configured authentication method.
 func isAuthorizedForAction(req *http.Request, user auth.User) bool {
+	return isAuthorizedForClusterAction(req, user, "")
+}
+
+// isAuthorizedForClusterAction checks req to see whether authenticated user has write-privileges
+// on given cluster. An empty cluster name stands for an action not bound to a single cluster.
+// Only requests authenticated by a cluster scoped API token are told apart by cluster.
+func isAuthorizedForClusterAction(req *http.Request, user auth.User, clusterName string) bool {
 	if config.Config.ReadOnly {
 		return false
 	}
@@ -49,6 +56,11 @@ func isAuthorizedForAction(req *http.Request, user auth.User) bool {
 		return false
 	}
 
+	if apiToken := requestAPIToken(req); apiToken != nil {
+		// Bearer token authentication, regardless of configured authentication method
+		return apiToken.CanWrite(clusterName)
+	}
+
 	switch strings.ToLower(config.Config.AuthenticationMethod) {
 	case "basic":
 		{
@@ -94,6 +106,11 @@ func isAuthorizedForAction(req *http.Request, user auth.User) bool {
 		{
 			return false
 		}
+	case "oidc":
+		{
+			principal := requestOIDCPrincipal(req)
+			return principal != nil && principal.isPowerUser()
+		}
 	default:
 		{
 			// Default: no authentication method
@@ -119,6 +136,10 @@ func getUserId(req *http.Request, user auth.User) string {
 		return ""
 	}
 
+	if apiToken := requestAPIToken(req); apiToken != nil {
+		return apiToken.Name
+	}
+
 	switch strings.ToLower(config.Config.AuthenticationMethod) {
 	case "basic":
 		{
@@ -136,6 +157,13 @@ func getUserId(req *http.Request, user auth.User) string {
 		{
 			return ""
 		}
+	case "oidc":
+		{
+			if principal := requestOIDCPrincipal(req); principal != nil {
+				return principal.User
+			}
+			return ""
+		}
 	default:
 		{
 			return ""
@@ -174,3 +202,15 @@ func getClusterNameIfExists(params map[string]string) (clusterName string, err e
 		return figureClusterName(clusterHint)
 	}
 }
+
+// etagMatches checks whether an If-None-Match header value matches given entity tag. The header may
+// list several tags, weak or strong, or be "*".
+func etagMatches(ifNoneMatch string, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,780 @@
+/*
+   Copyright 2019 GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package http
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-martini/martini"
+	"github.com/martini-contrib/auth"
+
+	"github.com/openark/golib/log"
+
+	"github.com/github/orchestrator/go/config"
+)
+
+const (
+	oidcSessionCookieName       = "orchestrator-session"
+	oidcLoginCookieName         = "orchestrator-oidc-login"
+	oidcLoginExpiry             = 10 * time.Minute
+	oidcClockSkew               = time.Minute
+	oidcKeysMinRefreshInterval  = time.Minute
+	oidcProviderRequestTimeout  = 10 * time.Second
+	oidcSessionCookiePurpose    = "session"
+	oidcLoginStateCookiePurpose = "login"
+)
+
+// oidcUnauthenticatedAPIEndpoints are the API endpoints of health checks and of raft's internal communication.
+// See isUnauthenticatedPath
+var oidcUnauthenticatedAPIEndpoints = []string{
+	"headers",
+	"health",
+	"lb-check",
+	"_ping",
+	"leader-check",
+	"grab-election",
+	"raft-yield",
+	"raft-yield-hint",
+	"raft-peers",
+	"raft-state",
+	"raft-leader",
+	"raft-health",
+	"raft-snapshot",
+	"raft-follower-health-report",
+}
+
+// oidcProviderMetadata is the part of an OpenID Connect discovery document orchestrator uses
+type oidcProviderMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+	EndSessionEndpoint    string `json:"end_session_endpoint"`
+}
+
+// jsonWebKey is a public key of a JSON Web Key Set, by which the provider signs tokens
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// oidcPrincipal is a user authenticated by OpenID Connect, by session cookie or by JWT bearer token
+type oidcPrincipal struct {
+	User      string
+	Groups    []string
+	ExpiresAt int64 // Unix time at which the session expires; sessions only
+}
+
+// oidcLoginState is kept by the browser, in a signed cookie, between login and callback
+type oidcLoginState struct {
+	State        string
+	Nonce        string
+	CodeVerifier string
+	Redirect     string
+	ExpiresAt    int64
+}
+
+// oidcPrincipalContextKey keys the OpenID Connect principal of a request in the request's context
+type oidcPrincipalContextKey struct{}
+
+// OIDCAuthenticator authenticates users via an OpenID Connect provider: the web UI by authorization
+// code flow with PKCE, followed by a session cookie, and API calls by JWT bearer tokens. The provider's
+// discovery document and signing keys are read on first use.
+type OIDCAuthenticator struct {
+	URLPrefix string
+
+	mutex      sync.Mutex
+	provider   *oidcProviderMetadata
+	keys       map[string]crypto.PublicKey
+	keysReadAt time.Time
+}
+
+var OIDC OIDCAuthenticator = OIDCAuthenticator{}
+
+var oidcHTTPClient = &http.Client{Timeout: oidcProviderRequestTimeout}
+
+// requestOIDCPrincipal returns the OpenID Connect principal of given request, or nil if the request
+// is not so authenticated
+func requestOIDCPrincipal(req *http.Request) *oidcPrincipal {
+	principal, _ := req.Context().Value(oidcPrincipalContextKey{}).(*oidcPrincipal)
+	return principal
+}
+
+// isPowerUser checks whether this principal may make changes, by PowerAuthUsers or by PowerAuthGroups
+func (this *oidcPrincipal) isPowerUser() bool {
+	for _, powerAuthUser := range config.Config.PowerAuthUsers {
+		if powerAuthUser == "*" || powerAuthUser == this.User {
+			return true
+		}
+	}
+	for _, group := range this.Groups {
+		for _, powerAuthGroup := range config.Config.PowerAuthGroups {
+			if group == powerAuthGroup {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// oidcPrincipalOf returns the principal identified by given token claims, by OIDCUsernameClaim
+// and OIDCGroupsClaim
+func oidcPrincipalOf(claims map[string]interface{}) (*oidcPrincipal, error) {
+	principal := &oidcPrincipal{}
+	principal.User, _ = claims[config.Config.OIDCUsernameClaim].(string)
+	if principal.User == "" {
+		principal.User, _ = claims["sub"].(string)
+	}
+	if principal.User == "" {
+		return nil, fmt.Errorf("Token has neither %s nor sub claim", config.Config.OIDCUsernameClaim)
+	}
+	switch groups := claims[config.Config.OIDCGroupsClaim].(type) {
+	case string:
+		principal.Groups = []string{groups}
+	case []interface{}:
+		for _, group := range groups {
+			if group, ok := group.(string); ok {
+				principal.Groups = append(principal.Groups, group)
+			}
+		}
+	}
+	return principal, nil
+}
+
+func randomBase64(size int) (string, error) {
+	data := make([]byte, size)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// pkceCodeChallenge is the S256 code challenge of given code verifier
+func pkceCodeChallenge(codeVerifier string) string {
+	hash := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+func oidcSignature(purpose string, payload string) string {
+	mac := hmac.New(sha256.New, []byte(config.Config.OIDCSessionSecret))
+	mac.Write([]byte(purpose + "." + payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// oidcSignedValue encodes given value as a cookie value, signed by OIDCSessionSecret for given purpose
+func oidcSignedValue(purpose string, value interface{}) (string, error) {
+	content, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(content)
+	return fmt.Sprintf("%s.%s", payload, oidcSignature(purpose, payload)), nil
+}
+
+// oidcVerifySignedValue decodes a cookie value encoded by oidcSignedValue for the same purpose
+func oidcVerifySignedValue(purpose string, signedValue string, value interface{}) error {
+	tokens := strings.SplitN(signedValue, ".", 2)
+	if len(tokens) != 2 {
+		return fmt.Errorf("Malformed signed value")
+	}
+	if !hmac.Equal([]byte(tokens[1]), []byte(oidcSignature(purpose, tokens[0]))) {
+		return fmt.Errorf("Invalid signature")
+	}
+	content, err := base64.RawURLEncoding.DecodeString(tokens[0])
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(content, value)
+}
+
+func (this *OIDCAuthenticator) cookiePath() string {
+	if this.URLPrefix == "" {
+		return "/"
+	}
+	return this.URLPrefix
+}
+
+// setCookie sets, or with an empty value clears, a cookie of the login flow. The login state cookie is
+// SameSite=Lax, as it must come along with the provider's redirect to the callback; the session cookie
+// is SameSite=Strict.
+func (this *OIDCAuthenticator) setCookie(w http.ResponseWriter, name string, value string, expiresAt time.Time) {
+	sameSite := http.SameSiteLaxMode
+	if name == oidcSessionCookieName {
+		sameSite = http.SameSiteStrictMode
+	}
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     this.cookiePath(),
+		Expires:  expiresAt,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(strings.ToLower(config.Config.OIDCRedirectURL), "https:"),
+		SameSite: sameSite,
+	}
+	if value == "" {
+		cookie.MaxAge = -1
+	}
+	http.SetCookie(w, cookie)
+}
+
+// localRedirect returns given post-login redirect if it is a path on this server, and the home page otherwise
+func (this *OIDCAuthenticator) localRedirect(redirect string) string {
+	if !strings.HasPrefix(redirect, "/") || strings.HasPrefix(redirect, "//") || strings.HasPrefix(redirect, "/\\") {
+		return this.URLPrefix + "/"
+	}
+	return redirect
+}
+
+func (this *OIDCAuthenticator) isLoginFlowPath(path string) bool {
+	return strings.HasPrefix(path, this.URLPrefix+"/oidc/")
+}
+
+func (this *OIDCAuthenticator) isAPIPath(path string) bool {
+	return strings.HasPrefix(path, this.URLPrefix+"/api/")
+}
+
+// isUnauthenticatedPath checks whether given path is served without requiring authentication: the status
+// endpoint and health checks, as probed by load balancers, and raft's internal endpoints, which raft nodes
+// call without credentials. The raft health report carries raft's own token. Actions on such endpoints are
+// still subject to authorization, and so require a session or bearer token.
+func (this *OIDCAuthenticator) isUnauthenticatedPath(path string) bool {
+	if path == config.Config.StatusEndpoint {
+		return true
+	}
+	if !this.isAPIPath(path) {
+		return false
+	}
+	endpoint := strings.Split(strings.TrimPrefix(path, this.URLPrefix+"/api/"), "/")[0]
+	for _, unauthenticatedEndpoint := range oidcUnauthenticatedAPIEndpoints {
+		if endpoint == unauthenticatedEndpoint {
+			return true
+		}
+	}
+	return false
+}
+
+func getProviderJSON(endpoint string, value interface{}) error {
+	resp, err := oidcHTTPClient.Get(endpoint)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: unexpected status %d", endpoint, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(value)
+}
+
+// providerMetadata returns the provider's discovery document, reading it on first use
+func (this *OIDCAuthenticator) providerMetadata() (*oidcProviderMetadata, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.provider != nil {
+		return this.provider, nil
+	}
+	issuer := strings.TrimRight(config.Config.OIDCIssuerURL, "/")
+	provider := &oidcProviderMetadata{}
+	if err := getProviderJSON(issuer+"/.well-known/openid-configuration", provider); err != nil {
+		return nil, fmt.Errorf("OpenID Connect discovery: %+v", err)
+	}
+	if strings.TrimRight(provider.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("OpenID Connect discovery: issuer %s does not match OIDCIssuerURL %s", provider.Issuer, config.Config.OIDCIssuerURL)
+	}
+	if provider.AuthorizationEndpoint == "" || provider.TokenEndpoint == "" || provider.JWKSURI == "" {
+		return nil, fmt.Errorf("OpenID Connect discovery: authorization_endpoint, token_endpoint and jwks_uri required")
+	}
+	this.provider = provider
+	return provider, nil
+}
+
+func decodeBase64BigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+// publicKey returns the RSA or EC public key given by this JSON Web Key
+func (this *jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch this.Kty {
+	case "RSA":
+		n, err := decodeBase64BigInt(this.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBase64BigInt(this.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		curves := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}
+		curve, ok := curves[this.Crv]
+		if !ok {
+			return nil, fmt.Errorf("Unsupported curve: %s", this.Crv)
+		}
+		x, err := decodeBase64BigInt(this.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBase64BigInt(this.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("Unsupported key type: %s", this.Kty)
+}
+
+// signingKey returns the provider's signing key of given key id. The key set is re-read upon an
+// unknown key id, as the provider rotates keys, though not more than once a minute.
+func (this *OIDCAuthenticator) signingKey(kid string) (crypto.PublicKey, error) {
+	provider, err := this.providerMetadata()
+	if err != nil {
+		return nil, err
+	}
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	lookup := func() crypto.PublicKey {
+		if kid == "" && len(this.keys) == 1 {
+			for _, key := range this.keys {
+				return key
+			}
+		}
+		return this.keys[kid]
+	}
+	if key := lookup(); key != nil {
+		return key, nil
+	}
+	if time.Since(this.keysReadAt) < oidcKeysMinRefreshInterval {
+		return nil, fmt.Errorf("Unknown signing key: %s", kid)
+	}
+	this.keysReadAt = time.Now()
+	keySet := struct{ Keys []jsonWebKey }{}
+	if err := getProviderJSON(provider.JWKSURI, &keySet); err != nil {
+		return nil, fmt.Errorf("OpenID Connect signing keys: %+v", err)
+	}
+	this.keys = map[string]crypto.PublicKey{}
+	for _, jwk := range keySet.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			log.Warningf("OpenID Connect signing keys: skipping key %s: %+v", jwk.Kid, err)
+			continue
+		}
+		this.keys[jwk.Kid] = key
+	}
+	if key := lookup(); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("Unknown signing key: %s", kid)
+}
+
+// jwtHashes maps supported JWT signature algorithms to their hash. "none" and HMAC algorithms are not supported.
+var jwtHashes = map[string]crypto.Hash{
+	"RS256": crypto.SHA256, "RS384": crypto.SHA384, "RS512": crypto.SHA512,
+	"PS256": crypto.SHA256, "PS384": crypto.SHA384, "PS512": crypto.SHA512,
+	"ES256": crypto.SHA256, "ES384": crypto.SHA384, "ES512": crypto.SHA512,
+}
+
+// verifyJWTSignature verifies the signature of a JWT's signing input, "<header>.<payload>", by given algorithm and key
+func verifyJWTSignature(alg string, key crypto.PublicKey, signingInput string, signature []byte) error {
+	hash, ok := jwtHashes[alg]
+	if !ok {
+		return fmt.Errorf("Unsupported signature algorithm: %s", alg)
+	}
+	hasher := hash.New()
+	hasher.Write([]byte(signingInput))
+	digest := hasher.Sum(nil)
+
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		switch alg[:2] {
+		case "RS":
+			return rsa.VerifyPKCS1v15(key, hash, digest, signature)
+		case "PS":
+			return rsa.VerifyPSS(key, hash, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		}
+	case *ecdsa.PublicKey:
+		if alg[:2] == "ES" {
+			size := (key.Curve.Params().BitSize + 7) / 8
+			if len(signature) != 2*size {
+				return fmt.Errorf("Invalid signature")
+			}
+			r := new(big.Int).SetBytes(signature[:size])
+			s := new(big.Int).SetBytes(signature[size:])
+			if !ecdsa.Verify(key, digest, r, s) {
+				return fmt.Errorf("Invalid signature")
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("Signature algorithm %s does not match key type", alg)
+}
+
+// validateJWTClaims validates the registered claims of a JWT: issuer, audience (any of given audiences),
+// expiry and not-before time and, when given, nonce
+func validateJWTClaims(claims map[string]interface{}, issuer string, audiences []string, nonce string, now time.Time) error {
+	if claims["iss"] != issuer {
+		return fmt.Errorf("Unexpected issuer: %v", claims["iss"])
+	}
+	tokenAudiences := []string{}
+	switch aud := claims["aud"].(type) {
+	case string:
+		tokenAudiences = append(tokenAudiences, aud)
+	case []interface{}:
+		for _, audience := range aud {
+			if audience, ok := audience.(string); ok {
+				tokenAudiences = append(tokenAudiences, audience)
+			}
+		}
+	}
+	audienceMatches := false
+	for _, tokenAudience := range tokenAudiences {
+		for _, audience := range audiences {
+			if tokenAudience == audience {
+				audienceMatches = true
+			}
+		}
+	}
+	if !audienceMatches {
+		return fmt.Errorf("Unexpected audience: %v", claims["aud"])
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return fmt.Errorf("Missing exp claim")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(oidcClockSkew)) {
+		return fmt.Errorf("Token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Before(time.Unix(int64(nbf), 0).Add(-oidcClockSkew)) {
+		return fmt.Errorf("Token not yet valid")
+	}
+	if nonce != "" {
+		if tokenNonce, _ := claims["nonce"].(string); !hmac.Equal([]byte(tokenNonce), []byte(nonce)) {
+			return fmt.Errorf("Unexpected nonce")
+		}
+	}
+	return nil
+}
+
+// verifyJWT verifies a JWT issued by the provider, for any of given audiences, and returns its claims
+func (this *OIDCAuthenticator) verifyJWT(token string, audiences []string, nonce string) (claims map[string]interface{}, err error) {
+	tokens := strings.Split(token, ".")
+	if len(tokens) != 3 {
+		return nil, fmt.Errorf("Malformed JWT")
+	}
+	headerContent, err := base64.RawURLEncoding.DecodeString(tokens[0])
+	if err != nil {
+		return nil, fmt.Errorf("Malformed JWT header: %+v", err)
+	}
+	header := struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}{}
+	if err := json.Unmarshal(headerContent, &header); err != nil {
+		return nil, fmt.Errorf("Malformed JWT header: %+v", err)
+	}
+	if _, ok := jwtHashes[header.Alg]; !ok {
+		return nil, fmt.Errorf("Unsupported signature algorithm: %s", header.Alg)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(tokens[2])
+	if err != nil {
+		return nil, fmt.Errorf("Malformed JWT signature: %+v", err)
+	}
+	key, err := this.signingKey(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyJWTSignature(header.Alg, key, tokens[0]+"."+tokens[1], signature); err != nil {
+		return nil, err
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(tokens[1])
+	if err != nil {
+		return nil, fmt.Errorf("Malformed JWT payload: %+v", err)
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("Malformed JWT payload: %+v", err)
+	}
+	provider, err := this.providerMetadata()
+	if err != nil {
+		return nil, err
+	}
+	if err := validateJWTClaims(claims, provider.Issuer, audiences, nonce, time.Now()); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// exchangeCode redeems an authorization code at the provider's token endpoint, and returns the ID token
+func (this *OIDCAuthenticator) exchangeCode(provider *oidcProviderMetadata, code string, codeVerifier string) (idToken string, err error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", config.Config.OIDCRedirectURL)
+	form.Set("code_verifier", codeVerifier)
+	form.Set("client_id", config.Config.OAuthClientId)
+	req, err := http.NewRequest(http.MethodPost, provider.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if config.Config.OAuthClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(config.Config.OAuthClientId), url.QueryEscape(config.Config.OAuthClientSecret))
+	}
+	resp, err := oidcHTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	tokenResponse := struct {
+		IdToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}{}
+	json.Unmarshal(body, &tokenResponse)
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Token endpoint: status %d: %s %s", resp.StatusCode, tokenResponse.Error, tokenResponse.ErrorDescription)
+	}
+	if tokenResponse.IdToken == "" {
+		return "", fmt.Errorf("Token endpoint: no id_token in response")
+	}
+	return tokenResponse.IdToken, nil
+}
+
+// sessionPrincipal returns the principal of a valid session cookie, or nil
+func (this *OIDCAuthenticator) sessionPrincipal(req *http.Request) *oidcPrincipal {
+	cookie, err := req.Cookie(oidcSessionCookieName)
+	if err != nil {
+		return nil
+	}
+	principal := &oidcPrincipal{}
+	if err := oidcVerifySignedValue(oidcSessionCookiePurpose, cookie.Value, principal); err != nil {
+		return nil
+	}
+	if principal.User == "" || time.Now().Unix() >= principal.ExpiresAt {
+		return nil
+	}
+	return principal
+}
+
+// Authenticate is the martini handler of AuthenticationMethod "oidc". Requests are authenticated by
+// "Authorization: Bearer" JWT, or by session cookie. Unauthenticated web UI requests are redirected to
+// login; unauthenticated API requests are refused.
+func (this *OIDCAuthenticator) Authenticate(w http.ResponseWriter, req *http.Request, c martini.Context) {
+	if this.isLoginFlowPath(req.URL.Path) {
+		c.Map(auth.User(""))
+		return
+	}
+	var principal *oidcPrincipal
+	if token := bearerToken(req); token != "" {
+		audiences := append([]string{config.Config.OAuthClientId}, config.Config.OIDCAPIAudiences...)
+		claims, err := this.verifyJWT(token, audiences, "")
+		if err == nil {
+			principal, err = oidcPrincipalOf(claims)
+		}
+		if err != nil {
+			log.Debugf("OpenID Connect: rejecting bearer token: %+v", err)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="orchestrator", error="invalid_token"`)
+			http.Error(w, "Not Authorized", http.StatusUnauthorized)
+			return
+		}
+	} else {
+		principal = this.sessionPrincipal(req)
+	}
+	if principal == nil {
+		if this.isUnauthenticatedPath(req.URL.Path) {
+			c.Map(auth.User(""))
+			return
+		}
+		if req.Method == http.MethodGet && !this.isAPIPath(req.URL.Path) {
+			loginURL := fmt.Sprintf("%s/oidc/login?redirect=%s", this.URLPrefix, url.QueryEscape(req.URL.RequestURI()))
+			http.Redirect(w, req, loginURL, http.StatusFound)
+			return
+		}
+		w.Header().Set("WWW-Authenticate", `Bearer realm="orchestrator"`)
+		http.Error(w, "Not Authorized", http.StatusUnauthorized)
+		return
+	}
+	c.Map(auth.User(principal.User))
+	c.Map(req.WithContext(context.WithValue(req.Context(), oidcPrincipalContextKey{}, principal)))
+}
+
+// Login starts the authorization code flow: it redirects to the provider, with a PKCE code challenge
+func (this *OIDCAuthenticator) Login(w http.ResponseWriter, req *http.Request) {
+	provider, err := this.providerMetadata()
+	if err != nil {
+		log.Errore(err)
+		http.Error(w, "OpenID Connect provider unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	loginState := oidcLoginState{
+		Redirect:  this.localRedirect(req.URL.Query().Get("redirect")),
+		ExpiresAt: time.Now().Add(oidcLoginExpiry).Unix(),
+	}
+	for _, value := range []*string{&loginState.State, &loginState.Nonce, &loginState.CodeVerifier} {
+		if *value, err = randomBase64(32); err != nil {
+			log.Errore(err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+	}
+	cookieValue, err := oidcSignedValue(oidcLoginStateCookiePurpose, loginState)
+	if err != nil {
+		log.Errore(err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	this.setCookie(w, oidcLoginCookieName, cookieValue, time.Unix(loginState.ExpiresAt, 0))
+
+	authorizationURL, err := url.Parse(provider.AuthorizationEndpoint)
+	if err != nil {
+		log.Errore(err)
+		http.Error(w, "OpenID Connect provider unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	query := authorizationURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", config.Config.OAuthClientId)
+	query.Set("redirect_uri", config.Config.OIDCRedirectURL)
+	query.Set("scope", strings.Join(config.Config.OAuthScopes, " "))
+	query.Set("state", loginState.State)
+	query.Set("nonce", loginState.Nonce)
+	query.Set("code_challenge", pkceCodeChallenge(loginState.CodeVerifier))
+	query.Set("code_challenge_method", "S256")
+	authorizationURL.RawQuery = query.Encode()
+	http.Redirect(w, req, authorizationURL.String(), http.StatusFound)
+}
+
+// Callback completes the authorization code flow: it redeems the code for an ID token, validates it,
+// and starts a session
+func (this *OIDCAuthenticator) Callback(w http.ResponseWriter, req *http.Request) {
+	loginState := oidcLoginState{}
+	cookie, err := req.Cookie(oidcLoginCookieName)
+	if err == nil {
+		err = oidcVerifySignedValue(oidcLoginStateCookiePurpose, cookie.Value, &loginState)
+	}
+	if err != nil || time.Now().Unix() >= loginState.ExpiresAt {
+		http.Error(w, "Login expired or not started; please log in again", http.StatusBadRequest)
+		return
+	}
+	this.setCookie(w, oidcLoginCookieName, "", time.Unix(0, 0))
+
+	query := req.URL.Query()
+	if query.Get("error") != "" {
+		http.Error(w, fmt.Sprintf("Login failed: %s %s", query.Get("error"), query.Get("error_description")), http.StatusUnauthorized)
+		return
+	}
+	if !hmac.Equal([]byte(query.Get("state")), []byte(loginState.State)) {
+		http.Error(w, "Login state mismatch; please log in again", http.StatusBadRequest)
+		return
+	}
+	if query.Get("code") == "" {
+		http.Error(w, "Missing authorization code", http.StatusBadRequest)
+		return
+	}
+	provider, err := this.providerMetadata()
+	if err != nil {
+		log.Errore(err)
+		http.Error(w, "OpenID Connect provider unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	idToken, err := this.exchangeCode(provider, query.Get("code"), loginState.CodeVerifier)
+	if err != nil {
+		log.Errore(err)
+		http.Error(w, "Login failed: unable to redeem authorization code", http.StatusUnauthorized)
+		return
+	}
+	claims, err := this.verifyJWT(idToken, []string{config.Config.OAuthClientId}, loginState.Nonce)
+	if err != nil {
+		log.Errorf("OpenID Connect: invalid ID token: %+v", err)
+		http.Error(w, "Login failed: invalid ID token", http.StatusUnauthorized)
+		return
+	}
+	principal, err := oidcPrincipalOf(claims)
+	if err != nil {
+		log.Errore(err)
+		http.Error(w, "Login failed: invalid ID token", http.StatusUnauthorized)
+		return
+	}
+	expiresAt := time.Now().Add(time.Duration(config.Config.OIDCSessionExpirySeconds) * time.Second)
+	principal.ExpiresAt = expiresAt.Unix()
+	cookieValue, err := oidcSignedValue(oidcSessionCookiePurpose, principal)
+	if err != nil {
+		log.Errore(err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	this.setCookie(w, oidcSessionCookieName, cookieValue, expiresAt)
+	log.Infof("OpenID Connect: %s logged in; groups: %+v", principal.User, principal.Groups)
+	// Browsers do not send the SameSite=Strict session cookie along a redirect chain which started at the
+	// provider; a page navigating on its own is same-site
+	redirect := html.EscapeString(loginState.Redirect)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	fmt.Fprintf(w, `<!DOCTYPE html><html><head><meta http-equiv="refresh" content="0;url=%s"></head><body><a href="%s">Continue</a></body></html>`, redirect, redirect)
+}
+
+// Logout ends the session, and redirects to the provider's end session endpoint, if any
+func (this *OIDCAuthenticator) Logout(w http.ResponseWriter, req *http.Request) {
+	this.setCookie(w, oidcSessionCookieName, "", time.Unix(0, 0))
+	redirect := this.URLPrefix + "/"
+	if provider, err := this.providerMetadata(); err == nil && provider.EndSessionEndpoint != "" {
+		redirect = provider.EndSessionEndpoint
+	}
+	http.Redirect(w, req, redirect, http.StatusFound)
+}
+
+// RegisterRequests registers the login flow's endpoints
+func (this *OIDCAuthenticator) RegisterRequests(m *martini.ClassicMartini) {
+	m.Get(this.URLPrefix+"/oidc/login", this.Login)
+	m.Get(this.URLPrefix+"/oidc/callback", this.Callback)
+	m.Get(this.URLPrefix+"/oidc/logout", this.Logout)
+}
@@ -0,0 +1,333 @@
+package http
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-martini/martini"
+	"github.com/martini-contrib/auth"
+
+	test "github.com/openark/golib/tests"
+
+	"github.com/github/orchestrator/go/config"
+)
+
+// mockIdentityProvider is an OpenID Connect provider issuing RS256 signed tokens for a single user
+type mockIdentityProvider struct {
+	server         *httptest.Server
+	key            *rsa.PrivateKey
+	claims         map[string]interface{} // Claims of issued ID tokens, besides iss, aud, exp, iat and nonce
+	authorizations map[string]url.Values  // Authorization requests by issued code
+}
+
+func newMockIdentityProvider(t *testing.T) *mockIdentityProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	test.S(t).ExpectNil(err)
+	idp := &mockIdentityProvider{key: key, authorizations: map[string]url.Values{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA", "kid": "key-1", "use": "sig",
+			"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("response_type") != "code" || query.Get("code_challenge_method") != "S256" || !strings.Contains(query.Get("scope"), "openid") {
+			http.Error(w, "invalid_request", http.StatusBadRequest)
+			return
+		}
+		code := fmt.Sprintf("code-%d", len(idp.authorizations))
+		idp.authorizations[code] = query
+		http.Redirect(w, r, fmt.Sprintf("%s?code=%s&state=%s", query.Get("redirect_uri"), code, url.QueryEscape(query.Get("state"))), http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		authorization, ok := idp.authorizations[r.Form.Get("code")]
+		delete(idp.authorizations, r.Form.Get("code"))
+		if !ok || r.Form.Get("redirect_uri") != authorization.Get("redirect_uri") || pkceCodeChallenge(r.Form.Get("code_verifier")) != authorization.Get("code_challenge") {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		claims := map[string]interface{}{"aud": authorization.Get("client_id"), "nonce": authorization.Get("nonce")}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": idp.token(claims)})
+	})
+	idp.server = httptest.NewServer(mux)
+	return idp
+}
+
+// token signs a JWT of given claims on top of the provider's claims
+func (this *mockIdentityProvider) token(claims map[string]interface{}) string {
+	payload := map[string]interface{}{"iss": this.server.URL, "iat": time.Now().Unix(), "exp": time.Now().Add(time.Hour).Unix()}
+	for _, source := range []map[string]interface{}{this.claims, claims} {
+		for claim, value := range source {
+			payload[claim] = value
+		}
+	}
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "key-1", "typ": "JWT"})
+	content, _ := json.Marshal(payload)
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(content)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, _ := rsa.SignPKCS1v15(rand.Reader, this.key, crypto.SHA256, digest[:])
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// newOIDCTest configures OIDC authentication against a mock provider, and serves /web/whoami and
+// /api/whoami, answering the authenticated user and whether they may make changes
+func newOIDCTest(t *testing.T) (idp *mockIdentityProvider, server *httptest.Server, closeFunc func()) {
+	configuration := *config.Config
+	idp = newMockIdentityProvider(t)
+
+	m := martini.Classic()
+	oidc := &OIDCAuthenticator{}
+	m.Use(AuthenticateAPIToken(oidc.Authenticate))
+	oidc.RegisterRequests(m)
+	whoami := func(user auth.User, req *http.Request) string {
+		return fmt.Sprintf("%s %t", user, isAuthorizedForAction(req, user))
+	}
+	m.Get("/web/whoami", whoami)
+	m.Get("/api/whoami", whoami)
+	server = httptest.NewServer(m)
+
+	config.Config.AuthenticationMethod = "oidc"
+	config.Config.OIDCIssuerURL = idp.server.URL
+	config.Config.OAuthClientId = "orchestrator"
+	config.Config.OIDCRedirectURL = server.URL + "/oidc/callback"
+	config.Config.OIDCSessionSecret = strings.Repeat("s", 32)
+	config.Config.OIDCAPIAudiences = []string{"orchestrator-api"}
+	config.Config.PowerAuthUsers = []string{}
+	config.Config.PowerAuthGroups = []string{"dba"}
+
+	return idp, server, func() {
+		server.Close()
+		idp.server.Close()
+		*config.Config = configuration
+	}
+}
+
+func getBody(t *testing.T, client *http.Client, requestURL string, bearer string) (statusCode int, body string) {
+	req, _ := http.NewRequest(http.MethodGet, requestURL, nil)
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	resp, err := client.Do(req)
+	test.S(t).ExpectNil(err)
+	defer resp.Body.Close()
+	content, _ := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, strings.TrimSpace(string(content))
+}
+
+func TestOIDCLogin(t *testing.T) {
+	idp, server, closeFunc := newOIDCTest(t)
+	defer closeFunc()
+
+	noRedirectClient := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	{
+		statusCode, _ := getBody(t, noRedirectClient, server.URL+"/web/whoami", "")
+		test.S(t).ExpectEquals(statusCode, http.StatusFound)
+		statusCode, _ = getBody(t, noRedirectClient, server.URL+"/api/whoami", "")
+		test.S(t).ExpectEquals(statusCode, http.StatusUnauthorized)
+	}
+	login := func(user string, groups ...string) *http.Client {
+		idp.claims = map[string]interface{}{"sub": "id-" + user, "preferred_username": user, "groups": groups}
+		jar, _ := cookiejar.New(nil)
+		client := &http.Client{Jar: jar}
+		// The callback answers a page navigating back to the original request
+		statusCode, body := getBody(t, client, server.URL+"/web/whoami", "")
+		test.S(t).ExpectEquals(statusCode, http.StatusOK)
+		test.S(t).ExpectTrue(strings.Contains(body, `content="0;url=/web/whoami"`))
+		statusCode, body = getBody(t, client, server.URL+"/web/whoami", "")
+		test.S(t).ExpectEquals(statusCode, http.StatusOK)
+		test.S(t).ExpectEquals(strings.Fields(body)[0], user)
+		return client
+	}
+	{
+		client := login("alice", "dba", "staff")
+		_, body := getBody(t, client, server.URL+"/api/whoami", "")
+		test.S(t).ExpectEquals(body, "alice true")
+
+		// Logged out
+		client.CheckRedirect = noRedirectClient.CheckRedirect
+		statusCode, _ := getBody(t, client, server.URL+"/oidc/logout", "")
+		test.S(t).ExpectEquals(statusCode, http.StatusFound)
+		statusCode, _ = getBody(t, client, server.URL+"/api/whoami", "")
+		test.S(t).ExpectEquals(statusCode, http.StatusUnauthorized)
+	}
+	{
+		client := login("bob", "staff")
+		_, body := getBody(t, client, server.URL+"/api/whoami", "")
+		test.S(t).ExpectEquals(body, "bob false")
+	}
+	{
+		// A session cookie signed by OIDCSessionSecret authenticates; a tampered one does not
+		principal, _ := oidcSignedValue(oidcSessionCookiePurpose, oidcPrincipal{User: "mallory", Groups: []string{"dba"}, ExpiresAt: time.Now().Add(time.Hour).Unix()})
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/api/whoami", nil)
+		req.AddCookie(&http.Cookie{Name: oidcSessionCookieName, Value: principal})
+		resp, err := http.DefaultClient.Do(req)
+		test.S(t).ExpectNil(err)
+		resp.Body.Close()
+		test.S(t).ExpectEquals(resp.StatusCode, http.StatusOK)
+
+		req.Header.Del("Cookie")
+		req.AddCookie(&http.Cookie{Name: oidcSessionCookieName, Value: principal[:len(principal)-2] + "xx"})
+		resp, err = http.DefaultClient.Do(req)
+		test.S(t).ExpectNil(err)
+		resp.Body.Close()
+		test.S(t).ExpectEquals(resp.StatusCode, http.StatusUnauthorized)
+	}
+}
+
+func TestOIDCUnauthenticatedPaths(t *testing.T) {
+	oidc := &OIDCAuthenticator{URLPrefix: "/orc"}
+	test.S(t).ExpectTrue(oidc.isUnauthenticatedPath("/orc/api/lb-check"))
+	test.S(t).ExpectTrue(oidc.isUnauthenticatedPath("/orc/api/leader-check/503"))
+	test.S(t).ExpectTrue(oidc.isUnauthenticatedPath("/orc/api/raft-follower-health-report/token/10.0.0.2/10.0.0.2"))
+	test.S(t).ExpectTrue(oidc.isUnauthenticatedPath(config.Config.StatusEndpoint))
+	test.S(t).ExpectFalse(oidc.isUnauthenticatedPath("/orc/api/raft-snapshots"))
+	test.S(t).ExpectFalse(oidc.isUnauthenticatedPath("/orc/api/reload-configuration"))
+	test.S(t).ExpectFalse(oidc.isUnauthenticatedPath("/api/lb-check"))
+	test.S(t).ExpectFalse(oidc.isUnauthenticatedPath("/orc/web/health"))
+}
+
+func TestOIDCCookieSameSite(t *testing.T) {
+	oidc := &OIDCAuthenticator{}
+	w := httptest.NewRecorder()
+	oidc.setCookie(w, oidcLoginCookieName, "login", time.Now().Add(time.Minute))
+	oidc.setCookie(w, oidcSessionCookieName, "session", time.Now().Add(time.Minute))
+	cookies := w.Result().Cookies()
+	test.S(t).ExpectEquals(len(cookies), 2)
+	test.S(t).ExpectEquals(cookies[0].SameSite, http.SameSiteLaxMode)
+	test.S(t).ExpectEquals(cookies[1].SameSite, http.SameSiteStrictMode)
+}
+
+func TestOIDCCallbackStateMismatch(t *testing.T) {
+	_, server, closeFunc := newOIDCTest(t)
+	defer closeFunc()
+
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar, CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	statusCode, _ := getBody(t, client, server.URL+"/oidc/callback?code=code-0&state=forged", "")
+	test.S(t).ExpectEquals(statusCode, http.StatusBadRequest)
+
+	statusCode, _ = getBody(t, client, server.URL+"/oidc/login?redirect=/web/whoami", "")
+	test.S(t).ExpectEquals(statusCode, http.StatusFound)
+	statusCode, body := getBody(t, client, server.URL+"/oidc/callback?code=code-0&state=forged", "")
+	test.S(t).ExpectEquals(statusCode, http.StatusBadRequest)
+	test.S(t).ExpectTrue(strings.Contains(body, "state mismatch"))
+}
+
+func TestOIDCBearer(t *testing.T) {
+	idp, server, closeFunc := newOIDCTest(t)
+	defer closeFunc()
+
+	idp.claims = map[string]interface{}{"sub": "svc-deploy", "groups": []string{"dba"}}
+	{
+		_, body := getBody(t, http.DefaultClient, server.URL+"/api/whoami", idp.token(map[string]interface{}{"aud": "orchestrator-api"}))
+		test.S(t).ExpectEquals(body, "svc-deploy true")
+	}
+	for _, token := range []string{
+		idp.token(map[string]interface{}{"aud": "elsewhere"}),
+		idp.token(map[string]interface{}{"aud": "orchestrator", "exp": time.Now().Add(-time.Hour).Unix()}),
+		idp.token(map[string]interface{}{"aud": "orchestrator", "iss": "https://evil.example.com"}),
+		idp.token(map[string]interface{}{"aud": "orchestrator"}) + "x",
+		"eyJhbGciOiJub25lIn0.eyJzdWIiOiJtYWxsb3J5In0.",
+	} {
+		statusCode, _ := getBody(t, http.DefaultClient, server.URL+"/api/whoami", token)
+		test.S(t).ExpectEquals(statusCode, http.StatusUnauthorized)
+	}
+}
+
+func TestValidateJWTClaims(t *testing.T) {
+	now := time.Now()
+	claims := func(extra map[string]interface{}) map[string]interface{} {
+		claims := map[string]interface{}{"iss": "https://idp", "aud": []interface{}{"other", "orchestrator"}, "exp": float64(now.Add(time.Minute).Unix())}
+		for claim, value := range extra {
+			claims[claim] = value
+		}
+		return claims
+	}
+	test.S(t).ExpectNil(validateJWTClaims(claims(nil), "https://idp", []string{"orchestrator"}, "", now))
+	test.S(t).ExpectNil(validateJWTClaims(claims(map[string]interface{}{"nonce": "n"}), "https://idp", []string{"orchestrator"}, "n", now))
+	test.S(t).ExpectNotNil(validateJWTClaims(claims(nil), "https://idp", []string{"orchestrator"}, "n", now))
+	test.S(t).ExpectNotNil(validateJWTClaims(claims(nil), "https://idp/", []string{"orchestrator"}, "", now))
+	test.S(t).ExpectNotNil(validateJWTClaims(claims(nil), "https://idp", []string{"orchestrator-api"}, "", now))
+	test.S(t).ExpectNotNil(validateJWTClaims(claims(map[string]interface{}{"exp": nil}), "https://idp", []string{"orchestrator"}, "", now))
+	test.S(t).ExpectNotNil(validateJWTClaims(claims(nil), "https://idp", []string{"orchestrator"}, "", now.Add(time.Hour)))
+	test.S(t).ExpectNotNil(validateJWTClaims(claims(map[string]interface{}{"nbf": float64(now.Add(time.Hour).Unix())}), "https://idp", []string{"orchestrator"}, "", now))
+}
+
+func TestVerifyJWTSignatureEC(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.S(t).ExpectNil(err)
+	digest := sha256.Sum256([]byte("header.payload"))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	test.S(t).ExpectNil(err)
+	signature := make([]byte, 64)
+	rBytes, sBytes := r.Bytes(), s.Bytes()
+	copy(signature[32-len(rBytes):32], rBytes)
+	copy(signature[64-len(sBytes):], sBytes)
+
+	test.S(t).ExpectNil(verifyJWTSignature("ES256", &key.PublicKey, "header.payload", signature))
+	test.S(t).ExpectNotNil(verifyJWTSignature("ES256", &key.PublicKey, "header.tampered", signature))
+	test.S(t).ExpectNotNil(verifyJWTSignature("RS256", &key.PublicKey, "header.payload", signature))
+	test.S(t).ExpectNotNil(verifyJWTSignature("HS256", &key.PublicKey, "header.payload", signature))
+}
+
+func TestOIDCPrincipal(t *testing.T) {
+	defer func(users []string, groups []string) {
+		config.Config.PowerAuthUsers, config.Config.PowerAuthGroups = users, groups
+	}(config.Config.PowerAuthUsers, config.Config.PowerAuthGroups)
+	config.Config.PowerAuthUsers = []string{"carol"}
+	config.Config.PowerAuthGroups = []string{"dba"}
+
+	principal, err := oidcPrincipalOf(map[string]interface{}{"sub": "id-1", "groups": []interface{}{"staff", "dba"}})
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(principal.User, "id-1")
+	test.S(t).ExpectTrue(principal.isPowerUser())
+
+	principal, err = oidcPrincipalOf(map[string]interface{}{"sub": "id-2", "preferred_username": "carol", "groups": "staff"})
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(principal.User, "carol")
+	test.S(t).ExpectEquals(strings.Join(principal.Groups, ","), "staff")
+	test.S(t).ExpectTrue(principal.isPowerUser())
+
+	principal, _ = oidcPrincipalOf(map[string]interface{}{"sub": "id-3"})
+	test.S(t).ExpectFalse(principal.isPowerUser())
+
+	_, err = oidcPrincipalOf(map[string]interface{}{"email": "dave@example.com"})
+	test.S(t).ExpectNotNil(err)
+}
+
+func TestOIDCLocalRedirect(t *testing.T) {
+	oidc := &OIDCAuthenticator{URLPrefix: "/orc"}
+	test.S(t).ExpectEquals(oidc.localRedirect("/orc/web/clusters?x=1"), "/orc/web/clusters?x=1")
+	test.S(t).ExpectEquals(oidc.localRedirect("https://evil.example.com/"), "/orc/")
+	test.S(t).ExpectEquals(oidc.localRedirect("//evil.example.com/"), "/orc/")
+	test.S(t).ExpectEquals(oidc.localRedirect(""), "/orc/")
+}
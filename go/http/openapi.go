@@ -0,0 +1,267 @@
+/*
+   Copyright 2019 GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package http
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"path"
+	"reflect"
+	"runtime"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/github/orchestrator/go/inst"
+)
+
+// openAPISchema is an OpenAPI schema object
+type openAPISchema map[string]interface{}
+
+var (
+	timeType           = reflect.TypeOf(time.Time{})
+	instanceKeyMapType = reflect.TypeOf(inst.InstanceKeyMap{})
+	responseCodeType   = reflect.TypeOf(APIResponseCode(0))
+	jsonMarshalerType  = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType  = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// openAPISchemas generates OpenAPI schemas of Go types, as encoding/json marshals them. Named
+// structs are generated once, as components referenced by name, which also allows recursive types.
+type openAPISchemas struct {
+	components map[string]openAPISchema
+}
+
+func newOpenAPISchemas() *openAPISchemas {
+	return &openAPISchemas{components: make(map[string]openAPISchema)}
+}
+
+// componentName names a struct's schema component, e.g. "inst.Instance"
+func componentName(t reflect.Type) string {
+	return fmt.Sprintf("%s.%s", path.Base(t.PkgPath()), t.Name())
+}
+
+// schemaOf returns the schema of given type
+func (this *openAPISchemas) schemaOf(t reflect.Type) openAPISchema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t {
+	case timeType:
+		return openAPISchema{"type": "string", "format": "date-time"}
+	case instanceKeyMapType:
+		return openAPISchema{"type": "array", "items": this.schemaOf(reflect.TypeOf(inst.InstanceKey{}))}
+	case responseCodeType:
+		return openAPISchema{"type": "string", "enum": []string{"OK", "ERROR"}}
+	}
+	if t.Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(jsonMarshalerType) {
+		// Custom marshaling; shape unknown
+		return openAPISchema{}
+	}
+	if t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType) {
+		return openAPISchema{"type": "string"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return openAPISchema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return openAPISchema{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return openAPISchema{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return openAPISchema{"type": "number"}
+	case reflect.String:
+		return openAPISchema{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return openAPISchema{"type": "string", "format": "byte"}
+		}
+		return openAPISchema{"type": "array", "items": this.schemaOf(t.Elem())}
+	case reflect.Map:
+		return openAPISchema{"type": "object", "additionalProperties": this.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return this.structSchema(t)
+		}
+		name := componentName(t)
+		if _, found := this.components[name]; !found {
+			// Placeholder, in case the struct refers to itself
+			this.components[name] = openAPISchema{}
+			this.components[name] = this.structSchema(t)
+		}
+		return openAPISchema{"$ref": "#/components/schemas/" + name}
+	}
+	// Interfaces, or anything else: any value
+	return openAPISchema{}
+}
+
+// structSchema returns the schema of a struct, flattening embedded structs as encoding/json does
+func (this *openAPISchemas) structSchema(t reflect.Type) openAPISchema {
+	properties := make(map[string]openAPISchema)
+	this.addStructProperties(t, properties)
+	return openAPISchema{"type": "object", "properties": properties}
+}
+
+func (this *openAPISchemas) addStructProperties(t reflect.Type, properties map[string]openAPISchema) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		tagName := strings.Split(tag, ",")[0]
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && tagName == "" && fieldType.Kind() == reflect.Struct {
+			this.addStructProperties(fieldType, properties)
+			continue
+		}
+		if field.PkgPath != "" {
+			// unexported
+			continue
+		}
+		name := field.Name
+		if tagName != "" {
+			name = tagName
+		}
+		if strings.Contains(tag, ",string") {
+			properties[name] = openAPISchema{"type": "string"}
+		} else {
+			properties[name] = this.schemaOf(field.Type)
+		}
+	}
+}
+
+// operationId names a route's operation after its handler, e.g. "clusterInstances" for v2ClusterInstances
+func (this *apiV2Route) operationId() string {
+	name := runtime.FuncForPC(reflect.ValueOf(this.Handler).Pointer()).Name()
+	name = strings.TrimSuffix(name, "-fm")
+	name = name[strings.LastIndex(name, ".")+1:]
+	name = strings.TrimPrefix(name, "v2")
+	if name == "" {
+		return name
+	}
+	runes := []rune(name)
+	runes[0] = unicode.ToLower(runes[0])
+	return string(runes)
+}
+
+// openAPIPath converts a martini pattern to an OpenAPI path, listing path parameters
+func openAPIPath(pattern string) (openAPIPath string, parameters []string) {
+	segments := strings.Split(pattern, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			parameter := strings.TrimPrefix(segment, ":")
+			parameters = append(parameters, parameter)
+			segments[i] = fmt.Sprintf("{%s}", parameter)
+		}
+	}
+	return "/" + strings.Join(segments, "/"), parameters
+}
+
+// openAPIOperation describes a route as an OpenAPI operation
+func (this *openAPISchemas) openAPIOperation(route *apiV2Route, pathParameters []string) map[string]interface{} {
+	parameters := []map[string]interface{}{}
+	for _, parameter := range pathParameters {
+		parameterType := "string"
+		if parameter == "port" {
+			parameterType = "integer"
+		}
+		parameters = append(parameters, map[string]interface{}{
+			"name":     parameter,
+			"in":       "path",
+			"required": true,
+			"schema":   openAPISchema{"type": parameterType},
+		})
+	}
+	for _, parameter := range route.Query {
+		parameters = append(parameters, map[string]interface{}{
+			"name":        parameter.Name,
+			"in":          "query",
+			"description": parameter.Description,
+			"schema":      openAPISchema{"type": parameter.Type},
+		})
+	}
+	responses := map[string]interface{}{
+		"default": map[string]interface{}{
+			"description": "Error",
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": this.schemaOf(reflect.TypeOf(APIError{}))},
+			},
+		},
+	}
+	if route.Response == nil {
+		responses["204"] = map[string]interface{}{"description": "Success"}
+	} else {
+		responses["200"] = map[string]interface{}{
+			"description": "Success",
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": this.schemaOf(reflect.TypeOf(route.Response))},
+			},
+		}
+	}
+	if !route.isMutation() {
+		responses["304"] = map[string]interface{}{"description": "Not modified since the ETag given in If-None-Match"}
+	}
+	operation := map[string]interface{}{
+		"operationId": route.operationId(),
+		"summary":     route.Summary,
+		"tags":        []string{route.Tag},
+		"parameters":  parameters,
+		"responses":   responses,
+	}
+	if route.Request != nil {
+		operation["requestBody"] = map[string]interface{}{
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": this.schemaOf(reflect.TypeOf(route.Request))},
+			},
+		}
+	}
+	return operation
+}
+
+// OpenAPIDocument generates the OpenAPI 3 document of API v2, from its routes
+func (this *HttpAPI) OpenAPIDocument() map[string]interface{} {
+	schemas := newOpenAPISchemas()
+	paths := make(map[string]map[string]interface{})
+	for _, route := range this.apiV2Routes() {
+		route := route
+		routePath, pathParameters := openAPIPath(route.Path)
+		if _, found := paths[routePath]; !found {
+			paths[routePath] = make(map[string]interface{})
+		}
+		paths[routePath][strings.ToLower(route.Method)] = schemas.openAPIOperation(&route, pathParameters)
+	}
+	return map[string]interface{}{
+		"openapi": "3.0.0",
+		"info": map[string]interface{}{
+			"title":       "orchestrator",
+			"description": "MySQL replication topology management and high availability",
+			"version":     APIVersion2,
+		},
+		"servers": []map[string]interface{}{
+			{"url": fmt.Sprintf("%s/api/%s", this.URLPrefix, APIVersion2)},
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas.components,
+		},
+	}
+}
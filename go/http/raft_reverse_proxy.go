@@ -5,6 +5,7 @@ import (
 	"net/http/httputil"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/openark/golib/log"
 
@@ -44,5 +45,7 @@ func raftReverseProxy(w http.ResponseWriter, r *http.Request, c martini.Context)
 		r.SetBasicAuth(config.Config.HTTPAuthUser, config.Config.HTTPAuthPassword)
 	}
 	proxy := httputil.NewSingleHostReverseProxy(url)
+	// Streamed responses, such as the events stream, are relayed as they arrive
+	proxy.FlushInterval = 100 * time.Millisecond
 	proxy.ServeHTTP(w, r)
 }
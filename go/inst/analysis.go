@@ -54,6 +54,8 @@ const (
 	AllIntermediateMasterSlavesNotReplicating                          = "AllIntermediateMasterSlavesNotReplicating"
 	FirstTierSlaveFailingToConnectToMaster                             = "FirstTierSlaveFailingToConnectToMaster"
 	BinlogServerFailingToConnectToMaster                               = "BinlogServerFailingToConnectToMaster"
+	LaggingReplicaStalledOnLongQuery                                   = "LaggingReplicaStalledOnLongQuery"
+	ClusterLinkNotReplicating                                          = "ClusterLinkNotReplicating"
 )
 
 const (
@@ -66,6 +68,12 @@ const (
 	ErrantGTIDStructureWarning                                               = "ErrantGTIDStructureWarning"
 	NoFailoverSupportStructureWarning                                        = "NoFailoverSupportStructureWarning"
 	NoWriteableMasterStructureWarning                                        = "NoWriteableMasterStructureWarning"
+	DifferentReplicationFiltersStructureWarning                              = "DifferentReplicationFiltersStructureWarning"
+	DifferentBinlogRowImageStructureWarning                                  = "DifferentBinlogRowImageStructureWarning"
+	DifferentSQLModesStructureWarning                                        = "DifferentSQLModesStructureWarning"
+	DifferentLowerCaseTableNamesStructureWarning                             = "DifferentLowerCaseTableNamesStructureWarning"
+	DifferentCharacterSetsStructureWarning                                   = "DifferentCharacterSetsStructureWarning"
+	DifferentTimeZonesStructureWarning                                       = "DifferentTimeZonesStructureWarning"
 )
 
 type InstanceAnalysis struct {
@@ -147,6 +155,9 @@ type ReplicationAnalysis struct {
 	CountDistinctMajorVersionsLoggingReplicas uint
 	CountDelayedReplicas                      uint
 	CountLaggingReplicas                      uint
+	CountLaggingReplicasStalledOnLongQueries  uint // lagging replicas with long running queries or transactions, see LongRunningQueriesSampleIntervalSeconds
+	IsStalledOnLongQuery                      bool
+	IsClusterLinkBoundary                     bool // master of a linked downstream cluster, see link-cluster
 	IsActionableRecovery                      bool
 	ProcessingNodeHostname                    string
 	ProcessingNodeToken                       string
@@ -159,6 +170,13 @@ type ReplicationAnalysis struct {
 	MaxReplicaGTIDErrant                      string
 	CommandHint                               string
 	IsReadOnly                                bool
+	CountReplicasWithReplicationFilters       uint
+	CountDistinctReplicaReplicationFilters    uint
+	CountReplicasWithDifferentBinlogRowImage  uint
+	CountReplicasWithDifferentSQLMode         uint
+	CountReplicasWithDifferentLowerCaseTables uint
+	CountReplicasWithDifferentCharacterSet    uint
+	CountReplicasWithDifferentTimeZone        uint
 }
 
 type AnalysisMap map[string](*ReplicationAnalysis)
@@ -186,6 +204,11 @@ func (this *ReplicationAnalysis) AnalysisString() string {
 	return strings.Join(result, ", ")
 }
 
+// ClusterConfig returns the configuration in effect for the analyzed cluster
+func (this *ReplicationAnalysis) ClusterConfig() *config.Configuration {
+	return config.Config.ForCluster(this.ClusterDetails.ClusterName, this.ClusterDetails.ClusterAlias)
+}
+
 // Get a string description of the analyzed instance type (master? co-master? intermediate-master?)
 func (this *ReplicationAnalysis) GetAnalysisInstanceType() AnalysisInstanceType {
 	if this.IsCoMaster {
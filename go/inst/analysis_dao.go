@@ -23,6 +23,7 @@ import (
 
 	"github.com/github/orchestrator/go/config"
 	"github.com/github/orchestrator/go/db"
+	"github.com/github/orchestrator/go/events"
 	"github.com/github/orchestrator/go/process"
 	"github.com/github/orchestrator/go/raft"
 	"github.com/github/orchestrator/go/util"
@@ -55,11 +56,17 @@ func initializeAnalysisDaoPostConfiguration() {
 func GetReplicationAnalysis(clusterName string, hints *ReplicationAnalysisHints) ([]ReplicationAnalysis, error) {
 	result := []ReplicationAnalysis{}
 
-	args := sqlutils.Args(ValidSecondsFromSeenToLastAttemptedCheck(), config.Config.ReasonableReplicationLagSeconds, clusterName)
+	// ReasonableReplicationLagSeconds may be overridden per cluster
+	lagExpression, lagArgs := reasonableReplicationLagSecondsExpression("master_instance.cluster_name")
+	args := sqlutils.Args(ValidSecondsFromSeenToLastAttemptedCheck())
+	for i := 0; i < 3; i++ {
+		args = append(args, lagArgs...)
+	}
+	args = append(args, clusterName)
 	analysisQueryReductionClause := ``
 
 	if config.Config.ReduceReplicationAnalysisCount {
-		analysisQueryReductionClause = `
+		analysisQueryReductionClause = fmt.Sprintf(`
 			HAVING
 				(MIN(
 					master_instance.last_checked <= master_instance.last_seen
@@ -67,7 +74,7 @@ func GetReplicationAnalysis(clusterName string, hints *ReplicationAnalysisHints)
        	 ) = 1 /* AS is_last_check_valid */) = 0
 				OR (IFNULL(SUM(replica_instance.last_checked <= replica_instance.last_seen
 		                    AND replica_instance.slave_io_running = 0
-		                    AND replica_instance.last_io_error like '%error %connecting to master%'
+		                    AND replica_instance.last_io_error like '%%error %%connecting to master%%'
 		                    AND replica_instance.slave_sql_running = 1),
 		                0) /* AS count_replicas_failing_to_connect_to_master */ > 0)
 				OR (IFNULL(SUM(replica_instance.last_checked <= replica_instance.last_seen),
@@ -79,11 +86,22 @@ func GetReplicationAnalysis(clusterName string, hints *ReplicationAnalysisHints)
 				OR (MIN(
 		            master_instance.slave_sql_running = 1
 		            AND master_instance.slave_io_running = 0
-		            AND master_instance.last_io_error like '%error %connecting to master%'
+		            AND master_instance.last_io_error like '%%error %%connecting to master%%'
 		          ) /* AS is_failing_to_connect_to_master */)
 				OR (COUNT(replica_instance.server_id) /* AS count_replicas */ > 0)
-			`
+				OR (MIN(master_instance.slave_lag_seconds > %s
+						AND master_instance.slave_sql_running = 1
+						AND EXISTS (
+							SELECT 1 FROM database_instance_long_running_queries
+							WHERE database_instance_long_running_queries.hostname = master_instance.hostname
+								AND database_instance_long_running_queries.port = master_instance.port
+						)) /* AS is_stalled_on_long_query */)
+				OR (MIN(cluster_link.hostname IS NOT NULL
+						AND NOT (master_instance.slave_io_running = 1 AND master_instance.slave_sql_running = 1)
+						) /* AS cluster link not replicating */)
+			`, lagExpression)
 		args = append(args, ValidSecondsFromSeenToLastAttemptedCheck())
+		args = append(args, lagArgs...)
 	}
 	// "OR count_replicas > 0" above is a recent addition, which, granted, makes some previous conditions redundant.
 	// It gives more output, and more "NoProblem" messages that I am now interested in for purpose of auditing in database_instance_analysis_changelog
@@ -107,7 +125,11 @@ func GetReplicationAnalysis(clusterName string, hints *ReplicationAnalysisHints)
 						MIN(master_instance.last_check_partial_success) as last_check_partial_success,
 		        MIN(master_instance.master_host IN ('' , '_')
 		            OR master_instance.master_port = 0
-								OR substr(master_instance.master_host, 1, 2) = '//') AS is_master,
+								OR substr(master_instance.master_host, 1, 2) = '//'
+								OR cluster_link.hostname IS NOT NULL) AS is_master,
+						MIN(cluster_link.hostname IS NOT NULL) AS is_cluster_link_boundary,
+						MIN(master_instance.slave_io_running = 1
+								AND master_instance.slave_sql_running = 1) AS is_replicating,
 		        MIN(master_instance.is_co_master) AS is_co_master,
 		        MIN(CONCAT(master_instance.hostname,
 		                ':',
@@ -189,8 +211,23 @@ func GetReplicationAnalysis(clusterName string, hints *ReplicationAnalysisHints)
               0) AS count_row_based_loggin_slaves,
 						IFNULL(SUM(replica_instance.sql_delay > 0),
               0) AS count_delayed_replicas,
-						IFNULL(SUM(replica_instance.slave_lag_seconds > ?),
+						IFNULL(SUM(replica_instance.slave_lag_seconds > %s),
               0) AS count_lagging_replicas,
+						IFNULL(SUM(replica_instance.slave_lag_seconds > %s
+								AND replica_instance.slave_sql_running = 1
+								AND EXISTS (
+									SELECT 1 FROM database_instance_long_running_queries
+									WHERE database_instance_long_running_queries.hostname = replica_instance.hostname
+										AND database_instance_long_running_queries.port = replica_instance.port
+								)),
+              0) AS count_lagging_replicas_stalled_on_long_queries,
+						MIN(master_instance.slave_lag_seconds > %s
+								AND master_instance.slave_sql_running = 1
+								AND EXISTS (
+									SELECT 1 FROM database_instance_long_running_queries
+									WHERE database_instance_long_running_queries.hostname = master_instance.hostname
+										AND database_instance_long_running_queries.port = master_instance.port
+								)) AS is_stalled_on_long_query,
 						IFNULL(MIN(replica_instance.gtid_mode), '')
               AS min_replica_gtid_mode,
 						IFNULL(MAX(replica_instance.gtid_mode), '')
@@ -210,7 +247,32 @@ func GetReplicationAnalysis(clusterName string, hints *ReplicationAnalysisHints)
 								then replica_instance.major_version
 								else NULL
 							end
-						) AS count_distinct_logging_major_versions
+						) AS count_distinct_logging_major_versions,
+						IFNULL(SUM(replica_instance.has_replication_filters),
+              0) AS count_replicas_with_replication_filters,
+						COUNT(DISTINCT replica_instance.replication_filters) AS count_distinct_replica_replication_filters,
+						IFNULL(SUM(replica_instance.log_bin
+								AND replica_instance.log_slave_updates
+								AND replica_instance.binlog_row_image != ''
+								AND master_instance.binlog_row_image != ''
+								AND replica_instance.binlog_row_image != master_instance.binlog_row_image),
+              0) AS count_replicas_with_different_binlog_row_image,
+						IFNULL(SUM(replica_instance.character_set_server != ''
+								AND master_instance.character_set_server != ''
+								AND replica_instance.sql_mode != master_instance.sql_mode),
+              0) AS count_replicas_with_different_sql_mode,
+						IFNULL(SUM(replica_instance.character_set_server != ''
+								AND master_instance.character_set_server != ''
+								AND replica_instance.lower_case_table_names != master_instance.lower_case_table_names),
+              0) AS count_replicas_with_different_lower_case_table_names,
+						IFNULL(SUM(replica_instance.character_set_server != ''
+								AND master_instance.character_set_server != ''
+								AND replica_instance.character_set_server != master_instance.character_set_server),
+              0) AS count_replicas_with_different_character_set_server,
+						IFNULL(SUM(replica_instance.time_zone != ''
+								AND master_instance.time_zone != ''
+								AND replica_instance.time_zone != master_instance.time_zone),
+              0) AS count_replicas_with_different_time_zone
 		    FROM
 		        database_instance master_instance
           LEFT JOIN
@@ -218,7 +280,15 @@ func GetReplicationAnalysis(clusterName string, hints *ReplicationAnalysisHints)
           LEFT JOIN
 		        database_instance replica_instance ON (COALESCE(hostname_resolve.resolved_hostname,
               master_instance.hostname) = replica_instance.master_host
-							AND master_instance.port = replica_instance.master_port)
+							AND master_instance.port = replica_instance.master_port
+							AND NOT EXISTS (
+								SELECT 1 FROM cluster_link
+								WHERE cluster_link.hostname = replica_instance.hostname
+									AND cluster_link.port = replica_instance.port
+							))
+          LEFT JOIN
+		        cluster_link ON (master_instance.hostname = cluster_link.hostname
+							AND master_instance.port = cluster_link.port)
           LEFT JOIN
 		        database_instance_maintenance ON (master_instance.hostname = database_instance_maintenance.hostname
 							AND master_instance.port = database_instance_maintenance.port
@@ -246,7 +316,7 @@ func GetReplicationAnalysis(clusterName string, hints *ReplicationAnalysisHints)
 			    is_master DESC ,
 			    is_cluster_master DESC,
 			    count_replicas DESC
-	`, analysisQueryReductionClause)
+	`, lagExpression, lagExpression, lagExpression, analysisQueryReductionClause)
 
 	err := db.QueryOrchestrator(query, args, func(m sqlutils.RowMap) error {
 		a := ReplicationAnalysis{
@@ -304,9 +374,23 @@ func GetReplicationAnalysis(clusterName string, hints *ReplicationAnalysisHints)
 
 		a.CountDelayedReplicas = m.GetUint("count_delayed_replicas")
 		a.CountLaggingReplicas = m.GetUint("count_lagging_replicas")
+		a.CountLaggingReplicasStalledOnLongQueries = m.GetUint("count_lagging_replicas_stalled_on_long_queries")
+		a.IsStalledOnLongQuery = m.GetBool("is_stalled_on_long_query")
+		a.IsClusterLinkBoundary = m.GetBool("is_cluster_link_boundary")
+		isReplicating := m.GetBool("is_replicating")
 
 		a.IsReadOnly = m.GetUint("read_only") == 1
 
+		a.CountReplicasWithReplicationFilters = m.GetUint("count_replicas_with_replication_filters")
+		a.CountDistinctReplicaReplicationFilters = m.GetUint("count_distinct_replica_replication_filters")
+		a.CountReplicasWithDifferentBinlogRowImage = m.GetUint("count_replicas_with_different_binlog_row_image")
+		// Server settings are read by a single query: an empty character_set_server means none is known, in which
+		// case an empty sql_mode or a 0 lower_case_table_names does not count as a difference
+		a.CountReplicasWithDifferentSQLMode = m.GetUint("count_replicas_with_different_sql_mode")
+		a.CountReplicasWithDifferentLowerCaseTables = m.GetUint("count_replicas_with_different_lower_case_table_names")
+		a.CountReplicasWithDifferentCharacterSet = m.GetUint("count_replicas_with_different_character_set_server")
+		a.CountReplicasWithDifferentTimeZone = m.GetUint("count_replicas_with_different_time_zone")
+
 		if !a.LastCheckValid {
 			analysisMessage := fmt.Sprintf("analysis: IsMaster: %+v, LastCheckValid: %+v, LastCheckPartialSuccess: %+v, CountReplicas: %+v, CountValidReplicatingReplicas: %+v, CountLaggingReplicas: %+v, CountDelayedReplicas: %+v, ",
 				a.IsMaster, a.LastCheckValid, a.LastCheckPartialSuccess, a.CountReplicas, a.CountValidReplicatingReplicas, a.CountLaggingReplicas, a.CountDelayedReplicas,
@@ -331,7 +415,7 @@ func GetReplicationAnalysis(clusterName string, hints *ReplicationAnalysisHints)
 			a.Analysis = DeadMasterAndSomeSlaves
 			a.Description = "Master cannot be reached by orchestrator; some of its replicas are unreachable and none of its reachable replicas is replicating"
 			//
-		} else if a.IsMaster && !a.LastCheckValid && a.CountLaggingReplicas == a.CountReplicas && a.CountDelayedReplicas < a.CountReplicas && a.CountValidReplicatingReplicas > 0 {
+		} else if a.IsMaster && !a.LastCheckValid && a.CountLaggingReplicas == a.CountReplicas && a.CountDelayedReplicas < a.CountReplicas && a.CountLaggingReplicasStalledOnLongQueries < a.CountLaggingReplicas && a.CountValidReplicatingReplicas > 0 {
 			a.Analysis = UnreachableMasterWithLaggingReplicas
 			a.Description = "Master cannot be reached by orchestrator and all of its replicas are lagging"
 			//
@@ -391,7 +475,7 @@ func GetReplicationAnalysis(clusterName string, hints *ReplicationAnalysisHints)
 			a.Analysis = DeadIntermediateMasterAndSlaves
 			a.Description = "Intermediate master cannot be reached by orchestrator and all of its replicas are unreachable"
 			//
-		} else if !a.IsMaster && !a.LastCheckValid && a.CountLaggingReplicas == a.CountReplicas && a.CountDelayedReplicas < a.CountReplicas && a.CountValidReplicatingReplicas > 0 {
+		} else if !a.IsMaster && !a.LastCheckValid && a.CountLaggingReplicas == a.CountReplicas && a.CountDelayedReplicas < a.CountReplicas && a.CountLaggingReplicasStalledOnLongQueries < a.CountLaggingReplicas && a.CountValidReplicatingReplicas > 0 {
 			a.Analysis = UnreachableIntermediateMasterWithLaggingReplicas
 			a.Description = "Intermediate master cannot be reached by orchestrator and all of its replicas are lagging"
 			//
@@ -420,6 +504,14 @@ func GetReplicationAnalysis(clusterName string, hints *ReplicationAnalysisHints)
 			a.Analysis = FirstTierSlaveFailingToConnectToMaster
 			a.Description = "1st tier slave (directly replicating from topology master) is unable to connect to the master"
 			//
+		} else if a.IsStalledOnLongQuery {
+			a.Analysis = LaggingReplicaStalledOnLongQuery
+			a.Description = "Replica is lagging while replicating, and is running a long query or transaction; replication is stalled rather than broken"
+			//
+		} else if a.IsClusterLinkBoundary && a.LastCheckValid && !isReplicating {
+			a.Analysis = ClusterLinkNotReplicating
+			a.Description = "Master of a linked downstream cluster is reachable but is not replicating from the upstream cluster"
+			//
 		}
 		//		 else if a.IsMaster && a.CountReplicas == 0 {
 		//			a.Analysis = MasterWithoutSlaves
@@ -497,12 +589,33 @@ func GetReplicationAnalysis(clusterName string, hints *ReplicationAnalysisHints)
 				a.StructureAnalysis = append(a.StructureAnalysis, NoWriteableMasterStructureWarning)
 			}
 
+			// Replicas which drift from their master or siblings make for unsafe promotions
+			if a.CountReplicasWithReplicationFilters > 0 &&
+				(a.CountReplicasWithReplicationFilters < a.CountReplicas || a.CountDistinctReplicaReplicationFilters > 1) {
+				a.StructureAnalysis = append(a.StructureAnalysis, DifferentReplicationFiltersStructureWarning)
+			}
+			if a.CountReplicasWithDifferentBinlogRowImage > 0 {
+				a.StructureAnalysis = append(a.StructureAnalysis, DifferentBinlogRowImageStructureWarning)
+			}
+			if a.CountReplicasWithDifferentSQLMode > 0 {
+				a.StructureAnalysis = append(a.StructureAnalysis, DifferentSQLModesStructureWarning)
+			}
+			if a.CountReplicasWithDifferentLowerCaseTables > 0 {
+				a.StructureAnalysis = append(a.StructureAnalysis, DifferentLowerCaseTableNamesStructureWarning)
+			}
+			if a.CountReplicasWithDifferentCharacterSet > 0 {
+				a.StructureAnalysis = append(a.StructureAnalysis, DifferentCharacterSetsStructureWarning)
+			}
+			if a.CountReplicasWithDifferentTimeZone > 0 {
+				a.StructureAnalysis = append(a.StructureAnalysis, DifferentTimeZonesStructureWarning)
+			}
+
 		}
 		appendAnalysis(&a)
 
 		if a.CountReplicas > 0 && hints.AuditAnalysis {
 			// Interesting enough for analysis
-			go auditInstanceAnalysisInChangelog(&a.AnalyzedInstanceKey, a.Analysis)
+			go auditInstanceAnalysisInChangelog(&a.AnalyzedInstanceKey, a.ClusterDetails.ClusterName, a.Analysis)
 		}
 		return nil
 	})
@@ -547,7 +660,7 @@ func getConcensusReplicationAnalysis(analysisEntries []ReplicationAnalysis) ([]R
 // auditInstanceAnalysisInChangelog will write down an instance's analysis in the database_instance_analysis_changelog table.
 // To not repeat recurring analysis code, the database_instance_last_analysis table is used, so that only changes to
 // analysis codes are written.
-func auditInstanceAnalysisInChangelog(instanceKey *InstanceKey, analysisCode AnalysisCode) error {
+func auditInstanceAnalysisInChangelog(instanceKey *InstanceKey, clusterName string, analysisCode AnalysisCode) error {
 	if lastWrittenAnalysis, found := recentInstantAnalysis.Get(instanceKey.DisplayString()); found {
 		if lastWrittenAnalysis == analysisCode {
 			// Surely nothing new.
@@ -601,6 +714,7 @@ func auditInstanceAnalysisInChangelog(instanceKey *InstanceKey, analysisCode Ana
 	if !lastAnalysisChanged {
 		return nil
 	}
+	events.Publish(events.AnalysisChanged, clusterName, instanceKey.Hostname, instanceKey.Port, string(analysisCode), nil)
 
 	_, err := db.ExecOrchestrator(`
 			insert into database_instance_analysis_changelog (
@@ -24,6 +24,7 @@ import (
 
 	"github.com/github/orchestrator/go/config"
 	"github.com/github/orchestrator/go/db"
+	"github.com/github/orchestrator/go/events"
 	"github.com/openark/golib/log"
 	"github.com/openark/golib/sqlutils"
 	"github.com/rcrowley/go-metrics"
@@ -34,6 +35,15 @@ var syslogWriter *syslog.Writer
 
 var auditOperationCounter = metrics.NewCounter()
 
+// auditOperationEvents maps audited operations to the events they publish
+var auditOperationEvents = map[string]events.EventType{
+	"forget":         events.InstanceForgotten,
+	"forget-unseen":  events.InstanceForgotten,
+	"forget-stale":   events.InstanceForgotten,
+	"begin-downtime": events.DowntimeBegun,
+	"end-downtime":   events.DowntimeEnded,
+}
+
 func init() {
 	metrics.Register("audit.write", auditOperationCounter)
 }
@@ -49,12 +59,21 @@ func EnableAuditSyslog() (err error) {
 
 // AuditOperation creates and writes a new audit entry by given params
 func AuditOperation(auditType string, instanceKey *InstanceKey, message string) error {
+	clusterName := ""
+	if instanceKey != nil && instanceKey.Hostname != "" {
+		clusterName, _ = GetClusterName(instanceKey)
+	}
+	return auditOperation(auditType, instanceKey, clusterName, message)
+}
+
+// auditOperation creates and writes a new audit entry of an instance whose cluster name is known to the caller,
+// e.g. as the instance has just been forgotten
+func auditOperation(auditType string, instanceKey *InstanceKey, clusterName string, message string) error {
 	if instanceKey == nil {
 		instanceKey = &InstanceKey{}
 	}
-	clusterName := ""
-	if instanceKey.Hostname != "" {
-		clusterName, _ = GetClusterName(instanceKey)
+	if eventType, ok := auditOperationEvents[auditType]; ok && instanceKey.Hostname != "" {
+		events.Publish(eventType, clusterName, instanceKey.Hostname, instanceKey.Port, message, nil)
 	}
 
 	auditWrittenToFile := false
@@ -0,0 +1,162 @@
+/*
+   Copyright 2019 GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/db"
+	"github.com/openark/golib/log"
+	"github.com/openark/golib/sqlutils"
+)
+
+// clusterAliasesCache holds the cluster name to alias mapping, for resolving per cluster configuration
+var clusterAliasesCache = cache.New(time.Minute, time.Minute)
+
+// readClusterAliases reads all cluster aliases, mapped by cluster name
+func readClusterAliases() (aliases map[string]string, err error) {
+	aliases = make(map[string]string)
+	query := `
+		select
+			cluster_name,
+			alias
+		from
+			cluster_alias
+		`
+	err = db.QueryOrchestrator(query, sqlutils.Args(), func(m sqlutils.RowMap) error {
+		aliases[m.GetString("cluster_name")] = m.GetString("alias")
+		return nil
+	})
+	return aliases, log.Errore(err)
+}
+
+// getCachedClusterAlias returns the alias of given cluster, based on a recent read of cluster aliases
+func getCachedClusterAlias(clusterName string) string {
+	aliases, found := clusterAliasesCache.Get("aliases")
+	if !found {
+		readAliases, err := readClusterAliases()
+		if err != nil {
+			return clusterName
+		}
+		clusterAliasesCache.Set("aliases", readAliases, cache.DefaultExpiration)
+		aliases = readAliases
+	}
+	clusterInfo := ClusterInfo{ClusterName: clusterName, ClusterAlias: aliases.(map[string]string)[clusterName]}
+	clusterInfo.ApplyClusterAlias()
+	return clusterInfo.ClusterAlias
+}
+
+// GetClusterConfig returns the configuration in effect for given cluster, with per cluster
+// overrides applied. See config.Configuration.ForCluster
+func GetClusterConfig(clusterName string) *config.Configuration {
+	if len(config.Config.ClusterConfigOverrides) == 0 {
+		return config.Config
+	}
+	return config.Config.ForCluster(clusterName, getCachedClusterAlias(clusterName))
+}
+
+// minReasonableReplicationLagSeconds returns the lowest ReasonableReplicationLagSeconds in effect for any cluster
+func minReasonableReplicationLagSeconds() int {
+	reasonableReplicationLagSeconds := config.Config.ReasonableReplicationLagSeconds
+	for _, override := range config.Config.ClusterConfigOverrides {
+		rawValue, found := override.Settings["ReasonableReplicationLagSeconds"]
+		if !found {
+			continue
+		}
+		var overrideValue int
+		// Validated upon reading configuration
+		json.Unmarshal(rawValue, &overrideValue)
+		if overrideValue < reasonableReplicationLagSeconds {
+			reasonableReplicationLagSeconds = overrideValue
+		}
+	}
+	return reasonableReplicationLagSeconds
+}
+
+// overriddenReasonableReplicationLagCache holds the clusters whose ReasonableReplicationLagSeconds is overridden
+var overriddenReasonableReplicationLagCache = cache.New(time.Minute, time.Minute)
+
+// readOverriddenReasonableReplicationLagSeconds maps the known clusters whose ReasonableReplicationLagSeconds
+// is overridden to the value in effect for them
+func readOverriddenReasonableReplicationLagSeconds() map[string]int {
+	if len(config.Config.ClusterConfigOverrides) == 0 {
+		return nil
+	}
+	if lagSeconds, found := overriddenReasonableReplicationLagCache.Get("lag"); found {
+		return lagSeconds.(map[string]int)
+	}
+	clusterNames, err := ReadClusters()
+	if err != nil {
+		return nil
+	}
+	lagSeconds := make(map[string]int)
+	for _, clusterName := range clusterNames {
+		clusterLagSeconds := GetClusterConfig(clusterName).ReasonableReplicationLagSeconds
+		if clusterLagSeconds != config.Config.ReasonableReplicationLagSeconds {
+			lagSeconds[clusterName] = clusterLagSeconds
+		}
+	}
+	overriddenReasonableReplicationLagCache.Set("lag", lagSeconds, cache.DefaultExpiration)
+	return lagSeconds
+}
+
+// reasonableReplicationLagSecondsExpression returns an SQL expression, and its arguments, evaluating to the
+// ReasonableReplicationLagSeconds in effect for the cluster named by given column
+func reasonableReplicationLagSecondsExpression(clusterNameColumn string) (expression string, args []interface{}) {
+	lagSeconds := readOverriddenReasonableReplicationLagSeconds()
+	if len(lagSeconds) == 0 {
+		return "?", sqlutils.Args(config.Config.ReasonableReplicationLagSeconds)
+	}
+	clusterNames := []string{}
+	for clusterName := range lagSeconds {
+		clusterNames = append(clusterNames, clusterName)
+	}
+	sort.Strings(clusterNames)
+
+	expression = fmt.Sprintf("(case %s", clusterNameColumn)
+	for _, clusterName := range clusterNames {
+		expression = expression + " when ? then ?"
+		args = append(args, clusterName, lagSeconds[clusterName])
+	}
+	expression = expression + " else ? end)"
+	args = append(args, config.Config.ReasonableReplicationLagSeconds)
+	return expression, args
+}
+
+// EffectiveClusterConfig shows the per cluster overridable settings in effect for a cluster
+type EffectiveClusterConfig struct {
+	ClusterName  string
+	ClusterAlias string
+	Settings     []config.ClusterConfigSetting
+}
+
+// ReadEffectiveClusterConfig lists the per cluster overridable settings in effect for given cluster,
+// and where their values come from
+func ReadEffectiveClusterConfig(clusterName string) *EffectiveClusterConfig {
+	clusterAlias := getCachedClusterAlias(clusterName)
+	return &EffectiveClusterConfig{
+		ClusterName:  clusterName,
+		ClusterAlias: clusterAlias,
+		Settings:     config.Config.GetClusterConfigSettings(clusterName, clusterAlias),
+	}
+}
@@ -0,0 +1,41 @@
+/*
+   Copyright 2019 GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+// ClusterLink marks a replica as the boundary between two clusters: the upstream cluster, which
+// the replica replicates from, and the downstream cluster, of which the replica is the master.
+// The boundary and its replicas are analyzed and recovered as a cluster of their own.
+type ClusterLink struct {
+	Key                    InstanceKey
+	DownstreamClusterAlias string
+	UpstreamClusterName    string
+	LastUpdated            string
+}
+
+// removeClusterLinkBoundaries returns given instances, excluding those which are cluster link boundaries
+func removeClusterLinkBoundaries(instances [](*Instance), links map[InstanceKey]*ClusterLink) (filtered [](*Instance)) {
+	for _, instance := range instances {
+		if instance == nil {
+			continue
+		}
+		if _, isBoundary := links[instance.Key]; isBoundary {
+			continue
+		}
+		filtered = append(filtered, instance)
+	}
+	return filtered
+}
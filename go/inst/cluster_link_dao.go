@@ -0,0 +1,225 @@
+/*
+   Copyright 2019 GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/github/orchestrator/go/db"
+	"github.com/openark/golib/log"
+	"github.com/openark/golib/sqlutils"
+	"github.com/patrickmn/go-cache"
+)
+
+const clusterLinksCacheKey = "cluster_links"
+
+// clusterLinksCache holds all cluster links, mapped by boundary key. Links are consulted upon
+// each instance read and rarely change, hence are not read from the backend each time.
+var clusterLinksCache = cache.New(time.Minute, time.Minute)
+
+// ReadClusterLinks returns all cluster links. The upstream cluster name is that of the boundary's current
+// master, which may change following upstream failovers; it falls back to the name recorded upon linking.
+func ReadClusterLinks() (links [](*ClusterLink), err error) {
+	query := `
+		select
+			cluster_link.hostname,
+			cluster_link.port,
+			cluster_link.downstream_cluster_alias,
+			ifnull(master_instance.cluster_name, cluster_link.upstream_cluster_name) as upstream_cluster_name,
+			cluster_link.last_updated
+		from
+			cluster_link
+			left join database_instance boundary_instance on (
+				boundary_instance.hostname = cluster_link.hostname
+				and boundary_instance.port = cluster_link.port
+			)
+			left join database_instance master_instance on (
+				master_instance.hostname = boundary_instance.master_host
+				and master_instance.port = boundary_instance.master_port
+			)
+		order by
+			cluster_link.hostname, cluster_link.port
+		`
+	err = db.QueryOrchestrator(query, sqlutils.Args(), func(m sqlutils.RowMap) error {
+		link := &ClusterLink{
+			Key:                    InstanceKey{Hostname: m.GetString("hostname"), Port: m.GetInt("port")},
+			DownstreamClusterAlias: m.GetString("downstream_cluster_alias"),
+			UpstreamClusterName:    m.GetString("upstream_cluster_name"),
+			LastUpdated:            m.GetString("last_updated"),
+		}
+		links = append(links, link)
+		return nil
+	})
+	return links, log.Errore(err)
+}
+
+// readClusterLinksMap returns all cluster links mapped by boundary key, possibly from cache
+func readClusterLinksMap() (map[InstanceKey]*ClusterLink, error) {
+	if linksMap, found := clusterLinksCache.Get(clusterLinksCacheKey); found {
+		return linksMap.(map[InstanceKey]*ClusterLink), nil
+	}
+	links, err := ReadClusterLinks()
+	if err != nil {
+		return nil, err
+	}
+	linksMap := make(map[InstanceKey]*ClusterLink)
+	for _, link := range links {
+		linksMap[link.Key] = link
+	}
+	clusterLinksCache.Set(clusterLinksCacheKey, linksMap, cache.DefaultExpiration)
+	return linksMap, nil
+}
+
+// ReadClusterLink returns the cluster link whose boundary is given instance, or nil if the instance is not a boundary
+func ReadClusterLink(instanceKey *InstanceKey) (*ClusterLink, error) {
+	linksMap, err := readClusterLinksMap()
+	if err != nil {
+		return nil, err
+	}
+	return linksMap[*instanceKey], nil
+}
+
+// IsClusterLinkBoundary checks whether given instance is the master of a downstream, linked, cluster
+func IsClusterLinkBoundary(instanceKey *InstanceKey) bool {
+	link, _ := ReadClusterLink(instanceKey)
+	return link != nil
+}
+
+// RemoveClusterLinkBoundaries returns given instances, excluding cluster link boundaries. Use this when
+// operating on an upstream cluster, whose topology should not include downstream clusters' masters.
+func RemoveClusterLinkBoundaries(instances [](*Instance)) ([](*Instance), error) {
+	linksMap, err := readClusterLinksMap()
+	if err != nil {
+		return instances, err
+	}
+	return removeClusterLinkBoundaries(instances, linksMap), nil
+}
+
+// ReadClusterLinkBoundaryReplicas returns the cluster link boundaries directly replicating from given master
+func ReadClusterLinkBoundaryReplicas(masterKey *InstanceKey) (boundaries [](*Instance), err error) {
+	replicas, err := ReadReplicaInstances(masterKey)
+	if err != nil {
+		return boundaries, err
+	}
+	for _, replica := range replicas {
+		if IsClusterLinkBoundary(&replica.Key) {
+			boundaries = append(boundaries, replica)
+		}
+	}
+	return boundaries, nil
+}
+
+// writeClusterLink writes (and overrides) a cluster link
+func writeClusterLink(link *ClusterLink) error {
+	writeFunc := func() error {
+		_, err := db.ExecOrchestrator(`
+			replace into cluster_link (
+				hostname, port, downstream_cluster_alias, upstream_cluster_name, last_updated
+			) values (
+				?, ?, ?, ?, NOW()
+			)
+			`, link.Key.Hostname, link.Key.Port, link.DownstreamClusterAlias, link.UpstreamClusterName,
+		)
+		clusterLinksCache.Delete(clusterLinksCacheKey)
+		return log.Errore(err)
+	}
+	return ExecDBWriteFunc(writeFunc)
+}
+
+// deleteClusterLink removes the cluster link whose boundary is given instance
+func deleteClusterLink(instanceKey *InstanceKey) error {
+	writeFunc := func() error {
+		_, err := db.ExecOrchestrator(`
+			delete from cluster_link
+			where
+				hostname = ?
+				and port = ?
+			`, instanceKey.Hostname, instanceKey.Port,
+		)
+		clusterLinksCache.Delete(clusterLinksCacheKey)
+		return log.Errore(err)
+	}
+	return ExecDBWriteFunc(writeFunc)
+}
+
+// NewClusterLink validates and returns a link marking given replica as the boundary between the cluster
+// it replicates from and a downstream cluster, aliased as given.
+func NewClusterLink(instanceKey *InstanceKey, downstreamClusterAlias string) (*ClusterLink, error) {
+	if downstreamClusterAlias == "" {
+		return nil, fmt.Errorf("NewClusterLink: downstream cluster alias must be provided")
+	}
+	instance, found, err := ReadInstance(instanceKey)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("NewClusterLink: unknown instance %+v", *instanceKey)
+	}
+	if !instance.IsReplica() {
+		return nil, fmt.Errorf("NewClusterLink: %+v is not a replica; a cluster link boundary must replicate from the upstream cluster", *instanceKey)
+	}
+	link := &ClusterLink{
+		Key:                    *instanceKey,
+		DownstreamClusterAlias: downstreamClusterAlias,
+		UpstreamClusterName:    instance.ClusterName,
+	}
+	if master, found, _ := ReadInstance(&instance.MasterKey); found {
+		link.UpstreamClusterName = master.ClusterName
+	}
+	return link, nil
+}
+
+// WriteClusterLink persists given cluster link. The boundary assumes its own cluster name upon next read;
+// the downstream cluster alias is applied at once.
+func WriteClusterLink(link *ClusterLink) error {
+	if err := writeClusterLink(link); err != nil {
+		return err
+	}
+	if err := SetClusterAlias(link.Key.StringCode(), link.DownstreamClusterAlias); err != nil {
+		return err
+	}
+	AuditOperation("link-cluster", &link.Key, fmt.Sprintf("linked downstream cluster %s to upstream cluster %s", link.DownstreamClusterAlias, link.UpstreamClusterName))
+	return nil
+}
+
+// LinkCluster marks given replica as the boundary between the cluster it replicates from and a downstream
+// cluster, of which it becomes the master. The downstream cluster is aliased as given.
+func LinkCluster(instanceKey *InstanceKey, downstreamClusterAlias string) (*ClusterLink, error) {
+	link, err := NewClusterLink(instanceKey, downstreamClusterAlias)
+	if err != nil {
+		return nil, err
+	}
+	return link, WriteClusterLink(link)
+}
+
+// UnlinkCluster removes the cluster link whose boundary is given instance. The boundary and its replicas
+// rejoin the upstream cluster upon next read.
+func UnlinkCluster(instanceKey *InstanceKey) error {
+	link, err := ReadClusterLink(instanceKey)
+	if err != nil {
+		return err
+	}
+	if link == nil {
+		return fmt.Errorf("UnlinkCluster: %+v is not a cluster link boundary", *instanceKey)
+	}
+	if err := deleteClusterLink(instanceKey); err != nil {
+		return err
+	}
+	AuditOperation("unlink-cluster", instanceKey, fmt.Sprintf("unlinked downstream cluster %s from upstream cluster %s", link.DownstreamClusterAlias, link.UpstreamClusterName))
+	return nil
+}
@@ -0,0 +1,32 @@
+package inst
+
+import (
+	"testing"
+
+	test "github.com/openark/golib/tests"
+)
+
+func TestRemoveClusterLinkBoundaries(t *testing.T) {
+	masterKey := InstanceKey{Hostname: "m", Port: 3306}
+	r1Key := InstanceKey{Hostname: "r1", Port: 3306}
+	r2Key := InstanceKey{Hostname: "r2", Port: 3306}
+	r3Key := InstanceKey{Hostname: "r3", Port: 3306}
+
+	instances := [](*Instance){}
+	for _, key := range []InstanceKey{r1Key, r2Key, r3Key} {
+		instance := NewInstance()
+		instance.Key = key
+		instance.MasterKey = masterKey
+		instances = append(instances, instance)
+	}
+	links := map[InstanceKey]*ClusterLink{
+		r2Key: {Key: r2Key, DownstreamClusterAlias: "downstream"},
+	}
+	filtered := removeClusterLinkBoundaries(append(instances, nil), links)
+	test.S(t).ExpectEquals(len(filtered), 2)
+	test.S(t).ExpectEquals(filtered[0].Key, r1Key)
+	test.S(t).ExpectEquals(filtered[1].Key, r3Key)
+
+	filtered = removeClusterLinkBoundaries(instances, map[InstanceKey]*ClusterLink{})
+	test.S(t).ExpectEquals(len(filtered), 3)
+}
@@ -22,6 +22,7 @@ import (
 
 	"github.com/github/orchestrator/go/config"
 	"github.com/github/orchestrator/go/db"
+	"github.com/github/orchestrator/go/events"
 	"github.com/openark/golib/log"
 	"github.com/openark/golib/sqlutils"
 )
@@ -186,6 +187,21 @@ func ExpireDowntime() error {
 		return log.Errore(err)
 	}
 	{
+		expiredKeys := []InstanceKey{}
+		err := db.QueryOrchestrator(`
+			select
+				hostname, port
+			from
+				database_instance_downtime
+			where
+				end_timestamp < NOW()
+			`, sqlutils.Args(), func(m sqlutils.RowMap) error {
+			expiredKeys = append(expiredKeys, InstanceKey{Hostname: m.GetString("hostname"), Port: m.GetInt("port")})
+			return nil
+		})
+		if err != nil {
+			return log.Errore(err)
+		}
 		res, err := db.ExecOrchestrator(`
 			delete from
 				database_instance_downtime
@@ -198,6 +214,10 @@ func ExpireDowntime() error {
 		}
 		if rowsAffected, _ := res.RowsAffected(); rowsAffected > 0 {
 			AuditOperation("expire-downtime", nil, fmt.Sprintf("Expired %d entries", rowsAffected))
+			for _, expiredKey := range expiredKeys {
+				clusterName, _ := GetClusterName(&expiredKey)
+				events.Publish(events.DowntimeEnded, clusterName, expiredKey.Hostname, expiredKey.Port, "expired", nil)
+			}
 		}
 	}
 
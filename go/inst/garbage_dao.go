@@ -0,0 +1,271 @@
+/*
+   Copyright 2019 GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"fmt"
+
+	"github.com/github/orchestrator/go/db"
+	"github.com/openark/golib/log"
+	"github.com/openark/golib/sqlutils"
+	"github.com/openark/golib/util"
+)
+
+// DefaultStaleInstanceHours is the default number of hours an instance is unseen before reported as stale
+const DefaultStaleInstanceHours = 24
+
+// orphanableTables are tables referencing instances, whose rows are not removed when an instance is forgotten
+var orphanableTables = []string{
+	"database_instance_downtime",
+	"candidate_database_instance",
+	"database_instance_tags",
+	"database_instance_pool",
+}
+
+// StaleInstance is an instance that has not been seen for a while
+type StaleInstance struct {
+	Key                InstanceKey
+	ClusterName        string
+	LastSeen           string
+	HoursSinceLastSeen int64
+}
+
+// GhostCluster is a cluster with no valid master: either no master is known, or the known master's
+// last check is invalid.
+type GhostCluster struct {
+	ClusterName    string
+	ClusterAlias   string
+	CountInstances int
+	HasMaster      bool
+	LastSeen       string
+}
+
+// OrphanedRow is a row referencing an instance which is forgotten, or is a stale instance
+type OrphanedRow struct {
+	Table string
+	Key   InstanceKey
+}
+
+// GarbageReport lists what can be garbage collected from the backend database. Stale instances and
+// orphaned rows are forgotten by ForgetGarbage; ghost clusters are for review, and may be forgotten
+// via forget-cluster.
+type GarbageReport struct {
+	StaleHours     uint
+	StaleInstances []StaleInstance
+	GhostClusters  []GhostCluster
+	OrphanedRows   []OrphanedRow
+}
+
+// StaleHoursFromDuration converts a simple duration, such as "12h" or "2d", into whole hours.
+// An empty duration stands for DefaultStaleInstanceHours.
+func StaleHoursFromDuration(duration string) (staleHours uint, err error) {
+	if duration == "" {
+		return DefaultStaleInstanceHours, nil
+	}
+	seconds, err := util.SimpleTimeToSeconds(duration)
+	if err != nil {
+		return 0, err
+	}
+	if seconds < 3600 {
+		return 0, fmt.Errorf("Stale duration must be at least 1h. Given: %s", duration)
+	}
+	return uint(seconds / 3600), nil
+}
+
+func isOrphanableTable(table string) bool {
+	for _, orphanableTable := range orphanableTables {
+		if orphanableTable == table {
+			return true
+		}
+	}
+	return false
+}
+
+// readStaleInstances reads instances not seen for given number of hours
+func readStaleInstances(staleHours uint) (staleInstances []StaleInstance, err error) {
+	staleInstances = []StaleInstance{}
+	query := `
+		select
+			hostname,
+			port,
+			cluster_name,
+			last_seen,
+			unix_timestamp() - unix_timestamp(last_seen) as seconds_since_last_seen
+		from
+			database_instance
+		where
+			last_seen < NOW() - interval ? hour
+		order by
+			cluster_name, hostname, port
+		`
+	err = db.QueryOrchestrator(query, sqlutils.Args(staleHours), func(m sqlutils.RowMap) error {
+		staleInstances = append(staleInstances, StaleInstance{
+			Key:                InstanceKey{Hostname: m.GetString("hostname"), Port: m.GetInt("port")},
+			ClusterName:        m.GetString("cluster_name"),
+			LastSeen:           m.GetString("last_seen"),
+			HoursSinceLastSeen: m.GetInt64("seconds_since_last_seen") / 3600,
+		})
+		return nil
+	})
+	return staleInstances, log.Errore(err)
+}
+
+// readGhostClusters reads clusters with no valid master
+func readGhostClusters() (ghostClusters []GhostCluster, err error) {
+	ghostClusters = []GhostCluster{}
+	query := `
+		select
+			database_instance.cluster_name,
+			ifnull(max(cluster_alias.alias), '') as cluster_alias,
+			count(*) as count_instances,
+			sum(replication_depth = 0 or is_co_master) as count_masters,
+			sum((replication_depth = 0 or is_co_master) and ifnull(last_checked <= last_seen, 0)) as count_valid_masters,
+			ifnull(max(last_seen), '') as last_seen
+		from
+			database_instance
+			left join cluster_alias on (database_instance.cluster_name = cluster_alias.cluster_name)
+		group by
+			database_instance.cluster_name
+		having
+			count_valid_masters = 0
+		order by
+			database_instance.cluster_name
+		`
+	err = db.QueryOrchestrator(query, sqlutils.Args(), func(m sqlutils.RowMap) error {
+		ghostClusters = append(ghostClusters, GhostCluster{
+			ClusterName:    m.GetString("cluster_name"),
+			ClusterAlias:   m.GetString("cluster_alias"),
+			CountInstances: m.GetInt("count_instances"),
+			HasMaster:      m.GetInt("count_masters") > 0,
+			LastSeen:       m.GetString("last_seen"),
+		})
+		return nil
+	})
+	return ghostClusters, log.Errore(err)
+}
+
+// readOrphanedRows reads rows referencing instances which are either forgotten, or not seen for given number of hours
+func readOrphanedRows(staleHours uint) (orphanedRows []OrphanedRow, err error) {
+	orphanedRows = []OrphanedRow{}
+	for _, table := range orphanableTables {
+		query := fmt.Sprintf(`
+			select distinct
+				%s.hostname,
+				%s.port
+			from
+				%s
+				left join database_instance on (%s.hostname = database_instance.hostname and %s.port = database_instance.port)
+			where
+				database_instance.hostname is null
+				or database_instance.last_seen < NOW() - interval ? hour
+			order by
+				%s.hostname, %s.port
+			`, table, table, table, table, table, table, table)
+		err = db.QueryOrchestrator(query, sqlutils.Args(staleHours), func(m sqlutils.RowMap) error {
+			orphanedRows = append(orphanedRows, OrphanedRow{
+				Table: table,
+				Key:   InstanceKey{Hostname: m.GetString("hostname"), Port: m.GetInt("port")},
+			})
+			return nil
+		})
+		if err != nil {
+			return orphanedRows, log.Errore(err)
+		}
+	}
+	return orphanedRows, nil
+}
+
+// forgetStaleInstance forgets an instance, provided it is still not seen for given number of hours, and audits it
+func forgetStaleInstance(staleInstance *StaleInstance, staleHours uint, auditType string) (forgotten bool, err error) {
+	instanceKey := staleInstance.Key
+	sqlResult, err := db.ExecOrchestrator(`
+			delete
+				from database_instance
+			where
+				hostname = ? and port = ?
+				and last_seen < NOW() - interval ? hour
+			`,
+		instanceKey.Hostname, instanceKey.Port, staleHours,
+	)
+	if err != nil {
+		return false, log.Errore(err)
+	}
+	if rows, _ := sqlResult.RowsAffected(); rows == 0 {
+		return false, nil
+	}
+	auditOperation(auditType, &instanceKey, staleInstance.ClusterName, fmt.Sprintf("cluster: %s, last seen: %s", staleInstance.ClusterName, staleInstance.LastSeen))
+	return true, nil
+}
+
+// ReadGarbageReport lists instances not seen for given number of hours, clusters with no valid master,
+// and rows referencing forgotten or stale instances.
+func ReadGarbageReport(staleHours uint) (report *GarbageReport, err error) {
+	if staleHours == 0 {
+		staleHours = DefaultStaleInstanceHours
+	}
+	report = &GarbageReport{StaleHours: staleHours}
+	if report.StaleInstances, err = readStaleInstances(staleHours); err != nil {
+		return report, err
+	}
+	if report.GhostClusters, err = readGhostClusters(); err != nil {
+		return report, err
+	}
+	if report.OrphanedRows, err = readOrphanedRows(staleHours); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+// ForgetGarbage forgets stale instances and removes orphaned rows listed in given report, normally one
+// previously reviewed. Instances seen since the report was made are kept, as are rows referencing them.
+// Every removal is audited.
+func ForgetGarbage(report *GarbageReport) (forgottenCount int, err error) {
+	for _, staleInstance := range report.StaleInstances {
+		forgotten, err := forgetStaleInstance(&staleInstance, report.StaleHours, "forget-stale")
+		if err != nil {
+			return forgottenCount, err
+		}
+		if forgotten {
+			forgottenCount++
+		}
+	}
+	for _, orphanedRow := range report.OrphanedRows {
+		if !isOrphanableTable(orphanedRow.Table) {
+			return forgottenCount, log.Errorf("ForgetGarbage: unexpected table %s", orphanedRow.Table)
+		}
+		instanceKey := orphanedRow.Key
+		sqlResult, err := db.ExecOrchestrator(fmt.Sprintf(`
+				delete
+					from %s
+				where
+					hostname = ? and port = ?
+					and not exists (
+						select 1 from database_instance where hostname = ? and port = ?
+					)
+				`, orphanedRow.Table),
+			instanceKey.Hostname, instanceKey.Port, instanceKey.Hostname, instanceKey.Port,
+		)
+		if err != nil {
+			return forgottenCount, log.Errore(err)
+		}
+		if rows, _ := sqlResult.RowsAffected(); rows > 0 {
+			forgottenCount++
+			AuditOperation("forget-orphaned", &instanceKey, fmt.Sprintf("table: %s, rows: %d", orphanedRow.Table, rows))
+		}
+	}
+	return forgottenCount, nil
+}
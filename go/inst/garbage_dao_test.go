@@ -0,0 +1,38 @@
+package inst
+
+import (
+	"testing"
+
+	test "github.com/openark/golib/tests"
+)
+
+func TestStaleHoursFromDuration(t *testing.T) {
+	{
+		staleHours, err := StaleHoursFromDuration("")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(staleHours, uint(DefaultStaleInstanceHours))
+	}
+	{
+		staleHours, err := StaleHoursFromDuration("12h")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(staleHours, uint(12))
+	}
+	{
+		staleHours, err := StaleHoursFromDuration("2d")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(staleHours, uint(48))
+	}
+	{
+		_, err := StaleHoursFromDuration("30m")
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		_, err := StaleHoursFromDuration("yesterday")
+		test.S(t).ExpectNotNil(err)
+	}
+}
+
+func TestIsOrphanableTable(t *testing.T) {
+	test.S(t).ExpectTrue(isOrphanableTable("database_instance_downtime"))
+	test.S(t).ExpectFalse(isOrphanableTable("database_instance"))
+}
@@ -55,6 +55,7 @@ type Instance struct {
 	ReplicationSQLThreadState ReplicationThreadState
 	ReplicationIOThreadState  ReplicationThreadState
 	HasReplicationFilters     bool
+	ReplicationFilters        ReplicationFilters
 	GTIDMode                  string
 	SupportsOracleGTID        bool
 	UsingOracleGTID           bool
@@ -71,6 +72,10 @@ type Instance struct {
 	ExecutedGtidSet           string
 	GtidPurged                string
 	GtidErrant                string
+	SQLMode                   string
+	LowerCaseTableNames       uint
+	CharacterSetServer        string
+	TimeZone                  string
 
 	masterExecutedGtidSet string // Not exported
 
@@ -381,8 +386,8 @@ func (this *Instance) CanReplicateFrom(other *Instance) (bool, error) {
 		}
 	}
 	if config.Config.VerifyReplicationFilters {
-		if other.HasReplicationFilters && !this.HasReplicationFilters {
-			return false, fmt.Errorf("%+v has replication filters", other.Key)
+		if other.HasReplicationFilters && !this.ReplicationFilters.Equals(&other.ReplicationFilters) {
+			return false, fmt.Errorf("%+v has replication filters different than those of %+v", other.Key, this.Key)
 		}
 	}
 	if this.ServerID == other.ServerID && !this.IsBinlogServer() {
@@ -74,6 +74,81 @@ func (this *BinlogEvent) EqualsIgnoreCoordinates(other *BinlogEvent) bool {
 		this.EventType == other.EventType && this.Info == other.Info
 }
 
+// BinlogEventFilter describes which events should be returned when inspecting binary/relay logs.
+// Empty fields are ignored.
+type BinlogEventFilter struct {
+	EventType   string
+	GTID        string
+	InfoPattern *regexp.Regexp
+	gtidPattern *regexp.Regexp
+	// InMatchingTransaction is the GTID filtering state: whether events read belong to the filter's GTID transaction.
+	// Reading a log page by page, reuse the filter, or set this to the previous page's value, so that a transaction
+	// spanning pages is not cut short.
+	InMatchingTransaction bool
+}
+
+// NewBinlogEventFilter creates a filter given event type, GTID and text pattern (a regular expression).
+func NewBinlogEventFilter(eventType string, gtid string, pattern string) (*BinlogEventFilter, error) {
+	filter := &BinlogEventFilter{
+		EventType: strings.TrimSpace(eventType),
+		GTID:      strings.TrimSpace(gtid),
+	}
+	if filter.GTID != "" {
+		// Match GTID as a whole token: MySQL shows 'uuid:seq', MariaDB shows "BEGIN GTID domain-server-seq"
+		filter.gtidPattern = regexp.MustCompile(`(^|[ '])` + regexp.QuoteMeta(filter.GTID) + `($|[ '])`)
+	}
+	if pattern != "" {
+		infoPattern, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		filter.InfoPattern = infoPattern
+	}
+	return filter, nil
+}
+
+// isGTIDEvent returns true when the given event marks the beginning of a GTID transaction (either MySQL or MariaDB flavor)
+func isGTIDEvent(event *BinlogEvent) bool {
+	return event.EventType == "Gtid"
+}
+
+// matchesGTIDEvent returns true when the given event is a GTID event of the filter's GTID
+func (this *BinlogEventFilter) matchesGTIDEvent(event *BinlogEvent) bool {
+	return isGTIDEvent(event) && this.gtidPattern != nil && this.gtidPattern.MatchString(event.Info)
+}
+
+// Accepts checks whether given event, read in log order, passes the filter. GTID filtering applies to all
+// events of the transaction, up to the next GTID event, and so this updates the filter's state.
+func (this *BinlogEventFilter) Accepts(event *BinlogEvent) bool {
+	if this == nil {
+		return true
+	}
+	if this.GTID != "" {
+		if isGTIDEvent(event) {
+			this.InMatchingTransaction = this.matchesGTIDEvent(event)
+		}
+		if !this.InMatchingTransaction {
+			return false
+		}
+	}
+	return this.Matches(event)
+}
+
+// Matches checks whether given event satisfies the event type and text conditions of the filter.
+// GTID filtering is stateful (it applies to all events of a transaction) and is handled by Accepts.
+func (this *BinlogEventFilter) Matches(event *BinlogEvent) bool {
+	if this == nil {
+		return true
+	}
+	if this.EventType != "" && !strings.EqualFold(this.EventType, event.EventType) {
+		return false
+	}
+	if this.InfoPattern != nil && !this.InfoPattern.MatchString(event.Info) {
+		return false
+	}
+	return true
+}
+
 const maxEmptyEventsEvents int = 10
 
 //
@@ -32,9 +32,14 @@ import (
 
 const maxEmptyBinlogFiles int = 10
 const maxEventInfoDisplayLength int = 200
+const maxBinlogEventsToScan int = 100000
 
 var instanceBinlogEntryCache *cache.Cache
 
+// logFileNameRegexp matches binary log and relay log file names, which are interpolated into
+// SHOW BINLOG EVENTS / SHOW RELAYLOG EVENTS and may come from API requests
+var logFileNameRegexp = regexp.MustCompile(`^[A-Za-z0-9._-]+[.][0-9]+$`)
+
 func init() {
 	go initializeBinlogDaoPostConfiguration()
 }
@@ -550,14 +555,17 @@ func SearchEntryInInstanceBinlogs(instance *Instance, entryText string, monotoni
 // Read (as much as possible of) a chunk of binary log events starting the given startingCoordinates
 func readBinlogEventsChunk(instanceKey *InstanceKey, startingCoordinates BinlogCoordinates) ([]BinlogEvent, error) {
 	events := []BinlogEvent{}
+	if startingCoordinates.LogFile == "" {
+		return events, log.Errorf("readBinlogEventsChunk: empty binlog file name for %+v.", *instanceKey)
+	}
+	if !logFileNameRegexp.MatchString(startingCoordinates.LogFile) {
+		return events, log.Errorf("readBinlogEventsChunk: invalid binlog file name for %+v: %q", *instanceKey, startingCoordinates.LogFile)
+	}
 	db, err := db.OpenTopology(instanceKey.Hostname, instanceKey.Port)
 	if err != nil {
 		return events, err
 	}
 	commandToken := math.TernaryString(startingCoordinates.Type == BinaryLog, "binlog", "relaylog")
-	if startingCoordinates.LogFile == "" {
-		return events, log.Errorf("readBinlogEventsChunk: empty binlog file name for %+v.", *instanceKey)
-	}
 	query := fmt.Sprintf("show %s events in '%s' FROM %d LIMIT %d", commandToken, startingCoordinates.LogFile, startingCoordinates.LogPos, config.Config.BinlogEventsChunkSize)
 	err = sqlutils.QueryRowsMap(db, query, func(m sqlutils.RowMap) error {
 		binlogEvent := BinlogEvent{}
@@ -574,6 +582,62 @@ func readBinlogEventsChunk(instanceKey *InstanceKey, startingCoordinates BinlogC
 	return events, err
 }
 
+// ReadBinlogEvents reads a page of events from a single binary log or relay log of a given instance, starting at
+// given coordinates, and returns up to `limit` events matching given filter.
+// It also returns the coordinates of the first event not returned, or nil when the end of the log file is reached.
+// The filter keeps GTID filtering state; pass the same filter in when reading the next page.
+// The number of scanned events is bounded, so that a very selective filter does not turn into a full log scan.
+func ReadBinlogEvents(instanceKey *InstanceKey, startingCoordinates BinlogCoordinates, filter *BinlogEventFilter, limit int) (events []BinlogEvent, nextCoordinates *BinlogCoordinates, err error) {
+	events = []BinlogEvent{}
+	if startingCoordinates.LogFile == "" {
+		return events, nil, log.Errorf("ReadBinlogEvents: empty binlog file name for %+v", *instanceKey)
+	}
+	if !logFileNameRegexp.MatchString(startingCoordinates.LogFile) {
+		return events, nil, log.Errorf("ReadBinlogEvents: invalid binlog file name for %+v: %q", *instanceKey, startingCoordinates.LogFile)
+	}
+	if limit <= 0 {
+		limit = config.Config.BinlogEventsChunkSize
+	}
+	db, err := db.OpenTopology(instanceKey.Hostname, instanceKey.Port)
+	if err != nil {
+		return events, nil, err
+	}
+	commandToken := math.TernaryString(startingCoordinates.Type == BinaryLog, "binlog", "relaylog")
+
+	scannedEvents := 0
+	moreRowsExpected := true
+	for step := 0; moreRowsExpected && nextCoordinates == nil; step++ {
+		query := fmt.Sprintf("show %s events in '%s' FROM %d LIMIT %d,%d", commandToken, startingCoordinates.LogFile, startingCoordinates.LogPos, (step * config.Config.BinlogEventsChunkSize), config.Config.BinlogEventsChunkSize)
+
+		moreRowsExpected = false
+		err = sqlutils.QueryRowsMapBuffered(db, query, func(m sqlutils.RowMap) error {
+			if nextCoordinates != nil {
+				return nil
+			}
+			binlogEvent := BinlogEvent{
+				Coordinates: BinlogCoordinates{LogFile: startingCoordinates.LogFile, Type: startingCoordinates.Type},
+			}
+			readBinlogEvent(&binlogEvent, m)
+			if len(events) >= limit || scannedEvents >= maxBinlogEventsToScan {
+				// This is the first event we do not return; next page starts here
+				nextCoordinates = &binlogEvent.Coordinates
+				return nil
+			}
+			moreRowsExpected = true
+			scannedEvents++
+
+			if filter.Accepts(&binlogEvent) {
+				events = append(events, binlogEvent)
+			}
+			return nil
+		})
+		if err != nil {
+			return events, nil, err
+		}
+	}
+	return events, nextCoordinates, nil
+}
+
 // Return the next chunk of binlog events; skip to next binary log file if need be; return empty result only
 // if reached end of binary logs
 func getNextBinlogEventsChunk(instance *Instance, startingCoordinates BinlogCoordinates, numEmptyBinlogs int) ([]BinlogEvent, error) {
@@ -0,0 +1,120 @@
+package inst
+
+import (
+	"testing"
+
+	test "github.com/openark/golib/tests"
+)
+
+func TestBinlogEventFilterMatches(t *testing.T) {
+	queryEvent := &BinlogEvent{EventType: "Query", Info: "drop table if exists `test`.`t1`"}
+	writeEvent := &BinlogEvent{EventType: "Write_rows", Info: "table_id: 108 flags: STMT_END_F"}
+	{
+		var filter *BinlogEventFilter
+		test.S(t).ExpectTrue(filter.Matches(queryEvent))
+	}
+	{
+		filter, err := NewBinlogEventFilter("", "", "")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectTrue(filter.Matches(queryEvent))
+		test.S(t).ExpectTrue(filter.Matches(writeEvent))
+	}
+	{
+		filter, err := NewBinlogEventFilter("query", "", "")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectTrue(filter.Matches(queryEvent))
+		test.S(t).ExpectFalse(filter.Matches(writeEvent))
+	}
+	{
+		filter, err := NewBinlogEventFilter("", "", "drop table")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectTrue(filter.Matches(queryEvent))
+		test.S(t).ExpectFalse(filter.Matches(writeEvent))
+	}
+	{
+		_, err := NewBinlogEventFilter("", "", "drop (table")
+		test.S(t).ExpectNotNil(err)
+	}
+}
+
+func TestBinlogEventFilterGTID(t *testing.T) {
+	filter, err := NewBinlogEventFilter("", "00020192-1111-1111-1111-111111111111:83", "")
+	test.S(t).ExpectNil(err)
+	{
+		event := &BinlogEvent{EventType: "Gtid", Info: "SET @@SESSION.GTID_NEXT= '00020192-1111-1111-1111-111111111111:83'"}
+		test.S(t).ExpectTrue(filter.matchesGTIDEvent(event))
+	}
+	{
+		event := &BinlogEvent{EventType: "Gtid", Info: "SET @@SESSION.GTID_NEXT= '00020192-1111-1111-1111-111111111111:830'"}
+		test.S(t).ExpectFalse(filter.matchesGTIDEvent(event))
+	}
+	{
+		event := &BinlogEvent{EventType: "Query", Info: "SET @@SESSION.GTID_NEXT= '00020192-1111-1111-1111-111111111111:83'"}
+		test.S(t).ExpectFalse(filter.matchesGTIDEvent(event))
+	}
+	{
+		mariadbFilter, _ := NewBinlogEventFilter("", "0-1-5", "")
+		test.S(t).ExpectTrue(mariadbFilter.matchesGTIDEvent(&BinlogEvent{EventType: "Gtid", Info: "BEGIN GTID 0-1-5"}))
+		test.S(t).ExpectFalse(mariadbFilter.matchesGTIDEvent(&BinlogEvent{EventType: "Gtid", Info: "BEGIN GTID 0-1-55"}))
+	}
+}
+
+func TestBinlogEventFilterGTIDAcrossPages(t *testing.T) {
+	events := []BinlogEvent{
+		{EventType: "Gtid", Info: "SET @@SESSION.GTID_NEXT= '00020192-1111-1111-1111-111111111111:82'"},
+		{EventType: "Query", Info: "BEGIN"},
+		{EventType: "Gtid", Info: "SET @@SESSION.GTID_NEXT= '00020192-1111-1111-1111-111111111111:83'"},
+		{EventType: "Query", Info: "BEGIN"},
+		{EventType: "Write_rows", Info: "table_id: 108"},
+		{EventType: "Xid", Info: "COMMIT"},
+		{EventType: "Gtid", Info: "SET @@SESSION.GTID_NEXT= '00020192-1111-1111-1111-111111111111:84'"},
+		{EventType: "Query", Info: "BEGIN"},
+	}
+	accepted := func(filter *BinlogEventFilter, pages ...[]BinlogEvent) (count int) {
+		for _, page := range pages {
+			for i := range page {
+				if filter.Accepts(&page[i]) {
+					count++
+				}
+			}
+		}
+		return count
+	}
+	{
+		filter, _ := NewBinlogEventFilter("", "00020192-1111-1111-1111-111111111111:83", "")
+		test.S(t).ExpectEquals(accepted(filter, events), 4)
+	}
+	{
+		// Transaction split across pages: the filter carries its state
+		filter, _ := NewBinlogEventFilter("", "00020192-1111-1111-1111-111111111111:83", "")
+		test.S(t).ExpectEquals(accepted(filter, events[:4], events[4:]), 4)
+	}
+	{
+		// A new filter for the second page, given the first page's state
+		filter, _ := NewBinlogEventFilter("", "00020192-1111-1111-1111-111111111111:83", "")
+		test.S(t).ExpectEquals(accepted(filter, events[:4]), 2)
+		nextPageFilter, _ := NewBinlogEventFilter("", "00020192-1111-1111-1111-111111111111:83", "")
+		nextPageFilter.InMatchingTransaction = filter.InMatchingTransaction
+		test.S(t).ExpectEquals(accepted(nextPageFilter, events[4:]), 2)
+	}
+	{
+		filter, _ := NewBinlogEventFilter("Write_rows", "00020192-1111-1111-1111-111111111111:83", "")
+		test.S(t).ExpectEquals(accepted(filter, events[:5], events[5:]), 1)
+	}
+}
+
+func TestReadBinlogEventsInvalidLogFile(t *testing.T) {
+	test.S(t).ExpectTrue(logFileNameRegexp.MatchString("mysql-bin.000017"))
+	test.S(t).ExpectTrue(logFileNameRegexp.MatchString("db1_relay-bin.000002"))
+	test.S(t).ExpectFalse(logFileNameRegexp.MatchString("mysql-bin"))
+	test.S(t).ExpectFalse(logFileNameRegexp.MatchString("/var/lib/mysql/mysql-bin.000017"))
+
+	instanceKey := &InstanceKey{Hostname: "db1", Port: 3306}
+	for _, logFile := range []string{"mysql-bin.000017' from 4; drop table t; -- .1", "x'.000001"} {
+		coordinates := BinlogCoordinates{LogFile: logFile, LogPos: 4, Type: BinaryLog}
+		_, _, err := ReadBinlogEvents(instanceKey, coordinates, nil, 10)
+		test.S(t).ExpectNotNil(err)
+		_, err = readBinlogEventsChunk(instanceKey, coordinates)
+		test.S(t).ExpectNotNil(err)
+	}
+}
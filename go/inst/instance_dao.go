@@ -418,6 +418,25 @@ func ReadTopologyInstanceBufferable(instanceKey *InstanceKey, bufferWrites bool,
 			}()
 		}
 
+		{
+			waitGroup.Add(1)
+			go func() {
+				defer waitGroup.Done()
+				// Server settings which affect replicated data; compared across the topology by the analysis
+				var timeZone, systemTimeZone string
+				err := db.QueryRow("select @@global.sql_mode, @@global.lower_case_table_names, @@global.character_set_server, @@global.time_zone, @@global.system_time_zone").Scan(
+					&instance.SQLMode, &instance.LowerCaseTableNames, &instance.CharacterSetServer, &timeZone, &systemTimeZone)
+				if err != nil {
+					logReadTopologyInstanceError(instanceKey, "select @@global.sql_mode", err)
+				}
+				instance.TimeZone = timeZone
+				if strings.ToUpper(timeZone) == "SYSTEM" {
+					instance.TimeZone = systemTimeZone
+				}
+				errorChan <- err
+			}()
+		}
+
 		{
 			waitGroup.Add(1)
 			go func() {
@@ -519,7 +538,8 @@ func ReadTopologyInstanceBufferable(instanceKey *InstanceKey, bufferWrites bool,
 		instance.UsingOracleGTID = (m.GetIntD("Auto_Position", 0) == 1)
 		instance.UsingMariaDBGTID = (m.GetStringD("Using_Gtid", "No") != "No")
 		instance.MasterUUID = m.GetStringD("Master_UUID", "No")
-		instance.HasReplicationFilters = ((m.GetStringD("Replicate_Do_DB", "") != "") || (m.GetStringD("Replicate_Ignore_DB", "") != "") || (m.GetStringD("Replicate_Do_Table", "") != "") || (m.GetStringD("Replicate_Ignore_Table", "") != "") || (m.GetStringD("Replicate_Wild_Do_Table", "") != "") || (m.GetStringD("Replicate_Wild_Ignore_Table", "") != ""))
+		instance.ReplicationFilters = NewReplicationFiltersFromSlaveStatus(m)
+		instance.HasReplicationFilters = !instance.ReplicationFilters.IsEmpty()
 
 		masterHostname := m.GetString("Master_Host")
 		if isMaxScale110 {
@@ -955,6 +975,17 @@ func ReadInstanceClusterAttributes(instance *Instance) (err error) {
 		return log.Errore(err)
 	}
 
+	if link, _ := ReadClusterLink(&instance.Key); link != nil {
+		// A cluster link boundary heads its own, downstream, cluster, even though it replicates from the upstream cluster.
+		instance.ClusterName = instance.Key.StringCode()
+		instance.SuggestedClusterAlias = link.DownstreamClusterAlias
+		instance.ReplicationDepth = 0
+		instance.IsCoMaster = false
+		instance.AncestryUUID = ""
+		instance.masterExecutedGtidSet = masterExecutedGtidSet
+		return nil
+	}
+
 	var replicationDepth uint = 0
 	var clusterName string
 	if masterDataFound {
@@ -1074,6 +1105,7 @@ func readInstanceRow(m sqlutils.RowMap) *Instance {
 	instance.ReplicationSQLThreadState = ReplicationThreadState(m.GetInt("replication_sql_thread_state"))
 	instance.ReplicationIOThreadState = ReplicationThreadState(m.GetInt("replication_io_thread_state"))
 	instance.HasReplicationFilters = m.GetBool("has_replication_filters")
+	instance.ReplicationFilters.ReadJson(m.GetString("replication_filters"))
 	instance.SupportsOracleGTID = m.GetBool("supports_oracle_gtid")
 	instance.UsingOracleGTID = m.GetBool("oracle_gtid")
 	instance.MasterUUID = m.GetString("master_uuid")
@@ -1082,6 +1114,10 @@ func readInstanceRow(m sqlutils.RowMap) *Instance {
 	instance.GTIDMode = m.GetString("gtid_mode")
 	instance.GtidPurged = m.GetString("gtid_purged")
 	instance.GtidErrant = m.GetString("gtid_errant")
+	instance.SQLMode = m.GetString("sql_mode")
+	instance.LowerCaseTableNames = m.GetUint("lower_case_table_names")
+	instance.CharacterSetServer = m.GetString("character_set_server")
+	instance.TimeZone = m.GetString("time_zone")
 	instance.UsingMariaDBGTID = m.GetBool("mariadb_gtid")
 	instance.UsingPseudoGTID = m.GetBool("pseudo_gtid")
 	instance.SelfBinlogCoordinates.LogFile = m.GetString("binary_log_file")
@@ -1132,21 +1168,24 @@ func readInstanceRow(m sqlutils.RowMap) *Instance {
 	instance.SlaveHosts.ReadJson(slaveHostsJSON)
 	instance.applyFlavorName()
 
-	// problems
+	return instance
+}
+
+// readInstanceProblems sets the problems of an instance read from the backend, given the
+// replication lag considered reasonable for its cluster
+func readInstanceProblems(instance *Instance, reasonableReplicationLagSeconds int) {
 	if !instance.IsLastCheckValid {
 		instance.Problems = append(instance.Problems, "last_check_invalid")
 	} else if !instance.IsRecentlyChecked {
 		instance.Problems = append(instance.Problems, "not_recently_checked")
 	} else if instance.ReplicationThreadsExist() && !instance.ReplicaRunning() {
 		instance.Problems = append(instance.Problems, "not_replicating")
-	} else if instance.SlaveLagSeconds.Valid && math.AbsInt64(instance.SlaveLagSeconds.Int64-int64(instance.SQLDelay)) > int64(config.Config.ReasonableReplicationLagSeconds) {
+	} else if instance.SlaveLagSeconds.Valid && math.AbsInt64(instance.SlaveLagSeconds.Int64-int64(instance.SQLDelay)) > int64(reasonableReplicationLagSeconds) {
 		instance.Problems = append(instance.Problems, "replication_lag")
 	}
 	if instance.GtidErrant != "" {
 		instance.Problems = append(instance.Problems, "errant_gtid")
 	}
-
-	return instance
 }
 
 // readInstancesByCondition is a generic function to read instances from the backend database
@@ -1191,6 +1230,10 @@ func readInstancesByCondition(condition string, args []interface{}, sort string)
 		if err != nil {
 			return instances, log.Errore(err)
 		}
+		// Resolved past the above query: resolving cluster configuration may itself query the backend
+		for _, instance := range instances {
+			readInstanceProblems(instance, GetClusterConfig(instance.ClusterName).ReasonableReplicationLagSeconds)
+		}
 		err = PopulateInstancesAgents(instances)
 		if err != nil {
 			return instances, log.Errore(err)
@@ -1340,7 +1383,10 @@ func ReadProblemInstances(clusterName string) ([](*Instance), error) {
 			)
 		`
 
-	args := sqlutils.Args(clusterName, clusterName, config.Config.InstancePollSeconds*5, config.Config.ReasonableReplicationLagSeconds, config.Config.ReasonableReplicationLagSeconds)
+	// ReasonableReplicationLagSeconds may be overridden per cluster: the query uses the lowest, and instances
+	// lagging within their cluster's setting are filtered out below
+	reasonableReplicationLagSeconds := minReasonableReplicationLagSeconds()
+	args := sqlutils.Args(clusterName, clusterName, config.Config.InstancePollSeconds*5, reasonableReplicationLagSeconds, reasonableReplicationLagSeconds)
 	instances, err := readInstancesByCondition(condition, args, "")
 	if err != nil {
 		return instances, err
@@ -1354,6 +1400,9 @@ func ReadProblemInstances(clusterName string) ([](*Instance), error) {
 		if RegexpMatchPatterns(instance.Key.StringCode(), config.Config.ProblemIgnoreHostnameFilters) {
 			skip = true
 		}
+		if len(instance.Problems) == 0 && GetClusterConfig(instance.ClusterName) != config.Config {
+			skip = true
+		}
 		if !skip {
 			reportedInstances = append(reportedInstances, instance)
 		}
@@ -2397,6 +2446,11 @@ func mkInsertOdkuForInstances(instances []*Instance, instanceWasActuallyFound bo
 		"semi_sync_replica_enabled",
 		"instance_alias",
 		"last_discovery_latency",
+		"replication_filters",
+		"sql_mode",
+		"lower_case_table_names",
+		"character_set_server",
+		"time_zone",
 	}
 
 	var values []string = make([]string, len(columns), len(columns))
@@ -2477,6 +2531,11 @@ func mkInsertOdkuForInstances(instances []*Instance, instanceWasActuallyFound bo
 		args = append(args, instance.SemiSyncReplicaEnabled)
 		args = append(args, instance.InstanceAlias)
 		args = append(args, instance.LastDiscoveryLatency.Nanoseconds())
+		args = append(args, instance.ReplicationFilters.ToJSONString())
+		args = append(args, instance.SQLMode)
+		args = append(args, instance.LowerCaseTableNames)
+		args = append(args, instance.CharacterSetServer)
+		args = append(args, instance.TimeZone)
 	}
 
 	sql, err := mkInsertOdku("database_instance", columns, values, len(instances), insertIgnore)
@@ -2673,6 +2732,8 @@ func ForgetInstance(instanceKey *InstanceKey) error {
 	if instanceKey == nil {
 		return log.Errorf("ForgetInstance(): nil instanceKey")
 	}
+	// The cluster name is unknown once the instance is forgotten
+	clusterName, _ := GetClusterName(instanceKey)
 	forgetInstanceKeys.Set(instanceKey.StringCode(), true, cache.DefaultExpiration)
 	sqlResult, err := db.ExecOrchestrator(`
 			delete
@@ -2692,7 +2753,7 @@ func ForgetInstance(instanceKey *InstanceKey) error {
 	if rows == 0 {
 		return log.Errorf("ForgetInstance(): instance %+v not found", *instanceKey)
 	}
-	AuditOperation("forget", instanceKey, "")
+	auditOperation("forget", instanceKey, clusterName, "")
 	return nil
 }
 
@@ -2708,7 +2769,7 @@ func ForgetCluster(clusterName string) error {
 	}
 	for _, instance := range clusterInstances {
 		forgetInstanceKeys.Set(instance.Key.StringCode(), true, cache.DefaultExpiration)
-		AuditOperation("forget", &instance.Key, "")
+		auditOperation("forget", &instance.Key, clusterName, "")
 	}
 	_, err = db.ExecOrchestrator(`
 			delete
@@ -2721,23 +2782,24 @@ func ForgetCluster(clusterName string) error {
 }
 
 // ForgetLongUnseenInstances will remove entries of all instacnes that have long since been last seen.
+// Each forgotten instance is audited.
 func ForgetLongUnseenInstances() error {
-	sqlResult, err := db.ExecOrchestrator(`
-			delete
-				from database_instance
-			where
-				last_seen < NOW() - interval ? hour`,
-		config.Config.UnseenInstanceForgetHours,
-	)
+	staleInstances, err := readStaleInstances(config.Config.UnseenInstanceForgetHours)
 	if err != nil {
-		return log.Errore(err)
+		return err
 	}
-	rows, err := sqlResult.RowsAffected()
-	if err != nil {
-		return log.Errore(err)
+	forgottenCount := 0
+	for _, staleInstance := range staleInstances {
+		forgotten, err := forgetStaleInstance(&staleInstance, config.Config.UnseenInstanceForgetHours, "forget-unseen")
+		if err != nil {
+			return err
+		}
+		if forgotten {
+			forgottenCount++
+		}
 	}
-	AuditOperation("forget-unseen", nil, fmt.Sprintf("Forgotten instances: %d", rows))
-	return err
+	AuditOperation("forget-unseen", nil, fmt.Sprintf("Forgotten instances: %d", forgottenCount))
+	return nil
 }
 
 // SnapshotTopologies records topology graph for all existing topologies
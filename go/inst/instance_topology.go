@@ -1699,8 +1699,9 @@ func TakeMasterHook(successor *Instance, demoted *Instance) {
 	successorStr := fmt.Sprintf("%s", successorKey)
 	demotedStr := fmt.Sprintf("%s", demotedKey)
 
-	processCount := len(config.Config.PostTakeMasterProcesses)
-	for i, command := range config.Config.PostTakeMasterProcesses {
+	postTakeMasterProcesses := GetClusterConfig(successor.ClusterName).PostTakeMasterProcesses
+	processCount := len(postTakeMasterProcesses)
+	for i, command := range postTakeMasterProcesses {
 		fullDescription := fmt.Sprintf("PostTakeMasterProcesses hook %d of %d", i+1, processCount)
 		log.Debugf("Take-Master: PostTakeMasterProcesses: Calling %+s", fullDescription)
 		start := time.Now()
@@ -1779,7 +1780,7 @@ Cleanup:
 	// This only runs if there is a hook configured in orchestrator.conf.json
 	demoted := masterInstance
 	successor := instance
-	if config.Config.PostTakeMasterProcesses != nil {
+	if GetClusterConfig(successor.ClusterName).PostTakeMasterProcesses != nil {
 		TakeMasterHook(successor, demoted)
 	}
 
@@ -1855,7 +1856,11 @@ func getReplicasForSorting(masterKey *InstanceKey, includeBinlogServerSubReplica
 	} else {
 		replicas, err = ReadReplicaInstances(masterKey)
 	}
-	return replicas, err
+	if err != nil {
+		return replicas, err
+	}
+	// Cluster link boundaries belong with their downstream clusters, and are never promoted nor regrouped here
+	return RemoveClusterLinkBoundaries(replicas)
 }
 
 func sortedReplicas(replicas [](*Instance), stopReplicationMethod StopReplicationMethod) [](*Instance) {
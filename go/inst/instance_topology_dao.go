@@ -304,7 +304,8 @@ func WaitForSQLThreadUpToDate(instanceKey *InstanceKey, overallTimeout time.Dura
 		overallTimeout = 24 * time.Hour
 	}
 	if staleCoordinatesTimeout == 0 {
-		staleCoordinatesTimeout = time.Duration(config.Config.ReasonableReplicationLagSeconds) * time.Second
+		clusterName, _ := GetClusterName(instanceKey)
+		staleCoordinatesTimeout = time.Duration(GetClusterConfig(clusterName).ReasonableReplicationLagSeconds) * time.Second
 	}
 	generalTimer := time.NewTimer(overallTimeout)
 	staleTimer := time.NewTimer(staleCoordinatesTimeout)
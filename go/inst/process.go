@@ -29,4 +29,5 @@ type Process struct {
 	State            string
 	Info             string
 	StartedAt        string
+	InTransaction    bool
 }
@@ -0,0 +1,332 @@
+/*
+   Copyright 2019 GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/db"
+	"github.com/github/orchestrator/go/raft"
+	"github.com/openark/golib/log"
+	"github.com/openark/golib/sqlutils"
+)
+
+// process_info column length in database_instance_long_running_queries
+const maxLongRunningQueryInfoLength = 1024
+
+// ReadActiveWriteTransactions reads, directly from given instance, the processes running InnoDB
+// transactions which have modified or locked rows, and which have been running for at least
+// minSeconds seconds. Orchestrator's own connection is excluded.
+func ReadActiveWriteTransactions(instanceKey *InstanceKey, minSeconds int) (processes [](*Process), err error) {
+	sqlDB, err := db.OpenTopology(instanceKey.Hostname, instanceKey.Port)
+	if err != nil {
+		return processes, log.Errore(err)
+	}
+	query := `
+		select
+			processlist.id,
+			processlist.user,
+			processlist.host,
+			ifnull(processlist.db, '') as db,
+			processlist.command,
+			processlist.time,
+			ifnull(processlist.state, '') as state,
+			ifnull(processlist.info, '') as info,
+			innodb_trx.trx_started
+		from
+			information_schema.innodb_trx
+			join information_schema.processlist on (innodb_trx.trx_mysql_thread_id = processlist.id)
+		where
+			processlist.id != connection_id()
+			and (innodb_trx.trx_rows_modified > 0 or innodb_trx.trx_lock_structs > 0)
+			and innodb_trx.trx_started <= now() - interval ? second
+		order by
+			innodb_trx.trx_started
+		`
+	err = sqlutils.QueryRowsMap(sqlDB, query, func(m sqlutils.RowMap) error {
+		process := &Process{
+			InstanceHostname: instanceKey.Hostname,
+			InstancePort:     instanceKey.Port,
+			Id:               m.GetInt64("id"),
+			User:             m.GetString("user"),
+			Host:             m.GetString("host"),
+			Db:               m.GetString("db"),
+			Command:          m.GetString("command"),
+			Time:             m.GetInt64("time"),
+			State:            m.GetString("state"),
+			Info:             m.GetString("info"),
+			StartedAt:        m.GetString("trx_started"),
+		}
+		processes = append(processes, process)
+		return nil
+	}, minSeconds)
+	return processes, log.Errore(err)
+}
+
+// KillProcess kills a connection on given instance, rolling back any transaction it may be running
+func KillProcess(instanceKey *InstanceKey, processId int64) error {
+	if *config.RuntimeCLIFlags.Noop {
+		return fmt.Errorf("noop: aborting kill operation on %+v; signalling error but nothing went wrong.", *instanceKey)
+	}
+	if _, err := ExecInstance(instanceKey, `kill ?`, processId); err != nil {
+		return log.Errore(err)
+	}
+	log.Infof("Killed process %d on %+v", processId, *instanceKey)
+	AuditOperation("kill-process", instanceKey, fmt.Sprintf("Killed process %d", processId))
+	return nil
+}
+
+// SetSuperReadOnly sets or clears the instance's global super_read_only variable
+func SetSuperReadOnly(instanceKey *InstanceKey, superReadOnly bool) error {
+	if *config.RuntimeCLIFlags.Noop {
+		return fmt.Errorf("noop: aborting set-super-read-only operation on %+v; signalling error but nothing went wrong.", *instanceKey)
+	}
+	if _, err := ExecInstance(instanceKey, "set global super_read_only = ?", superReadOnly); err != nil {
+		return log.Errore(err)
+	}
+	log.Infof("instance %+v super_read_only: %t", instanceKey, superReadOnly)
+	AuditOperation("super-read-only", instanceKey, fmt.Sprintf("set as %t", superReadOnly))
+	return nil
+}
+
+// ReadLongRunningProcesses reads, directly from given instance, the processes running a query for at least
+// minSeconds seconds, as well as the processes holding an InnoDB transaction open for at least minSeconds
+// seconds (possibly idle, yet holding locks). Replication dump threads and orchestrator's own connection are excluded.
+func ReadLongRunningProcesses(instanceKey *InstanceKey, minSeconds int) (processes [](*Process), err error) {
+	sqlDB, err := db.OpenTopology(instanceKey.Hostname, instanceKey.Port)
+	if err != nil {
+		return processes, log.Errore(err)
+	}
+	query := `
+		select
+			processlist.id,
+			processlist.user,
+			processlist.host,
+			ifnull(processlist.db, '') as db,
+			processlist.command,
+			processlist.time,
+			ifnull(processlist.state, '') as state,
+			ifnull(processlist.info, '') as info,
+			ifnull(innodb_trx.trx_started, now() - interval processlist.time second) as started_at,
+			innodb_trx.trx_id is not null as in_transaction
+		from
+			information_schema.processlist
+			left join information_schema.innodb_trx on (innodb_trx.trx_mysql_thread_id = processlist.id)
+		where
+			processlist.id != connection_id()
+			and processlist.command not in ('Binlog Dump', 'Binlog Dump GTID', 'Daemon')
+			and (
+				(processlist.command != 'Sleep' and processlist.info is not null and processlist.time >= ?)
+				or innodb_trx.trx_started <= now() - interval ? second
+			)
+		order by
+			started_at
+		`
+	err = sqlutils.QueryRowsMap(sqlDB, query, func(m sqlutils.RowMap) error {
+		process := &Process{
+			InstanceHostname: instanceKey.Hostname,
+			InstancePort:     instanceKey.Port,
+			Id:               m.GetInt64("id"),
+			User:             m.GetString("user"),
+			Host:             m.GetString("host"),
+			Db:               m.GetString("db"),
+			Command:          m.GetString("command"),
+			Time:             m.GetInt64("time"),
+			State:            m.GetString("state"),
+			Info:             m.GetString("info"),
+			StartedAt:        m.GetString("started_at"),
+			InTransaction:    m.GetBool("in_transaction"),
+		}
+		processes = append(processes, process)
+		return nil
+	}, minSeconds, minSeconds)
+	return processes, log.Errore(err)
+}
+
+// filterLongRunningQueriesUsers applies LongRunningQueriesUserFilters and LongRunningQueriesIgnoreUserFilters
+func filterLongRunningQueriesUsers(processes [](*Process)) (filtered [](*Process)) {
+	for _, process := range processes {
+		if len(config.Config.LongRunningQueriesUserFilters) > 0 && !RegexpMatchPatterns(process.User, config.Config.LongRunningQueriesUserFilters) {
+			continue
+		}
+		if RegexpMatchPatterns(process.User, config.Config.LongRunningQueriesIgnoreUserFilters) {
+			continue
+		}
+		filtered = append(filtered, process)
+	}
+	return filtered
+}
+
+// readLongRunningQueriesSampleCandidates returns the instances whose processlist should be sampled:
+// masters and intermediate masters, as well as replicas lagging while replicating
+func readLongRunningQueriesSampleCandidates() (instanceKeys [](*InstanceKey), err error) {
+	query := `
+		select
+			hostname,
+			port
+		from
+			database_instance
+		where
+			last_checked <= last_seen
+			and (
+				num_slave_hosts > 0
+				or (slave_sql_running = 1 and slave_lag_seconds > %s)
+			)
+		`
+	// ReasonableReplicationLagSeconds may be overridden per cluster
+	lagExpression, lagArgs := reasonableReplicationLagSecondsExpression("cluster_name")
+	query = fmt.Sprintf(query, lagExpression)
+	err = db.QueryOrchestrator(query, lagArgs, func(m sqlutils.RowMap) error {
+		instanceKeys = append(instanceKeys, &InstanceKey{Hostname: m.GetString("hostname"), Port: m.GetInt("port")})
+		return nil
+	})
+	return instanceKeys, log.Errore(err)
+}
+
+// writeLongRunningProcesses replaces the recorded long running processes of given instance
+func writeLongRunningProcesses(instanceKey *InstanceKey, processes [](*Process)) error {
+	writeFunc := func() error {
+		_, err := db.ExecOrchestrator(`
+			delete from database_instance_long_running_queries
+			where
+				hostname = ?
+				and port = ?
+			`, instanceKey.Hostname, instanceKey.Port)
+		if err != nil {
+			return log.Errore(err)
+		}
+		for _, process := range processes {
+			info := process.Info
+			if len(info) > maxLongRunningQueryInfoLength {
+				info = info[0:maxLongRunningQueryInfoLength]
+			}
+			_, err := db.ExecOrchestrator(`
+				insert into database_instance_long_running_queries (
+					hostname, port, process_id, process_started_at, process_user, process_host, process_db,
+					process_command, process_time_seconds, process_state, process_info, in_transaction, sampled_at
+				) values (
+					?, ?, ?, ?, ?, ?, ?,
+					?, ?, ?, ?, ?, NOW()
+				)
+				`, instanceKey.Hostname, instanceKey.Port, process.Id, process.StartedAt, process.User, process.Host, process.Db,
+				process.Command, process.Time, process.State, info, process.InTransaction,
+			)
+			if err != nil {
+				return log.Errore(err)
+			}
+		}
+		return nil
+	}
+	return ExecDBWriteFunc(writeFunc)
+}
+
+// LongRunningQueriesSample is the long running processes sampled on an instance
+type LongRunningQueriesSample struct {
+	Key       InstanceKey
+	Processes [](*Process)
+}
+
+// WriteLongRunningQueriesSample replaces the recorded long running processes of the sampled instance.
+// It is the operation applied by raft members upon sampling by the leader.
+func WriteLongRunningQueriesSample(sample *LongRunningQueriesSample) error {
+	return writeLongRunningProcesses(&sample.Key, sample.Processes)
+}
+
+// ExpireLongRunningQueries removes records of instances no longer sampled. Raft members expire the samples
+// published to them by the leader, each on its own.
+func ExpireLongRunningQueries() error {
+	writeFunc := func() error {
+		_, err := db.ExecOrchestrator(`
+			delete from database_instance_long_running_queries
+			where
+				sampled_at < NOW() - INTERVAL ? SECOND
+			`, 2*config.Config.LongRunningQueriesSampleIntervalSeconds,
+		)
+		return log.Errore(err)
+	}
+	return ExecDBWriteFunc(writeFunc)
+}
+
+// SampleLongRunningQueries samples processlists of masters, intermediate masters and lagging replicas,
+// and records long running queries and transactions. On raft setups, samples are published to all members.
+func SampleLongRunningQueries() error {
+	instanceKeys, err := readLongRunningQueriesSampleCandidates()
+	if err != nil {
+		return err
+	}
+	var wg sync.WaitGroup
+	for _, instanceKey := range instanceKeys {
+		instanceKey := instanceKey
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ExecuteOnTopology(func() {
+				processes, err := ReadLongRunningProcesses(instanceKey, config.Config.LongRunningQueriesThresholdSeconds)
+				if err != nil {
+					return
+				}
+				sample := &LongRunningQueriesSample{Key: *instanceKey, Processes: filterLongRunningQueriesUsers(processes)}
+				if err := WriteLongRunningQueriesSample(sample); err != nil {
+					return
+				}
+				if orcraft.IsRaftEnabled() {
+					if _, err := orcraft.PublishCommand("write-long-running-queries", sample); err != nil {
+						log.Errore(err)
+					}
+				}
+			})
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// ReadClusterLongRunningQueries returns the recorded long running queries and transactions in given cluster
+func ReadClusterLongRunningQueries(clusterName string) (processes [](*Process), err error) {
+	query := `
+		select
+			database_instance_long_running_queries.*
+		from
+			database_instance_long_running_queries
+			join database_instance using (hostname, port)
+		where
+			database_instance.cluster_name = ?
+		order by
+			process_started_at asc
+		`
+	err = db.QueryOrchestrator(query, sqlutils.Args(clusterName), func(m sqlutils.RowMap) error {
+		process := &Process{
+			InstanceHostname: m.GetString("hostname"),
+			InstancePort:     m.GetInt("port"),
+			Id:               m.GetInt64("process_id"),
+			User:             m.GetString("process_user"),
+			Host:             m.GetString("process_host"),
+			Db:               m.GetString("process_db"),
+			Command:          m.GetString("process_command"),
+			Time:             m.GetInt64("process_time_seconds"),
+			State:            m.GetString("process_state"),
+			Info:             m.GetString("process_info"),
+			StartedAt:        m.GetString("process_started_at"),
+			InTransaction:    m.GetBool("in_transaction"),
+		}
+		processes = append(processes, process)
+		return nil
+	})
+	return processes, log.Errore(err)
+}
@@ -0,0 +1,35 @@
+package inst
+
+import (
+	"testing"
+
+	"github.com/github/orchestrator/go/config"
+	test "github.com/openark/golib/tests"
+)
+
+func TestFilterLongRunningQueriesUsers(t *testing.T) {
+	defer func(userFilters []string, ignoreUserFilters []string) {
+		config.Config.LongRunningQueriesUserFilters = userFilters
+		config.Config.LongRunningQueriesIgnoreUserFilters = ignoreUserFilters
+	}(config.Config.LongRunningQueriesUserFilters, config.Config.LongRunningQueriesIgnoreUserFilters)
+
+	processes := [](*Process){
+		{Id: 1, User: "app"},
+		{Id: 2, User: "app_ro"},
+		{Id: 3, User: "backup"},
+		{Id: 4, User: "system user"},
+	}
+
+	config.Config.LongRunningQueriesUserFilters = []string{}
+	config.Config.LongRunningQueriesIgnoreUserFilters = []string{}
+	test.S(t).ExpectEquals(len(filterLongRunningQueriesUsers(processes)), 4)
+
+	config.Config.LongRunningQueriesIgnoreUserFilters = []string{"^backup$"}
+	test.S(t).ExpectEquals(len(filterLongRunningQueriesUsers(processes)), 3)
+
+	config.Config.LongRunningQueriesUserFilters = []string{"^app"}
+	config.Config.LongRunningQueriesIgnoreUserFilters = []string{"_ro$"}
+	filtered := filterLongRunningQueriesUsers(processes)
+	test.S(t).ExpectEquals(len(filtered), 1)
+	test.S(t).ExpectEquals(filtered[0].Id, int64(1))
+}
@@ -0,0 +1,199 @@
+/*
+   Copyright 2019 GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/kv"
+)
+
+const (
+	// ReplicaPoolMaxWeight is the weight of a replica with no lag
+	ReplicaPoolMaxWeight = 100
+	// ReplicaPoolMinWeight is the weight of an included replica lagging by ReplicaPoolMaxLagSeconds
+	ReplicaPoolMinWeight = 1
+)
+
+// ReplicaPoolMember describes a replica as published to proxies: its identity, health and traffic weight.
+// Excluded replicas are listed with zero weight, so that consumers may tell why they should not get traffic.
+type ReplicaPoolMember struct {
+	Hostname        string
+	Port            int
+	LagSeconds      int64 // -1 when unknown
+	DataCenter      string
+	IsDowntimed     bool
+	InMaintenance   bool
+	Weight          int
+	Excluded        bool
+	ExclusionReason string
+}
+
+// ReplicaPool is the set of replicas of a cluster
+type ReplicaPool struct {
+	ClusterName  string
+	ClusterAlias string
+	Members      []ReplicaPoolMember
+}
+
+// replicaPoolWeight computes traffic weight of a replica by its lag: ReplicaPoolMaxWeight when not lagging,
+// decreasing linearly down to ReplicaPoolMinWeight at maxLagSeconds.
+func replicaPoolWeight(lagSeconds int64, maxLagSeconds int) int {
+	if lagSeconds <= 0 || maxLagSeconds <= 0 {
+		return ReplicaPoolMaxWeight
+	}
+	if lagSeconds >= int64(maxLagSeconds) {
+		return ReplicaPoolMinWeight
+	}
+	weight := ReplicaPoolMaxWeight - int(lagSeconds*int64(ReplicaPoolMaxWeight-ReplicaPoolMinWeight)/int64(maxLagSeconds))
+	if weight < ReplicaPoolMinWeight {
+		weight = ReplicaPoolMinWeight
+	}
+	return weight
+}
+
+// replicaPoolExclusionReason returns the reason for which a replica should not receive traffic; empty if none
+func replicaPoolExclusionReason(replica *Instance, inMaintenance bool) string {
+	maxLagSeconds := GetClusterConfig(replica.ClusterName).GetReplicaPoolMaxLagSeconds()
+	switch {
+	case !replica.IsLastCheckValid:
+		return "last check invalid"
+	case !replica.ReplicaRunning():
+		return "replication not running"
+	case !replica.SlaveLagSeconds.Valid:
+		return "lag unknown"
+	case replica.SlaveLagSeconds.Int64 > int64(maxLagSeconds):
+		return fmt.Sprintf("lag %ds exceeds %ds", replica.SlaveLagSeconds.Int64, maxLagSeconds)
+	case replica.SQLDelay > 0:
+		return "delayed replica"
+	case replica.IsDowntimed:
+		return "downtimed"
+	case inMaintenance:
+		return "in maintenance"
+	}
+	return ""
+}
+
+// NewReplicaPoolMember evaluates a replica for a replica pool
+func NewReplicaPoolMember(replica *Instance, inMaintenance bool) ReplicaPoolMember {
+	member := ReplicaPoolMember{
+		Hostname:      replica.Key.Hostname,
+		Port:          replica.Key.Port,
+		LagSeconds:    -1,
+		DataCenter:    replica.DataCenter,
+		IsDowntimed:   replica.IsDowntimed,
+		InMaintenance: inMaintenance,
+	}
+	if replica.SlaveLagSeconds.Valid {
+		member.LagSeconds = replica.SlaveLagSeconds.Int64
+	}
+	member.ExclusionReason = replicaPoolExclusionReason(replica, inMaintenance)
+	member.Excluded = (member.ExclusionReason != "")
+	if !member.Excluded {
+		member.Weight = replicaPoolWeight(member.LagSeconds, GetClusterConfig(replica.ClusterName).GetReplicaPoolMaxLagSeconds())
+	}
+	return member
+}
+
+// readMaintenanceKeys returns the keys of all instances in active maintenance
+func readMaintenanceKeys() (*InstanceKeyMap, error) {
+	keys := NewInstanceKeyMap()
+	maintenanceEntries, err := ReadActiveMaintenance()
+	if err != nil {
+		return keys, err
+	}
+	for _, maintenance := range maintenanceEntries {
+		keys.AddKey(maintenance.Key)
+	}
+	return keys, nil
+}
+
+// ReadReplicaPools reads the replica pools of all clusters, or of a specific cluster. A pool lists all
+// replicas in the cluster, ordered by weight.
+func ReadReplicaPools(clusterName string) (pools []ReplicaPool, err error) {
+	clustersInfo, err := ReadClustersInfo(clusterName)
+	if err != nil {
+		return pools, err
+	}
+	maintenanceKeys, err := readMaintenanceKeys()
+	if err != nil {
+		return pools, err
+	}
+	for _, clusterInfo := range clustersInfo {
+		instances, err := ReadClusterInstances(clusterInfo.ClusterName)
+		if err != nil {
+			return pools, err
+		}
+		pool := ReplicaPool{
+			ClusterName:  clusterInfo.ClusterName,
+			ClusterAlias: clusterInfo.ClusterAlias,
+			Members:      []ReplicaPoolMember{},
+		}
+		for _, instance := range instances {
+			if !instance.IsReplica() || instance.IsCoMaster {
+				continue
+			}
+			pool.Members = append(pool.Members, NewReplicaPoolMember(instance, maintenanceKeys.HasKey(instance.Key)))
+		}
+		sort.SliceStable(pool.Members, func(i, j int) bool {
+			if pool.Members[i].Weight == pool.Members[j].Weight {
+				return pool.Members[i].Hostname < pool.Members[j].Hostname
+			}
+			return pool.Members[i].Weight > pool.Members[j].Weight
+		})
+		pools = append(pools, pool)
+	}
+	return pools, nil
+}
+
+// GetClusterReplicasKVKey returns the KV key of a cluster's replica pool
+func GetClusterReplicasKVKey(clusterAlias string) string {
+	return fmt.Sprintf("%s%s", config.Config.KVClusterReplicasPrefix, clusterAlias)
+}
+
+// GetReplicaPoolKVPair returns the KV pair of a replica pool: the pool members, in JSON format
+func GetReplicaPoolKVPair(pool *ReplicaPool) (*kv.KVPair, error) {
+	if pool.ClusterAlias == "" {
+		return nil, nil
+	}
+	value, err := json.Marshal(pool.Members)
+	if err != nil {
+		return nil, err
+	}
+	return kv.NewKVPair(GetClusterReplicasKVKey(pool.ClusterAlias), string(value)), nil
+}
+
+// GetReplicaPoolsKVPairs returns the KV pairs of replica pools, for all clusters or for a specific cluster.
+func GetReplicaPoolsKVPairs(clusterName string) (kvPairs [](*kv.KVPair), err error) {
+	pools, err := ReadReplicaPools(clusterName)
+	if err != nil {
+		return kvPairs, err
+	}
+	for i := range pools {
+		kvPair, err := GetReplicaPoolKVPair(&pools[i])
+		if err != nil {
+			return kvPairs, err
+		}
+		if kvPair != nil {
+			kvPairs = append(kvPairs, kvPair)
+		}
+	}
+	return kvPairs, nil
+}
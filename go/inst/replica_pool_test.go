@@ -0,0 +1,79 @@
+package inst
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/github/orchestrator/go/config"
+	test "github.com/openark/golib/tests"
+)
+
+func newReplicaPoolTestInstance(lagSeconds int64) *Instance {
+	instance := NewInstance()
+	instance.Key = InstanceKey{Hostname: "replica", Port: 3306}
+	instance.MasterKey = InstanceKey{Hostname: "master", Port: 3306}
+	instance.ReadBinlogCoordinates = BinlogCoordinates{LogFile: "mysql-bin.000001", LogPos: 4}
+	instance.ReplicationIOThreadState = ReplicationThreadStateRunning
+	instance.ReplicationSQLThreadState = ReplicationThreadStateRunning
+	instance.IsLastCheckValid = true
+	instance.SlaveLagSeconds = sql.NullInt64{Int64: lagSeconds, Valid: true}
+	instance.DataCenter = "dc1"
+	return instance
+}
+
+func TestReplicaPoolWeight(t *testing.T) {
+	test.S(t).ExpectEquals(replicaPoolWeight(0, 10), ReplicaPoolMaxWeight)
+	test.S(t).ExpectEquals(replicaPoolWeight(5, 10), 51)
+	test.S(t).ExpectEquals(replicaPoolWeight(10, 10), ReplicaPoolMinWeight)
+	test.S(t).ExpectEquals(replicaPoolWeight(20, 10), ReplicaPoolMinWeight)
+	test.S(t).ExpectEquals(replicaPoolWeight(20, 0), ReplicaPoolMaxWeight)
+}
+
+func TestNewReplicaPoolMember(t *testing.T) {
+	defer func(maxLag int) { config.Config.ReplicaPoolMaxLagSeconds = maxLag }(config.Config.ReplicaPoolMaxLagSeconds)
+	config.Config.ReplicaPoolMaxLagSeconds = 10
+
+	member := NewReplicaPoolMember(newReplicaPoolTestInstance(0), false)
+	test.S(t).ExpectFalse(member.Excluded)
+	test.S(t).ExpectEquals(member.Weight, ReplicaPoolMaxWeight)
+	test.S(t).ExpectEquals(member.DataCenter, "dc1")
+	test.S(t).ExpectEquals(member.LagSeconds, int64(0))
+
+	member = NewReplicaPoolMember(newReplicaPoolTestInstance(11), false)
+	test.S(t).ExpectTrue(member.Excluded)
+	test.S(t).ExpectEquals(member.Weight, 0)
+	test.S(t).ExpectEquals(member.ExclusionReason, "lag 11s exceeds 10s")
+
+	member = NewReplicaPoolMember(newReplicaPoolTestInstance(0), true)
+	test.S(t).ExpectTrue(member.Excluded)
+	test.S(t).ExpectTrue(member.InMaintenance)
+	test.S(t).ExpectEquals(member.ExclusionReason, "in maintenance")
+
+	instance := newReplicaPoolTestInstance(0)
+	instance.IsDowntimed = true
+	member = NewReplicaPoolMember(instance, false)
+	test.S(t).ExpectTrue(member.Excluded)
+	test.S(t).ExpectTrue(member.IsDowntimed)
+
+	instance = newReplicaPoolTestInstance(0)
+	instance.ReplicationSQLThreadState = ReplicationThreadStateStopped
+	instance.SlaveLagSeconds = sql.NullInt64{}
+	member = NewReplicaPoolMember(instance, false)
+	test.S(t).ExpectTrue(member.Excluded)
+	test.S(t).ExpectEquals(member.LagSeconds, int64(-1))
+	test.S(t).ExpectEquals(member.ExclusionReason, "replication not running")
+}
+
+func TestGetReplicaPoolKVPair(t *testing.T) {
+	pool := &ReplicaPool{ClusterName: "master:3306", Members: []ReplicaPoolMember{}}
+	kvPair, err := GetReplicaPoolKVPair(pool)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectTrue(kvPair == nil)
+
+	pool.ClusterAlias = "mycluster"
+	pool.Members = append(pool.Members, NewReplicaPoolMember(newReplicaPoolTestInstance(0), false))
+	kvPair, err = GetReplicaPoolKVPair(pool)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(kvPair.Key, config.Config.KVClusterReplicasPrefix+"mycluster")
+	test.S(t).ExpectEquals(kvPair.Value, `[{"Hostname":"replica","Port":3306,"LagSeconds":0,"DataCenter":"dc1","IsDowntimed":false,"InMaintenance":false,"Weight":100,"Excluded":false,"ExclusionReason":""}]`)
+}
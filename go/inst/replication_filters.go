@@ -0,0 +1,100 @@
+/*
+   Copyright 2019 GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/openark/golib/sqlutils"
+)
+
+// ReplicationFilters lists the replication filter rules of a replica, as reported by SHOW SLAVE STATUS.
+// Each rule is a normalized (sorted, comma delimited) list, so that equal rule sets compare equal.
+type ReplicationFilters struct {
+	DoDB            string
+	IgnoreDB        string
+	DoTable         string
+	IgnoreTable     string
+	WildDoTable     string
+	WildIgnoreTable string
+}
+
+// normalizeReplicationFilterRule sorts the comma delimited entries of a single rule
+func normalizeReplicationFilterRule(rule string) string {
+	entries := []string{}
+	for _, entry := range strings.Split(rule, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, ",")
+}
+
+// NewReplicationFilters returns normalized replication filters given the raw rules
+func NewReplicationFilters(doDB, ignoreDB, doTable, ignoreTable, wildDoTable, wildIgnoreTable string) ReplicationFilters {
+	return ReplicationFilters{
+		DoDB:            normalizeReplicationFilterRule(doDB),
+		IgnoreDB:        normalizeReplicationFilterRule(ignoreDB),
+		DoTable:         normalizeReplicationFilterRule(doTable),
+		IgnoreTable:     normalizeReplicationFilterRule(ignoreTable),
+		WildDoTable:     normalizeReplicationFilterRule(wildDoTable),
+		WildIgnoreTable: normalizeReplicationFilterRule(wildIgnoreTable),
+	}
+}
+
+// NewReplicationFiltersFromSlaveStatus reads replication filters off a SHOW SLAVE STATUS row
+func NewReplicationFiltersFromSlaveStatus(m sqlutils.RowMap) ReplicationFilters {
+	return NewReplicationFilters(
+		m.GetStringD("Replicate_Do_DB", ""),
+		m.GetStringD("Replicate_Ignore_DB", ""),
+		m.GetStringD("Replicate_Do_Table", ""),
+		m.GetStringD("Replicate_Ignore_Table", ""),
+		m.GetStringD("Replicate_Wild_Do_Table", ""),
+		m.GetStringD("Replicate_Wild_Ignore_Table", ""),
+	)
+}
+
+// IsEmpty returns true when no replication filter is defined
+func (this *ReplicationFilters) IsEmpty() bool {
+	return *this == ReplicationFilters{}
+}
+
+// Equals tests whether two sets of replication filters are identical
+func (this *ReplicationFilters) Equals(other *ReplicationFilters) bool {
+	return *this == *other
+}
+
+// ToJSONString returns the JSON representation of these filters; empty filters are represented by an empty string
+func (this *ReplicationFilters) ToJSONString() string {
+	if this.IsEmpty() {
+		return ""
+	}
+	b, _ := json.Marshal(this)
+	return string(b)
+}
+
+// ReadJson reads replication filters as generated by ToJSONString
+func (this *ReplicationFilters) ReadJson(jsonString string) error {
+	*this = ReplicationFilters{}
+	if jsonString == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(jsonString), this)
+}
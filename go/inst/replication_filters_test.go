@@ -0,0 +1,43 @@
+package inst
+
+import (
+	"testing"
+
+	test "github.com/openark/golib/tests"
+)
+
+func TestNewReplicationFilters(t *testing.T) {
+	filters := NewReplicationFilters("db2, db1", "", "", "", "", "mysql.%,test.%")
+	test.S(t).ExpectEquals(filters.DoDB, "db1,db2")
+	test.S(t).ExpectEquals(filters.WildIgnoreTable, "mysql.%,test.%")
+	test.S(t).ExpectFalse(filters.IsEmpty())
+
+	other := NewReplicationFilters("db1,db2", "", "", "", "", "test.%,mysql.%")
+	test.S(t).ExpectTrue(filters.Equals(&other))
+
+	empty := NewReplicationFilters("", "", "", "", "", "")
+	test.S(t).ExpectTrue(empty.IsEmpty())
+	test.S(t).ExpectFalse(filters.Equals(&empty))
+}
+
+func TestReplicationFiltersJSON(t *testing.T) {
+	{
+		filters := NewReplicationFilters("", "", "", "", "", "")
+		test.S(t).ExpectEquals(filters.ToJSONString(), "")
+
+		read := NewReplicationFilters("db1", "", "", "", "", "")
+		err := read.ReadJson("")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectTrue(read.IsEmpty())
+	}
+	{
+		filters := NewReplicationFilters("db1", "db3", "", "", "", "")
+		jsonString := filters.ToJSONString()
+		test.S(t).ExpectNotEquals(jsonString, "")
+
+		read := ReplicationFilters{}
+		err := read.ReadJson(jsonString)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectTrue(read.Equals(&filters))
+	}
+}
@@ -90,7 +90,7 @@ func getHostnameResolvesLightweightCache() *cache.Cache {
 }
 
 func HostnameResolveMethodIsNone() bool {
-	return strings.ToLower(config.Config.HostnameResolveMethod) == "none"
+	return strings.ToLower(config.Config.HostnameResolveMethod) == "none" && len(config.Config.HostnameResolveMethodsByPattern) == 0
 }
 
 // GetCNAME resolves an IP or hostname into a normalized valid CNAME
@@ -104,17 +104,7 @@ func GetCNAME(hostname string) (string, error) {
 }
 
 func resolveHostname(hostname string) (string, error) {
-	switch strings.ToLower(config.Config.HostnameResolveMethod) {
-	case "none":
-		return hostname, nil
-	case "default":
-		return hostname, nil
-	case "cname":
-		return GetCNAME(hostname)
-	case "ip":
-		return getHostnameIP(hostname)
-	}
-	return hostname, nil
+	return GetHostnameResolver(hostname).Resolve(hostname)
 }
 
 // Attempt to resolve a hostname. This may return a database cached hostname or otherwise
@@ -240,7 +230,7 @@ func UnresolveHostname(instanceKey *InstanceKey) (InstanceKey, bool, error) {
 	if *config.RuntimeCLIFlags.SkipUnresolve {
 		return *instanceKey, false, nil
 	}
-	unresolvedHostname, err := readUnresolvedHostname(instanceKey.Hostname)
+	unresolvedHostname, err := unresolveHostname(instanceKey.Hostname)
 	if err != nil {
 		return *instanceKey, false, log.Errore(err)
 	}
@@ -267,6 +257,22 @@ func UnresolveHostname(instanceKey *InstanceKey) (InstanceKey, bool, error) {
 	return *unresolvedKey, true, nil
 }
 
+// unresolveHostname consults the configured resolvers able to unresolve, and otherwise the registered
+// hostname unresolves. The resolve method is configured by the unresolved ("virtual") hostname, not by
+// the given resolved one, and so a resolver's unresolve only counts when it is the resolver of its result.
+func unresolveHostname(hostname string) (string, error) {
+	for _, unresolver := range hostnameUnresolvers(hostname) {
+		unresolvedHostname, found, err := unresolver.Unresolve(hostname)
+		if err != nil {
+			return hostname, err
+		}
+		if found && GetHostnameResolver(unresolvedHostname) == unresolver.(HostnameResolver) {
+			return unresolvedHostname, nil
+		}
+	}
+	return readUnresolvedHostname(hostname)
+}
+
 func RegisterHostnameUnresolve(registration *HostnameRegistration) (err error) {
 	if registration.Hostname == "" {
 		return DeleteHostnameUnresolve(&registration.Key)
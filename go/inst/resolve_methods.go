@@ -0,0 +1,281 @@
+/*
+   Copyright 2019 GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/openark/golib/log"
+)
+
+// HostnameResolver normalizes a hostname into the name by which orchestrator identifies an instance
+type HostnameResolver interface {
+	Resolve(hostname string) (string, error)
+}
+
+// HostnameUnresolver is optionally implemented by resolvers which are able to map a resolved
+// hostname back to its "virtual" name. found is false when the resolver has no opinion.
+type HostnameUnresolver interface {
+	Unresolve(hostname string) (unresolvedHostname string, found bool, err error)
+}
+
+type noneHostnameResolver struct{}
+
+func (this *noneHostnameResolver) Resolve(hostname string) (string, error) {
+	return hostname, nil
+}
+
+type cnameHostnameResolver struct{}
+
+func (this *cnameHostnameResolver) Resolve(hostname string) (string, error) {
+	return GetCNAME(hostname)
+}
+
+type ipHostnameResolver struct{}
+
+func (this *ipHostnameResolver) Resolve(hostname string) (string, error) {
+	return getHostnameIP(hostname)
+}
+
+// srvHostnameResolver treats the hostname as a SRV record name (e.g. _mysql._tcp.mycluster.example.com)
+// and resolves it into the target of the highest priority record.
+type srvHostnameResolver struct{}
+
+func (this *srvHostnameResolver) Resolve(hostname string) (string, error) {
+	_, addrs, err := net.LookupSRV("", "", hostname)
+	if err != nil {
+		return hostname, err
+	}
+	if len(addrs) == 0 {
+		return hostname, fmt.Errorf("No SRV records found for %s", hostname)
+	}
+	// net.LookupSRV returns records sorted by priority and randomized by weight
+	return strings.TrimRight(addrs[0].Target, "."), nil
+}
+
+// staticHostnameResolver resolves via a JSON file mapping hostname to resolved hostname.
+// The file is read upon first use and re-read via ReloadHostnameResolveStaticMap
+type staticHostnameResolver struct {
+	mutex      sync.RWMutex
+	loaded     bool
+	resolves   map[string]string
+	unresolves map[string]string
+}
+
+func (this *staticHostnameResolver) load() error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	resolves := make(map[string]string)
+	if config.Config.HostnameResolveStaticMapFile != "" {
+		content, err := ioutil.ReadFile(config.Config.HostnameResolveStaticMapFile)
+		if err != nil {
+			return log.Errore(err)
+		}
+		if err := json.Unmarshal(content, &resolves); err != nil {
+			return log.Errorf("Cannot parse HostnameResolveStaticMapFile %s: %+v", config.Config.HostnameResolveStaticMapFile, err)
+		}
+	}
+	this.setMap(resolves)
+	return nil
+}
+
+// setMap assumes the mutex is held
+func (this *staticHostnameResolver) setMap(resolves map[string]string) {
+	unresolves := make(map[string]string)
+	for hostname, resolvedHostname := range resolves {
+		unresolves[resolvedHostname] = hostname
+	}
+	this.resolves = resolves
+	this.unresolves = unresolves
+	this.loaded = true
+}
+
+func (this *staticHostnameResolver) ensureLoaded() error {
+	this.mutex.RLock()
+	loaded := this.loaded
+	this.mutex.RUnlock()
+	if loaded {
+		return nil
+	}
+	return this.load()
+}
+
+func (this *staticHostnameResolver) Resolve(hostname string) (string, error) {
+	if err := this.ensureLoaded(); err != nil {
+		return hostname, err
+	}
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	if resolvedHostname, found := this.resolves[hostname]; found {
+		return resolvedHostname, nil
+	}
+	return hostname, nil
+}
+
+func (this *staticHostnameResolver) Unresolve(hostname string) (string, bool, error) {
+	if err := this.ensureLoaded(); err != nil {
+		return hostname, false, err
+	}
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	if unresolvedHostname, found := this.unresolves[hostname]; found {
+		return unresolvedHostname, true, nil
+	}
+	return hostname, false, nil
+}
+
+// httpHostnameResolver consults an external lookup service. A 200 response body is the result,
+// a 404 response means the service has no opinion on the hostname.
+type httpHostnameResolver struct{}
+
+func (this *httpHostnameResolver) lookup(urlTemplate string, hostname string) (string, bool, error) {
+	lookupURL := strings.Replace(urlTemplate, "{hostname}", url.QueryEscape(hostname), -1)
+	client := &http.Client{Timeout: time.Duration(config.Config.HostnameResolveHTTPTimeoutSeconds) * time.Second}
+	response, err := client.Get(lookupURL)
+	if err != nil {
+		return hostname, false, err
+	}
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return hostname, false, err
+	}
+	switch response.StatusCode {
+	case http.StatusOK:
+		result := strings.TrimSpace(string(body))
+		if result == "" {
+			return hostname, false, fmt.Errorf("Empty response from %s", lookupURL)
+		}
+		return result, true, nil
+	case http.StatusNotFound:
+		return hostname, false, nil
+	}
+	return hostname, false, fmt.Errorf("Unexpected status %d from %s", response.StatusCode, lookupURL)
+}
+
+func (this *httpHostnameResolver) Resolve(hostname string) (string, error) {
+	if config.Config.HostnameResolveHTTPURL == "" {
+		return hostname, fmt.Errorf("HostnameResolveHTTPURL is not configured")
+	}
+	resolvedHostname, _, err := this.lookup(config.Config.HostnameResolveHTTPURL, hostname)
+	return resolvedHostname, err
+}
+
+func (this *httpHostnameResolver) Unresolve(hostname string) (string, bool, error) {
+	if config.Config.HostnameUnresolveHTTPURL == "" {
+		return hostname, false, nil
+	}
+	return this.lookup(config.Config.HostnameUnresolveHTTPURL, hostname)
+}
+
+var staticResolver = &staticHostnameResolver{}
+
+var hostnameResolvers = map[string]HostnameResolver{
+	"none":    &noneHostnameResolver{},
+	"default": &noneHostnameResolver{},
+	"cname":   &cnameHostnameResolver{},
+	"ip":      &ipHostnameResolver{},
+	"srv":     &srvHostnameResolver{},
+	"static":  staticResolver,
+	"http":    &httpHostnameResolver{},
+}
+
+// hostnameResolveMethod returns the resolve method applying to given hostname: the first
+// (in lexical order) matching pattern in HostnameResolveMethodsByPattern, or else HostnameResolveMethod
+func hostnameResolveMethod(hostname string) string {
+	for _, pattern := range config.Config.HostnameResolvePatterns() {
+		if pattern.Regexp.MatchString(hostname) {
+			return pattern.Method
+		}
+	}
+	return strings.ToLower(config.Config.HostnameResolveMethod)
+}
+
+// hostnameUnresolvers returns the configured resolvers able to unresolve: that of given hostname first,
+// then those of HostnameResolveMethodsByPattern and HostnameResolveMethod
+func hostnameUnresolvers(hostname string) (unresolvers []HostnameUnresolver) {
+	methods := []string{hostnameResolveMethod(hostname)}
+	for _, pattern := range config.Config.HostnameResolvePatterns() {
+		methods = append(methods, pattern.Method)
+	}
+	methods = append(methods, strings.ToLower(config.Config.HostnameResolveMethod))
+
+	listed := map[HostnameResolver]bool{}
+	for _, method := range methods {
+		resolver, ok := hostnameResolvers[method]
+		if !ok || listed[resolver] {
+			continue
+		}
+		listed[resolver] = true
+		if unresolver, ok := resolver.(HostnameUnresolver); ok {
+			unresolvers = append(unresolvers, unresolver)
+		}
+	}
+	return unresolvers
+}
+
+// GetHostnameResolver returns the resolver applying to given hostname
+func GetHostnameResolver(hostname string) HostnameResolver {
+	method := hostnameResolveMethod(hostname)
+	if resolver, ok := hostnameResolvers[method]; ok {
+		return resolver
+	}
+	log.Warningf("Unknown hostname resolve method: %s; not resolving %s", method, hostname)
+	return hostnameResolvers["none"]
+}
+
+// ReloadHostnameResolveStaticMap re-reads HostnameResolveStaticMapFile. Cached resolves of
+// hostnames whose mapping is added, removed or changed are evicted.
+func ReloadHostnameResolveStaticMap() error {
+	staticResolver.mutex.RLock()
+	wasLoaded := staticResolver.loaded
+	previousResolves := staticResolver.resolves
+	staticResolver.mutex.RUnlock()
+
+	if !wasLoaded && config.Config.HostnameResolveStaticMapFile == "" {
+		return nil
+	}
+	if err := staticResolver.load(); err != nil {
+		return err
+	}
+
+	staticResolver.mutex.RLock()
+	defer staticResolver.mutex.RUnlock()
+	for hostname, resolvedHostname := range previousResolves {
+		if staticResolver.resolves[hostname] != resolvedHostname {
+			getHostnameResolvesLightweightCache().Delete(hostname)
+		}
+	}
+	for hostname := range staticResolver.resolves {
+		if _, found := previousResolves[hostname]; !found {
+			getHostnameResolvesLightweightCache().Delete(hostname)
+		}
+	}
+	log.Infof("Reloaded hostname resolve static map: %d entries", len(staticResolver.resolves))
+	return nil
+}
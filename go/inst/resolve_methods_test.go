@@ -0,0 +1,106 @@
+package inst
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/github/orchestrator/go/config"
+	test "github.com/openark/golib/tests"
+)
+
+func TestHostnameResolveMethod(t *testing.T) {
+	defer func(method string, patterns map[string]string) {
+		config.Config.HostnameResolveMethod = method
+		config.Config.SetHostnameResolveMethodsByPattern(patterns)
+	}(config.Config.HostnameResolveMethod, config.Config.HostnameResolveMethodsByPattern)
+
+	config.Config.HostnameResolveMethod = "default"
+	test.S(t).ExpectNil(config.Config.SetHostnameResolveMethodsByPattern(map[string]string{
+		"^_mysql[.]_tcp[.]": "srv",
+		"[.]static[.]":      "Static",
+	}))
+	test.S(t).ExpectEquals(hostnameResolveMethod("db1.example.com"), "default")
+	test.S(t).ExpectEquals(hostnameResolveMethod("_mysql._tcp.cluster1.example.com"), "srv")
+	test.S(t).ExpectEquals(hostnameResolveMethod("db1.static.example.com"), "static")
+	test.S(t).ExpectTrue(GetHostnameResolver("db1.static.example.com") == staticResolver)
+	test.S(t).ExpectFalse(HostnameResolveMethodIsNone())
+
+	test.S(t).ExpectNotNil(config.Config.SetHostnameResolveMethodsByPattern(map[string]string{"(": "srv"}))
+	config.Config.SetHostnameResolveMethodsByPattern(map[string]string{".": "no-such-method"})
+	resolvedHostname, err := GetHostnameResolver("db1.example.com").Resolve("db1.example.com")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(resolvedHostname, "db1.example.com")
+}
+
+func TestStaticHostnameResolver(t *testing.T) {
+	defer func(mapFile string) {
+		config.Config.HostnameResolveStaticMapFile = mapFile
+		staticResolver.loaded = false
+	}(config.Config.HostnameResolveStaticMapFile)
+
+	mapFile, err := ioutil.TempFile("", "orchestrator-resolve-map")
+	test.S(t).ExpectNil(err)
+	defer os.Remove(mapFile.Name())
+	ioutil.WriteFile(mapFile.Name(), []byte(`{"db1-vip": "db1.example.com"}`), 0644)
+	config.Config.HostnameResolveStaticMapFile = mapFile.Name()
+	staticResolver.loaded = false
+
+	resolvedHostname, err := staticResolver.Resolve("db1-vip")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(resolvedHostname, "db1.example.com")
+
+	resolvedHostname, err = staticResolver.Resolve("db2-vip")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(resolvedHostname, "db2-vip")
+
+	unresolvedHostname, found, err := staticResolver.Unresolve("db1.example.com")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectTrue(found)
+	test.S(t).ExpectEquals(unresolvedHostname, "db1-vip")
+
+	ioutil.WriteFile(mapFile.Name(), []byte(`{"db1-vip": "db1b.example.com"}`), 0644)
+	err = ReloadHostnameResolveStaticMap()
+	test.S(t).ExpectNil(err)
+	resolvedHostname, err = staticResolver.Resolve("db1-vip")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(resolvedHostname, "db1b.example.com")
+
+	_, found, err = staticResolver.Unresolve("db1.example.com")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectFalse(found)
+}
+
+func TestUnresolveHostnameByPattern(t *testing.T) {
+	defer func(method string, patterns map[string]string, mapFile string) {
+		config.Config.HostnameResolveMethod = method
+		config.Config.SetHostnameResolveMethodsByPattern(patterns)
+		config.Config.HostnameResolveStaticMapFile = mapFile
+		staticResolver.loaded = false
+	}(config.Config.HostnameResolveMethod, config.Config.HostnameResolveMethodsByPattern, config.Config.HostnameResolveStaticMapFile)
+
+	mapFile, err := ioutil.TempFile("", "orchestrator-resolve-map")
+	test.S(t).ExpectNil(err)
+	defer os.Remove(mapFile.Name())
+	ioutil.WriteFile(mapFile.Name(), []byte(`{"db1-vip": "db1.example.com", "db2-primary": "db2.example.com"}`), 0644)
+	config.Config.HostnameResolveStaticMapFile = mapFile.Name()
+	staticResolver.loaded = false
+
+	config.Config.HostnameResolveMethod = "default"
+	config.Config.SetHostnameResolveMethodsByPattern(map[string]string{"-vip$": "static"})
+
+	// The resolved hostname does not match the pattern; the virtual one does
+	unresolvedHostname, err := unresolveHostname("db1.example.com")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(unresolvedHostname, "db1-vip")
+	test.S(t).ExpectEquals(len(hostnameUnresolvers("db1.example.com")), 1)
+
+	// Unresolves to a hostname which static does not resolve: does not count
+	for _, unresolver := range hostnameUnresolvers("db2.example.com") {
+		unresolvedHostname, found, err := unresolver.Unresolve("db2.example.com")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectTrue(found)
+		test.S(t).ExpectEquals(unresolvedHostname, "db2-primary")
+		test.S(t).ExpectFalse(GetHostnameResolver(unresolvedHostname) == unresolver.(HostnameResolver))
+	}
+}
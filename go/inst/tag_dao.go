@@ -149,6 +149,36 @@ func ReadInstanceTags(instanceKey *InstanceKey) (tags [](*Tag), err error) {
 	return tags, log.Errore(err)
 }
 
+// ReadClusterInstanceTags reads the tags of all instances of given cluster, by instance
+func ReadClusterInstanceTags(clusterName string) (tagsMap map[InstanceKey][](*Tag), err error) {
+	tagsMap = make(map[InstanceKey][](*Tag))
+	query := `
+		select
+			database_instance_tags.hostname,
+			database_instance_tags.port,
+			database_instance_tags.tag_name,
+			database_instance_tags.tag_value
+		from
+			database_instance_tags
+			join database_instance using (hostname, port)
+		where
+			database_instance.cluster_name = ?
+		order by
+			database_instance_tags.hostname, database_instance_tags.port, database_instance_tags.tag_name
+			`
+	err = db.QueryOrchestrator(query, sqlutils.Args(clusterName), func(m sqlutils.RowMap) error {
+		instanceKey := InstanceKey{Hostname: m.GetString("hostname"), Port: m.GetInt("port")}
+		tag := &Tag{
+			TagName:  m.GetString("tag_name"),
+			TagValue: m.GetString("tag_value"),
+		}
+		tagsMap[instanceKey] = append(tagsMap[instanceKey], tag)
+		return nil
+	})
+
+	return tagsMap, log.Errore(err)
+}
+
 func GetInstanceKeysByTag(tag *Tag) (tagged *InstanceKeyMap, err error) {
 	if tag == nil {
 		return nil, log.Errorf("GetInstanceKeysByTag: tag is nil")
@@ -0,0 +1,244 @@
+/*
+   Copyright 2019 GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Operations a topology plan is made of
+const (
+	TopologyPlanMoveUp    = "move-up"
+	TopologyPlanMoveBelow = "move-below"
+	TopologyPlanRelocate  = "relocate"
+)
+
+// States of a topology plan and of its steps
+const (
+	TopologyPlanStatePending   = "pending"
+	TopologyPlanStateRunning   = "running"
+	TopologyPlanStateCompleted = "completed"
+	TopologyPlanStateFailed    = "failed"
+	TopologyPlanStateSkipped   = "skipped"
+)
+
+// DesiredTopology maps replicas onto their desired masters. Replicas not listed remain
+// below their current masters (and follow them if those are moved).
+type DesiredTopology map[InstanceKey]InstanceKey
+
+// ParseDesiredTopology reads a desired topology either as a JSON object of "replica": "master"
+// entries, or as a comma/whitespace delimited list of "replica>master" entries.
+func ParseDesiredTopology(text string) (DesiredTopology, error) {
+	text = strings.TrimSpace(text)
+	entries := make(map[string]string)
+	if strings.HasPrefix(text, "{") {
+		if err := json.Unmarshal([]byte(text), &entries); err != nil {
+			return nil, fmt.Errorf("Cannot parse desired topology: %+v", err)
+		}
+	} else {
+		for _, token := range strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r' }) {
+			tokens := strings.Split(token, ">")
+			if len(tokens) != 2 {
+				return nil, fmt.Errorf("Cannot parse desired topology entry: %s. Expected replica>master", token)
+			}
+			entries[tokens[0]] = tokens[1]
+		}
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("Desired topology is empty")
+	}
+	desired := make(DesiredTopology)
+	for replica, master := range entries {
+		replicaKey, err := ParseResolveInstanceKey(replica)
+		if err != nil {
+			return nil, err
+		}
+		masterKey, err := ParseResolveInstanceKey(master)
+		if err != nil {
+			return nil, err
+		}
+		desired[*replicaKey] = *masterKey
+	}
+	return desired, nil
+}
+
+// String returns the canonical, sorted, "replica>master" representation of this topology
+func (this DesiredTopology) String() string {
+	entries := []string{}
+	for replicaKey, masterKey := range this {
+		entries = append(entries, fmt.Sprintf("%s>%s", replicaKey.StringCode(), masterKey.StringCode()))
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, ",")
+}
+
+// TopologyPlanStep is a single operation in a topology plan: moving an instance below a target
+type TopologyPlanStep struct {
+	StepIndex   int
+	Operation   string
+	Key         InstanceKey
+	TargetKey   InstanceKey
+	State       string
+	StartedAt   string
+	CompletedAt string
+	Message     string
+}
+
+// TopologyPlan is an ordered list of operations reshaping a cluster into a desired topology
+type TopologyPlan struct {
+	PlanId          int64
+	ClusterName     string
+	DesiredTopology string
+	State           string
+	CreatedAt       string
+	UpdatedAt       string
+	LastError       string
+	Steps           [](*TopologyPlanStep)
+}
+
+// ComputeTopologyPlan computes the plan reshaping given cluster into the desired topology,
+// based on the current, known, topology.
+func ComputeTopologyPlan(clusterName string, desired DesiredTopology) (*TopologyPlan, error) {
+	instances, err := ReadClusterInstances(clusterName)
+	if err != nil {
+		return nil, err
+	}
+	if len(instances) == 0 {
+		return nil, fmt.Errorf("No instances found for cluster %s", clusterName)
+	}
+	plan, err := computeTopologyPlan(instances, desired)
+	if err != nil {
+		return nil, err
+	}
+	plan.ClusterName = clusterName
+	return plan, nil
+}
+
+// computeTopologyPlan computes the minimal ordered list of operations reshaping given instances into
+// the desired topology. Only instances whose master changes are moved. Instances are moved in order
+// of their depth in the desired topology, so that an instance is never moved below its own descendant.
+func computeTopologyPlan(instances [](*Instance), desired DesiredTopology) (*TopologyPlan, error) {
+	instancesMap := make(map[InstanceKey]*Instance)
+	for _, instance := range instances {
+		instancesMap[instance.Key] = instance
+	}
+	currentMasters := make(map[InstanceKey]InstanceKey)
+	var clusterMasterKey *InstanceKey
+	for _, instance := range instances {
+		if _, found := instancesMap[instance.MasterKey]; found {
+			currentMasters[instance.Key] = instance.MasterKey
+			continue
+		}
+		if clusterMasterKey != nil {
+			return nil, fmt.Errorf("Cannot determine cluster master: both %+v and %+v qualify", clusterMasterKey.StringCode(), instance.Key.StringCode())
+		}
+		clusterMasterKey = &instance.Key
+	}
+	if clusterMasterKey == nil {
+		return nil, fmt.Errorf("Cannot determine cluster master. Co-master topologies are not supported")
+	}
+
+	desiredMasters := make(map[InstanceKey]InstanceKey)
+	for replicaKey, masterKey := range currentMasters {
+		desiredMasters[replicaKey] = masterKey
+	}
+	for replicaKey, masterKey := range desired {
+		if replicaKey.Equals(clusterMasterKey) {
+			return nil, fmt.Errorf("Cannot change the master of %+v: it is the cluster master. Use graceful-master-takeover", replicaKey.StringCode())
+		}
+		if _, found := instancesMap[replicaKey]; !found {
+			return nil, fmt.Errorf("%+v is not a known member of the cluster", replicaKey.StringCode())
+		}
+		master, found := instancesMap[masterKey]
+		if !found {
+			return nil, fmt.Errorf("%+v is not a known member of the cluster", masterKey.StringCode())
+		}
+		if replicaKey.Equals(&masterKey) {
+			return nil, fmt.Errorf("%+v cannot replicate from itself", replicaKey.StringCode())
+		}
+		if !master.IsBinlogServer() {
+			if !master.LogBinEnabled {
+				return nil, fmt.Errorf("%+v cannot act as master: binary logs are not enabled", masterKey.StringCode())
+			}
+			if !masterKey.Equals(clusterMasterKey) && !master.LogSlaveUpdatesEnabled {
+				return nil, fmt.Errorf("%+v cannot act as intermediate master: log_slave_updates is not enabled", masterKey.StringCode())
+			}
+		}
+		desiredMasters[replicaKey] = masterKey
+	}
+
+	desiredDepth := func(instanceKey InstanceKey) (depth int, err error) {
+		for key := instanceKey; !key.Equals(clusterMasterKey); key = desiredMasters[key] {
+			depth++
+			if depth > len(instances) {
+				return depth, fmt.Errorf("Desired topology has a cycle through %+v", instanceKey.StringCode())
+			}
+		}
+		return depth, nil
+	}
+	depths := make(map[InstanceKey]int)
+	movedKeys := []InstanceKey{}
+	for replicaKey, masterKey := range desiredMasters {
+		depth, err := desiredDepth(replicaKey)
+		if err != nil {
+			return nil, err
+		}
+		depths[replicaKey] = depth
+		if currentMasterKey := currentMasters[replicaKey]; !masterKey.Equals(&currentMasterKey) {
+			movedKeys = append(movedKeys, replicaKey)
+		}
+	}
+	sort.Slice(movedKeys, func(i, j int) bool {
+		if depths[movedKeys[i]] != depths[movedKeys[j]] {
+			return depths[movedKeys[i]] < depths[movedKeys[j]]
+		}
+		return movedKeys[i].StringCode() < movedKeys[j].StringCode()
+	})
+
+	// Simulate the plan, so as to pick the simplest operation given the topology at time of each step
+	simulatedMasters := make(map[InstanceKey]InstanceKey)
+	for replicaKey, masterKey := range currentMasters {
+		simulatedMasters[replicaKey] = masterKey
+	}
+	plan := &TopologyPlan{
+		DesiredTopology: desired.String(),
+		State:           TopologyPlanStatePending,
+		Steps:           [](*TopologyPlanStep){},
+	}
+	for i, replicaKey := range movedKeys {
+		targetKey := desiredMasters[replicaKey]
+		step := &TopologyPlanStep{
+			StepIndex: i,
+			Operation: TopologyPlanRelocate,
+			Key:       replicaKey,
+			TargetKey: targetKey,
+			State:     TopologyPlanStatePending,
+		}
+		currentMasterKey := simulatedMasters[replicaKey]
+		if grandMasterKey, found := simulatedMasters[currentMasterKey]; found && grandMasterKey.Equals(&targetKey) {
+			step.Operation = TopologyPlanMoveUp
+		} else if targetMasterKey, found := simulatedMasters[targetKey]; found && targetMasterKey.Equals(&currentMasterKey) {
+			step.Operation = TopologyPlanMoveBelow
+		}
+		simulatedMasters[replicaKey] = targetKey
+		plan.Steps = append(plan.Steps, step)
+	}
+	return plan, nil
+}
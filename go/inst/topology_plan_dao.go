@@ -0,0 +1,465 @@
+/*
+   Copyright 2019 GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/db"
+	"github.com/github/orchestrator/go/process"
+	"github.com/github/orchestrator/go/raft"
+	"github.com/github/orchestrator/go/util"
+	"github.com/openark/golib/log"
+	"github.com/openark/golib/sqlutils"
+)
+
+// A running plan not updated for this long is assumed to have been abandoned (e.g. orchestrator
+// restarted mid-plan) and may be resumed
+const topologyPlanStaleMinutes = 10
+
+// A running plan is heartbeated at this interval while a step runs, such that it is not taken as stale
+const topologyPlanHeartbeatInterval = time.Minute
+
+// writeTopologyPlan persists a plan along with its steps, unless already persisted. A new plan
+// is assigned its PlanId.
+func writeTopologyPlan(plan *TopologyPlan) error {
+	sqlResult, err := db.ExecOrchestrator(`
+			insert ignore into topology_plan (
+				plan_id, cluster_name, desired_topology, plan_state, created_at, updated_at,
+				processing_node_hostname, processing_node_token, last_error
+			) values (
+				?, ?, ?, ?, NOW(), NOW(),
+				?, ?, ''
+			)
+		`, sqlutils.NilIfZero(plan.PlanId), plan.ClusterName, plan.DesiredTopology, plan.State,
+		process.ThisHostname, util.ProcessToken.Hash,
+	)
+	if err != nil {
+		return log.Errore(err)
+	}
+	if plan.PlanId == 0 {
+		if plan.PlanId, err = sqlResult.LastInsertId(); err != nil {
+			return log.Errore(err)
+		}
+	}
+	for _, step := range plan.Steps {
+		_, err := db.ExecOrchestrator(`
+				insert ignore into topology_plan_step (
+					plan_id, step_index, operation, hostname, port, target_hostname, target_port, step_state, message
+				) values (
+					?, ?, ?, ?, ?, ?, ?, ?, ''
+				)
+			`, plan.PlanId, step.StepIndex, step.Operation, step.Key.Hostname, step.Key.Port,
+			step.TargetKey.Hostname, step.TargetKey.Port, step.State,
+		)
+		if err != nil {
+			return log.Errore(err)
+		}
+	}
+	return nil
+}
+
+// beginTopologyPlan marks a plan as running, unless it is already completed or is being run elsewhere.
+// Returns false when the plan may not be run.
+func beginTopologyPlan(planId int64) (bool, error) {
+	sqlResult, err := db.ExecOrchestrator(`
+			update topology_plan set
+				plan_state = ?,
+				updated_at = NOW(),
+				processing_node_hostname = ?,
+				processing_node_token = ?
+			where
+				plan_id = ?
+				and (
+					plan_state in (?, ?)
+					or (plan_state = ? and updated_at < NOW() - INTERVAL ? MINUTE)
+				)
+		`, TopologyPlanStateRunning, process.ThisHostname, util.ProcessToken.Hash,
+		planId,
+		TopologyPlanStatePending, TopologyPlanStateFailed,
+		TopologyPlanStateRunning, topologyPlanStaleMinutes,
+	)
+	if err != nil {
+		return false, log.Errore(err)
+	}
+	rows, err := sqlResult.RowsAffected()
+	return rows > 0, log.Errore(err)
+}
+
+// endTopologyPlan records the final state of a plan run
+func endTopologyPlan(planId int64, state string, lastError string) error {
+	_, err := db.ExecOrchestrator(`
+			update topology_plan set
+				plan_state = ?,
+				updated_at = NOW(),
+				last_error = ?
+			where
+				plan_id = ?
+		`, state, lastError, planId,
+	)
+	return log.Errore(err)
+}
+
+// writeTopologyPlanStepState checkpoints a step
+func writeTopologyPlanStepState(planId int64, step *TopologyPlanStep) error {
+	_, err := db.ExecOrchestrator(`
+			update topology_plan_step set
+				step_state = ?,
+				started_at = case when ? = ? then NOW() else started_at end,
+				completed_at = case when ? in (?, ?) then NOW() else completed_at end,
+				message = ?
+			where
+				plan_id = ?
+				and step_index = ?
+		`, step.State,
+		step.State, TopologyPlanStateRunning,
+		step.State, TopologyPlanStateCompleted, TopologyPlanStateSkipped,
+		step.Message,
+		planId, step.StepIndex,
+	)
+	if err != nil {
+		return log.Errore(err)
+	}
+	return touchTopologyPlan(planId)
+}
+
+// touchTopologyPlan marks a plan as updated, keeping a running plan from being taken as stale
+func touchTopologyPlan(planId int64) error {
+	_, err := db.ExecOrchestrator(`update topology_plan set updated_at = NOW() where plan_id = ?`, planId)
+	return log.Errore(err)
+}
+
+// WriteTopologyPlanState persists a plan published via raft: the plan and its steps are created
+// if needed, and their states updated.
+func WriteTopologyPlanState(plan *TopologyPlan) error {
+	if err := writeTopologyPlan(plan); err != nil {
+		return err
+	}
+	if err := endTopologyPlan(plan.PlanId, plan.State, plan.LastError); err != nil {
+		return err
+	}
+	for _, step := range plan.Steps {
+		if err := writeTopologyPlanStepState(plan.PlanId, step); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TouchTopologyPlan persists a plan heartbeat published via raft
+func TouchTopologyPlan(planId int64) error {
+	return touchTopologyPlan(planId)
+}
+
+// publishTopologyPlan replicates the plan's state, along with its steps' states, via raft.
+// Plans are executed by the leader, which persists their state locally.
+func publishTopologyPlan(plan *TopologyPlan) {
+	if orcraft.IsRaftEnabled() {
+		if _, err := orcraft.PublishCommand("write-topology-plan", plan); err != nil {
+			log.Errore(err)
+		}
+	}
+}
+
+// heartbeatTopologyPlan touches a running plan every topologyPlanHeartbeatInterval, until the
+// returned function is called.
+func heartbeatTopologyPlan(planId int64) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(topologyPlanHeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				touchTopologyPlan(planId)
+				if orcraft.IsRaftEnabled() {
+					if _, err := orcraft.PublishCommand("touch-topology-plan", planId); err != nil {
+						log.Errore(err)
+					}
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+func readTopologyPlans(whereCondition string, args []interface{}) (plans [](*TopologyPlan), err error) {
+	query := fmt.Sprintf(`
+		select
+			plan_id,
+			cluster_name,
+			desired_topology,
+			plan_state,
+			created_at,
+			updated_at,
+			last_error
+		from
+			topology_plan
+		%s
+		order by
+			plan_id desc
+		limit 100
+		`, whereCondition)
+	err = db.QueryOrchestrator(query, args, func(m sqlutils.RowMap) error {
+		plan := &TopologyPlan{
+			PlanId:          m.GetInt64("plan_id"),
+			ClusterName:     m.GetString("cluster_name"),
+			DesiredTopology: m.GetString("desired_topology"),
+			State:           m.GetString("plan_state"),
+			CreatedAt:       m.GetString("created_at"),
+			UpdatedAt:       m.GetString("updated_at"),
+			LastError:       m.GetString("last_error"),
+			Steps:           [](*TopologyPlanStep){},
+		}
+		plans = append(plans, plan)
+		return nil
+	})
+	if err != nil {
+		return plans, log.Errore(err)
+	}
+	for _, plan := range plans {
+		if err := readTopologyPlanSteps(plan); err != nil {
+			return plans, err
+		}
+	}
+	return plans, nil
+}
+
+func readTopologyPlanSteps(plan *TopologyPlan) error {
+	query := `
+		select
+			step_index,
+			operation,
+			hostname,
+			port,
+			target_hostname,
+			target_port,
+			step_state,
+			ifnull(started_at, '') as started_at,
+			ifnull(completed_at, '') as completed_at,
+			message
+		from
+			topology_plan_step
+		where
+			plan_id = ?
+		order by
+			step_index asc
+		`
+	err := db.QueryOrchestrator(query, sqlutils.Args(plan.PlanId), func(m sqlutils.RowMap) error {
+		step := &TopologyPlanStep{
+			StepIndex:   m.GetInt("step_index"),
+			Operation:   m.GetString("operation"),
+			Key:         InstanceKey{Hostname: m.GetString("hostname"), Port: m.GetInt("port")},
+			TargetKey:   InstanceKey{Hostname: m.GetString("target_hostname"), Port: m.GetInt("target_port")},
+			State:       m.GetString("step_state"),
+			StartedAt:   m.GetString("started_at"),
+			CompletedAt: m.GetString("completed_at"),
+			Message:     m.GetString("message"),
+		}
+		plan.Steps = append(plan.Steps, step)
+		return nil
+	})
+	return log.Errore(err)
+}
+
+// ReadTopologyPlan returns a plan with its steps
+func ReadTopologyPlan(planId int64) (*TopologyPlan, error) {
+	plans, err := readTopologyPlans(`where plan_id = ?`, sqlutils.Args(planId))
+	if err != nil {
+		return nil, err
+	}
+	if len(plans) == 0 {
+		return nil, fmt.Errorf("Topology plan %d not found", planId)
+	}
+	return plans[0], nil
+}
+
+// ReadClusterTopologyPlans returns the most recent plans of a cluster, latest first
+func ReadClusterTopologyPlans(clusterName string) ([](*TopologyPlan), error) {
+	return readTopologyPlans(`where cluster_name = ?`, sqlutils.Args(clusterName))
+}
+
+// ReadLatestUnfinishedTopologyPlan returns the latest plan of given cluster which did not complete, or nil
+func ReadLatestUnfinishedTopologyPlan(clusterName string) (*TopologyPlan, error) {
+	plans, err := readTopologyPlans(`where cluster_name = ? and plan_state != ?`, sqlutils.Args(clusterName, TopologyPlanStateCompleted))
+	if err != nil || len(plans) == 0 {
+		return nil, err
+	}
+	return plans[0], nil
+}
+
+// revalidateTopologyPlanOperation returns the operation to run for given step against the current topology.
+// A plan may be resumed long after it was computed: a move-up or move-below no longer applicable, e.g. as the
+// instance's master has since moved, is replaced by a relocation.
+func revalidateTopologyPlanOperation(step *TopologyPlanStep, instance *Instance, master *Instance, target *Instance) string {
+	switch step.Operation {
+	case TopologyPlanMoveUp:
+		if master == nil || !master.Key.Equals(&instance.MasterKey) || !master.MasterKey.Equals(&step.TargetKey) {
+			return TopologyPlanRelocate
+		}
+	case TopologyPlanMoveBelow:
+		if target == nil || !target.Key.Equals(&step.TargetKey) || !target.MasterKey.Equals(&instance.MasterKey) {
+			return TopologyPlanRelocate
+		}
+	}
+	return step.Operation
+}
+
+// executeTopologyPlanStep runs the step's operation, unless the instance is already in place. The operation
+// is revalidated against the current topology, and the instance verified to have ended up below the target.
+func executeTopologyPlanStep(step *TopologyPlanStep) (skipped bool, err error) {
+	instance, err := ReadTopologyInstance(&step.Key)
+	if err != nil {
+		return false, err
+	}
+	if instance.MasterKey.Equals(&step.TargetKey) {
+		return true, nil
+	}
+	var master, target *Instance
+	switch step.Operation {
+	case TopologyPlanMoveUp:
+		master, _ = ReadTopologyInstance(&instance.MasterKey)
+	case TopologyPlanMoveBelow:
+		target, _ = ReadTopologyInstance(&step.TargetKey)
+	}
+	operation := revalidateTopologyPlanOperation(step, instance, master, target)
+	if operation != step.Operation {
+		step.Message = fmt.Sprintf("%s no longer applicable; relocating", step.Operation)
+		log.Infof("Topology plan step %d: %s %+v below %+v %s", step.StepIndex, step.Operation, step.Key, step.TargetKey, step.Message)
+	}
+	switch operation {
+	case TopologyPlanMoveUp:
+		_, err = MoveUp(&step.Key)
+	case TopologyPlanMoveBelow:
+		_, err = MoveBelow(&step.Key, &step.TargetKey)
+	case TopologyPlanRelocate:
+		_, err = RelocateBelow(&step.Key, &step.TargetKey)
+	default:
+		err = fmt.Errorf("Unknown topology plan operation: %s", step.Operation)
+	}
+	if err != nil {
+		return false, err
+	}
+	if instance, err = ReadTopologyInstance(&step.Key); err != nil {
+		return false, err
+	}
+	if !instance.MasterKey.Equals(&step.TargetKey) {
+		return false, fmt.Errorf("%+v replicates from %+v rather than from %+v following %s", step.Key, instance.MasterKey, step.TargetKey, operation)
+	}
+	return false, nil
+}
+
+// ExecuteTopologyPlan runs a persisted plan's steps in order, checkpointing each step. Steps completed
+// (or skipped) by a previous run are not repeated; a failing step stops the plan, which may then be
+// resumed by executing it again.
+func ExecuteTopologyPlan(planId int64) (*TopologyPlan, error) {
+	if *config.RuntimeCLIFlags.Noop {
+		return nil, fmt.Errorf("noop: aborting topology plan %d execution; signalling error but nothing went wrong.", planId)
+	}
+	plan, err := ReadTopologyPlan(planId)
+	if err != nil {
+		return nil, err
+	}
+	began, err := beginTopologyPlan(planId)
+	if err != nil {
+		return plan, err
+	}
+	if !began {
+		return plan, fmt.Errorf("Topology plan %d cannot be executed: it is %s", planId, plan.State)
+	}
+	plan.State = TopologyPlanStateRunning
+	publishTopologyPlan(plan)
+	AuditOperation("topology-plan", nil, fmt.Sprintf("Executing topology plan %d on cluster %s: %s", plan.PlanId, plan.ClusterName, plan.DesiredTopology))
+
+	for _, step := range plan.Steps {
+		if step.State == TopologyPlanStateCompleted || step.State == TopologyPlanStateSkipped {
+			continue
+		}
+		step.State = TopologyPlanStateRunning
+		step.Message = ""
+		if err := writeTopologyPlanStepState(planId, step); err != nil {
+			return plan, err
+		}
+		publishTopologyPlan(plan)
+		stopHeartbeat := heartbeatTopologyPlan(planId)
+		skipped, err := executeTopologyPlanStep(step)
+		stopHeartbeat()
+		switch {
+		case err != nil:
+			step.State = TopologyPlanStateFailed
+			step.Message = err.Error()
+		case skipped:
+			step.State = TopologyPlanStateSkipped
+			step.Message = "already in place"
+		default:
+			step.State = TopologyPlanStateCompleted
+		}
+		log.Errore(writeTopologyPlanStepState(planId, step))
+		if err != nil {
+			plan.State = TopologyPlanStateFailed
+			plan.LastError = fmt.Sprintf("step %d: %s %+v below %+v: %+v", step.StepIndex, step.Operation, step.Key.StringCode(), step.TargetKey.StringCode(), err)
+			log.Errore(endTopologyPlan(planId, plan.State, plan.LastError))
+			publishTopologyPlan(plan)
+			AuditOperation("topology-plan", &step.Key, fmt.Sprintf("Topology plan %d failed: %s", plan.PlanId, plan.LastError))
+			return plan, log.Errorf("Topology plan %d failed: %s", plan.PlanId, plan.LastError)
+		}
+		publishTopologyPlan(plan)
+		AuditOperation("topology-plan", &step.Key, fmt.Sprintf("Topology plan %d step %d: %s below %+v: %s", plan.PlanId, step.StepIndex, step.Operation, step.TargetKey.StringCode(), step.State))
+	}
+	plan.State = TopologyPlanStateCompleted
+	plan.LastError = ""
+	if err := endTopologyPlan(planId, plan.State, plan.LastError); err != nil {
+		return plan, err
+	}
+	publishTopologyPlan(plan)
+	AuditOperation("topology-plan", nil, fmt.Sprintf("Topology plan %d on cluster %s completed", plan.PlanId, plan.ClusterName))
+	return plan, nil
+}
+
+// ApplyTopology computes, persists and executes a plan reshaping given cluster into the desired topology
+func ApplyTopology(clusterName string, desired DesiredTopology) (*TopologyPlan, error) {
+	plan, err := ComputeTopologyPlan(clusterName, desired)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeTopologyPlan(plan); err != nil {
+		return plan, err
+	}
+	publishTopologyPlan(plan)
+	return ExecuteTopologyPlan(plan.PlanId)
+}
+
+// ResumeTopologyPlan resumes the latest unfinished plan of given cluster
+func ResumeTopologyPlan(clusterName string) (*TopologyPlan, error) {
+	plan, err := ReadLatestUnfinishedTopologyPlan(clusterName)
+	if err != nil {
+		return nil, err
+	}
+	if plan == nil {
+		return nil, fmt.Errorf("No unfinished topology plan found for cluster %s", clusterName)
+	}
+	return ExecuteTopologyPlan(plan.PlanId)
+}
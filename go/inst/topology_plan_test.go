@@ -0,0 +1,137 @@
+package inst
+
+import (
+	"testing"
+
+	test "github.com/openark/golib/tests"
+)
+
+var (
+	planMasterKey = InstanceKey{Hostname: "m", Port: 3306}
+	planR1Key     = InstanceKey{Hostname: "r1", Port: 3306}
+	planR2Key     = InstanceKey{Hostname: "r2", Port: 3306}
+	planR3Key     = InstanceKey{Hostname: "r3", Port: 3306}
+	planR4Key     = InstanceKey{Hostname: "r4", Port: 3306}
+	planR5Key     = InstanceKey{Hostname: "r5", Port: 3306}
+)
+
+// generateTopologyPlanTestInstances creates the topology:
+//
+//	m
+//	+ r1
+//	  + r4
+//	    + r5
+//	+ r2
+//	+ r3
+func generateTopologyPlanTestInstances() [](*Instance) {
+	instances := [](*Instance){}
+	for _, keys := range [][]InstanceKey{
+		{planMasterKey, {}},
+		{planR1Key, planMasterKey},
+		{planR2Key, planMasterKey},
+		{planR3Key, planMasterKey},
+		{planR4Key, planR1Key},
+		{planR5Key, planR4Key},
+	} {
+		instance := NewInstance()
+		instance.Key = keys[0]
+		instance.MasterKey = keys[1]
+		instance.LogBinEnabled = true
+		instance.LogSlaveUpdatesEnabled = true
+		instances = append(instances, instance)
+	}
+	return instances
+}
+
+func TestParseDesiredTopology(t *testing.T) {
+	desired, err := ParseDesiredTopology("r2:3306>r1:3306, r3>r4:3306")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(desired), 2)
+	test.S(t).ExpectEquals(desired[planR2Key], planR1Key)
+	test.S(t).ExpectEquals(desired.String(), "r2:3306>r1:3306,r3:3306>r4:3306")
+
+	desired, err = ParseDesiredTopology(`{"r2:3306": "r1:3306"}`)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(desired[planR2Key], planR1Key)
+
+	_, err = ParseDesiredTopology("r2:3306")
+	test.S(t).ExpectNotNil(err)
+	_, err = ParseDesiredTopology("")
+	test.S(t).ExpectNotNil(err)
+}
+
+func TestComputeTopologyPlan(t *testing.T) {
+	desired := DesiredTopology{
+		planR2Key: planR1Key,
+		planR3Key: planR4Key,
+		planR4Key: planMasterKey,
+		planR5Key: planR2Key,
+	}
+	plan, err := computeTopologyPlan(generateTopologyPlanTestInstances(), desired)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(plan.Steps), 4)
+
+	expectStep := func(step *TopologyPlanStep, operation string, key InstanceKey, targetKey InstanceKey) {
+		test.S(t).ExpectEquals(step.Operation, operation)
+		test.S(t).ExpectEquals(step.Key, key)
+		test.S(t).ExpectEquals(step.TargetKey, targetKey)
+		test.S(t).ExpectEquals(step.State, TopologyPlanStatePending)
+	}
+	expectStep(plan.Steps[0], TopologyPlanMoveUp, planR4Key, planMasterKey)
+	expectStep(plan.Steps[1], TopologyPlanMoveBelow, planR2Key, planR1Key)
+	expectStep(plan.Steps[2], TopologyPlanMoveBelow, planR3Key, planR4Key)
+	expectStep(plan.Steps[3], TopologyPlanRelocate, planR5Key, planR2Key)
+}
+
+func TestComputeTopologyPlanNoop(t *testing.T) {
+	plan, err := computeTopologyPlan(generateTopologyPlanTestInstances(), DesiredTopology{planR4Key: planR1Key})
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(plan.Steps), 0)
+}
+
+func TestComputeTopologyPlanInvalid(t *testing.T) {
+	instances := generateTopologyPlanTestInstances()
+	{
+		_, err := computeTopologyPlan(instances, DesiredTopology{planMasterKey: planR1Key})
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		_, err := computeTopologyPlan(instances, DesiredTopology{planR1Key: planR4Key})
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		_, err := computeTopologyPlan(instances, DesiredTopology{planR1Key: InstanceKey{Hostname: "unknown", Port: 3306}})
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		instances[2].LogSlaveUpdatesEnabled = false
+		_, err := computeTopologyPlan(instances, DesiredTopology{planR3Key: planR2Key})
+		test.S(t).ExpectNotNil(err)
+	}
+}
+
+func TestRevalidateTopologyPlanOperation(t *testing.T) {
+	instances := generateTopologyPlanTestInstances()
+	master, r1, r2, r4, r5 := instances[0], instances[1], instances[2], instances[4], instances[5]
+	{
+		// r4 moves up below m
+		step := &TopologyPlanStep{Operation: TopologyPlanMoveUp, Key: planR4Key, TargetKey: planMasterKey}
+		test.S(t).ExpectEquals(revalidateTopologyPlanOperation(step, r4, r1, nil), TopologyPlanMoveUp)
+		// r5 is two levels below m: move-up no longer applies
+		step = &TopologyPlanStep{Operation: TopologyPlanMoveUp, Key: planR5Key, TargetKey: planMasterKey}
+		test.S(t).ExpectEquals(revalidateTopologyPlanOperation(step, r5, r4, nil), TopologyPlanRelocate)
+		test.S(t).ExpectEquals(revalidateTopologyPlanOperation(step, r5, nil, nil), TopologyPlanRelocate)
+	}
+	{
+		// r2 moves below its sibling r1
+		step := &TopologyPlanStep{Operation: TopologyPlanMoveBelow, Key: planR2Key, TargetKey: planR1Key}
+		test.S(t).ExpectEquals(revalidateTopologyPlanOperation(step, r2, nil, r1), TopologyPlanMoveBelow)
+		// r4 is no sibling of r2
+		step = &TopologyPlanStep{Operation: TopologyPlanMoveBelow, Key: planR2Key, TargetKey: planR4Key}
+		test.S(t).ExpectEquals(revalidateTopologyPlanOperation(step, r2, nil, r4), TopologyPlanRelocate)
+	}
+	{
+		step := &TopologyPlanStep{Operation: TopologyPlanRelocate, Key: planR5Key, TargetKey: planMasterKey}
+		test.S(t).ExpectEquals(revalidateTopologyPlanOperation(step, r5, nil, master), TopologyPlanRelocate)
+	}
+}
@@ -19,6 +19,8 @@ package kv
 import (
 	"fmt"
 	"sync"
+
+	"github.com/github/orchestrator/go/config"
 )
 
 type KVPair struct {
@@ -41,22 +43,47 @@ type KVStore interface {
 }
 
 var kvMutex sync.Mutex
-var kvInitOnce sync.Once
+var kvInitialized = false
 var kvStores = []KVStore{}
 
+func init() {
+	config.SubscribeReload("kv", []string{
+		"ConsulAddress",
+		"ConsulScheme",
+		"ConsulAclToken",
+		"ZkAddress",
+	}, ReloadKVStores)
+}
+
 // InitKVStores initializes the KV stores (duh), once in the lifetime of this app.
-// Configuration reload does not affect a running instance.
+// Stores are re-created on configuration reload, see ReloadKVStores.
 func InitKVStores() {
 	kvMutex.Lock()
 	defer kvMutex.Unlock()
 
-	kvInitOnce.Do(func() {
-		kvStores = []KVStore{
-			NewInternalKVStore(),
-			NewConsulStore(),
-			NewZkStore(),
-		}
-	})
+	if !kvInitialized {
+		kvStores = newKVStores()
+		kvInitialized = true
+	}
+}
+
+// ReloadKVStores re-creates the KV stores with current configuration, if already initialized
+func ReloadKVStores() error {
+	kvMutex.Lock()
+	defer kvMutex.Unlock()
+
+	if kvInitialized {
+		kvStores = newKVStores()
+	}
+	return nil
+}
+
+func newKVStores() []KVStore {
+	return []KVStore{
+		NewInternalKVStore(),
+		NewConsulStore(),
+		NewZkStore(),
+	}
 }
 
 func getKVStores() (stores []KVStore) {
@@ -0,0 +1,327 @@
+/*
+   Copyright 2019 GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/inst"
+)
+
+// DashboardAnalysis is a problem analyzed on an instance, as shown on a cluster dashboard
+type DashboardAnalysis struct {
+	AnalyzedInstanceKey inst.InstanceKey
+	Analysis            inst.AnalysisCode
+	Description         string
+	StructureAnalysis   []inst.StructureAnalysisCode
+	IsDowntimed         bool
+}
+
+// DashboardMaintenance is an active maintenance, as shown on a cluster dashboard
+type DashboardMaintenance struct {
+	Owner          string
+	Reason         string
+	BeginTimestamp string
+}
+
+// DashboardInstance is an instance as shown on a cluster dashboard: its health, replication state,
+// downtime, maintenance, tags, pools, promotion rule and problems, along with its replicas.
+// Ever changing values, such as seconds since last check, are left out, and only the crossing of
+// ReasonableReplicationLagSeconds, not exact lag, changes the dashboard's ETag, such that a dashboard
+// only changes when the cluster does.
+type DashboardInstance struct {
+	Key                         inst.InstanceKey
+	MasterKey                   inst.InstanceKey
+	Version                     string
+	ReadOnly                    bool
+	DataCenter                  string
+	Region                      string
+	PhysicalEnvironment         string
+	IsCoMaster                  bool
+	IsDetachedMaster            bool
+	ReplicationDepth            uint
+	IsLastCheckValid            bool
+	IsUpToDate                  bool
+	IsRecentlyChecked           bool
+	ReplicationSQLThreadRunning bool
+	ReplicationIOThreadRunning  bool
+	LagSeconds                  int64 // -1 when unknown
+	SQLDelay                    uint
+	PromotionRule               inst.CandidatePromotionRule
+	IsDowntimed                 bool
+	DowntimeReason              string
+	DowntimeOwner               string
+	DowntimeEndTimestamp        string
+	Maintenance                 *DashboardMaintenance
+	Tags                        []string
+	Pools                       []string
+	ReplicaPool                 *inst.ReplicaPoolMember // Replica pool membership and traffic weight; nil for masters and co-masters
+	Problems                    []string
+	Analysis                    []DashboardAnalysis
+	Replicas                    [](*DashboardInstance)
+}
+
+// ClusterDashboard is all a dashboard needs to render a cluster, in one read: the topology tree,
+// the analysis of the cluster, and its active and recent recoveries
+type ClusterDashboard struct {
+	ClusterInfo      *inst.ClusterInfo
+	Topology         [](*DashboardInstance) // Roots of the topology tree: normally the master, or co-masters
+	Analysis         []DashboardAnalysis
+	ActiveRecoveries []TopologyRecovery
+	RecentRecoveries []TopologyRecovery
+}
+
+// newDashboardInstance describes an instance for a dashboard, without replicas
+func newDashboardInstance(instance *inst.Instance) *DashboardInstance {
+	dashboardInstance := &DashboardInstance{
+		Key:                         instance.Key,
+		MasterKey:                   instance.MasterKey,
+		Version:                     instance.Version,
+		ReadOnly:                    instance.ReadOnly,
+		DataCenter:                  instance.DataCenter,
+		Region:                      instance.Region,
+		PhysicalEnvironment:         instance.PhysicalEnvironment,
+		IsCoMaster:                  instance.IsCoMaster,
+		IsDetachedMaster:            instance.IsDetachedMaster,
+		ReplicationDepth:            instance.ReplicationDepth,
+		IsLastCheckValid:            instance.IsLastCheckValid,
+		IsUpToDate:                  instance.IsUpToDate,
+		IsRecentlyChecked:           instance.IsRecentlyChecked,
+		ReplicationSQLThreadRunning: instance.Slave_SQL_Running,
+		ReplicationIOThreadRunning:  instance.Slave_IO_Running,
+		LagSeconds:                  -1,
+		SQLDelay:                    instance.SQLDelay,
+		PromotionRule:               instance.PromotionRule,
+		IsDowntimed:                 instance.IsDowntimed,
+		DowntimeReason:              instance.DowntimeReason,
+		DowntimeOwner:               instance.DowntimeOwner,
+		DowntimeEndTimestamp:        instance.DowntimeEndTimestamp,
+		Tags:                        []string{},
+		Pools:                       []string{},
+		Problems:                    instance.Problems,
+		Analysis:                    []DashboardAnalysis{},
+		Replicas:                    [](*DashboardInstance){},
+	}
+	if instance.SlaveLagSeconds.Valid {
+		dashboardInstance.LagSeconds = instance.SlaveLagSeconds.Int64
+	}
+	if dashboardInstance.Problems == nil {
+		dashboardInstance.Problems = []string{}
+	}
+	return dashboardInstance
+}
+
+// buildDashboardTopology arranges instances as a tree. Instances whose master is not in the cluster are
+// roots; so are co-masters, and any instance not reachable from another root.
+func buildDashboardTopology(dashboardInstances [](*DashboardInstance)) (roots [](*DashboardInstance)) {
+	instancesMap := make(map[inst.InstanceKey]*DashboardInstance)
+	for _, dashboardInstance := range dashboardInstances {
+		instancesMap[dashboardInstance.Key] = dashboardInstance
+	}
+	placed := make(map[inst.InstanceKey]bool)
+	var place func(dashboardInstance *DashboardInstance)
+	place = func(dashboardInstance *DashboardInstance) {
+		placed[dashboardInstance.Key] = true
+		for _, replica := range dashboardInstances {
+			if replica.MasterKey.Equals(&dashboardInstance.Key) && !placed[replica.Key] && !replica.IsCoMaster {
+				dashboardInstance.Replicas = append(dashboardInstance.Replicas, replica)
+				place(replica)
+			}
+		}
+	}
+	for _, dashboardInstance := range dashboardInstances {
+		if _, masterFound := instancesMap[dashboardInstance.MasterKey]; !masterFound || dashboardInstance.IsCoMaster {
+			roots = append(roots, dashboardInstance)
+			place(dashboardInstance)
+		}
+	}
+	for _, dashboardInstance := range dashboardInstances {
+		if !placed[dashboardInstance.Key] {
+			// Replication cycle
+			roots = append(roots, dashboardInstance)
+			place(dashboardInstance)
+		}
+	}
+	return roots
+}
+
+// ReadClusterDashboard reads all a dashboard needs to render given cluster, in a fixed number of backend reads
+func ReadClusterDashboard(clusterName string) (*ClusterDashboard, error) {
+	clusterInfo, err := inst.ReadClusterInfo(clusterName)
+	if err != nil {
+		return nil, err
+	}
+	instances, err := inst.ReadClusterInstances(clusterName)
+	if err != nil {
+		return nil, err
+	}
+	if len(instances) == 0 {
+		return nil, fmt.Errorf("ReadClusterDashboard: no instances found for cluster %s", clusterName)
+	}
+	maintenanceEntries, err := inst.ReadActiveMaintenance()
+	if err != nil {
+		return nil, err
+	}
+	tagsMap, err := inst.ReadClusterInstanceTags(clusterName)
+	if err != nil {
+		return nil, err
+	}
+	clusterPoolInstances, err := inst.ReadClusterPoolInstances(clusterName, "")
+	if err != nil {
+		return nil, err
+	}
+	analysis, err := inst.GetReplicationAnalysis(clusterName, &inst.ReplicationAnalysisHints{IncludeDowntimed: true})
+	if err != nil {
+		return nil, err
+	}
+	activeRecoveries, err := ReadActiveClusterRecovery(clusterName)
+	if err != nil {
+		return nil, err
+	}
+	recentRecoveries, err := ReadRecentRecoveries(clusterName, "", false, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	dashboard := &ClusterDashboard{
+		ClusterInfo:      clusterInfo,
+		Analysis:         []DashboardAnalysis{},
+		ActiveRecoveries: activeRecoveries,
+		RecentRecoveries: recentRecoveries,
+	}
+	if dashboard.ActiveRecoveries == nil {
+		dashboard.ActiveRecoveries = []TopologyRecovery{}
+	}
+	if dashboard.RecentRecoveries == nil {
+		dashboard.RecentRecoveries = []TopologyRecovery{}
+	}
+
+	dashboardInstances := [](*DashboardInstance){}
+	instancesMap := make(map[inst.InstanceKey]*DashboardInstance)
+	for _, instance := range instances {
+		dashboardInstance := newDashboardInstance(instance)
+		dashboardInstances = append(dashboardInstances, dashboardInstance)
+		instancesMap[instance.Key] = dashboardInstance
+	}
+	sort.SliceStable(dashboardInstances, func(i, j int) bool {
+		return dashboardInstances[i].Key.StringCode() < dashboardInstances[j].Key.StringCode()
+	})
+	for _, maintenance := range maintenanceEntries {
+		if dashboardInstance, found := instancesMap[maintenance.Key]; found {
+			dashboardInstance.Maintenance = &DashboardMaintenance{
+				Owner:          maintenance.Owner,
+				Reason:         maintenance.Reason,
+				BeginTimestamp: maintenance.BeginTimestamp,
+			}
+		}
+	}
+	for instanceKey, tags := range tagsMap {
+		if dashboardInstance, found := instancesMap[instanceKey]; found {
+			for _, tag := range tags {
+				dashboardInstance.Tags = append(dashboardInstance.Tags, tag.Display())
+			}
+		}
+	}
+	for _, clusterPoolInstance := range clusterPoolInstances {
+		instanceKey := inst.InstanceKey{Hostname: clusterPoolInstance.Hostname, Port: clusterPoolInstance.Port}
+		if dashboardInstance, found := instancesMap[instanceKey]; found {
+			dashboardInstance.Pools = append(dashboardInstance.Pools, clusterPoolInstance.Pool)
+		}
+	}
+	for _, instance := range instances {
+		if instance.IsReplica() && !instance.IsCoMaster {
+			member := inst.NewReplicaPoolMember(instance, instancesMap[instance.Key].Maintenance != nil)
+			instancesMap[instance.Key].ReplicaPool = &member
+		}
+	}
+	for _, analysisEntry := range analysis {
+		dashboardAnalysis := DashboardAnalysis{
+			AnalyzedInstanceKey: analysisEntry.AnalyzedInstanceKey,
+			Analysis:            analysisEntry.Analysis,
+			Description:         analysisEntry.Description,
+			StructureAnalysis:   analysisEntry.StructureAnalysis,
+			IsDowntimed:         analysisEntry.IsDowntimed,
+		}
+		dashboard.Analysis = append(dashboard.Analysis, dashboardAnalysis)
+		if dashboardInstance, found := instancesMap[analysisEntry.AnalyzedInstanceKey]; found {
+			dashboardInstance.Analysis = append(dashboardInstance.Analysis, dashboardAnalysis)
+		}
+	}
+	dashboard.Topology = buildDashboardTopology(dashboardInstances)
+	return dashboard, nil
+}
+
+// Coarse lag states, standing for exact lag when computing a dashboard's ETag
+const (
+	dashboardLagUnknown int64 = -1
+	dashboardLagOK      int64 = 0
+	dashboardLagLagging int64 = 1
+)
+
+// dashboardLagState returns the coarse lag state of given lag: unknown, ok, or lagging beyond reasonableLagSeconds
+func dashboardLagState(lagSeconds int64, reasonableLagSeconds int) int64 {
+	if lagSeconds < 0 {
+		return dashboardLagUnknown
+	}
+	if lagSeconds > int64(reasonableLagSeconds) {
+		return dashboardLagLagging
+	}
+	return dashboardLagOK
+}
+
+// coarsenLagging replaces values which change with replication lag by their coarse lag state, and clears
+// values which change with check timing, recursively
+func coarsenLagging(dashboardInstances [](*DashboardInstance), reasonableLagSeconds int) {
+	for _, dashboardInstance := range dashboardInstances {
+		dashboardInstance.LagSeconds = dashboardLagState(dashboardInstance.LagSeconds, reasonableLagSeconds)
+		dashboardInstance.IsRecentlyChecked = false
+		if dashboardInstance.ReplicaPool != nil {
+			dashboardInstance.ReplicaPool.LagSeconds = dashboardLagState(dashboardInstance.ReplicaPool.LagSeconds, reasonableLagSeconds)
+			dashboardInstance.ReplicaPool.Weight = 0
+		}
+		coarsenLagging(dashboardInstance.Replicas, reasonableLagSeconds)
+	}
+}
+
+// ETag returns a weak entity tag of this dashboard's content, changing whenever the content changes.
+// Exact lag, whether recently checked, and replica pool weight are left out, as they change with every
+// check of a lagging cluster; whether each instance lags beyond ReasonableReplicationLagSeconds is not.
+func (this *ClusterDashboard) ETag() (string, error) {
+	content, err := json.Marshal(this)
+	if err != nil {
+		return "", err
+	}
+	tagged := &ClusterDashboard{}
+	if err := json.Unmarshal(content, tagged); err != nil {
+		return "", err
+	}
+	clusterConfig := config.Config
+	if this.ClusterInfo != nil {
+		clusterConfig = config.Config.ForCluster(this.ClusterInfo.ClusterName, this.ClusterInfo.ClusterAlias)
+	}
+	coarsenLagging(tagged.Topology, clusterConfig.ReasonableReplicationLagSeconds)
+	if content, err = json.Marshal(tagged); err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(content)
+	return fmt.Sprintf(`W/"%s"`, hex.EncodeToString(hash[:16])), nil
+}
@@ -0,0 +1,85 @@
+package logic
+
+import (
+	"testing"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/inst"
+	test "github.com/openark/golib/tests"
+)
+
+func newTestDashboardInstance(port int, masterPort int, isCoMaster bool) *DashboardInstance {
+	instance := inst.NewInstance()
+	instance.Key = inst.InstanceKey{Hostname: "db", Port: port}
+	if masterPort != 0 {
+		instance.MasterKey = inst.InstanceKey{Hostname: "db", Port: masterPort}
+	}
+	instance.IsCoMaster = isCoMaster
+	return newDashboardInstance(instance)
+}
+
+func TestBuildDashboardTopology(t *testing.T) {
+	{
+		master := newTestDashboardInstance(3306, 0, false)
+		intermediate := newTestDashboardInstance(3307, 3306, false)
+		replica := newTestDashboardInstance(3308, 3307, false)
+		roots := buildDashboardTopology([](*DashboardInstance){replica, intermediate, master})
+		test.S(t).ExpectEquals(len(roots), 1)
+		test.S(t).ExpectEquals(roots[0].Key.Port, 3306)
+		test.S(t).ExpectEquals(len(roots[0].Replicas), 1)
+		test.S(t).ExpectEquals(roots[0].Replicas[0].Key.Port, 3307)
+		test.S(t).ExpectEquals(roots[0].Replicas[0].Replicas[0].Key.Port, 3308)
+		test.S(t).ExpectEquals(len(replica.Replicas), 0)
+		test.S(t).ExpectEquals(replica.LagSeconds, int64(-1))
+	}
+	{
+		// Co-masters are both roots
+		coMaster1 := newTestDashboardInstance(3306, 3307, true)
+		coMaster2 := newTestDashboardInstance(3307, 3306, true)
+		replica := newTestDashboardInstance(3308, 3306, false)
+		roots := buildDashboardTopology([](*DashboardInstance){coMaster1, coMaster2, replica})
+		test.S(t).ExpectEquals(len(roots), 2)
+		test.S(t).ExpectEquals(len(coMaster1.Replicas), 1)
+		test.S(t).ExpectEquals(len(coMaster2.Replicas), 0)
+	}
+	{
+		// A replication cycle not marked as co-masters still shows all instances
+		instance1 := newTestDashboardInstance(3306, 3307, false)
+		instance2 := newTestDashboardInstance(3307, 3306, false)
+		roots := buildDashboardTopology([](*DashboardInstance){instance1, instance2})
+		test.S(t).ExpectEquals(len(roots), 1)
+		test.S(t).ExpectEquals(len(roots[0].Replicas), 1)
+	}
+}
+
+func TestClusterDashboardETag(t *testing.T) {
+	dashboard := &ClusterDashboard{
+		ClusterInfo: &inst.ClusterInfo{ClusterName: "db:3306"},
+		Topology:    [](*DashboardInstance){newTestDashboardInstance(3306, 0, false)},
+	}
+	dashboard.Topology[0].LagSeconds = 0
+	etag, err := dashboard.ETag()
+	test.S(t).ExpectNil(err)
+	sameEtag, _ := dashboard.ETag()
+	test.S(t).ExpectEquals(etag, sameEtag)
+
+	dashboard.Topology[0].LagSeconds = 7
+	dashboard.Topology[0].IsRecentlyChecked = !dashboard.Topology[0].IsRecentlyChecked
+	laggingEtag, _ := dashboard.ETag()
+	test.S(t).ExpectEquals(etag, laggingEtag)
+
+	dashboard.Topology[0].LagSeconds = int64(config.Config.ReasonableReplicationLagSeconds) + 1
+	overLaggingEtag, _ := dashboard.ETag()
+	test.S(t).ExpectNotEquals(etag, overLaggingEtag)
+	dashboard.Topology[0].LagSeconds = int64(config.Config.ReasonableReplicationLagSeconds) + 60
+	stillOverLaggingEtag, _ := dashboard.ETag()
+	test.S(t).ExpectEquals(overLaggingEtag, stillOverLaggingEtag)
+	dashboard.Topology[0].LagSeconds = -1
+	unknownLagEtag, _ := dashboard.ETag()
+	test.S(t).ExpectNotEquals(etag, unknownLagEtag)
+	dashboard.Topology[0].LagSeconds = 0
+
+	dashboard.Topology[0].IsDowntimed = true
+	changedEtag, _ := dashboard.ETag()
+	test.S(t).ExpectNotEquals(etag, changedEtag)
+}
@@ -21,6 +21,7 @@ import (
 
 	"github.com/github/orchestrator/go/inst"
 	"github.com/github/orchestrator/go/kv"
+	"github.com/github/orchestrator/go/process"
 	"github.com/github/orchestrator/go/raft"
 
 	"github.com/openark/golib/log"
@@ -51,6 +52,8 @@ func (applier *CommandApplier) ApplyCommand(op string, value []byte) interface{}
 		return applier.forget(value)
 	case "forget-cluster":
 		return applier.forgetCluster(value)
+	case "forget-garbage":
+		return applier.forgetGarbage(value)
 	case "begin-downtime":
 		return applier.beginDowntime(value)
 	case "end-downtime":
@@ -87,6 +90,20 @@ func (applier *CommandApplier) ApplyCommand(op string, value []byte) interface{}
 		return applier.healthReport(value)
 	case "set-cluster-alias-manual-override":
 		return applier.setClusterAliasManualOverride(value)
+	case "link-cluster":
+		return applier.linkCluster(value)
+	case "unlink-cluster":
+		return applier.unlinkCluster(value)
+	case "create-api-token":
+		return applier.createAPIToken(value)
+	case "revoke-api-token":
+		return applier.revokeAPIToken(value)
+	case "write-topology-plan":
+		return applier.writeTopologyPlan(value)
+	case "touch-topology-plan":
+		return applier.touchTopologyPlan(value)
+	case "write-long-running-queries":
+		return applier.writeLongRunningQueries(value)
 	}
 	return log.Errorf("Unknown command op: %s", op)
 }
@@ -136,6 +153,15 @@ func (applier *CommandApplier) forgetCluster(value []byte) interface{} {
 	return err
 }
 
+func (applier *CommandApplier) forgetGarbage(value []byte) interface{} {
+	report := inst.GarbageReport{}
+	if err := json.Unmarshal(value, &report); err != nil {
+		return log.Errore(err)
+	}
+	_, err := inst.ForgetGarbage(&report)
+	return err
+}
+
 func (applier *CommandApplier) beginDowntime(value []byte) interface{} {
 	downtime := inst.Downtime{}
 	if err := json.Unmarshal(value, &downtime); err != nil {
@@ -309,3 +335,66 @@ func (applier *CommandApplier) setClusterAliasManualOverride(value []byte) inter
 	err := inst.SetClusterAliasManualOverride(clusterName, alias)
 	return err
 }
+
+func (applier *CommandApplier) linkCluster(value []byte) interface{} {
+	link := inst.ClusterLink{}
+	if err := json.Unmarshal(value, &link); err != nil {
+		return log.Errore(err)
+	}
+	err := inst.WriteClusterLink(&link)
+	return err
+}
+
+func (applier *CommandApplier) unlinkCluster(value []byte) interface{} {
+	instanceKey := inst.InstanceKey{}
+	if err := json.Unmarshal(value, &instanceKey); err != nil {
+		return log.Errore(err)
+	}
+	err := inst.UnlinkCluster(&instanceKey)
+	return err
+}
+
+func (applier *CommandApplier) createAPIToken(value []byte) interface{} {
+	apiToken := process.APIToken{}
+	if err := json.Unmarshal(value, &apiToken); err != nil {
+		return log.Errore(err)
+	}
+	err := process.WriteAPIToken(&apiToken)
+	return err
+}
+
+func (applier *CommandApplier) revokeAPIToken(value []byte) interface{} {
+	var tokenId string
+	if err := json.Unmarshal(value, &tokenId); err != nil {
+		return log.Errore(err)
+	}
+	err := process.RevokeAPIToken(tokenId)
+	return err
+}
+
+func (applier *CommandApplier) writeTopologyPlan(value []byte) interface{} {
+	plan := inst.TopologyPlan{}
+	if err := json.Unmarshal(value, &plan); err != nil {
+		return log.Errore(err)
+	}
+	err := inst.WriteTopologyPlanState(&plan)
+	return err
+}
+
+func (applier *CommandApplier) touchTopologyPlan(value []byte) interface{} {
+	var planId int64
+	if err := json.Unmarshal(value, &planId); err != nil {
+		return log.Errore(err)
+	}
+	err := inst.TouchTopologyPlan(planId)
+	return err
+}
+
+func (applier *CommandApplier) writeLongRunningQueries(value []byte) interface{} {
+	sample := inst.LongRunningQueriesSample{}
+	if err := json.Unmarshal(value, &sample); err != nil {
+		return log.Errore(err)
+	}
+	err := inst.WriteLongRunningQueriesSample(&sample)
+	return err
+}
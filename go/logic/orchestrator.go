@@ -29,7 +29,9 @@ import (
 	"github.com/github/orchestrator/go/agent"
 	"github.com/github/orchestrator/go/collection"
 	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/db"
 	"github.com/github/orchestrator/go/discovery"
+	"github.com/github/orchestrator/go/events"
 	"github.com/github/orchestrator/go/inst"
 	"github.com/github/orchestrator/go/kv"
 	ometrics "github.com/github/orchestrator/go/metrics"
@@ -71,6 +73,7 @@ var isElectedNode int64 = 0
 var recentDiscoveryOperationKeys *cache.Cache
 var pseudoGTIDPublishCache = cache.New(time.Minute, time.Second)
 var kvFoundCache = cache.New(10*time.Minute, time.Minute)
+var replicaPoolsKVCache = cache.New(10*time.Minute, time.Minute)
 
 func init() {
 	snapshotDiscoveryKeys = make(chan inst.InstanceKey, 10)
@@ -85,6 +88,12 @@ func init() {
 	metrics.Register("raft.is_healthy", isRaftHealthyGauge)
 	metrics.Register("raft.is_leader", isRaftLeaderGauge)
 
+	config.SubscribeReload("discovery-workers", []string{"DiscoveryMaxConcurrency"}, reloadDiscoveryWorkers)
+	config.SubscribeReload("discovery-metrics", []string{"DiscoveryCollectionRetentionSeconds"}, func() error {
+		discoveryMetrics.SetExpirePeriod(time.Duration(config.Config.DiscoveryCollectionRetentionSeconds) * time.Second)
+		return nil
+	})
+
 	ometrics.OnMetricsTick(func() {
 		discoveryQueueLengthGauge.Update(int64(discoveryQueue.QueueLen()))
 	})
@@ -142,9 +151,7 @@ func acceptSignals() {
 			switch sig {
 			case syscall.SIGHUP:
 				log.Infof("Received SIGHUP. Reloading configuration")
-				inst.AuditOperation("reload-configuration", nil, "Triggered via SIGHUP")
-				config.Reload()
-				discoveryMetrics.SetExpirePeriod(time.Duration(config.Config.DiscoveryCollectionRetentionSeconds) * time.Second)
+				ReloadConfiguration("SIGHUP")
 			case syscall.SIGTERM:
 				log.Infof("Received SIGTERM. Shutting down orchestrator")
 				discoveryMetrics.StopAutoExpiration()
@@ -156,30 +163,82 @@ func acceptSignals() {
 	}()
 }
 
+// ReloadConfiguration reloads configuration, re-initializing subscribed subsystems, and reloads
+// settings read from outside the configuration files. trigger describes what requested the reload.
+func ReloadConfiguration(trigger string) *config.ReloadReport {
+	inst.AuditOperation("reload-configuration", nil, fmt.Sprintf("Triggered via %s", trigger))
+	report := config.Reload(trigger)
+	inst.ReloadHostnameResolveStaticMap()
+	db.ResetCredentials()
+	return report
+}
+
+// discoveryWorkersStop holds a stop channel per running discovery worker
+var discoveryWorkersStop [](chan struct{})
+var discoveryWorkersStarted = false
+var discoveryWorkersMutex sync.Mutex
+
+// setDiscoveryWorkers grows or shrinks the pool of discovery workers to given size.
+// A stopped worker completes the discovery it is waiting on or running.
+func setDiscoveryWorkers(count uint) {
+	discoveryWorkersMutex.Lock()
+	defer discoveryWorkersMutex.Unlock()
+
+	discoveryWorkersStarted = true
+	for uint(len(discoveryWorkersStop)) < count {
+		stop := make(chan struct{})
+		discoveryWorkersStop = append(discoveryWorkersStop, stop)
+		go discoveryWorker(stop)
+	}
+	for uint(len(discoveryWorkersStop)) > count {
+		last := len(discoveryWorkersStop) - 1
+		close(discoveryWorkersStop[last])
+		discoveryWorkersStop = discoveryWorkersStop[:last]
+	}
+}
+
+// reloadDiscoveryWorkers applies configured DiscoveryMaxConcurrency, if discovery workers are running
+func reloadDiscoveryWorkers() error {
+	discoveryWorkersMutex.Lock()
+	started := discoveryWorkersStarted
+	discoveryWorkersMutex.Unlock()
+
+	if started {
+		setDiscoveryWorkers(config.Config.DiscoveryMaxConcurrency)
+	}
+	return nil
+}
+
+// discoveryWorker consumes the discovery queue until stopped
+func discoveryWorker(stop chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		instanceKey := discoveryQueue.Consume()
+		// Possibly this used to be the elected node, but has
+		// been demoted, while still the queue is full.
+		if !IsLeaderOrActive() {
+			log.Debugf("Node apparently demoted. Skipping discovery of %+v. "+
+				"Remaining queue size: %+v", instanceKey, discoveryQueue.QueueLen())
+			discoveryQueue.Release(instanceKey)
+			continue
+		}
+
+		DiscoverInstance(instanceKey)
+		discoveryQueue.Release(instanceKey)
+	}
+}
+
 // handleDiscoveryRequests iterates the discoveryQueue channel and calls upon
 // instance discovery per entry.
 func handleDiscoveryRequests() {
 	discoveryQueue = discovery.CreateOrReturnQueue("DEFAULT")
 
 	// create a pool of discovery workers
-	for i := uint(0); i < config.Config.DiscoveryMaxConcurrency; i++ {
-		go func() {
-			for {
-				instanceKey := discoveryQueue.Consume()
-				// Possibly this used to be the elected node, but has
-				// been demoted, while still the queue is full.
-				if !IsLeaderOrActive() {
-					log.Debugf("Node apparently demoted. Skipping discovery of %+v. "+
-						"Remaining queue size: %+v", instanceKey, discoveryQueue.QueueLen())
-					discoveryQueue.Release(instanceKey)
-					continue
-				}
-
-				DiscoverInstance(instanceKey)
-				discoveryQueue.Release(instanceKey)
-			}
-		}()
-	}
+	setDiscoveryWorkers(config.Config.DiscoveryMaxConcurrency)
 }
 
 // DiscoverInstance will attempt to discover (poll) an instance (unless
@@ -272,6 +331,9 @@ func DiscoverInstance(instanceKey inst.InstanceKey) {
 		InstanceLatency: instanceLatency,
 		Err:             nil,
 	})
+	if !found {
+		events.Publish(events.InstanceDiscovered, instance.ClusterName, instanceKey.Hostname, instanceKey.Port, fmt.Sprintf("Discovered %s", instanceKey.DisplayString()), nil)
+	}
 
 	if !IsLeaderOrActive() {
 		// Maybe this node was elected before, but isn't elected anymore.
@@ -460,6 +522,45 @@ func SubmitMastersToKvStores(clusterName string, force bool) (kvPairs [](*kv.KVP
 	return kvPairs, submittedCount, log.Errore(selectedError)
 }
 
+// SubmitReplicaPoolsToKvStores writes a cluster's replica pool (or all clusters' replica pools) to kv stores.
+// Unless forced, only pools which changed since last submitted are written.
+func SubmitReplicaPoolsToKvStores(clusterName string, force bool) (kvPairs [](*kv.KVPair), submittedCount int, err error) {
+	kvPairs, err = inst.GetReplicaPoolsKVPairs(clusterName)
+	if err != nil {
+		return kvPairs, submittedCount, log.Errore(err)
+	}
+	var selectedError error
+	var submitKvPairs [](*kv.KVPair)
+	for _, kvPair := range kvPairs {
+		if !force {
+			if value, found := replicaPoolsKVCache.Get(kvPair.Key); found && value.(string) == kvPair.Value {
+				continue
+			}
+		}
+		submitKvPairs = append(submitKvPairs, kvPair)
+	}
+	log.Debugf("kv.SubmitReplicaPoolsToKvStores, clusterName: %s, force: %+v: numPairs: %+v, submitKvPairs: %+v", clusterName, force, len(kvPairs), len(submitKvPairs))
+	for _, kvPair := range submitKvPairs {
+		if orcraft.IsRaftEnabled() {
+			_, err = orcraft.PublishCommand("put-key-value", kvPair)
+		} else {
+			err = kv.PutKVPair(kvPair)
+		}
+		if err == nil {
+			replicaPoolsKVCache.Set(kvPair.Key, kvPair.Value, cache.DefaultExpiration)
+			submittedCount++
+		} else {
+			selectedError = err
+		}
+	}
+	if len(submitKvPairs) > 0 {
+		if err := kv.DistributePairs(submitKvPairs); err != nil {
+			log.Errore(err)
+		}
+	}
+	return kvPairs, submittedCount, log.Errore(selectedError)
+}
+
 func injectSeeds(seedOnce *sync.Once) {
 	seedOnce.Do(func() {
 		for _, seed := range config.Config.DiscoverySeeds {
@@ -490,12 +591,20 @@ func ContinuousDiscovery() {
 	caretakingTick := time.Tick(time.Minute)
 	raftCaretakingTick := time.Tick(10 * time.Minute)
 	recoveryTick := time.Tick(time.Duration(config.RecoveryPollSeconds) * time.Second)
+	replicaPoolsTick := time.Tick(time.Duration(config.ReplicaPoolsPollSeconds) * time.Second)
+	var replicaPoolsEntrance int64
+	proxySQLReadersTick := time.Tick(time.Duration(config.ProxySQLSyncReadersPollSeconds) * time.Second)
 	autoPseudoGTIDTick := time.Tick(time.Duration(config.PseudoGTIDIntervalSeconds) * time.Second)
 	var recoveryEntrance int64
 	var snapshotTopologiesTick <-chan time.Time
 	if config.Config.SnapshotTopologiesIntervalHours > 0 {
 		snapshotTopologiesTick = time.Tick(time.Duration(config.Config.SnapshotTopologiesIntervalHours) * time.Hour)
 	}
+	var longRunningQueriesEntrance int64
+	var longRunningQueriesTick <-chan time.Time
+	if config.Config.LongRunningQueriesSampleIntervalSeconds > 0 {
+		longRunningQueriesTick = time.Tick(time.Duration(config.Config.LongRunningQueriesSampleIntervalSeconds) * time.Second)
+	}
 
 	runCheckAndRecoverOperationsTimeRipe := func() bool {
 		return time.Since(continuousDiscoveryStartTime) >= checkAndRecoverWaitPeriod
@@ -607,12 +716,47 @@ func ContinuousDiscovery() {
 					}()
 				}
 			}()
+		case <-replicaPoolsTick:
+			go func() {
+				if !(config.Config.KVPublishReplicaPools && runCheckAndRecoverOperationsTimeRipe() && IsLeader()) {
+					return
+				}
+				// Submission may take longer than the interval with slow KV stores; do not pile up
+				if !atomic.CompareAndSwapInt64(&replicaPoolsEntrance, 0, 1) {
+					return
+				}
+				defer atomic.StoreInt64(&replicaPoolsEntrance, 0)
+				SubmitReplicaPoolsToKvStores("", false)
+			}()
+		case <-proxySQLReadersTick:
+			go func() {
+				if config.Config.ProxySQLSyncReaderHostgroups && runCheckAndRecoverOperationsTimeRipe() && IsLeader() {
+					SyncProxySQLReaders(false)
+				}
+			}()
 		case <-snapshotTopologiesTick:
 			go func() {
 				if IsLeaderOrActive() {
 					go inst.SnapshotTopologies()
 				}
 			}()
+		case <-longRunningQueriesTick:
+			go func() {
+				if !IsLeaderOrActive() {
+					return
+				}
+				go inst.ExpireLongRunningQueries()
+				if !IsLeader() {
+					// The leader samples, and publishes samples via raft
+					return
+				}
+				// Sampling may take longer than the interval on large deployments; do not pile up
+				if !atomic.CompareAndSwapInt64(&longRunningQueriesEntrance, 0, 1) {
+					return
+				}
+				defer atomic.StoreInt64(&longRunningQueriesEntrance, 0)
+				inst.SampleLongRunningQueries()
+			}()
 		}
 	}
 }
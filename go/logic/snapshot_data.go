@@ -50,7 +50,12 @@ type SnapshotData struct {
 	Detections,
 	KVStore,
 	Recovery,
-	RecoverySteps sqlutils.NamedResultData
+	RecoverySteps,
+	ClusterLinks,
+	APITokens,
+	TopologyPlans,
+	TopologyPlanSteps,
+	LongRunningQueries sqlutils.NamedResultData
 
 	LeaderURI string
 }
@@ -102,6 +107,11 @@ func CreateSnapshotData() *SnapshotData {
 	readTableData("topology_recovery", &snapshotData.Recovery)
 	readTableData("topology_recovery_steps", &snapshotData.RecoverySteps)
 	readTableData("cluster_injected_pseudo_gtid", &snapshotData.InjectedPseudoGTIDClusters)
+	readTableData("cluster_link", &snapshotData.ClusterLinks)
+	readTableData("api_token", &snapshotData.APITokens)
+	readTableData("topology_plan", &snapshotData.TopologyPlans)
+	readTableData("topology_plan_step", &snapshotData.TopologyPlanSteps)
+	readTableData("database_instance_long_running_queries", &snapshotData.LongRunningQueries)
 
 	log.Debugf("raft snapshot data created")
 	return snapshotData
@@ -208,6 +218,11 @@ func (this *SnapshotDataCreatorApplier) Restore(rc io.ReadCloser) error {
 	writeTableData("topology_failure_detection", &snapshotData.Detections)
 	writeTableData("topology_recovery_steps", &snapshotData.RecoverySteps)
 	writeTableData("cluster_injected_pseudo_gtid", &snapshotData.InjectedPseudoGTIDClusters)
+	writeTableData("cluster_link", &snapshotData.ClusterLinks)
+	writeTableData("api_token", &snapshotData.APITokens)
+	writeTableData("topology_plan", &snapshotData.TopologyPlans)
+	writeTableData("topology_plan_step", &snapshotData.TopologyPlanSteps)
+	writeTableData("database_instance_long_running_queries", &snapshotData.LongRunningQueries)
 
 	// recovery disable
 	{
@@ -28,6 +28,7 @@ import (
 
 	"github.com/github/orchestrator/go/attributes"
 	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/events"
 	"github.com/github/orchestrator/go/inst"
 	"github.com/github/orchestrator/go/kv"
 	ometrics "github.com/github/orchestrator/go/metrics"
@@ -100,6 +101,7 @@ type TopologyRecovery struct {
 	IsSuccessful              bool
 	LostReplicas              inst.InstanceKeyMap
 	ParticipatingInstanceKeys inst.InstanceKeyMap
+	VetoedCandidates          inst.InstanceKeyMap
 	AllErrors                 []string
 	RecoveryStartTimestamp    string
 	RecoveryEndTimestamp      string
@@ -122,6 +124,7 @@ func NewTopologyRecovery(replicationAnalysis inst.ReplicationAnalysis) *Topology
 	topologyRecovery.SuccessorKey = nil
 	topologyRecovery.LostReplicas = *inst.NewInstanceKeyMap()
 	topologyRecovery.ParticipatingInstanceKeys = *inst.NewInstanceKeyMap()
+	topologyRecovery.VetoedCandidates = *inst.NewInstanceKeyMap()
 	topologyRecovery.AllErrors = []string{}
 	topologyRecovery.RecoveryType = NotMasterRecovery
 	return topologyRecovery
@@ -140,11 +143,31 @@ func (this *TopologyRecovery) AddErrors(errs []error) {
 	}
 }
 
+// IsVetoedCandidate checks whether a recovery hook vetoed the promotion of given instance
+func (this *TopologyRecovery) IsVetoedCandidate(instanceKey *inst.InstanceKey) bool {
+	if instanceKey == nil {
+		return false
+	}
+	return this.VetoedCandidates.HasKey(*instanceKey)
+}
+
+// RemoveVetoedCandidates returns given instances, excluding those a recovery hook vetoed
+func (this *TopologyRecovery) RemoveVetoedCandidates(instances [](*inst.Instance)) (result [](*inst.Instance)) {
+	for _, instance := range instances {
+		if !this.IsVetoedCandidate(&instance.Key) {
+			result = append(result, instance)
+		}
+	}
+	return result
+}
+
 type TopologyRecoveryStep struct {
 	Id          int64
 	RecoveryUID string
 	AuditAt     string
 	Message     string
+	Stdout      string
+	Stderr      string
 }
 
 func NewTopologyRecoveryStep(uid string, message string) *TopologyRecoveryStep {
@@ -229,7 +252,25 @@ func AuditTopologyRecovery(topologyRecovery *TopologyRecovery, message string) e
 		return nil
 	}
 
+	publishRecoveryEvent(events.RecoveryStep, topologyRecovery, message)
+	return auditTopologyRecoveryStep(NewTopologyRecoveryStep(topologyRecovery.UID, message))
+}
+
+// auditTopologyRecoveryHookOutput audits a step in a topology recovery process, along with the output of the hook it reports
+func auditTopologyRecoveryHookOutput(topologyRecovery *TopologyRecovery, message string, stdout string, stderr string) error {
+	log.Infof("topology_recovery: %s", message)
+	if topologyRecovery == nil {
+		return nil
+	}
+
+	publishRecoveryEvent(events.RecoveryStep, topologyRecovery, message)
 	recoveryStep := NewTopologyRecoveryStep(topologyRecovery.UID, message)
+	recoveryStep.Stdout = truncateHookOutput(stdout)
+	recoveryStep.Stderr = truncateHookOutput(stderr)
+	return auditTopologyRecoveryStep(recoveryStep)
+}
+
+func auditTopologyRecoveryStep(recoveryStep *TopologyRecoveryStep) error {
 	if orcraft.IsRaftEnabled() {
 		_, err := orcraft.PublishCommand("write-recovery-step", recoveryStep)
 		return err
@@ -238,12 +279,33 @@ func AuditTopologyRecovery(topologyRecovery *TopologyRecovery, message string) e
 	}
 }
 
+// RecoveryEventDetails accompany published recovery events
+type RecoveryEventDetails struct {
+	RecoveryUID  string
+	Analysis     inst.AnalysisCode
+	IsSuccessful bool
+	SuccessorKey *inst.InstanceKey
+}
+
+// publishRecoveryEvent publishes a recovery event to this node's event subscribers
+func publishRecoveryEvent(eventType events.EventType, topologyRecovery *TopologyRecovery, message string) {
+	analysisEntry := &topologyRecovery.AnalysisEntry
+	details := RecoveryEventDetails{
+		RecoveryUID:  topologyRecovery.UID,
+		Analysis:     analysisEntry.Analysis,
+		IsSuccessful: topologyRecovery.IsSuccessful,
+		SuccessorKey: topologyRecovery.SuccessorKey,
+	}
+	events.Publish(eventType, analysisEntry.ClusterDetails.ClusterName, analysisEntry.AnalyzedInstanceKey.Hostname, analysisEntry.AnalyzedInstanceKey.Port, message, details)
+}
+
 func resolveRecovery(topologyRecovery *TopologyRecovery, successorInstance *inst.Instance) error {
 	if successorInstance != nil {
 		topologyRecovery.SuccessorKey = &successorInstance.Key
 		topologyRecovery.SuccessorAlias = successorInstance.InstanceAlias
 		topologyRecovery.IsSuccessful = true
 	}
+	publishRecoveryEvent(events.RecoveryFinished, topologyRecovery, fmt.Sprintf("success=%t", topologyRecovery.IsSuccessful))
 	if orcraft.IsRaftEnabled() {
 		_, err := orcraft.PublishCommand("resolve-recovery", topologyRecovery)
 		return err
@@ -252,48 +314,59 @@ func resolveRecovery(topologyRecovery *TopologyRecovery, successorInstance *inst
 	}
 }
 
-// prepareCommand replaces agreed-upon placeholders with analysis data
-func prepareCommand(command string, topologyRecovery *TopologyRecovery) (result string, async bool) {
+// recoveryHookPlaceholderValues returns the values of config.RecoveryHookPlaceholders for given recovery,
+// mapped by placeholder. Successor placeholders have no value unless there is a successor.
+func recoveryHookPlaceholderValues(topologyRecovery *TopologyRecovery) map[string]string {
 	analysisEntry := &topologyRecovery.AnalysisEntry
-	command = strings.TrimSpace(command)
-	if strings.HasSuffix(command, "&") {
-		command = strings.TrimRight(command, "&")
-		async = true
+	values := map[string]string{
+		"failureType":                    string(analysisEntry.Analysis),
+		"instanceType":                   string(analysisEntry.GetAnalysisInstanceType()),
+		"isMaster":                       fmt.Sprintf("%t", analysisEntry.IsMaster),
+		"isCoMaster":                     fmt.Sprintf("%t", analysisEntry.IsCoMaster),
+		"failureDescription":             analysisEntry.Description,
+		"command":                        analysisEntry.CommandHint,
+		"failedHost":                     analysisEntry.AnalyzedInstanceKey.Hostname,
+		"failedPort":                     fmt.Sprintf("%d", analysisEntry.AnalyzedInstanceKey.Port),
+		"failureCluster":                 analysisEntry.ClusterDetails.ClusterName,
+		"failureClusterAlias":            analysisEntry.ClusterDetails.ClusterAlias,
+		"failureClusterDomain":           analysisEntry.ClusterDetails.ClusterDomain,
+		"countSlaves":                    fmt.Sprintf("%d", analysisEntry.CountReplicas),
+		"countReplicas":                  fmt.Sprintf("%d", analysisEntry.CountReplicas),
+		"isDowntimed":                    fmt.Sprint(analysisEntry.IsDowntimed),
+		"autoMasterRecovery":             fmt.Sprint(analysisEntry.ClusterDetails.HasAutomatedMasterRecovery),
+		"autoIntermediateMasterRecovery": fmt.Sprint(analysisEntry.ClusterDetails.HasAutomatedIntermediateMasterRecovery),
+		"orchestratorHost":               process.ThisHostname,
+		"recoveryUID":                    topologyRecovery.UID,
+		"isSuccessful":                   fmt.Sprint(topologyRecovery.SuccessorKey != nil),
+		"lostSlaves":                     topologyRecovery.LostReplicas.ToCommaDelimitedList(),
+		"lostReplicas":                   topologyRecovery.LostReplicas.ToCommaDelimitedList(),
+		"countLostReplicas":              fmt.Sprintf("%d", len(topologyRecovery.LostReplicas)),
+		"slaveHosts":                     analysisEntry.SlaveHosts.ToCommaDelimitedList(),
+		"replicaHosts":                   analysisEntry.SlaveHosts.ToCommaDelimitedList(),
 	}
-	command = strings.Replace(command, "{failureType}", string(analysisEntry.Analysis), -1)
-	command = strings.Replace(command, "{instanceType}", string(analysisEntry.GetAnalysisInstanceType()), -1)
-	command = strings.Replace(command, "{isMaster}", fmt.Sprintf("%t", analysisEntry.IsMaster), -1)
-	command = strings.Replace(command, "{isCoMaster}", fmt.Sprintf("%t", analysisEntry.IsCoMaster), -1)
-	command = strings.Replace(command, "{failureDescription}", analysisEntry.Description, -1)
-	command = strings.Replace(command, "{command}", analysisEntry.CommandHint, -1)
-	command = strings.Replace(command, "{failedHost}", analysisEntry.AnalyzedInstanceKey.Hostname, -1)
-	command = strings.Replace(command, "{failedPort}", fmt.Sprintf("%d", analysisEntry.AnalyzedInstanceKey.Port), -1)
-	command = strings.Replace(command, "{failureCluster}", analysisEntry.ClusterDetails.ClusterName, -1)
-	command = strings.Replace(command, "{failureClusterAlias}", analysisEntry.ClusterDetails.ClusterAlias, -1)
-	command = strings.Replace(command, "{failureClusterDomain}", analysisEntry.ClusterDetails.ClusterDomain, -1)
-	command = strings.Replace(command, "{countSlaves}", fmt.Sprintf("%d", analysisEntry.CountReplicas), -1)
-	command = strings.Replace(command, "{countReplicas}", fmt.Sprintf("%d", analysisEntry.CountReplicas), -1)
-	command = strings.Replace(command, "{isDowntimed}", fmt.Sprint(analysisEntry.IsDowntimed), -1)
-	command = strings.Replace(command, "{autoMasterRecovery}", fmt.Sprint(analysisEntry.ClusterDetails.HasAutomatedMasterRecovery), -1)
-	command = strings.Replace(command, "{autoIntermediateMasterRecovery}", fmt.Sprint(analysisEntry.ClusterDetails.HasAutomatedIntermediateMasterRecovery), -1)
-	command = strings.Replace(command, "{orchestratorHost}", process.ThisHostname, -1)
-	command = strings.Replace(command, "{recoveryUID}", topologyRecovery.UID, -1)
-
-	command = strings.Replace(command, "{isSuccessful}", fmt.Sprint(topologyRecovery.SuccessorKey != nil), -1)
 	if topologyRecovery.SuccessorKey != nil {
-		command = strings.Replace(command, "{successorHost}", topologyRecovery.SuccessorKey.Hostname, -1)
-		command = strings.Replace(command, "{successorPort}", fmt.Sprintf("%d", topologyRecovery.SuccessorKey.Port), -1)
+		values["successorHost"] = topologyRecovery.SuccessorKey.Hostname
+		values["successorPort"] = fmt.Sprintf("%d", topologyRecovery.SuccessorKey.Port)
 		// As long as SucesssorKey != nil, we replace {successorAlias}.
 		// If SucessorAlias is "", it's fine. We'll replace {successorAlias} with "".
-		command = strings.Replace(command, "{successorAlias}", topologyRecovery.SuccessorAlias, -1)
+		values["successorAlias"] = topologyRecovery.SuccessorAlias
 	}
+	return values
+}
 
-	command = strings.Replace(command, "{lostSlaves}", topologyRecovery.LostReplicas.ToCommaDelimitedList(), -1)
-	command = strings.Replace(command, "{lostReplicas}", topologyRecovery.LostReplicas.ToCommaDelimitedList(), -1)
-	command = strings.Replace(command, "{countLostReplicas}", fmt.Sprintf("%d", len(topologyRecovery.LostReplicas)), -1)
-	command = strings.Replace(command, "{slaveHosts}", analysisEntry.SlaveHosts.ToCommaDelimitedList(), -1)
-	command = strings.Replace(command, "{replicaHosts}", analysisEntry.SlaveHosts.ToCommaDelimitedList(), -1)
-
+// prepareCommand replaces agreed-upon placeholders, config.RecoveryHookPlaceholders, with analysis data
+func prepareCommand(command string, topologyRecovery *TopologyRecovery) (result string, async bool) {
+	command = strings.TrimSpace(command)
+	if strings.HasSuffix(command, "&") {
+		command = strings.TrimRight(command, "&")
+		async = true
+	}
+	values := recoveryHookPlaceholderValues(topologyRecovery)
+	for _, placeholder := range config.RecoveryHookPlaceholders {
+		if value, found := values[placeholder]; found {
+			command = strings.Replace(command, fmt.Sprintf("{%s}", placeholder), value, -1)
+		}
+	}
 	return command, async
 }
 
@@ -333,18 +406,39 @@ func applyEnvironmentVariables(topologyRecovery *TopologyRecovery) []string {
 	return env
 }
 
-func executeProcess(command string, env []string, topologyRecovery *TopologyRecovery, fullDescription string) (err error) {
-	// Log the command to be run and record how long it takes as this may be useful
-	AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("Running %s: %s", fullDescription, command))
-	start := time.Now()
-	var info string
-	if err = os.CommandRun(command, env); err == nil {
-		info = fmt.Sprintf("Completed %s in %v", fullDescription, time.Since(start))
-	} else {
-		info = fmt.Sprintf("Execution of %s failed in %v with error: %v", fullDescription, time.Since(start), err)
-		log.Errorf(info)
+// executeProcess runs a single hook, retrying it as per the hook type's policy. Directives printed by the
+// hook are collected across attempts and applied onto the recovery once; an abort directive is returned as
+// error, and is never retried.
+func executeProcess(command string, env []string, topologyRecovery *TopologyRecovery, hookType string, fullDescription string, async bool) (err error) {
+	policy := topologyRecovery.AnalysisEntry.ClusterConfig().GetRecoveryHookPolicy(hookType)
+	directives := []HookDirective{}
+	for attempt := 0; attempt <= policy.Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(policy.RetryInterval())
+			AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("Retrying %s: attempt %d of %d", fullDescription, attempt+1, policy.Retries+1))
+		}
+		// Log the command to be run and record how long it takes as this may be useful
+		AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("Running %s: %s", fullDescription, command))
+		start := time.Now()
+		var info string
+		var stdout, stderr string
+		if stdout, stderr, err = os.CommandRunWithTimeout(command, env, policy.Timeout()); err == nil {
+			info = fmt.Sprintf("Completed %s in %v", fullDescription, time.Since(start))
+		} else {
+			info = fmt.Sprintf("Execution of %s failed in %v with error: %v", fullDescription, time.Since(start), err)
+			log.Errorf(info)
+		}
+		auditTopologyRecoveryHookOutput(topologyRecovery, info, stdout, stderr)
+		attemptDirectives := parseHookDirectives(stdout)
+		directives = appendHookDirectives(directives, attemptDirectives)
+		if err == nil || (!async && hasAbortDirective(attemptDirectives)) {
+			break
+		}
+	}
+	if abortErr := applyHookDirectives(topologyRecovery, directives, fullDescription, async); abortErr != nil {
+		AuditTopologyRecovery(topologyRecovery, abortErr.Error())
+		return abortErr
 	}
-	AuditTopologyRecovery(topologyRecovery, info)
 	return err
 }
 
@@ -366,10 +460,10 @@ func executeProcesses(processes []string, description string, topologyRecovery *
 		}
 		if async {
 			// Ignore errors
-			go executeProcess(command, env, topologyRecovery, fullDescription)
+			go executeProcess(command, env, topologyRecovery, description, fullDescription, async)
 		} else {
-			if cmdErr := executeProcess(command, env, topologyRecovery, fullDescription); cmdErr != nil {
-				if failOnError {
+			if cmdErr := executeProcess(command, env, topologyRecovery, description, fullDescription, async); cmdErr != nil {
+				if failOnError || isHookAbortError(cmdErr) {
 					AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("Not running further %s hooks", description))
 					return cmdErr
 				}
@@ -489,10 +583,14 @@ func recoverDeadMaster(topologyRecovery *TopologyRecovery, candidateInstanceKey
 
 	inst.AuditOperation("recover-dead-master", failedInstanceKey, "problem found; will recover")
 	if !skipProcesses {
-		if err := executeProcesses(config.Config.PreFailoverProcesses, "PreFailoverProcesses", topologyRecovery, true); err != nil {
+		if err := executeProcesses(topologyRecovery.AnalysisEntry.ClusterConfig().PreFailoverProcesses, "PreFailoverProcesses", topologyRecovery, true); err != nil {
 			return false, nil, lostReplicas, topologyRecovery.AddError(err)
 		}
 	}
+	if topologyRecovery.IsVetoedCandidate(candidateInstanceKey) {
+		AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("RecoverDeadMaster: candidate %+v vetoed by recovery hook; ignoring it", *candidateInstanceKey))
+		candidateInstanceKey = nil
+	}
 
 	AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("RecoverDeadMaster: will recover %+v", *failedInstanceKey))
 
@@ -505,11 +603,22 @@ func recoverDeadMaster(topologyRecovery *TopologyRecovery, candidateInstanceKey
 	topologyRecovery.RecoveryType = masterRecoveryType
 	AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("RecoverDeadMaster: masterRecoveryType=%+v", masterRecoveryType))
 
+	if len(topologyRecovery.VetoedCandidates) > 0 && candidateInstanceKey == nil && masterRecoveryType != MasterRecoveryBinlogServer {
+		unvetoedCandidateKey, err := chooseUnvetoedCandidate(topologyRecovery, failedInstanceKey)
+		if err != nil {
+			return false, nil, lostReplicas, topologyRecovery.AddError(err)
+		}
+		candidateInstanceKey = unvetoedCandidateKey
+	}
+
 	promotedReplicaIsIdeal := func(promoted *inst.Instance) bool {
 		if promoted == nil {
 			return false
 		}
 		AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("RecoverDeadMaster: promotedReplicaIsIdeal(%+v)", promoted.Key))
+		if topologyRecovery.IsVetoedCandidate(&promoted.Key) {
+			return false
+		}
 		if promoted.Key.Equals(candidateInstanceKey) {
 			return true
 		}
@@ -548,7 +657,7 @@ func recoverDeadMaster(topologyRecovery *TopologyRecovery, candidateInstanceKey
 		AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("RecoverDeadMaster: - lost replica: %+v", replica.Key))
 	}
 
-	if promotedReplica != nil && len(lostReplicas) > 0 && config.Config.DetachLostReplicasAfterMasterFailover {
+	if promotedReplica != nil && len(lostReplicas) > 0 && topologyRecovery.AnalysisEntry.ClusterConfig().DetachLostReplicasAfterMasterFailover {
 		postponedFunction := func() error {
 			AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("RecoverDeadMaster: lost %+v replicas during recovery process; detaching them", len(lostReplicas)))
 			for _, replica := range lostReplicas {
@@ -589,8 +698,41 @@ func recoverDeadMaster(topologyRecovery *TopologyRecovery, candidateInstanceKey
 	return true, promotedReplica, lostReplicas, err
 }
 
+// chooseUnvetoedCandidate runs ahead of regrouping the replicas of a dead master, once recovery hooks have
+// vetoed candidates. Regrouping promotes the most up to date replica; if that replica is vetoed, the best
+// replica which is not vetoed is returned, to take over from it. When no replica may take over, regrouping
+// would leave the topology under a vetoed server, and an error is returned instead.
+func chooseUnvetoedCandidate(topologyRecovery *TopologyRecovery, failedInstanceKey *inst.InstanceKey) (*inst.InstanceKey, error) {
+	regroupCandidate, _, equalReplicas, laterReplicas, _, err := inst.GetCandidateReplica(failedInstanceKey, false)
+	if err != nil || regroupCandidate == nil {
+		// Regrouping will report the problem
+		return nil, nil
+	}
+	if !topologyRecovery.IsVetoedCandidate(&regroupCandidate.Key) {
+		return nil, nil
+	}
+	AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("RecoverDeadMaster: %+v would be promoted but is vetoed by recovery hook; looking for a replica to take over", regroupCandidate.Key))
+	// Replicas ahead of the regroup candidate are not regrouped, and so cannot take over
+	replicas := topologyRecovery.RemoveVetoedCandidates(append(equalReplicas, laterReplicas...))
+	for _, replica := range replicas {
+		if !isGenerallyValidAsWouldBeMaster(replica, true) {
+			continue
+		}
+		if canReplicate, _ := regroupCandidate.CanReplicateFrom(replica); !canReplicate {
+			continue
+		}
+		if satisfied, reason := MasterFailoverGeographicConstraintSatisfied(&topologyRecovery.AnalysisEntry, replica); !satisfied {
+			AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("skipping %+v; %s", replica.Key, reason))
+			continue
+		}
+		AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("RecoverDeadMaster: %+v will take over from %+v", replica.Key, regroupCandidate.Key))
+		return &replica.Key, nil
+	}
+	return nil, fmt.Errorf("RecoverDeadMaster: %+v would be promoted but is vetoed by recovery hook, and no other replica can take over; not regrouping", regroupCandidate.Key)
+}
+
 func MasterFailoverGeographicConstraintSatisfied(analysisEntry *inst.ReplicationAnalysis, suggestedInstance *inst.Instance) (satisfied bool, dissatisfiedReason string) {
-	if config.Config.PreventCrossDataCenterMasterFailover {
+	if analysisEntry.ClusterConfig().PreventCrossDataCenterMasterFailover {
 		if suggestedInstance.DataCenter != analysisEntry.AnalyzedInstanceDataCenter {
 			return false, fmt.Sprintf("PreventCrossDataCenterMasterFailover: will not promote server in %s when failed server in %s", suggestedInstance.DataCenter, analysisEntry.AnalyzedInstanceDataCenter)
 		}
@@ -608,6 +750,10 @@ func MasterFailoverGeographicConstraintSatisfied(analysisEntry *inst.Replication
 func SuggestReplacementForPromotedReplica(topologyRecovery *TopologyRecovery, deadInstanceKey *inst.InstanceKey, promotedReplica *inst.Instance, candidateInstanceKey *inst.InstanceKey) (replacement *inst.Instance, actionRequired bool, err error) {
 	candidateReplicas, _ := inst.ReadClusterCandidateInstances(promotedReplica.ClusterName)
 	candidateReplicas = inst.RemoveInstance(candidateReplicas, deadInstanceKey)
+	candidateReplicas = topologyRecovery.RemoveVetoedCandidates(candidateReplicas)
+	if topologyRecovery.IsVetoedCandidate(candidateInstanceKey) {
+		candidateInstanceKey = nil
+	}
 	deadInstance, _, err := inst.ReadInstance(deadInstanceKey)
 	if err != nil {
 		deadInstance = nil
@@ -702,10 +848,13 @@ func SuggestReplacementForPromotedReplica(topologyRecovery *TopologyRecovery, de
 		keepSearchingHint = fmt.Sprintf("Will keep searching; %s", reason)
 	} else if promotedReplica.PromotionRule == inst.PreferNotPromoteRule {
 		keepSearchingHint = fmt.Sprintf("Will keep searching because we have promoted a server with prefer_not rule: %+v", promotedReplica.Key)
+	} else if topologyRecovery.IsVetoedCandidate(&promotedReplica.Key) {
+		keepSearchingHint = fmt.Sprintf("Will keep searching because a recovery hook vetoed promotion of %+v", promotedReplica.Key)
 	}
 	if keepSearchingHint != "" {
 		AuditTopologyRecovery(topologyRecovery, keepSearchingHint)
 		neutralReplicas, _ := inst.ReadClusterNeutralPromotionRuleInstances(promotedReplica.ClusterName)
+		neutralReplicas = topologyRecovery.RemoveVetoedCandidates(neutralReplicas)
 
 		if candidateInstanceKey == nil {
 			// Still nothing? Then we didn't find a replica marked as "candidate". OK, further down the stream we have:
@@ -827,12 +976,15 @@ func checkAndRecoverDeadMaster(analysisEntry inst.ReplicationAnalysis, candidate
 	// That's it! We must do recovery!
 	AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("will handle DeadMaster event on %+v", analysisEntry.ClusterDetails.ClusterName))
 	recoverDeadMasterCounter.Inc(1)
+	demoteMasterInProxySQL(topologyRecovery, analysisEntry.ClusterDetails.ClusterAlias, &analysisEntry.AnalyzedInstanceKey)
 	recoveryAttempted, promotedReplica, lostReplicas, err := recoverDeadMaster(topologyRecovery, candidateInstanceKey, skipProcesses)
 	if err != nil {
 		AuditTopologyRecovery(topologyRecovery, err.Error())
 	}
 	topologyRecovery.LostReplicas.AddInstances(lostReplicas)
 	if !recoveryAttempted {
+		// Nothing changed; the master is restored in ProxySQL as it was prior to the recovery
+		promoteMasterInProxySQL(topologyRecovery, analysisEntry.ClusterDetails.ClusterAlias, &analysisEntry.AnalyzedInstanceKey)
 		return false, topologyRecovery, err
 	}
 
@@ -845,10 +997,13 @@ func checkAndRecoverDeadMaster(analysisEntry inst.ReplicationAnalysis, candidate
 		if satisfied, reason := MasterFailoverGeographicConstraintSatisfied(&analysisEntry, promotedReplica); !satisfied {
 			return nil, fmt.Errorf("RecoverDeadMaster: failed %+v promotion; %s", promotedReplica.Key, reason)
 		}
-		if config.Config.FailMasterPromotionIfSQLThreadNotUpToDate && !promotedReplica.SQLThreadUpToDate() {
+		if topologyRecovery.IsVetoedCandidate(&promotedReplica.Key) {
+			return nil, fmt.Errorf("RecoverDeadMaster: failed %+v promotion; promotion vetoed by recovery hook and no replacement found", promotedReplica.Key)
+		}
+		if analysisEntry.ClusterConfig().FailMasterPromotionIfSQLThreadNotUpToDate && !promotedReplica.SQLThreadUpToDate() {
 			return nil, fmt.Errorf("RecoverDeadMaster: failed promotion. FailMasterPromotionIfSQLThreadNotUpToDate is set and promoted replica %+v 's sql thread is not up to date (relay logs still unapplied). Aborting promotion", promotedReplica.Key)
 		}
-		if config.Config.DelayMasterPromotionIfSQLThreadNotUpToDate && !promotedReplica.SQLThreadUpToDate() {
+		if analysisEntry.ClusterConfig().DelayMasterPromotionIfSQLThreadNotUpToDate && !promotedReplica.SQLThreadUpToDate() {
 			AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("DelayMasterPromotionIfSQLThreadNotUpToDate: waiting for SQL thread on %+v", promotedReplica.Key))
 			if _, err := inst.WaitForSQLThreadUpToDate(&promotedReplica.Key, 0, 0); err != nil {
 				return nil, fmt.Errorf("DelayMasterPromotionIfSQLThreadNotUpToDate error: %+v", err)
@@ -870,7 +1025,7 @@ func checkAndRecoverDeadMaster(analysisEntry inst.ReplicationAnalysis, candidate
 		AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("RecoverDeadMaster: successfully promoted %+v", promotedReplica.Key))
 		AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("- RecoverDeadMaster: promoted server coordinates: %+v", promotedReplica.SelfBinlogCoordinates))
 
-		if config.Config.ApplyMySQLPromotionAfterMasterFailover || analysisEntry.CommandHint == inst.GracefulMasterTakeoverCommandHint {
+		if analysisEntry.ClusterConfig().ApplyMySQLPromotionAfterMasterFailover || analysisEntry.CommandHint == inst.GracefulMasterTakeoverCommandHint {
 			// on GracefulMasterTakeoverCommandHint it makes utter sense to RESET SLAVE ALL and read_only=0, and there is no sense in not doing so.
 			AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("- RecoverDeadMaster: will apply MySQL changes to promoted master"))
 			{
@@ -895,28 +1050,12 @@ func checkAndRecoverDeadMaster(analysisEntry inst.ReplicationAnalysis, candidate
 			}()
 		}
 
-		kvPairs := inst.GetClusterMasterKVPairs(analysisEntry.ClusterDetails.ClusterAlias, &promotedReplica.Key)
-		AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("Writing KV %+v", kvPairs))
-		if orcraft.IsRaftEnabled() {
-			for _, kvPair := range kvPairs {
-				_, err := orcraft.PublishCommand("put-key-value", kvPair)
-				log.Errore(err)
-			}
-			// since we'll be affecting 3rd party tools here, we _prefer_ to mitigate re-applying
-			// of the put-key-value event upon startup. We _recommend_ a snapshot in the near future.
-			go orcraft.PublishCommand("async-snapshot", "")
-		} else {
-			for _, kvPair := range kvPairs {
-				err := kv.PutKVPair(kvPair)
-				log.Errore(err)
-			}
-		}
-		{
-			AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("Distributing KV %+v", kvPairs))
-			err := kv.DistributePairs(kvPairs)
-			log.Errore(err)
-		}
-		if config.Config.MasterFailoverDetachReplicaMasterHost {
+		writeClusterMasterKVPairs(topologyRecovery, analysisEntry.ClusterDetails.ClusterAlias, &promotedReplica.Key)
+		promoteMasterInProxySQL(topologyRecovery, analysisEntry.ClusterDetails.ClusterAlias, &promotedReplica.Key)
+		repointClusterLinks(topologyRecovery, &analysisEntry.AnalyzedInstanceKey, &promotedReplica.Key)
+		// The master of a linked downstream cluster keeps on replicating from the upstream cluster; no detaching
+		tookOverClusterLink := takeOverClusterLink(topologyRecovery, promotedReplica)
+		if analysisEntry.ClusterConfig().MasterFailoverDetachReplicaMasterHost && !tookOverClusterLink {
 			postponedFunction := func() error {
 				AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("- RecoverDeadMaster: detaching master host on promoted master"))
 				inst.DetachReplicaMasterHost(&promotedReplica.Key)
@@ -941,7 +1080,7 @@ func checkAndRecoverDeadMaster(analysisEntry inst.ReplicationAnalysis, candidate
 
 		if !skipProcesses {
 			// Execute post master-failover processes
-			executeProcesses(config.Config.PostMasterFailoverProcesses, "PostMasterFailoverProcesses", topologyRecovery, false)
+			executeProcesses(analysisEntry.ClusterConfig().PostMasterFailoverProcesses, "PostMasterFailoverProcesses", topologyRecovery, false)
 		}
 	} else {
 		recoverDeadMasterFailureCounter.Inc(1)
@@ -950,6 +1089,117 @@ func checkAndRecoverDeadMaster(analysisEntry inst.ReplicationAnalysis, candidate
 	return true, topologyRecovery, err
 }
 
+// writeClusterMasterKVPairs writes and distributes the KV pairs pointing to given master of a cluster
+func writeClusterMasterKVPairs(topologyRecovery *TopologyRecovery, clusterAlias string, masterKey *inst.InstanceKey) {
+	kvPairs := inst.GetClusterMasterKVPairs(clusterAlias, masterKey)
+	AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("Writing KV %+v", kvPairs))
+	if orcraft.IsRaftEnabled() {
+		for _, kvPair := range kvPairs {
+			_, err := orcraft.PublishCommand("put-key-value", kvPair)
+			log.Errore(err)
+		}
+		// since we'll be affecting 3rd party tools here, we _prefer_ to mitigate re-applying
+		// of the put-key-value event upon startup. We _recommend_ a snapshot in the near future.
+		go orcraft.PublishCommand("async-snapshot", "")
+	} else {
+		for _, kvPair := range kvPairs {
+			err := kv.PutKVPair(kvPair)
+			log.Errore(err)
+		}
+	}
+	{
+		AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("Distributing KV %+v", kvPairs))
+		err := kv.DistributePairs(kvPairs)
+		log.Errore(err)
+	}
+}
+
+// repointClusterLinks relocates cluster link boundaries, which replicate from a failed (intermediate) master,
+// below its successor. Linked downstream clusters thus keep replicating from the upstream cluster.
+func repointClusterLinks(topologyRecovery *TopologyRecovery, failedInstanceKey *inst.InstanceKey, successorKey *inst.InstanceKey) {
+	boundaries, err := inst.ReadClusterLinkBoundaryReplicas(failedInstanceKey)
+	if err != nil {
+		topologyRecovery.AddError(err)
+		return
+	}
+	for _, boundary := range boundaries {
+		AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("- repointClusterLinks: relocating downstream cluster master %+v below %+v", boundary.Key, *successorKey))
+		topologyRecovery.ParticipatingInstanceKeys.AddKey(boundary.Key)
+		if _, err := inst.RelocateBelow(&boundary.Key, successorKey); err != nil {
+			topologyRecovery.AddError(err)
+			AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("- repointClusterLinks: failed relocating %+v: %+v", boundary.Key, err))
+			continue
+		}
+		inst.AuditOperation("repoint-cluster-link", &boundary.Key, fmt.Sprintf("relocated below %+v following failure of %+v", *successorKey, *failedInstanceKey))
+	}
+}
+
+// transferClusterLink moves a cluster link from a failed downstream cluster master onto its promoted replica
+func transferClusterLink(link *inst.ClusterLink, promotedKey *inst.InstanceKey) error {
+	failedKey := link.Key
+	transferredLink := *link
+	transferredLink.Key = *promotedKey
+	if orcraft.IsRaftEnabled() {
+		if _, err := orcraft.PublishCommand("unlink-cluster", failedKey); err != nil {
+			return err
+		}
+		_, err := orcraft.PublishCommand("link-cluster", transferredLink)
+		return err
+	}
+	if err := inst.UnlinkCluster(&failedKey); err != nil {
+		return err
+	}
+	return inst.WriteClusterLink(&transferredLink)
+}
+
+// takeOverClusterLink handles failover of a linked downstream cluster's master: the promoted replica becomes
+// the cluster link boundary, and is set to replicate from the failed master's upstream master. This requires
+// GTID, since the promoted replica's coordinates are meaningless on the upstream master.
+// Returns true when the promoted replica took over a cluster link.
+func takeOverClusterLink(topologyRecovery *TopologyRecovery, promotedReplica *inst.Instance) bool {
+	analysisEntry := &topologyRecovery.AnalysisEntry
+	link, err := inst.ReadClusterLink(&analysisEntry.AnalyzedInstanceKey)
+	if err != nil || link == nil {
+		return false
+	}
+	upstreamMasterKey := analysisEntry.AnalyzedInstanceMasterKey
+	AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("- RecoverDeadMaster: transferring cluster link %s of %+v onto %+v", link.DownstreamClusterAlias, link.Key, promotedReplica.Key))
+	if err := transferClusterLink(link, &promotedReplica.Key); err != nil {
+		topologyRecovery.AddError(err)
+		AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("- RecoverDeadMaster: failed transferring cluster link: %+v", err))
+		return false
+	}
+	if !(promotedReplica.SupportsOracleGTID || promotedReplica.IsMariaDB()) {
+		AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("- RecoverDeadMaster: %+v does not support GTID and cannot be automatically attached to upstream master %+v. Please attach it manually", promotedReplica.Key, upstreamMasterKey))
+		return true
+	}
+	attachToUpstream := func() error {
+		instance, err := inst.ReadTopologyInstance(&promotedReplica.Key)
+		if err != nil {
+			return err
+		}
+		if instance.IsReplica() {
+			// Promotion did not apply RESET SLAVE ALL
+			if _, err := inst.StopSlave(&promotedReplica.Key); err != nil {
+				return err
+			}
+		}
+		if _, err := inst.ChangeMasterTo(&promotedReplica.Key, &upstreamMasterKey, &promotedReplica.SelfBinlogCoordinates, false, inst.GTIDHintForce); err != nil {
+			return err
+		}
+		_, err = inst.StartSlave(&promotedReplica.Key)
+		return err
+	}
+	if err := attachToUpstream(); err != nil {
+		topologyRecovery.AddError(err)
+		AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("- RecoverDeadMaster: failed attaching %+v to upstream master %+v: %+v", promotedReplica.Key, upstreamMasterKey, err))
+		return true
+	}
+	topologyRecovery.ParticipatingInstanceKeys.AddKey(upstreamMasterKey)
+	AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("- RecoverDeadMaster: attached %+v to upstream master %+v", promotedReplica.Key, upstreamMasterKey))
+	return true
+}
+
 // isGenerallyValidAsCandidateSiblingOfIntermediateMaster sees that basic server configuration and state are valid
 func isGenerallyValidAsCandidateSiblingOfIntermediateMaster(sibling *inst.Instance) bool {
 	if !sibling.LogBinEnabled {
@@ -979,7 +1229,7 @@ func isValidAsCandidateSiblingOfIntermediateMaster(intermediateMasterInstance *i
 	if inst.IsBannedFromBeingCandidateReplica(sibling) {
 		return false
 	}
-	if sibling.HasReplicationFilters != intermediateMasterInstance.HasReplicationFilters {
+	if !sibling.ReplicationFilters.Equals(&intermediateMasterInstance.ReplicationFilters) {
 		return false
 	}
 	if sibling.IsBinlogServer() != intermediateMasterInstance.IsBinlogServer() {
@@ -1038,6 +1288,7 @@ func GetCandidateSiblingOfIntermediateMaster(topologyRecovery *TopologyRecovery,
 	if len(siblings) <= 1 {
 		return nil, log.Errorf("topology_recovery: no siblings found for %+v", intermediateMasterInstance.Key)
 	}
+	siblings = topologyRecovery.RemoveVetoedCandidates(siblings)
 
 	sort.Sort(sort.Reverse(InstancesByCountReplicas(siblings)))
 
@@ -1095,7 +1346,7 @@ func RecoverDeadIntermediateMaster(topologyRecovery *TopologyRecovery, skipProce
 
 	inst.AuditOperation("recover-dead-intermediate-master", failedInstanceKey, "problem found; will recover")
 	if !skipProcesses {
-		if err := executeProcesses(config.Config.PreFailoverProcesses, "PreFailoverProcesses", topologyRecovery, true); err != nil {
+		if err := executeProcesses(topologyRecovery.AnalysisEntry.ClusterConfig().PreFailoverProcesses, "PreFailoverProcesses", topologyRecovery, true); err != nil {
 			return nil, topologyRecovery.AddError(err)
 		}
 	}
@@ -1208,12 +1459,13 @@ func checkAndRecoverDeadIntermediateMaster(analysisEntry inst.ReplicationAnalysi
 	if promotedReplica != nil {
 		// success
 		recoverDeadIntermediateMasterSuccessCounter.Inc(1)
+		repointClusterLinks(topologyRecovery, &analysisEntry.AnalyzedInstanceKey, &promotedReplica.Key)
 
 		if !skipProcesses {
 			// Execute post intermediate-master-failover processes
 			topologyRecovery.SuccessorKey = &promotedReplica.Key
 			topologyRecovery.SuccessorAlias = promotedReplica.InstanceAlias
-			executeProcesses(config.Config.PostIntermediateMasterFailoverProcesses, "PostIntermediateMasterFailoverProcesses", topologyRecovery, false)
+			executeProcesses(analysisEntry.ClusterConfig().PostIntermediateMasterFailoverProcesses, "PostIntermediateMasterFailoverProcesses", topologyRecovery, false)
 		}
 	} else {
 		recoverDeadIntermediateMasterFailureCounter.Inc(1)
@@ -1233,7 +1485,7 @@ func RecoverDeadCoMaster(topologyRecovery *TopologyRecovery, skipProcesses bool)
 	}
 	inst.AuditOperation("recover-dead-co-master", failedInstanceKey, "problem found; will recover")
 	if !skipProcesses {
-		if err := executeProcesses(config.Config.PreFailoverProcesses, "PreFailoverProcesses", topologyRecovery, true); err != nil {
+		if err := executeProcesses(topologyRecovery.AnalysisEntry.ClusterConfig().PreFailoverProcesses, "PreFailoverProcesses", topologyRecovery, true); err != nil {
 			return nil, lostReplicas, topologyRecovery.AddError(err)
 		}
 	}
@@ -1286,7 +1538,7 @@ func RecoverDeadCoMaster(topologyRecovery *TopologyRecovery, skipProcesses bool)
 		}
 	}
 	if promotedReplica != nil {
-		if config.Config.DelayMasterPromotionIfSQLThreadNotUpToDate {
+		if topologyRecovery.AnalysisEntry.ClusterConfig().DelayMasterPromotionIfSQLThreadNotUpToDate {
 			AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("Waiting to ensure the SQL thread catches up on %+v", promotedReplica.Key))
 			if _, err := inst.WaitForSQLThreadUpToDate(&promotedReplica.Key, 0, 0); err != nil {
 				return promotedReplica, lostReplicas, err
@@ -1315,7 +1567,7 @@ func RecoverDeadCoMaster(topologyRecovery *TopologyRecovery, skipProcesses bool)
 		topologyRecovery.AddError(log.Errore(err))
 	}
 
-	if promotedReplica != nil && len(lostReplicas) > 0 && config.Config.DetachLostReplicasAfterMasterFailover {
+	if promotedReplica != nil && len(lostReplicas) > 0 && topologyRecovery.AnalysisEntry.ClusterConfig().DetachLostReplicasAfterMasterFailover {
 		postponedFunction := func() error {
 			AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("- RecoverDeadCoMaster: lost %+v replicas during recovery process; detaching them", len(lostReplicas)))
 			for _, replica := range lostReplicas {
@@ -1364,13 +1616,13 @@ func checkAndRecoverDeadCoMaster(analysisEntry inst.ReplicationAnalysis, candida
 	}
 	topologyRecovery.LostReplicas.AddInstances(lostReplicas)
 	if promotedReplica != nil {
-		if config.Config.FailMasterPromotionIfSQLThreadNotUpToDate && !promotedReplica.SQLThreadUpToDate() {
+		if topologyRecovery.AnalysisEntry.ClusterConfig().FailMasterPromotionIfSQLThreadNotUpToDate && !promotedReplica.SQLThreadUpToDate() {
 			return false, nil, log.Errorf("Promoted replica %+v: sql thread is not up to date (relay logs still unapplied). Aborting promotion", promotedReplica.Key)
 		}
 		// success
 		recoverDeadCoMasterSuccessCounter.Inc(1)
 
-		if config.Config.ApplyMySQLPromotionAfterMasterFailover {
+		if topologyRecovery.AnalysisEntry.ClusterConfig().ApplyMySQLPromotionAfterMasterFailover {
 			AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("- RecoverDeadMaster: will apply MySQL changes to promoted master"))
 			inst.SetReadOnly(&promotedReplica.Key, false)
 		}
@@ -1378,7 +1630,7 @@ func checkAndRecoverDeadCoMaster(analysisEntry inst.ReplicationAnalysis, candida
 			// Execute post intermediate-master-failover processes
 			topologyRecovery.SuccessorKey = &promotedReplica.Key
 			topologyRecovery.SuccessorAlias = promotedReplica.InstanceAlias
-			executeProcesses(config.Config.PostMasterFailoverProcesses, "PostMasterFailoverProcesses", topologyRecovery, false)
+			executeProcesses(topologyRecovery.AnalysisEntry.ClusterConfig().PostMasterFailoverProcesses, "PostMasterFailoverProcesses", topologyRecovery, false)
 		}
 	} else {
 		recoverDeadCoMasterFailureCounter.Inc(1)
@@ -1474,7 +1726,7 @@ func checkAndExecuteFailureDetectionProcesses(analysisEntry inst.ReplicationAnal
 	if skipProcesses {
 		return true, false, nil
 	}
-	err = executeProcesses(config.Config.OnFailureDetectionProcesses, "OnFailureDetectionProcesses", NewTopologyRecovery(analysisEntry), true)
+	err = executeProcesses(analysisEntry.ClusterConfig().OnFailureDetectionProcesses, "OnFailureDetectionProcesses", NewTopologyRecovery(analysisEntry), true)
 	return true, true, err
 }
 
@@ -1640,11 +1892,11 @@ func executeCheckAndRecoverFunction(analysisEntry inst.ReplicationAnalysis, cand
 	if !skipProcesses {
 		if topologyRecovery.SuccessorKey == nil {
 			// Execute general unsuccessful post failover processes
-			executeProcesses(config.Config.PostUnsuccessfulFailoverProcesses, "PostUnsuccessfulFailoverProcesses", topologyRecovery, false)
+			executeProcesses(topologyRecovery.AnalysisEntry.ClusterConfig().PostUnsuccessfulFailoverProcesses, "PostUnsuccessfulFailoverProcesses", topologyRecovery, false)
 		} else {
 			// Execute general post failover processes
 			inst.EndDowntime(topologyRecovery.SuccessorKey)
-			executeProcesses(config.Config.PostFailoverProcesses, "PostFailoverProcesses", topologyRecovery, false)
+			executeProcesses(topologyRecovery.AnalysisEntry.ClusterConfig().PostFailoverProcesses, "PostFailoverProcesses", topologyRecovery, false)
 		}
 	}
 	AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("Waiting for %d postponed functions", topologyRecovery.PostponedFunctionsContainer.Len()))
@@ -1653,6 +1905,13 @@ func executeCheckAndRecoverFunction(analysisEntry inst.ReplicationAnalysis, cand
 	if topologyRecovery.PostponedFunctionsContainer.Len() > 0 {
 		AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("Executed postponed functions: %+v", strings.Join(topologyRecovery.PostponedFunctionsContainer.Descriptions(), ", ")))
 	}
+	if config.Config.KVPublishReplicaPools {
+		// Replicas have likely been relocated; have proxies learn about the new replica pools without waiting
+		go SubmitReplicaPoolsToKvStores("", false)
+	}
+	if config.Config.ProxySQLSyncReaderHostgroups {
+		go SyncProxySQLReaders(false)
+	}
 	return recoveryAttempted, topologyRecovery, err
 }
 
@@ -1798,6 +2057,167 @@ func ForceMasterTakeover(clusterName string, destination *inst.Instance) (topolo
 	return topologyRecovery, nil
 }
 
+// drainWriteTransactions waits for long running write transactions on given master to complete, up to
+// GracefulMasterTakeoverDrainTimeoutSeconds. With "kill" drain mode, transactions still running by then are
+// killed (and thus rolled back); with "wait" drain mode, an error is returned.
+func drainWriteTransactions(masterKey *inst.InstanceKey, auditStep func(string)) error {
+	timeout := time.Duration(config.Config.GracefulMasterTakeoverDrainTimeoutSeconds) * time.Second
+	auditStep(fmt.Sprintf("Draining write transactions running %ds or more on %+v; mode=%s, timeout=%+v", config.Config.GracefulMasterTakeoverDrainMinSeconds, *masterKey, config.Config.GracefulMasterTakeoverDrainMode, timeout))
+
+	startTime := time.Now()
+	for {
+		processes, err := inst.ReadActiveWriteTransactions(masterKey, config.Config.GracefulMasterTakeoverDrainMinSeconds)
+		if err != nil {
+			return err
+		}
+		if len(processes) == 0 {
+			auditStep(fmt.Sprintf("No long running write transactions on %+v", *masterKey))
+			return nil
+		}
+		if time.Since(startTime) < timeout {
+			time.Sleep(time.Second)
+			continue
+		}
+		// Timeout
+		if config.Config.GracefulMasterTakeoverDrainMode != "kill" {
+			return fmt.Errorf("GracefulMasterTakeover: %d write transactions still running on %+v after %+v; first: id=%d, user=%s, started at %s", len(processes), *masterKey, timeout, processes[0].Id, processes[0].User, processes[0].StartedAt)
+		}
+		for _, process := range processes {
+			auditStep(fmt.Sprintf("Killing process %d on %+v: user=%s, host=%s, transaction started at %s", process.Id, *masterKey, process.User, process.Host, process.StartedAt))
+			if err := inst.KillProcess(masterKey, process.Id); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// registerAbortedGracefulTakeover registers a graceful takeover which failed prior to promotion as an
+// unsuccessful recovery, auditing the steps taken and the failure. The recovery is acknowledged right away,
+// as the topology is left unchanged, and further recoveries on the cluster must not be blocked.
+func registerAbortedGracefulTakeover(analysisEntry inst.ReplicationAnalysis, steps []string, err error) {
+	topologyRecovery, registrationErr := AttemptRecoveryRegistration(&analysisEntry, false, false)
+	if topologyRecovery == nil {
+		log.Errorf("GracefulMasterTakeover: unable to register aborted takeover: %+v", registrationErr)
+		return
+	}
+	for _, step := range steps {
+		AuditTopologyRecovery(topologyRecovery, step)
+	}
+	AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("GracefulMasterTakeover: aborted prior to promotion: %+v", err))
+	topologyRecovery.AddError(err)
+	resolveRecovery(topologyRecovery, nil)
+
+	comment := "graceful master takeover aborted prior to promotion"
+	if orcraft.IsRaftEnabled() {
+		ack := NewInternalAcknowledgement()
+		ack.Comment = comment
+		ack.UID = topologyRecovery.UID
+		_, err = orcraft.PublishCommand("ack-recovery", ack)
+	} else {
+		_, err = AcknowledgeRecoveryByUID(topologyRecovery.UID, "orchestrator", comment)
+	}
+	log.Errore(err)
+}
+
+// rollbackGracefulMasterTakeover restores the original topology following a failure after promotion:
+// the original master is made a writable master again, and the promoted instance as well as its original
+// siblings are relocated back below it. Rollback is refused when the promoted master has taken writes,
+// as these would be lost.
+func rollbackGracefulMasterTakeover(topologyRecovery *TopologyRecovery, analysisEntry *inst.ReplicationAnalysis, originalSiblings [](*inst.Instance), originalMasterCoordinates *inst.BinlogCoordinates, promotedMasterCoordinates *inst.BinlogCoordinates, gtidHint inst.OperationGTIDHint) error {
+	originalMasterKey := &analysisEntry.AnalyzedInstanceKey
+	promotedKey := topologyRecovery.SuccessorKey
+	auditStep := func(message string) {
+		AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("GracefulMasterTakeover rollback: %s", message))
+	}
+	auditStep(fmt.Sprintf("rolling back; original master: %+v, promoted: %+v", *originalMasterKey, *promotedKey))
+
+	promoted, err := inst.SetReadOnly(promotedKey, true)
+	auditStep(fmt.Sprintf("set read_only on promoted %+v: success=%t", *promotedKey, (err == nil)))
+	if err != nil {
+		return err
+	}
+	if !promoted.SelfBinlogCoordinates.Equals(promotedMasterCoordinates) {
+		auditStep(fmt.Sprintf("promoted %+v has taken writes: coordinates moved from %+v to %+v. Will not roll back", *promotedKey, *promotedMasterCoordinates, promoted.SelfBinlogCoordinates))
+		return fmt.Errorf("Promoted master %+v has taken writes; cannot roll back", *promotedKey)
+	}
+
+	originalMaster, err := inst.ReadTopologyInstance(originalMasterKey)
+	if err != nil {
+		return err
+	}
+	if originalMaster.IsReplica() {
+		if _, err := inst.StopSlave(originalMasterKey); err != nil {
+			auditStep(fmt.Sprintf("stop replication on original master %+v: %+v", *originalMasterKey, err))
+			return err
+		}
+		_, err := inst.ResetSlave(originalMasterKey)
+		auditStep(fmt.Sprintf("reset replication on original master %+v: success=%t", *originalMasterKey, (err == nil)))
+		if err != nil {
+			return err
+		}
+	}
+	if config.Config.GracefulMasterTakeoverSetSuperReadOnly {
+		inst.SetSuperReadOnly(originalMasterKey, false)
+	}
+	_, err = inst.SetReadOnly(originalMasterKey, false)
+	auditStep(fmt.Sprintf("set read_only=0 on original master %+v: success=%t", *originalMasterKey, (err == nil)))
+	if err != nil {
+		return err
+	}
+
+	if _, err := inst.ChangeMasterTo(promotedKey, originalMasterKey, originalMasterCoordinates, false, gtidHint); err != nil {
+		auditStep(fmt.Sprintf("repoint %+v below %+v: %+v", *promotedKey, *originalMasterKey, err))
+		return err
+	}
+	_, err = inst.StartSlave(promotedKey)
+	auditStep(fmt.Sprintf("repointed %+v below %+v at %+v: success=%t", *promotedKey, *originalMasterKey, *originalMasterCoordinates, (err == nil)))
+	if err != nil {
+		return err
+	}
+
+	for _, sibling := range originalSiblings {
+		_, err := inst.RelocateBelow(&sibling.Key, originalMasterKey)
+		auditStep(fmt.Sprintf("relocate %+v below %+v: success=%t", sibling.Key, *originalMasterKey, (err == nil)))
+		if err != nil {
+			topologyRecovery.AddError(err)
+		}
+	}
+
+	writeClusterMasterKVPairs(topologyRecovery, analysisEntry.ClusterDetails.ClusterAlias, originalMasterKey)
+	demoteMasterInProxySQL(topologyRecovery, analysisEntry.ClusterDetails.ClusterAlias, promotedKey)
+	promoteMasterInProxySQL(topologyRecovery, analysisEntry.ClusterDetails.ClusterAlias, originalMasterKey)
+	if alias := analysisEntry.ClusterDetails.ClusterAlias; alias != "" {
+		inst.SetClusterAlias(originalMasterKey.StringCode(), alias)
+	}
+	attributes.SetGeneralAttribute(analysisEntry.ClusterDetails.ClusterDomain, originalMasterKey.StringCode())
+	auditStep("done")
+	return nil
+}
+
+// repointDemotedMaster points the demoted master below the promoted master, at the coordinates the promoted
+// master had upon promotion, and sets up its replication credentials and SSL. Replication is not started.
+func repointDemotedMaster(demotedMasterKey *inst.InstanceKey, promotedMaster *inst.Instance, promotedMasterCoordinates *inst.BinlogCoordinates, demotedMasterCoordinates *inst.BinlogCoordinates, gtidHint inst.OperationGTIDHint, replicationUser string, replicationPassword string, replicationCredentialsError error) error {
+	demotedMaster, err := inst.ChangeMasterTo(demotedMasterKey, &promotedMaster.Key, promotedMasterCoordinates, false, gtidHint)
+	if err != nil {
+		return fmt.Errorf("failed repointing demoted master %+v below %+v: %+v", *demotedMasterKey, promotedMaster.Key, err)
+	}
+	if !demotedMaster.SelfBinlogCoordinates.Equals(demotedMasterCoordinates) {
+		log.Errorf("GracefulMasterTakeover: sanity problem. Demoted master's coordinates changed from %+v to %+v while supposed to have been frozen", *demotedMasterCoordinates, demotedMaster.SelfBinlogCoordinates)
+	}
+	if !demotedMaster.HasReplicationCredentials && replicationCredentialsError == nil {
+		if _, err := inst.ChangeMasterCredentials(demotedMasterKey, replicationUser, replicationPassword); err != nil {
+			return fmt.Errorf("failed setting replication credentials on demoted master %+v: %+v", *demotedMasterKey, err)
+		}
+	}
+	if promotedMaster.AllowTLS {
+		if _, err := inst.EnableMasterSSL(demotedMasterKey); err != nil {
+			return fmt.Errorf("failed enabling replication SSL on demoted master %+v: %+v", *demotedMasterKey, err)
+		}
+	}
+	return nil
+}
+
 // GracefulMasterTakeover will demote master of existing topology and promote its
 // direct replica instead.
 // It expects that replica to have no siblings.
@@ -1813,6 +2233,8 @@ func GracefulMasterTakeover(clusterName string, designatedKey *inst.InstanceKey)
 		return nil, nil, fmt.Errorf("Cannot deduce cluster master for %+v. Found %+v potential masters", clusterName, len(clusterMasters))
 	}
 	clusterMaster := clusterMasters[0]
+	// clusterMaster is re-read along the way; the key of the master to demote is kept on its own
+	demotedMasterKey := clusterMaster.Key
 
 	clusterMasterDirectReplicas, err := inst.ReadReplicaInstances(&clusterMaster.Key)
 	if err != nil {
@@ -1901,18 +2323,67 @@ func GracefulMasterTakeover(clusterName string, designatedKey *inst.InstanceKey)
 		SuccessorKey:  &designatedInstance.Key,
 		AnalysisEntry: analysisEntry,
 	}
-	if err := executeProcesses(config.Config.PreGracefulTakeoverProcesses, "PreGracefulTakeoverProcesses", preGracefulTakeoverTopologyRecovery, true); err != nil {
+	if err := executeProcesses(preGracefulTakeoverTopologyRecovery.AnalysisEntry.ClusterConfig().PreGracefulTakeoverProcesses, "PreGracefulTakeoverProcesses", preGracefulTakeoverTopologyRecovery, true); err != nil {
 		return nil, nil, fmt.Errorf("Failed running PreGracefulTakeoverProcesses: %+v", err)
 	}
+	if preGracefulTakeoverTopologyRecovery.IsVetoedCandidate(&designatedInstance.Key) {
+		return nil, nil, fmt.Errorf("GracefulMasterTakeover: promotion of %+v vetoed by PreGracefulTakeoverProcesses", designatedInstance.Key)
+	}
 
-	log.Infof("GracefulMasterTakeover: Will set %+v as read_only", clusterMaster.Key)
-	if clusterMaster, err = inst.SetReadOnly(&clusterMaster.Key, true); err != nil {
+	// Steps taken ahead of promotion are recorded once the recovery is registered
+	preTakeoverSteps := []string{}
+	auditPreTakeoverStep := func(message string) {
+		log.Infof("GracefulMasterTakeover: %s", message)
+		preTakeoverSteps = append(preTakeoverSteps, fmt.Sprintf("GracefulMasterTakeover: %s", message))
+	}
+	// undoProxySQLDemotion places the demoted master back as ProxySQL writer, for failures prior to promotion
+	undoProxySQLDemotion := func() {
+		restoreMasterInProxySQL(analysisEntry.ClusterDetails.ClusterAlias, &demotedMasterKey)
+	}
+	// undoReadOnly reverts the demoted master to writable, for failures prior to promotion
+	undoReadOnly := func() {
+		if config.Config.GracefulMasterTakeoverSetSuperReadOnly {
+			inst.SetSuperReadOnly(&demotedMasterKey, false)
+		}
+		_, err := inst.SetReadOnly(&demotedMasterKey, false)
+		auditPreTakeoverStep(fmt.Sprintf("undo read_only on %+v: success=%t", demotedMasterKey, (err == nil)))
+		undoProxySQLDemotion()
+	}
+
+	// abortTakeover records a failure prior to promotion, along with the steps taken so far
+	abortTakeover := func(err error) (*TopologyRecovery, *inst.BinlogCoordinates, error) {
+		registerAbortedGracefulTakeover(analysisEntry, preTakeoverSteps, err)
 		return nil, nil, err
 	}
+
+	// Writes are no longer routed to the master ahead of draining and making it read-only
+	if err := demoteMasterInProxySQLAheadOfTakeover(analysisEntry.ClusterDetails.ClusterAlias, &demotedMasterKey, auditPreTakeoverStep); err != nil {
+		undoProxySQLDemotion()
+		return abortTakeover(err)
+	}
+	if config.Config.GracefulMasterTakeoverDrainMode != "" {
+		if err := drainWriteTransactions(&clusterMaster.Key, auditPreTakeoverStep); err != nil {
+			undoProxySQLDemotion()
+			return abortTakeover(err)
+		}
+	}
+	auditPreTakeoverStep(fmt.Sprintf("Will set %+v as read_only", clusterMaster.Key))
+	if clusterMaster, err = inst.SetReadOnly(&demotedMasterKey, true); err != nil {
+		undoProxySQLDemotion()
+		return abortTakeover(err)
+	}
+	if config.Config.GracefulMasterTakeoverSetSuperReadOnly {
+		auditPreTakeoverStep(fmt.Sprintf("Will set %+v as super_read_only", clusterMaster.Key))
+		if err := inst.SetSuperReadOnly(&clusterMaster.Key, true); err != nil {
+			undoReadOnly()
+			return abortTakeover(err)
+		}
+	}
 	demotedMasterSelfBinlogCoordinates := &clusterMaster.SelfBinlogCoordinates
-	log.Infof("GracefulMasterTakeover: Will wait for %+v to reach master coordinates %+v", designatedInstance.Key, *demotedMasterSelfBinlogCoordinates)
+	auditPreTakeoverStep(fmt.Sprintf("Will wait for %+v to reach master coordinates %+v", designatedInstance.Key, *demotedMasterSelfBinlogCoordinates))
 	if designatedInstance, _, err = inst.WaitForExecBinlogCoordinatesToReach(&designatedInstance.Key, demotedMasterSelfBinlogCoordinates, time.Duration(config.Config.ReasonableMaintenanceReplicationLagSeconds)*time.Second); err != nil {
-		return nil, nil, err
+		undoReadOnly()
+		return abortTakeover(err)
 	}
 	promotedMasterCoordinates = &designatedInstance.SelfBinlogCoordinates
 
@@ -1927,34 +2398,45 @@ func GracefulMasterTakeover(clusterName string, designatedKey *inst.InstanceKey)
 	if topologyRecovery == nil {
 		return nil, nil, fmt.Errorf("GracefulMasterTakeover: recovery attempted but with no results. This should not happen")
 	}
+	for _, step := range preTakeoverSteps {
+		AuditTopologyRecovery(topologyRecovery, step)
+	}
 	if topologyRecovery.SuccessorKey == nil {
 		// Promotion fails.
 		// Undo setting read-only on original master.
-		inst.SetReadOnly(&clusterMaster.Key, false)
+		undoReadOnly()
+		AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("GracefulMasterTakeover: promotion failed; reverted read_only on %+v", demotedMasterKey))
 		return nil, nil, fmt.Errorf("GracefulMasterTakeover: Recovery attempted yet no replica promoted; err=%+v", err)
 	}
 	var gtidHint inst.OperationGTIDHint = inst.GTIDHintNeutral
 	if topologyRecovery.RecoveryType == MasterRecoveryGTID {
 		gtidHint = inst.GTIDHintForce
 	}
-	clusterMaster, err = inst.ChangeMasterTo(&clusterMaster.Key, &designatedInstance.Key, promotedMasterCoordinates, false, gtidHint)
-	if !clusterMaster.SelfBinlogCoordinates.Equals(demotedMasterSelfBinlogCoordinates) {
-		log.Errorf("GracefulMasterTakeover: sanity problem. Demoted master's coordinates changed from %+v to %+v while supposed to have been frozen", *demotedMasterSelfBinlogCoordinates, clusterMaster.SelfBinlogCoordinates)
-	}
-	if !clusterMaster.HasReplicationCredentials && replicationCredentialsError == nil {
-		_, credentialsErr := inst.ChangeMasterCredentials(&clusterMaster.Key, replicationUser, replicationPassword)
-		if err == nil {
-			err = credentialsErr
+	// Any failure after promotion, including one noted by the recovery itself, fails the takeover
+	postPromotionErr := err
+	if repointErr := repointDemotedMaster(&demotedMasterKey, designatedInstance, promotedMasterCoordinates, demotedMasterSelfBinlogCoordinates, gtidHint, replicationUser, replicationPassword, replicationCredentialsError); repointErr != nil {
+		topologyRecovery.AddError(repointErr)
+		if postPromotionErr == nil {
+			postPromotionErr = repointErr
 		}
 	}
-
-	if designatedInstance.AllowTLS {
-		_, enableSSLErr := inst.EnableMasterSSL(&clusterMaster.Key)
-		if err == nil {
-			err = enableSSLErr
+	if postPromotionErr != nil {
+		AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("GracefulMasterTakeover: failed after promotion: %+v", postPromotionErr))
+		if config.Config.GracefulMasterTakeoverAutoRollback {
+			originalSiblings := [](*inst.Instance){}
+			for _, directReplica := range clusterMasterDirectReplicas {
+				if !directReplica.Key.Equals(&designatedInstance.Key) {
+					originalSiblings = append(originalSiblings, directReplica)
+				}
+			}
+			if rollbackErr := rollbackGracefulMasterTakeover(topologyRecovery, &analysisEntry, originalSiblings, demotedMasterSelfBinlogCoordinates, promotedMasterCoordinates, gtidHint); rollbackErr != nil {
+				topologyRecovery.AddError(rollbackErr)
+				return topologyRecovery, promotedMasterCoordinates, fmt.Errorf("GracefulMasterTakeover: failed after promotion: %+v; rollback failed: %+v", postPromotionErr, rollbackErr)
+			}
+			return topologyRecovery, nil, fmt.Errorf("GracefulMasterTakeover: failed after promotion: %+v; rolled back to original topology", postPromotionErr)
 		}
 	}
-	executeProcesses(config.Config.PostGracefulTakeoverProcesses, "PostGracefulTakeoverProcesses", topologyRecovery, false)
+	executeProcesses(topologyRecovery.AnalysisEntry.ClusterConfig().PostGracefulTakeoverProcesses, "PostGracefulTakeoverProcesses", topologyRecovery, false)
 
-	return topologyRecovery, promotedMasterCoordinates, err
+	return topologyRecovery, promotedMasterCoordinates, postPromotionErr
 }
@@ -22,6 +22,7 @@ import (
 
 	"github.com/github/orchestrator/go/config"
 	"github.com/github/orchestrator/go/db"
+	"github.com/github/orchestrator/go/events"
 	"github.com/github/orchestrator/go/inst"
 	"github.com/github/orchestrator/go/process"
 	"github.com/github/orchestrator/go/raft"
@@ -247,23 +248,64 @@ func AttemptRecoveryRegistration(analysisEntry *inst.ReplicationAnalysis, failIf
 			return nil, log.Errore(err)
 		}
 	}
+	publishRecoveryEvent(events.RecoveryStarted, topologyRecovery, string(analysisEntry.Analysis))
 	return topologyRecovery, nil
 }
 
 // ClearActiveRecoveries clears the "in_active_period" flag for old-enough recoveries, thereby allowing for
-// further recoveries on cleared instances.
+// further recoveries on cleared instances. RecoveryPeriodBlockSeconds may be overridden per cluster.
 func ClearActiveRecoveries() error {
-	_, err := db.ExecOrchestrator(`
-			update topology_recovery set
-				in_active_period = 0,
-				end_active_period_unixtime = UNIX_TIMESTAMP()
-			where
-				in_active_period = 1
-				AND start_active_period < NOW() - INTERVAL ? SECOND
-			`,
-		config.Config.RecoveryPeriodBlockSeconds,
-	)
-	return log.Errore(err)
+	if len(config.Config.ClusterConfigOverrides) == 0 {
+		_, err := db.ExecOrchestrator(`
+				update topology_recovery set
+					in_active_period = 0,
+					end_active_period_unixtime = UNIX_TIMESTAMP()
+				where
+					in_active_period = 1
+					AND start_active_period < NOW() - INTERVAL ? SECOND
+				`,
+			config.Config.RecoveryPeriodBlockSeconds,
+		)
+		return log.Errore(err)
+	}
+	expiredRecoveryIds := []int64{}
+	query := `
+		select
+			recovery_id,
+			cluster_name,
+			cluster_alias,
+			unix_timestamp() - unix_timestamp(start_active_period) as seconds_since_start
+		from
+			topology_recovery
+		where
+			in_active_period = 1
+		`
+	err := db.QueryOrchestrator(query, sqlutils.Args(), func(m sqlutils.RowMap) error {
+		clusterConfig := config.Config.ForCluster(m.GetString("cluster_name"), m.GetString("cluster_alias"))
+		if m.GetInt64("seconds_since_start") > int64(clusterConfig.RecoveryPeriodBlockSeconds) {
+			expiredRecoveryIds = append(expiredRecoveryIds, m.GetInt64("recovery_id"))
+		}
+		return nil
+	})
+	if err != nil {
+		return log.Errore(err)
+	}
+	for _, recoveryId := range expiredRecoveryIds {
+		_, err := db.ExecOrchestrator(`
+				update topology_recovery set
+					in_active_period = 0,
+					end_active_period_unixtime = UNIX_TIMESTAMP()
+				where
+					recovery_id = ?
+					AND in_active_period = 1
+				`,
+			recoveryId,
+		)
+		if err != nil {
+			return log.Errore(err)
+		}
+	}
+	return nil
 }
 
 // RegisterBlockedRecoveries writes down currently blocked recoveries, and indicates what recovery they are blocked on.
@@ -809,9 +851,10 @@ func writeTopologyRecoveryStep(topologyRecoveryStep *TopologyRecoveryStep) error
 	sqlResult, err := db.ExecOrchestrator(`
 			insert ignore
 				into topology_recovery_steps (
-					recovery_step_id, recovery_uid, audit_at, message
-				) values (?, ?, now(), ?)
+					recovery_step_id, recovery_uid, audit_at, message, stdout, stderr
+				) values (?, ?, now(), ?, ?, ?)
 			`, sqlutils.NilIfZero(topologyRecoveryStep.Id), topologyRecoveryStep.RecoveryUID, topologyRecoveryStep.Message,
+		topologyRecoveryStep.Stdout, topologyRecoveryStep.Stderr,
 	)
 	if err != nil {
 		return log.Errore(err)
@@ -825,7 +868,7 @@ func ReadTopologyRecoverySteps(recoveryUID string) ([]TopologyRecoveryStep, erro
 	res := []TopologyRecoveryStep{}
 	query := `
 		select
-			recovery_step_id, recovery_uid, audit_at, message
+			recovery_step_id, recovery_uid, audit_at, message, stdout, stderr
 		from
 			topology_recovery_steps
 		where
@@ -839,6 +882,8 @@ func ReadTopologyRecoverySteps(recoveryUID string) ([]TopologyRecoveryStep, erro
 		recoveryStep.Id = m.GetInt64("recovery_step_id")
 		recoveryStep.AuditAt = m.GetString("audit_at")
 		recoveryStep.Message = m.GetString("message")
+		recoveryStep.Stdout = m.GetString("stdout")
+		recoveryStep.Stderr = m.GetString("stderr")
 
 		res = append(res, recoveryStep)
 		return nil
@@ -0,0 +1,171 @@
+/*
+   Copyright 2019 GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/github/orchestrator/go/inst"
+)
+
+// maxHookOutputLength is the max length of hook stdout/stderr stored with a recovery step.
+// Longer output is truncated, keeping its tail.
+const maxHookOutputLength = 16384
+
+// HookDirective is a structured instruction a recovery hook may print to its standard output,
+// as a single line JSON object. Any other output is ignored. Example:
+//
+//	{"abort": true, "message": "maintenance window in progress"}
+//	{"veto_candidate": "db-0042.dc1:3306", "message": "scheduled for decommission"}
+type HookDirective struct {
+	Abort          bool     `json:"abort"`
+	VetoCandidate  string   `json:"veto_candidate"`
+	VetoCandidates []string `json:"veto_candidates"`
+	Message        string   `json:"message"`
+}
+
+// vetoedCandidates returns all candidates vetoed by this directive
+func (this *HookDirective) vetoedCandidates() (candidates []string) {
+	if this.VetoCandidate != "" {
+		candidates = append(candidates, this.VetoCandidate)
+	}
+	for _, candidate := range this.VetoCandidates {
+		if candidate != "" {
+			candidates = append(candidates, candidate)
+		}
+	}
+	return candidates
+}
+
+// hookAbortError is returned by a hook which instructed recovery to abort
+type hookAbortError struct {
+	description string
+	message     string
+}
+
+func (this *hookAbortError) Error() string {
+	if this.message == "" {
+		return fmt.Sprintf("%s requested recovery abort", this.description)
+	}
+	return fmt.Sprintf("%s requested recovery abort: %s", this.description, this.message)
+}
+
+// isHookAbortError checks whether given error indicates a hook requested recovery abort
+func isHookAbortError(err error) bool {
+	_, ok := err.(*hookAbortError)
+	return ok
+}
+
+// parseHookDirectives extracts directives printed by a hook. Each line which is a JSON object is
+// considered a directive; other lines are ignored.
+func parseHookDirectives(stdout string) (directives []HookDirective) {
+	for _, line := range strings.Split(stdout, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "{") || !strings.HasSuffix(line, "}") {
+			continue
+		}
+		directive := HookDirective{}
+		if err := json.Unmarshal([]byte(line), &directive); err != nil {
+			continue
+		}
+		directives = append(directives, directive)
+	}
+	return directives
+}
+
+// appendHookDirectives appends directives not already listed, such that directives repeated by a retried hook
+// are applied once
+func appendHookDirectives(directives []HookDirective, more []HookDirective) []HookDirective {
+	for _, directive := range more {
+		listed := false
+		for _, listedDirective := range directives {
+			listed = listed || reflect.DeepEqual(listedDirective, directive)
+		}
+		if !listed {
+			directives = append(directives, directive)
+		}
+	}
+	return directives
+}
+
+// hasAbortDirective returns true when any of given directives requests recovery abort
+func hasAbortDirective(directives []HookDirective) bool {
+	for _, directive := range directives {
+		if directive.Abort {
+			return true
+		}
+	}
+	return false
+}
+
+// truncateHookOutput makes hook output fit for storing with a recovery step: invalid UTF-8 is replaced
+// and long output is truncated, keeping its tail, where errors are most commonly found.
+func truncateHookOutput(output string) string {
+	if !utf8.ValidString(output) {
+		valid := make([]rune, 0, len(output))
+		for i := 0; i < len(output); {
+			r, size := utf8.DecodeRuneInString(output[i:])
+			valid = append(valid, r)
+			i += size
+		}
+		output = string(valid)
+	}
+	if len(output) <= maxHookOutputLength {
+		return output
+	}
+	output = output[len(output)-maxHookOutputLength:]
+	for len(output) > 0 && !utf8.RuneStart(output[0]) {
+		output = output[1:]
+	}
+	return "[truncated]..." + output
+}
+
+// applyHookDirectives applies directives printed by a hook onto the recovery. Vetoes and aborts are only
+// honored for synchronous hooks; an abort is returned as error.
+func applyHookDirectives(topologyRecovery *TopologyRecovery, directives []HookDirective, fullDescription string, async bool) (err error) {
+	for _, directive := range directives {
+		if directive.Message != "" {
+			AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("%s: %s", fullDescription, directive.Message))
+		}
+		if async {
+			if directive.Abort || len(directive.vetoedCandidates()) > 0 {
+				AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("%s: ignoring abort/veto directive of async hook", fullDescription))
+			}
+			continue
+		}
+		for _, candidate := range directive.vetoedCandidates() {
+			candidateKey, parseErr := inst.ParseResolveInstanceKey(candidate)
+			if parseErr != nil {
+				AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("%s: cannot parse vetoed candidate %s: %+v", fullDescription, candidate, parseErr))
+				continue
+			}
+			if topologyRecovery.VetoedCandidates == nil {
+				topologyRecovery.VetoedCandidates = *inst.NewInstanceKeyMap()
+			}
+			topologyRecovery.VetoedCandidates.AddKey(*candidateKey)
+			AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("%s: vetoed promotion of %+v", fullDescription, *candidateKey))
+		}
+		if directive.Abort && err == nil {
+			err = &hookAbortError{description: fullDescription, message: directive.Message}
+		}
+	}
+	return err
+}
@@ -0,0 +1,83 @@
+package logic
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/inst"
+	"github.com/openark/golib/log"
+	test "github.com/openark/golib/tests"
+)
+
+func init() {
+	log.SetLevel(log.ERROR)
+}
+
+func TestParseHookDirectives(t *testing.T) {
+	stdout := `checking maintenance window
+{"abort": true, "message": "maintenance in progress"}
+{not json}
+  {"veto_candidate": "db1:3306", "veto_candidates": ["db2:3306", ""]}
+done`
+	directives := parseHookDirectives(stdout)
+	test.S(t).ExpectEquals(len(directives), 2)
+	test.S(t).ExpectTrue(directives[0].Abort)
+	test.S(t).ExpectEquals(directives[0].Message, "maintenance in progress")
+	test.S(t).ExpectFalse(directives[1].Abort)
+	test.S(t).ExpectEquals(strings.Join(directives[1].vetoedCandidates(), ","), "db1:3306,db2:3306")
+
+	test.S(t).ExpectEquals(len(parseHookDirectives("")), 0)
+}
+
+func TestAppendHookDirectives(t *testing.T) {
+	// A retried hook repeats its directives
+	attempt := parseHookDirectives(`{"veto_candidates": ["db1:3306"], "message": "decommissioned"}`)
+	directives := appendHookDirectives([]HookDirective{}, attempt)
+	directives = appendHookDirectives(directives, attempt)
+	test.S(t).ExpectEquals(len(directives), 1)
+	test.S(t).ExpectFalse(hasAbortDirective(directives))
+
+	directives = appendHookDirectives(directives, parseHookDirectives(`{"abort": true}`))
+	test.S(t).ExpectEquals(len(directives), 2)
+	test.S(t).ExpectTrue(hasAbortDirective(directives))
+}
+
+func TestTruncateHookOutput(t *testing.T) {
+	test.S(t).ExpectEquals(truncateHookOutput("all good"), "all good")
+	test.S(t).ExpectEquals(truncateHookOutput("bad \xff byte"), "bad � byte")
+
+	long := strings.Repeat("a", maxHookOutputLength) + "tail"
+	truncated := truncateHookOutput(long)
+	test.S(t).ExpectTrue(strings.HasPrefix(truncated, "[truncated]..."))
+	test.S(t).ExpectTrue(strings.HasSuffix(truncated, "tail"))
+	test.S(t).ExpectEquals(len(truncated), len("[truncated]...")+maxHookOutputLength)
+}
+
+func TestHookAbortError(t *testing.T) {
+	var err error = &hookAbortError{description: "PreFailoverProcesses hook 1 of 1", message: "maintenance in progress"}
+	test.S(t).ExpectTrue(isHookAbortError(err))
+	test.S(t).ExpectEquals(err.Error(), "PreFailoverProcesses hook 1 of 1 requested recovery abort: maintenance in progress")
+	test.S(t).ExpectFalse(isHookAbortError(fmt.Errorf("exit status 1")))
+}
+
+func TestPrepareCommandPlaceholders(t *testing.T) {
+	topologyRecovery := NewTopologyRecovery(inst.ReplicationAnalysis{})
+	topologyRecovery.SuccessorKey = &inst.InstanceKey{Hostname: "db-2", Port: 3306}
+	for _, placeholder := range config.RecoveryHookPlaceholders {
+		command := fmt.Sprintf("echo {%s}", placeholder)
+		prepared, _ := prepareCommand(command, topologyRecovery)
+		test.S(t).ExpectNotEquals(prepared, command)
+	}
+	// Values are given for listed placeholders only
+	listed := make(map[string]bool)
+	for _, placeholder := range config.RecoveryHookPlaceholders {
+		listed[placeholder] = true
+	}
+	values := recoveryHookPlaceholderValues(topologyRecovery)
+	test.S(t).ExpectEquals(len(values), len(config.RecoveryHookPlaceholders))
+	for placeholder := range values {
+		test.S(t).ExpectTrue(listed[placeholder])
+	}
+}
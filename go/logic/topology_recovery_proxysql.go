@@ -0,0 +1,97 @@
+/*
+   Copyright 2019 GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logic
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/inst"
+	"github.com/github/orchestrator/go/proxysql"
+	"github.com/openark/golib/log"
+)
+
+// demoteMasterInProxySQL takes a failed (or demoted) master out of its cluster's ProxySQL writer hostgroup.
+// A ProxySQL failure is audited, but does not stop the recovery.
+func demoteMasterInProxySQL(topologyRecovery *TopologyRecovery, clusterAlias string, masterKey *inst.InstanceKey) {
+	if !config.Config.IsProxySQLEnabled() {
+		return
+	}
+	applied, err := proxysql.DemoteMaster(clusterAlias, masterKey)
+	if !applied {
+		return
+	}
+	AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("ProxySQL: removed %+v from writer hostgroup: success=%t", *masterKey, (err == nil)))
+	if err != nil {
+		topologyRecovery.AddError(err)
+	}
+}
+
+// promoteMasterInProxySQL places a promoted master in its cluster's ProxySQL writer hostgroup
+func promoteMasterInProxySQL(topologyRecovery *TopologyRecovery, clusterAlias string, masterKey *inst.InstanceKey) {
+	if !config.Config.IsProxySQLEnabled() {
+		return
+	}
+	applied, err := proxysql.PromoteMaster(clusterAlias, masterKey)
+	if !applied {
+		return
+	}
+	AuditTopologyRecovery(topologyRecovery, fmt.Sprintf("ProxySQL: set %+v as writer: success=%t", *masterKey, (err == nil)))
+	if err != nil {
+		topologyRecovery.AddError(err)
+	}
+}
+
+// demoteMasterInProxySQLAheadOfTakeover takes the master out of its cluster's ProxySQL writer hostgroup ahead of
+// a graceful takeover, before the master is made read-only, such that writes are no longer routed to it.
+// Unlike in a failover, a ProxySQL failure stops the takeover.
+func demoteMasterInProxySQLAheadOfTakeover(clusterAlias string, masterKey *inst.InstanceKey, auditStep func(string)) error {
+	if !config.Config.IsProxySQLEnabled() {
+		return nil
+	}
+	applied, err := proxysql.DemoteMaster(clusterAlias, masterKey)
+	if applied {
+		auditStep(fmt.Sprintf("ProxySQL: removed %+v from writer hostgroup: success=%t", *masterKey, (err == nil)))
+	}
+	return err
+}
+
+// restoreMasterInProxySQL places the master back in its cluster's ProxySQL writer hostgroup, following
+// a graceful takeover which failed before promotion
+func restoreMasterInProxySQL(clusterAlias string, masterKey *inst.InstanceKey) {
+	if !config.Config.IsProxySQLEnabled() {
+		return
+	}
+	if applied, err := proxysql.PromoteMaster(clusterAlias, masterKey); applied {
+		log.Infof("GracefulMasterTakeover: ProxySQL: restored %+v as writer: success=%t", *masterKey, (err == nil))
+	}
+}
+
+var proxySQLReadersSyncEntrance int64
+
+// SyncProxySQLReaders makes ProxySQL reader hostgroups reflect clusters' healthy replicas. Unless forced,
+// a sync is skipped while another runs, such that syncs do not pile up behind slow ProxySQL servers.
+func SyncProxySQLReaders(force bool) (syncedCount int, err error) {
+	if !force {
+		if !atomic.CompareAndSwapInt64(&proxySQLReadersSyncEntrance, 0, 1) {
+			return syncedCount, nil
+		}
+		defer atomic.StoreInt64(&proxySQLReadersSyncEntrance, 0)
+	}
+	return proxysql.SyncAllReaders(force)
+}
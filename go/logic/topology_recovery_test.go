@@ -0,0 +1,21 @@
+package logic
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/github/orchestrator/go/inst"
+	test "github.com/openark/golib/tests"
+)
+
+func TestRepointDemotedMasterChangeMasterToFailure(t *testing.T) {
+	// An invalid key fails ChangeMasterTo without reaching any server; no instance is returned
+	demotedMasterKey := &inst.InstanceKey{}
+	promotedMaster := inst.NewInstance()
+	promotedMaster.Key = inst.InstanceKey{Hostname: "db-2", Port: 3306}
+	coordinates := &inst.BinlogCoordinates{LogFile: "mysql-bin.000001", LogPos: 4}
+
+	err := repointDemotedMaster(demotedMasterKey, promotedMaster, coordinates, coordinates, inst.GTIDHintNeutral, "repl", "secret", nil)
+	test.S(t).ExpectNotNil(err)
+	test.S(t).ExpectTrue(strings.Contains(err.Error(), "failed repointing demoted master"))
+}
@@ -24,11 +24,49 @@ import (
 	"github.com/rcrowley/go-metrics"
 	"net"
 	"strings"
+	"sync"
 	"time"
 )
 
+var graphiteMutex sync.Mutex
+var graphiteInitialized = false
+var graphiteStop chan struct{}
+
+func init() {
+	config.SubscribeReload("graphite", []string{
+		"GraphiteAddr",
+		"GraphitePath",
+		"GraphiteConvertHostnameDotsToUnderscores",
+		"GraphitePollSeconds",
+	}, ReloadGraphiteMetrics)
+}
+
 // InitGraphiteMetrics is called once in the lifetime of the app, after config has been loaded
 func InitGraphiteMetrics() error {
+	graphiteMutex.Lock()
+	defer graphiteMutex.Unlock()
+
+	graphiteInitialized = true
+	return startGraphiteMetrics()
+}
+
+// ReloadGraphiteMetrics restarts writing to graphite with current configuration, if already initialized
+func ReloadGraphiteMetrics() error {
+	graphiteMutex.Lock()
+	defer graphiteMutex.Unlock()
+
+	if !graphiteInitialized {
+		return nil
+	}
+	return startGraphiteMetrics()
+}
+
+// startGraphiteMetrics stops writing to graphite, if running, and starts anew per configuration
+func startGraphiteMetrics() error {
+	if graphiteStop != nil {
+		close(graphiteStop)
+		graphiteStop = nil
+	}
 	if config.Config.GraphiteAddr == "" {
 		return nil
 	}
@@ -51,7 +89,29 @@ func InitGraphiteMetrics() error {
 
 	log.Debugf("Will log to graphite on %+v, %+v", config.Config.GraphiteAddr, graphitePath)
 
-	go graphite.Graphite(metrics.DefaultRegistry, 1*time.Minute, graphitePath, addr)
+	graphiteConfig := graphite.GraphiteConfig{
+		Addr:          addr,
+		Registry:      metrics.DefaultRegistry,
+		FlushInterval: time.Duration(config.Config.GraphitePollSeconds) * time.Second,
+		DurationUnit:  time.Nanosecond,
+		Prefix:        graphitePath,
+		Percentiles:   []float64{0.5, 0.75, 0.95, 0.99, 0.999},
+	}
+	graphiteStop = make(chan struct{})
+	go func(stop chan struct{}) {
+		tick := time.NewTicker(graphiteConfig.FlushInterval)
+		defer tick.Stop()
+		for {
+			select {
+			case <-tick.C:
+				if err := graphite.GraphiteOnce(graphiteConfig); err != nil {
+					log.Errore(err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}(graphiteStop)
 
 	return nil
 }
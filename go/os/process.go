@@ -17,12 +17,14 @@
 package os
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/github/orchestrator/go/config"
 	"github.com/openark/golib/log"
@@ -66,6 +68,55 @@ func CommandRun(commandText string, env []string, arguments ...string) error {
 	return nil
 }
 
+// CommandRunWithTimeout executes some text as a command, same as CommandRun, and returns its
+// stdout and stderr, captured separately. When timeout is positive, the command, along with any
+// processes it spawned, is killed once the timeout elapses, and an error is returned.
+func CommandRunWithTimeout(commandText string, env []string, timeout time.Duration, arguments ...string) (stdout string, stderr string, err error) {
+	log.Infof("CommandRunWithTimeout(%v,%+v,%+v)", commandText, arguments, timeout)
+
+	cmd, shellScript, err := generateShellScript(commandText, env, arguments...)
+	defer os.Remove(shellScript)
+	if err != nil {
+		return stdout, stderr, log.Errore(err)
+	}
+	var stdoutBuffer, stderrBuffer bytes.Buffer
+	cmd.Stdout = &stdoutBuffer
+	cmd.Stderr = &stderrBuffer
+	// A process group of its own, so that a timeout also kills processes spawned by the command
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	log.Infof("CommandRunWithTimeout/running: %s", strings.Join(cmd.Args, " "))
+	if err := cmd.Start(); err != nil {
+		return stdout, stderr, log.Errore(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	var timeoutChan <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutChan = timer.C
+	}
+	select {
+	case err = <-done:
+	case <-timeoutChan:
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		<-done
+		err = fmt.Errorf("timed out after %+v", timeout)
+	}
+	stdout, stderr = stdoutBuffer.String(), stderrBuffer.String()
+	if err != nil {
+		if exitError, ok := err.(*exec.ExitError); ok {
+			log.Errorf("CommandRunWithTimeout: failed. exit status %d", exitError.Sys().(syscall.WaitStatus).ExitStatus())
+		}
+		return stdout, stderr, log.Errore(fmt.Errorf("(%s) %s", err.Error(), stderr))
+	}
+	log.Infof("CommandRunWithTimeout successful. exit status %d", cmd.ProcessState.Sys().(syscall.WaitStatus).ExitStatus())
+	return stdout, stderr, nil
+}
+
 // generateShellScript generates a temporary shell script based on
 // the given command to be executed, writes the command to a temporary
 // file and returns the exec.Command which can be executed together
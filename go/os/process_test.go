@@ -2,7 +2,9 @@ package os
 
 import (
 	"fmt"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestCommandRun(t *testing.T) {
@@ -16,3 +18,32 @@ func TestCommandRun(t *testing.T) {
 		t.Errorf(fmt.Sprintf("Expected CommandRun to return an Error '%s' but got '%s'", expectedMsg, cmdErr.Error()))
 	}
 }
+
+func TestCommandRunWithTimeout(t *testing.T) {
+	stdout, stderr, err := CommandRunWithTimeout("echo \"VAR1=$VAR1\" && echo oops >&2", []string{"VAR1=a"}, time.Second)
+	if err != nil {
+		t.Errorf("Expected CommandRunWithTimeout to succeed, but got '%+v'", err)
+	}
+	if stdout != "VAR1=a\n" {
+		t.Errorf("Expected stdout 'VAR1=a' but got '%s'", stdout)
+	}
+	if stderr != "oops\n" {
+		t.Errorf("Expected stderr 'oops' but got '%s'", stderr)
+	}
+}
+
+func TestCommandRunWithTimeoutExpired(t *testing.T) {
+	start := time.Now()
+	stdout, _, err := CommandRunWithTimeout("echo started && sleep 10 && echo done", []string{}, 200*time.Millisecond)
+	if err == nil {
+		t.Error("Expected CommandRunWithTimeout to time out, but no error returned")
+	} else if !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Expected a timeout error, but got '%+v'", err)
+	}
+	if stdout != "started\n" {
+		t.Errorf("Expected stdout 'started' but got '%s'", stdout)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("Expected command to be killed on timeout, but it ran for %+v", time.Since(start))
+	}
+}
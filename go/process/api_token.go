@@ -0,0 +1,131 @@
+/*
+   Copyright 2019 GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package process
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// API token scopes
+const (
+	APITokenScopeRead  = "read"
+	APITokenScopeWrite = "write"
+)
+
+const (
+	apiTokenIdBytes     = 8
+	apiTokenSecretBytes = 32
+)
+
+// APIToken is a long lived API token of a service account, presented as an "Authorization: Bearer" header.
+// The token itself, "<TokenId>.<secret>", is only known upon creation; the backend holds a hash of the secret.
+type APIToken struct {
+	TokenId         string
+	TokenHash       string `json:",omitempty"`
+	Name            string // The service account, authenticated as the user of requests bearing the token
+	Scope           string // APITokenScopeRead or APITokenScopeWrite
+	ClusterName     string // When non empty, the token may only change this cluster
+	CreatedBy       string
+	CreatedAt       time.Time
+	ExpiresAt       time.Time // Zero for a token which does not expire
+	CreatedAtString string
+	ExpiresAtString string
+}
+
+func randomHex(size int) (string, error) {
+	data := make([]byte, size)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(data), nil
+}
+
+func hashAPITokenSecret(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(hash[:])
+}
+
+// parseAPIToken splits a token into its id and secret
+func parseAPIToken(token string) (tokenId string, secret string, err error) {
+	tokens := strings.SplitN(strings.TrimSpace(token), ".", 2)
+	if len(tokens) != 2 || tokens[0] == "" || tokens[1] == "" {
+		return "", "", fmt.Errorf("Malformed API token")
+	}
+	return tokens[0], tokens[1], nil
+}
+
+// NewAPIToken generates a token for given service account, with an expiry unless expiry is zero.
+// It returns the token, to be handed to the service account, and the APIToken to store.
+func NewAPIToken(name string, scope string, clusterName string, createdBy string, expiry time.Duration) (token string, apiToken *APIToken, err error) {
+	if name == "" {
+		return "", nil, fmt.Errorf("NewAPIToken: service account name required")
+	}
+	switch scope {
+	case APITokenScopeRead, APITokenScopeWrite:
+	default:
+		return "", nil, fmt.Errorf("NewAPIToken: scope must be %s or %s. Given value: %s", APITokenScopeRead, APITokenScopeWrite, scope)
+	}
+	if expiry < 0 {
+		return "", nil, fmt.Errorf("NewAPIToken: expiry must be non-negative. Given value: %+v", expiry)
+	}
+	tokenId, err := randomHex(apiTokenIdBytes)
+	if err != nil {
+		return "", nil, err
+	}
+	secret, err := randomHex(apiTokenSecretBytes)
+	if err != nil {
+		return "", nil, err
+	}
+	apiToken = &APIToken{
+		TokenId:     tokenId,
+		TokenHash:   hashAPITokenSecret(secret),
+		Name:        name,
+		Scope:       scope,
+		ClusterName: clusterName,
+		CreatedBy:   createdBy,
+		CreatedAt:   time.Now(),
+	}
+	if expiry > 0 {
+		apiToken.ExpiresAt = apiToken.CreatedAt.Add(expiry)
+	}
+	return fmt.Sprintf("%s.%s", tokenId, secret), apiToken, nil
+}
+
+// matchesSecret checks whether given secret hashes to this token's hash
+func (this *APIToken) matchesSecret(secret string) bool {
+	return subtle.ConstantTimeCompare([]byte(hashAPITokenSecret(secret)), []byte(this.TokenHash)) == 1
+}
+
+// ExpiresIn is the time left until expiry; it is only meaningful for a token which expires
+func (this *APIToken) ExpiresIn() time.Duration {
+	return this.ExpiresAt.Sub(time.Now())
+}
+
+// CanWrite checks whether this token may change given cluster. An empty cluster name stands for
+// an action not bound to any single cluster, which cluster scoped tokens may not take.
+func (this *APIToken) CanWrite(clusterName string) bool {
+	if this.Scope != APITokenScopeWrite {
+		return false
+	}
+	return this.ClusterName == "" || this.ClusterName == clusterName
+}
@@ -0,0 +1,150 @@
+/*
+   Copyright 2019 GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package process
+
+import (
+	"fmt"
+
+	"github.com/github/orchestrator/go/db"
+	"github.com/openark/golib/log"
+	"github.com/openark/golib/sqlutils"
+)
+
+// WriteAPIToken stores an API token, as generated by NewAPIToken. It is the operation applied
+// by raft members upon token creation, and is idempotent: a token replayed from the raft log,
+// or already restored from a snapshot, is kept as it is.
+func WriteAPIToken(apiToken *APIToken) error {
+	query := `
+		insert ignore into api_token (
+				token_id, token_hash, name, scope, cluster_name, created_by, created_at, expires_at
+			) values (
+				?, ?, ?, ?, ?, ?, NOW(), NULL
+			)
+		`
+	args := sqlutils.Args(apiToken.TokenId, apiToken.TokenHash, apiToken.Name, apiToken.Scope, apiToken.ClusterName, apiToken.CreatedBy)
+	if !apiToken.ExpiresAt.IsZero() {
+		expiresInSeconds := int(apiToken.ExpiresIn().Seconds())
+		if expiresInSeconds < 0 {
+			expiresInSeconds = 0
+		}
+		query = `
+			insert ignore into api_token (
+					token_id, token_hash, name, scope, cluster_name, created_by, created_at, expires_at
+				) values (
+					?, ?, ?, ?, ?, ?, NOW(), NOW() + INTERVAL ? SECOND
+				)
+			`
+		args = append(args, expiresInSeconds)
+	}
+	if _, err := db.ExecOrchestrator(query, args...); err != nil {
+		return log.Errore(err)
+	}
+	return nil
+}
+
+// RevokeAPIToken removes an API token, such that it no longer authenticates
+func RevokeAPIToken(tokenId string) error {
+	sqlResult, err := db.ExecOrchestrator(`
+			delete from api_token where token_id=?
+		`,
+		tokenId,
+	)
+	if err != nil {
+		return log.Errore(err)
+	}
+	rows, err := sqlResult.RowsAffected()
+	if err != nil {
+		return log.Errore(err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("API token not found: %s", tokenId)
+	}
+	return nil
+}
+
+func readAPITokens(condition string, args []interface{}) (apiTokens [](*APIToken), err error) {
+	query := fmt.Sprintf(`
+		select
+				token_id,
+				token_hash,
+				name,
+				scope,
+				cluster_name,
+				created_by,
+				created_at,
+				ifnull(expires_at, '') as expires_at
+			from
+				api_token
+			where
+				%s
+			order by
+				name, created_at
+		`, condition)
+	err = db.QueryOrchestrator(query, args, func(m sqlutils.RowMap) error {
+		apiToken := &APIToken{
+			TokenId:         m.GetString("token_id"),
+			TokenHash:       m.GetString("token_hash"),
+			Name:            m.GetString("name"),
+			Scope:           m.GetString("scope"),
+			ClusterName:     m.GetString("cluster_name"),
+			CreatedBy:       m.GetString("created_by"),
+			CreatedAtString: m.GetString("created_at"),
+			ExpiresAtString: m.GetString("expires_at"),
+		}
+		apiTokens = append(apiTokens, apiToken)
+		return nil
+	})
+	return apiTokens, log.Errore(err)
+}
+
+// ReadAPITokens returns all API tokens, expired ones included, without their hashes
+func ReadAPITokens() (apiTokens [](*APIToken), err error) {
+	apiTokens, err = readAPITokens("1=1", sqlutils.Args())
+	for _, apiToken := range apiTokens {
+		apiToken.TokenHash = ""
+	}
+	return apiTokens, err
+}
+
+// ReadAPIToken returns an API token by id, without its hash, or nil if there is no such token
+func ReadAPIToken(tokenId string) (*APIToken, error) {
+	apiTokens, err := readAPITokens("token_id=?", sqlutils.Args(tokenId))
+	if err != nil || len(apiTokens) == 0 {
+		return nil, err
+	}
+	apiTokens[0].TokenHash = ""
+	return apiTokens[0], nil
+}
+
+// ValidateAPIToken returns the API token matching given token, provided it has not expired.
+// It returns nil for an unknown, mismatching or expired token.
+func ValidateAPIToken(token string) (*APIToken, error) {
+	tokenId, secret, err := parseAPIToken(token)
+	if err != nil {
+		return nil, nil
+	}
+	apiTokens, err := readAPITokens("token_id=? and (expires_at is null or expires_at > NOW())", sqlutils.Args(tokenId))
+	if err != nil || len(apiTokens) == 0 {
+		return nil, err
+	}
+	apiToken := apiTokens[0]
+	if !apiToken.matchesSecret(secret) {
+		return nil, nil
+	}
+	apiToken.TokenHash = ""
+	return apiToken, nil
+}
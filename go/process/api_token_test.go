@@ -0,0 +1,56 @@
+package process
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	test "github.com/openark/golib/tests"
+)
+
+func TestNewAPIToken(t *testing.T) {
+	{
+		_, _, err := NewAPIToken("", APITokenScopeRead, "", "admin", 0)
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		_, _, err := NewAPIToken("deploy-bot", "admin", "", "admin", 0)
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		_, _, err := NewAPIToken("deploy-bot", APITokenScopeWrite, "", "admin", -time.Hour)
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		token, apiToken, err := NewAPIToken("deploy-bot", APITokenScopeWrite, "c1", "admin", 0)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectTrue(apiToken.ExpiresAt.IsZero())
+		test.S(t).ExpectTrue(strings.HasPrefix(token, apiToken.TokenId+"."))
+		test.S(t).ExpectFalse(strings.Contains(token, apiToken.TokenHash))
+
+		tokenId, secret, err := parseAPIToken(token)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(tokenId, apiToken.TokenId)
+		test.S(t).ExpectTrue(apiToken.matchesSecret(secret))
+		test.S(t).ExpectFalse(apiToken.matchesSecret(secret + "0"))
+	}
+	{
+		_, apiToken, err := NewAPIToken("deploy-bot", APITokenScopeRead, "", "admin", time.Hour)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectTrue(apiToken.ExpiresIn() > 59*time.Minute)
+	}
+}
+
+func TestParseAPIToken(t *testing.T) {
+	for _, token := range []string{"", "0123abcd", "0123abcd.", ".secret"} {
+		_, _, err := parseAPIToken(token)
+		test.S(t).ExpectNotNil(err)
+	}
+}
+
+func TestAPITokenCanWrite(t *testing.T) {
+	test.S(t).ExpectFalse((&APIToken{Scope: APITokenScopeRead}).CanWrite("c1"))
+	test.S(t).ExpectTrue((&APIToken{Scope: APITokenScopeWrite}).CanWrite("c1"))
+	test.S(t).ExpectTrue((&APIToken{Scope: APITokenScopeWrite, ClusterName: "c1"}).CanWrite("c1"))
+	test.S(t).ExpectFalse((&APIToken{Scope: APITokenScopeWrite, ClusterName: "c1"}).CanWrite("c2"))
+}
@@ -0,0 +1,246 @@
+/*
+   Copyright 2019 GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package proxysql updates ProxySQL routing via its admin interface: the writer hostgroup of a cluster
+// follows the cluster's master, and the reader hostgroup follows the cluster's healthy replicas.
+package proxysql
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/inst"
+	"github.com/openark/golib/log"
+	"github.com/openark/golib/sqlutils"
+)
+
+const (
+	statusOnline      = "ONLINE"
+	statusOfflineSoft = "OFFLINE_SOFT"
+)
+
+// Statement is a single statement to execute on ProxySQL admin interfaces
+type Statement struct {
+	Query string
+	Args  []interface{}
+}
+
+func (this Statement) String() string {
+	return fmt.Sprintf("%s %+v", this.Query, this.Args)
+}
+
+var loadServersStatements = []Statement{
+	{Query: "load mysql servers to runtime"},
+	{Query: "save mysql servers to disk"},
+}
+
+// readersSyncedCache maps cluster alias to the reader statements last applied, so that unchanged
+// reader hostgroups are not reloaded
+var readersSyncedCache = map[string]string{}
+var readersSyncedMutex sync.Mutex
+
+// removeServerStatement removes a server from a hostgroup
+func removeServerStatement(hostgroup int, key *inst.InstanceKey) Statement {
+	return Statement{
+		Query: "delete from mysql_servers where hostgroup_id = ? and hostname = ? and port = ?",
+		Args:  []interface{}{hostgroup, key.Hostname, key.Port},
+	}
+}
+
+// setServerStatements adds a server to a hostgroup if not already there, and sets its status and weight.
+// Any other settings of a server already in the hostgroup are kept.
+func setServerStatements(hostgroup int, key *inst.InstanceKey, status string, weight int) []Statement {
+	return []Statement{
+		{
+			Query: "insert or ignore into mysql_servers (hostgroup_id, hostname, port) values (?, ?, ?)",
+			Args:  []interface{}{hostgroup, key.Hostname, key.Port},
+		},
+		{
+			Query: "update mysql_servers set status = ?, weight = ? where hostgroup_id = ? and hostname = ? and port = ?",
+			Args:  []interface{}{status, weight, hostgroup, key.Hostname, key.Port},
+		},
+	}
+}
+
+// DemoteMasterStatements returns the statements taking a master out of its writer hostgroup
+func DemoteMasterStatements(hostgroups config.ProxySQLHostgroups, masterKey *inst.InstanceKey) (statements []Statement) {
+	statements = append(statements, removeServerStatement(hostgroups.WriterHostgroup, masterKey))
+	return append(statements, loadServersStatements...)
+}
+
+// PromoteMasterStatements returns the statements making a newly promoted master the single server of its
+// writer hostgroup. With synced reader hostgroups, the master is removed from the reader hostgroup.
+func PromoteMasterStatements(hostgroups config.ProxySQLHostgroups, masterKey *inst.InstanceKey) (statements []Statement) {
+	statements = append(statements, Statement{
+		Query: "delete from mysql_servers where hostgroup_id = ? and not (hostname = ? and port = ?)",
+		Args:  []interface{}{hostgroups.WriterHostgroup, masterKey.Hostname, masterKey.Port},
+	})
+	statements = append(statements, setServerStatements(hostgroups.WriterHostgroup, masterKey, statusOnline, inst.ReplicaPoolMaxWeight)...)
+	if config.Config.ProxySQLSyncReaderHostgroups {
+		statements = append(statements, removeServerStatement(hostgroups.ReaderHostgroup, masterKey))
+	}
+	return append(statements, loadServersStatements...)
+}
+
+// SyncReadersStatements returns the statements making a reader hostgroup reflect a replica pool: included
+// replicas are online, weighted by lag; excluded replicas are soft-offline; servers not in the pool are removed.
+// An empty pool leaves the reader hostgroup untouched.
+func SyncReadersStatements(hostgroups config.ProxySQLHostgroups, pool *inst.ReplicaPool) (statements []Statement) {
+	if len(pool.Members) == 0 {
+		return statements
+	}
+	hostPorts := []interface{}{hostgroups.ReaderHostgroup}
+	placeholders := []string{}
+	for _, member := range pool.Members {
+		key := &inst.InstanceKey{Hostname: member.Hostname, Port: member.Port}
+		hostPorts = append(hostPorts, key.StringCode())
+		placeholders = append(placeholders, "?")
+		if member.Excluded {
+			statements = append(statements, Statement{
+				Query: "update mysql_servers set status = ? where hostgroup_id = ? and hostname = ? and port = ?",
+				Args:  []interface{}{statusOfflineSoft, hostgroups.ReaderHostgroup, key.Hostname, key.Port},
+			})
+		} else {
+			statements = append(statements, setServerStatements(hostgroups.ReaderHostgroup, key, statusOnline, member.Weight)...)
+		}
+	}
+	statements = append(statements, Statement{
+		Query: fmt.Sprintf("delete from mysql_servers where hostgroup_id = ? and hostname || ':' || port not in (%s)", strings.Join(placeholders, ", ")),
+		Args:  hostPorts,
+	})
+	return append(statements, loadServersStatements...)
+}
+
+// openAdmin connects to a ProxySQL admin interface
+func openAdmin(address string) (*sql.DB, error) {
+	uri := fmt.Sprintf("%s:%s@tcp(%s)/?timeout=%ds&interpolateParams=true",
+		config.Config.ProxySQLAdminUser,
+		config.Config.ProxySQLAdminPassword,
+		address,
+		config.Config.MySQLConnectTimeoutSeconds,
+	)
+	db, _, err := sqlutils.GetDB(uri)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	return db, nil
+}
+
+// execute runs given statements, in order, on all configured admin interfaces. Failure on one
+// admin interface does not prevent applying the statements on others.
+func execute(statements []Statement) (err error) {
+	for _, address := range config.Config.ProxySQLAdminAddresses {
+		if addressErr := executeOnAdmin(address, statements); addressErr != nil {
+			err = log.Errorf("proxysql %s: %+v", address, addressErr)
+		}
+	}
+	return err
+}
+
+func executeOnAdmin(address string, statements []Statement) error {
+	db, err := openAdmin(address)
+	if err != nil {
+		return err
+	}
+	for _, statement := range statements {
+		if _, err := db.Exec(statement.Query, statement.Args...); err != nil {
+			return fmt.Errorf("%s: %+v", statement.Query, err)
+		}
+	}
+	return nil
+}
+
+// DemoteMaster takes a master out of its cluster's writer hostgroup. Returns false when the cluster
+// is not managed in ProxySQL.
+func DemoteMaster(clusterAlias string, masterKey *inst.InstanceKey) (applied bool, err error) {
+	hostgroups, found := config.Config.GetProxySQLHostgroups(clusterAlias)
+	if !found {
+		return false, nil
+	}
+	log.Infof("proxysql: removing %+v from writer hostgroup %d of %s", *masterKey, hostgroups.WriterHostgroup, clusterAlias)
+	return true, execute(DemoteMasterStatements(hostgroups, masterKey))
+}
+
+// PromoteMaster places a master in its cluster's writer hostgroup. Returns false when the cluster
+// is not managed in ProxySQL.
+func PromoteMaster(clusterAlias string, masterKey *inst.InstanceKey) (applied bool, err error) {
+	hostgroups, found := config.Config.GetProxySQLHostgroups(clusterAlias)
+	if !found {
+		return false, nil
+	}
+	log.Infof("proxysql: setting %+v as writer in hostgroup %d of %s", *masterKey, hostgroups.WriterHostgroup, clusterAlias)
+	clearSyncedReaders(clusterAlias)
+	return true, execute(PromoteMasterStatements(hostgroups, masterKey))
+}
+
+// clearSyncedReaders forces next reader sync of given cluster
+func clearSyncedReaders(clusterAlias string) {
+	readersSyncedMutex.Lock()
+	defer readersSyncedMutex.Unlock()
+
+	delete(readersSyncedCache, clusterAlias)
+}
+
+// SyncReaders makes a cluster's reader hostgroup reflect its replica pool. Unless forced, a reader
+// hostgroup is only updated when the pool changed since last synced.
+func SyncReaders(pool *inst.ReplicaPool, force bool) (applied bool, err error) {
+	hostgroups, found := config.Config.GetProxySQLHostgroups(pool.ClusterAlias)
+	if !found {
+		return false, nil
+	}
+	statements := SyncReadersStatements(hostgroups, pool)
+	if len(statements) == 0 {
+		return false, nil
+	}
+	fingerprint := fmt.Sprintf("%+v", statements)
+
+	readersSyncedMutex.Lock()
+	defer readersSyncedMutex.Unlock()
+	if !force && readersSyncedCache[pool.ClusterAlias] == fingerprint {
+		return false, nil
+	}
+	if err := execute(statements); err != nil {
+		delete(readersSyncedCache, pool.ClusterAlias)
+		return true, err
+	}
+	readersSyncedCache[pool.ClusterAlias] = fingerprint
+	return true, nil
+}
+
+// SyncAllReaders syncs reader hostgroups of all clusters managed in ProxySQL
+func SyncAllReaders(force bool) (syncedCount int, err error) {
+	if !config.Config.IsProxySQLEnabled() || !config.Config.ProxySQLSyncReaderHostgroups {
+		return syncedCount, nil
+	}
+	pools, err := inst.ReadReplicaPools("")
+	if err != nil {
+		return syncedCount, log.Errore(err)
+	}
+	for i := range pools {
+		applied, poolErr := SyncReaders(&pools[i], force)
+		if poolErr != nil {
+			err = poolErr
+		} else if applied {
+			syncedCount++
+		}
+	}
+	return syncedCount, err
+}
@@ -0,0 +1,66 @@
+package proxysql
+
+import (
+	"testing"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/inst"
+	test "github.com/openark/golib/tests"
+)
+
+var testHostgroups = config.ProxySQLHostgroups{WriterHostgroup: 10, ReaderHostgroup: 20}
+var testMasterKey = inst.InstanceKey{Hostname: "db-1", Port: 3306}
+
+func TestDemoteMasterStatements(t *testing.T) {
+	statements := DemoteMasterStatements(testHostgroups, &testMasterKey)
+	test.S(t).ExpectEquals(len(statements), 3)
+	test.S(t).ExpectEquals(statements[0].Query, "delete from mysql_servers where hostgroup_id = ? and hostname = ? and port = ?")
+	test.S(t).ExpectEquals(statements[0].String(), "delete from mysql_servers where hostgroup_id = ? and hostname = ? and port = ? [10 db-1 3306]")
+	test.S(t).ExpectEquals(statements[1].Query, "load mysql servers to runtime")
+	test.S(t).ExpectEquals(statements[2].Query, "save mysql servers to disk")
+}
+
+func TestPromoteMasterStatements(t *testing.T) {
+	defer func(sync bool) { config.Config.ProxySQLSyncReaderHostgroups = sync }(config.Config.ProxySQLSyncReaderHostgroups)
+	{
+		config.Config.ProxySQLSyncReaderHostgroups = false
+		statements := PromoteMasterStatements(testHostgroups, &testMasterKey)
+		test.S(t).ExpectEquals(len(statements), 5)
+		test.S(t).ExpectEquals(statements[0].String(), "delete from mysql_servers where hostgroup_id = ? and not (hostname = ? and port = ?) [10 db-1 3306]")
+		test.S(t).ExpectEquals(statements[1].String(), "insert or ignore into mysql_servers (hostgroup_id, hostname, port) values (?, ?, ?) [10 db-1 3306]")
+		test.S(t).ExpectEquals(statements[2].String(), "update mysql_servers set status = ?, weight = ? where hostgroup_id = ? and hostname = ? and port = ? [ONLINE 100 10 db-1 3306]")
+	}
+	{
+		config.Config.ProxySQLSyncReaderHostgroups = true
+		statements := PromoteMasterStatements(testHostgroups, &testMasterKey)
+		test.S(t).ExpectEquals(len(statements), 6)
+		test.S(t).ExpectEquals(statements[3].String(), "delete from mysql_servers where hostgroup_id = ? and hostname = ? and port = ? [20 db-1 3306]")
+	}
+}
+
+func TestSyncReadersStatements(t *testing.T) {
+	pool := &inst.ReplicaPool{ClusterAlias: "mycluster"}
+	test.S(t).ExpectEquals(len(SyncReadersStatements(testHostgroups, pool)), 0)
+
+	pool.Members = []inst.ReplicaPoolMember{
+		{Hostname: "db-2", Port: 3306, Weight: 100},
+		{Hostname: "db-3", Port: 3306, Weight: 0, Excluded: true, ExclusionReason: "downtimed"},
+	}
+	statements := SyncReadersStatements(testHostgroups, pool)
+	test.S(t).ExpectEquals(len(statements), 6)
+	test.S(t).ExpectEquals(statements[0].String(), "insert or ignore into mysql_servers (hostgroup_id, hostname, port) values (?, ?, ?) [20 db-2 3306]")
+	test.S(t).ExpectEquals(statements[1].String(), "update mysql_servers set status = ?, weight = ? where hostgroup_id = ? and hostname = ? and port = ? [ONLINE 100 20 db-2 3306]")
+	test.S(t).ExpectEquals(statements[2].String(), "update mysql_servers set status = ? where hostgroup_id = ? and hostname = ? and port = ? [OFFLINE_SOFT 20 db-3 3306]")
+	test.S(t).ExpectEquals(statements[3].String(), "delete from mysql_servers where hostgroup_id = ? and hostname || ':' || port not in (?, ?) [20 db-2:3306 db-3:3306]")
+	test.S(t).ExpectEquals(statements[4].Query, "load mysql servers to runtime")
+}
+
+func TestNotManagedCluster(t *testing.T) {
+	applied, err := DemoteMaster("no-such-cluster", &testMasterKey)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectFalse(applied)
+
+	applied, err = SyncReaders(&inst.ReplicaPool{ClusterAlias: "no-such-cluster"}, true)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectFalse(applied)
+}
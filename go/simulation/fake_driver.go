@@ -0,0 +1,162 @@
+/*
+   Copyright 2019 GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package simulation
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"io"
+
+	"github.com/github/orchestrator/go/inst"
+)
+
+// fakeConnector is a database/sql connector to a FakeInstance. A connection to a dead instance is refused;
+// an existing connection to an instance which died is reported as bad, so that database/sql reconnects.
+type fakeConnector struct {
+	topology *FakeTopology
+	key      inst.InstanceKey
+}
+
+func (this *fakeConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	this.topology.mutex.Lock()
+	defer this.topology.mutex.Unlock()
+
+	if instance, found := this.topology.instances[this.key]; !found || !instance.Alive {
+		return nil, errConnectionRefused(this.key)
+	}
+	return &fakeConn{connector: this}, nil
+}
+
+func (this *fakeConnector) Driver() driver.Driver {
+	return fakeDriver{}
+}
+
+// fakeDriver only exists to satisfy driver.Connector; connections are made via fakeConnector
+type fakeDriver struct{}
+
+func (this fakeDriver) Open(name string) (driver.Conn, error) {
+	return nil, fmt.Errorf("simulation: connections are made via FakeTopology.Connect()")
+}
+
+type fakeConn struct {
+	connector *fakeConnector
+}
+
+func (this *fakeConn) isAlive() bool {
+	this.connector.topology.mutex.Lock()
+	defer this.connector.topology.mutex.Unlock()
+
+	instance, found := this.connector.topology.instances[this.connector.key]
+	return found && instance.Alive
+}
+
+func (this *fakeConn) run(query string, namedArgs []driver.NamedValue) (*fakeResult, error) {
+	if !this.isAlive() {
+		return nil, driver.ErrBadConn
+	}
+	args := []interface{}{}
+	for _, namedArg := range namedArgs {
+		args = append(args, namedArg.Value)
+	}
+	return this.connector.topology.execute(this.connector.key, query, args)
+}
+
+func (this *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if _, err := this.run(query, args); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(0), nil
+}
+
+func (this *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	result, err := this.run(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{result: result}, nil
+}
+
+func (this *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{conn: this, query: query}, nil
+}
+
+func (this *fakeConn) Close() error {
+	return nil
+}
+
+func (this *fakeConn) Begin() (driver.Tx, error) {
+	if !this.isAlive() {
+		return nil, driver.ErrBadConn
+	}
+	return fakeTx{}, nil
+}
+
+type fakeTx struct{}
+
+func (this fakeTx) Commit() error   { return nil }
+func (this fakeTx) Rollback() error { return nil }
+
+type fakeStmt struct {
+	conn  *fakeConn
+	query string
+}
+
+func (this *fakeStmt) Close() error  { return nil }
+func (this *fakeStmt) NumInput() int { return -1 }
+
+func toNamedValues(args []driver.Value) (namedArgs []driver.NamedValue) {
+	for i, arg := range args {
+		namedArgs = append(namedArgs, driver.NamedValue{Ordinal: i + 1, Value: arg})
+	}
+	return namedArgs
+}
+
+func (this *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return this.conn.ExecContext(context.Background(), this.query, toNamedValues(args))
+}
+
+func (this *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return this.conn.QueryContext(context.Background(), this.query, toNamedValues(args))
+}
+
+type fakeRows struct {
+	result *fakeResult
+	index  int
+}
+
+func (this *fakeRows) Columns() []string {
+	return this.result.columns
+}
+
+func (this *fakeRows) Close() error {
+	return nil
+}
+
+func (this *fakeRows) Next(dest []driver.Value) error {
+	if this.index >= len(this.result.rows) {
+		return io.EOF
+	}
+	row := this.result.rows[this.index]
+	this.index++
+	for i := range dest {
+		if i < len(row) {
+			dest[i] = row[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+/*
+   Copyright 2019 GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package simulation
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/github/orchestrator/go/inst"
+)
+
+const (
+	fakeBinlogFile      = "mysql-bin.000001"
+	fakeTransactionSize = 100
+	fakeBinlogHeader    = 4
+)
+
+// FakeInstance is an in-memory MySQL server, replicating (or not) from another FakeInstance.
+// All state is guarded by the owning FakeTopology.
+type FakeInstance struct {
+	Key        inst.InstanceKey
+	ServerID   uint
+	ServerUUID string
+	Version    string
+
+	ReadOnly        bool
+	SuperReadOnly   bool
+	LogBinEnabled   bool
+	LogSlaveUpdates bool
+	GTIDMode        string
+
+	// Alive is false when the server is down: connections to it fail
+	Alive bool
+
+	// executed maps server UUIDs to the sequence number of the last transaction applied from that server.
+	// GTID sets in a simulation are always contiguous, e.g. "uuid:1-17".
+	executed map[string]int64
+	// relayed is the master's executed set as fetched by the IO thread
+	relayed map[string]int64
+
+	MasterKey      inst.InstanceKey
+	MasterUser     string
+	AutoPosition   bool
+	IOThread       string // "Yes", "No", "Connecting"
+	SQLThread      string // "Yes", "No"
+	LastIOError    string
+	LastSQLError   string
+	ReadMasterPos  int64
+	ExecMasterPos  int64
+	SQLDelay       int64
+	LagSeconds     int64
+	SQLThreadStuck bool   // When true, SQL thread does not apply events (replica lags behind)
+	brokenIO       string // When non empty, IO thread stopped with given error
+
+	// WriteTransactions lists process ids of long running write transactions, until killed
+	WriteTransactions []int64
+
+	// Statements lists all statements executed on this instance, in order
+	Statements []string
+}
+
+func newFakeInstance(key inst.InstanceKey, serverID uint) *FakeInstance {
+	return &FakeInstance{
+		Key:             key,
+		ServerID:        serverID,
+		ServerUUID:      fmt.Sprintf("00000000-0000-0000-0000-%012d", serverID),
+		Version:         "5.7.26-log",
+		LogBinEnabled:   true,
+		LogSlaveUpdates: true,
+		GTIDMode:        "ON",
+		Alive:           true,
+		executed:        map[string]int64{},
+		relayed:         map[string]int64{},
+		IOThread:        "No",
+		SQLThread:       "No",
+	}
+}
+
+// IsReplica checks whether this instance is configured to replicate
+func (this *FakeInstance) IsReplica() bool {
+	return this.MasterKey.Hostname != ""
+}
+
+// transactionsCount returns the number of transactions applied on this instance
+func (this *FakeInstance) transactionsCount() (count int64) {
+	for _, seq := range this.executed {
+		count += seq
+	}
+	return count
+}
+
+// BinlogPos returns this instance's own binary log position
+func (this *FakeInstance) BinlogPos() int64 {
+	return fakeBinlogHeader + fakeTransactionSize*this.transactionsCount()
+}
+
+// ExecutedGtidSet returns @@gtid_executed
+func (this *FakeInstance) ExecutedGtidSet() string {
+	return gtidSetString(this.executed)
+}
+
+// write applies given number of transactions originating on this instance
+func (this *FakeInstance) write(transactions int64) {
+	this.executed[this.ServerUUID] += transactions
+}
+
+// replicationRunning checks whether both replication threads are configured to run
+func (this *FakeInstance) replicationRunning() bool {
+	return this.IOThread != "No" && this.SQLThread == "Yes"
+}
+
+// secondsBehindMaster returns Seconds_Behind_Master; NULL (invalid) when replication threads do not run
+func (this *FakeInstance) secondsBehindMaster() interface{} {
+	if this.IOThread != "Yes" || this.SQLThread != "Yes" {
+		return nil
+	}
+	return this.LagSeconds
+}
+
+func gtidSetString(set map[string]int64) string {
+	uuids := []string{}
+	for uuid, seq := range set {
+		if seq > 0 {
+			uuids = append(uuids, uuid)
+		}
+	}
+	sort.Strings(uuids)
+	tokens := []string{}
+	for _, uuid := range uuids {
+		tokens = append(tokens, fmt.Sprintf("%s:1-%d", uuid, set[uuid]))
+	}
+	return strings.Join(tokens, ",\n")
+}
+
+// parseGtidSet parses a GTID set as generated by gtidSetString
+func parseGtidSet(gtidSet string) map[string]int64 {
+	set := map[string]int64{}
+	for _, token := range strings.Split(gtidSet, ",") {
+		token = strings.TrimSpace(token)
+		if token == "" {
+			continue
+		}
+		var uuid string
+		var first, last int64
+		tokens := strings.SplitN(token, ":", 2)
+		if len(tokens) != 2 {
+			continue
+		}
+		uuid = tokens[0]
+		if n, _ := fmt.Sscanf(tokens[1], "%d-%d", &first, &last); n < 2 {
+			last = first
+		}
+		set[uuid] = last
+	}
+	return set
+}
+
+// gtidSubtract computes gtid_subtract(set1, set2) on contiguous GTID sets
+func gtidSubtract(set1 string, set2 string) string {
+	minuend := parseGtidSet(set1)
+	subtrahend := parseGtidSet(set2)
+	tokens := []string{}
+	uuids := []string{}
+	for uuid := range minuend {
+		uuids = append(uuids, uuid)
+	}
+	sort.Strings(uuids)
+	for _, uuid := range uuids {
+		if last, first := minuend[uuid], subtrahend[uuid]+1; first <= last {
+			if first == last {
+				tokens = append(tokens, fmt.Sprintf("%s:%d", uuid, first))
+			} else {
+				tokens = append(tokens, fmt.Sprintf("%s:%d-%d", uuid, first, last))
+			}
+		}
+	}
+	return strings.Join(tokens, ",\n")
+}
+
+// mergeGtidSets adds all transactions of source onto target
+func mergeGtidSets(target map[string]int64, source map[string]int64) {
+	for uuid, seq := range source {
+		if seq > target[uuid] {
+			target[uuid] = seq
+		}
+	}
+}
+
+func copyGtidSet(set map[string]int64) map[string]int64 {
+	result := map[string]int64{}
+	mergeGtidSets(result, set)
+	return result
+}
@@ -0,0 +1,543 @@
+/*
+   Copyright 2019 GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package simulation
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/github/orchestrator/go/inst"
+)
+
+// FakeTopology is a set of in-memory MySQL servers. It answers the statements orchestrator issues
+// on topology servers: discovery queries, replication control and read-only control.
+// Unsupported statements fail, and are listed by UnsupportedStatements().
+type FakeTopology struct {
+	mutex                 sync.Mutex
+	instances             map[inst.InstanceKey]*FakeInstance
+	dbs                   map[inst.InstanceKey]*sql.DB
+	nextServerID          uint
+	unsupportedStatements []string
+}
+
+// NewFakeTopology returns an empty topology
+func NewFakeTopology() *FakeTopology {
+	return &FakeTopology{
+		instances:    map[inst.InstanceKey]*FakeInstance{},
+		dbs:          map[inst.InstanceKey]*sql.DB{},
+		nextServerID: 1,
+	}
+}
+
+// Connect returns a connection pool to given server. The signature fits db.SetTopologyConnector()
+func (this *FakeTopology) Connect(host string, port int) (*sql.DB, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	key := inst.InstanceKey{Hostname: host, Port: port}
+	if db, found := this.dbs[key]; found {
+		return db, nil
+	}
+	db := sql.OpenDB(&fakeConnector{topology: this, key: key})
+	this.dbs[key] = db
+	return db, nil
+}
+
+// Close closes all connection pools
+func (this *FakeTopology) Close() {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	for _, db := range this.dbs {
+		db.Close()
+	}
+	this.dbs = map[inst.InstanceKey]*sql.DB{}
+}
+
+// AddInstance adds a standalone, writable server
+func (this *FakeTopology) AddInstance(key inst.InstanceKey) *FakeInstance {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	instance := newFakeInstance(key, this.nextServerID)
+	this.nextServerID++
+	this.instances[key] = instance
+	return instance
+}
+
+// AddReplica adds a read-only server, replicating from given master, with replication running
+func (this *FakeTopology) AddReplica(key inst.InstanceKey, masterKey inst.InstanceKey) *FakeInstance {
+	instance := this.AddInstance(key)
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	instance.ReadOnly = true
+	instance.MasterKey = masterKey
+	instance.MasterUser = "repl"
+	instance.AutoPosition = true
+	instance.IOThread = "Yes"
+	instance.SQLThread = "Yes"
+	this.replicate()
+	return instance
+}
+
+// Update applies given function on a server, under lock, then lets replication make progress.
+func (this *FakeTopology) Update(key inst.InstanceKey, f func(instance *FakeInstance)) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	instance, found := this.instances[key]
+	if !found {
+		return fmt.Errorf("simulation: unknown instance %+v", key)
+	}
+	f(instance)
+	this.replicate()
+	return nil
+}
+
+// Get returns a copy of the state of given server
+func (this *FakeTopology) Get(key inst.InstanceKey) (FakeInstance, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	instance, found := this.instances[key]
+	if !found {
+		return FakeInstance{}, fmt.Errorf("simulation: unknown instance %+v", key)
+	}
+	copied := *instance
+	copied.executed = copyGtidSet(instance.executed)
+	copied.relayed = copyGtidSet(instance.relayed)
+	copied.Statements = append([]string{}, instance.Statements...)
+	copied.WriteTransactions = append([]int64{}, instance.WriteTransactions...)
+	return copied, nil
+}
+
+// UnsupportedStatements lists statements the simulation could not handle. A non empty list
+// typically indicates a gap in the simulation, rather than in orchestrator.
+func (this *FakeTopology) UnsupportedStatements() []string {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	return append([]string{}, this.unsupportedStatements...)
+}
+
+// replicate lets replication threads make progress: IO threads fetch from their masters, SQL threads apply.
+// A chain of N servers settles within N rounds.
+func (this *FakeTopology) replicate() {
+	keys := []inst.InstanceKey{}
+	for key := range this.instances {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].StringCode() < keys[j].StringCode() })
+
+	for range keys {
+		for _, key := range keys {
+			instance := this.instances[key]
+			if !instance.Alive || !instance.IsReplica() {
+				continue
+			}
+			if instance.IOThread != "No" {
+				master, found := this.instances[instance.MasterKey]
+				if instance.brokenIO != "" {
+					instance.IOThread = "No"
+					instance.LastIOError = instance.brokenIO
+				} else if !found || !master.Alive || master == instance {
+					instance.IOThread = "Connecting"
+					instance.LastIOError = fmt.Sprintf("error connecting to master '%s@%s' - retry-time: 60  retries: 1", instance.MasterUser, instance.MasterKey.StringCode())
+				} else {
+					instance.IOThread = "Yes"
+					instance.LastIOError = ""
+					instance.relayed = copyGtidSet(master.executed)
+					instance.ReadMasterPos = master.BinlogPos()
+				}
+			}
+			if instance.SQLThread == "Yes" && !instance.SQLThreadStuck {
+				mergeGtidSets(instance.executed, instance.relayed)
+				instance.ExecMasterPos = instance.ReadMasterPos
+			}
+		}
+	}
+}
+
+// masterUUID returns the server UUID of given instance's master, if known
+func (this *FakeTopology) masterUUID(instance *FakeInstance) string {
+	if master, found := this.instances[instance.MasterKey]; found {
+		return master.ServerUUID
+	}
+	return ""
+}
+
+// replicasOf returns the servers actively replicating from given server, as seen by SHOW SLAVE HOSTS
+func (this *FakeTopology) replicasOf(instance *FakeInstance) (replicas []*FakeInstance) {
+	for _, replica := range this.instances {
+		if replica.Alive && replica.IOThread == "Yes" && replica.MasterKey.Equals(&instance.Key) {
+			replicas = append(replicas, replica)
+		}
+	}
+	sort.Slice(replicas, func(i, j int) bool { return replicas[i].ServerID < replicas[j].ServerID })
+	return replicas
+}
+
+type fakeResult struct {
+	columns []string
+	rows    [][]interface{}
+}
+
+type fakeStatementHandler struct {
+	pattern *regexp.Regexp
+	handle  func(this *FakeTopology, instance *FakeInstance, args []interface{}, submatch []string) (*fakeResult, error)
+}
+
+var whitespaceRegexp = regexp.MustCompile(`\s+`)
+
+// normalizeStatement lower cases a statement and collapses whitespace
+func normalizeStatement(statement string) string {
+	return strings.ToLower(strings.TrimSpace(whitespaceRegexp.ReplaceAllString(statement, " ")))
+}
+
+// execute runs a statement on given server
+func (this *FakeTopology) execute(key inst.InstanceKey, statement string, args []interface{}) (*fakeResult, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	instance, found := this.instances[key]
+	if !found || !instance.Alive {
+		return nil, errConnectionRefused(key)
+	}
+	normalized := normalizeStatement(statement)
+	if len(args) > 0 {
+		instance.Statements = append(instance.Statements, fmt.Sprintf("%s %+v", normalized, args))
+	} else {
+		instance.Statements = append(instance.Statements, normalized)
+	}
+	for _, handler := range fakeStatementHandlers {
+		if submatch := handler.pattern.FindStringSubmatch(normalized); submatch != nil {
+			result, err := handler.handle(this, instance, args, submatch)
+			this.replicate()
+			if result == nil {
+				result = &fakeResult{}
+			}
+			return result, err
+		}
+	}
+	this.unsupportedStatements = append(this.unsupportedStatements, normalized)
+	return nil, fmt.Errorf("simulation: unsupported statement on %+v: %s", key, normalized)
+}
+
+func errConnectionRefused(key inst.InstanceKey) error {
+	return fmt.Errorf("dial tcp %s: connect: connection refused", key.StringCode())
+}
+
+func boolValue(value interface{}) bool {
+	switch value := value.(type) {
+	case bool:
+		return value
+	case int64:
+		return value != 0
+	case string:
+		return value == "1" || strings.ToLower(value) == "on" || strings.ToLower(value) == "true"
+	}
+	return false
+}
+
+func boolInt(value bool) int64 {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+func errNotReplica() error {
+	return fmt.Errorf("Error 1200: The server is not configured as slave; fix in config file or with CHANGE MASTER TO")
+}
+
+func errReplicationRunning() error {
+	return fmt.Errorf("Error 1198: This operation cannot be performed with a running slave; run STOP SLAVE first")
+}
+
+var changeMasterAssignmentRegexp = regexp.MustCompile(`^(\w+)\s*=\s*(.*)$`)
+
+// changeMasterTo applies a CHANGE MASTER TO statement
+func changeMasterTo(this *FakeTopology, instance *FakeInstance, args []interface{}, submatch []string) (*fakeResult, error) {
+	if instance.IOThread != "No" || instance.SQLThread != "No" {
+		return nil, errReplicationRunning()
+	}
+	masterKey := instance.MasterKey
+	var logPos int64 = -1
+	for _, assignment := range strings.Split(submatch[1], ",") {
+		match := changeMasterAssignmentRegexp.FindStringSubmatch(strings.TrimSpace(assignment))
+		if match == nil {
+			return nil, fmt.Errorf("simulation: cannot parse change master to assignment: %s", assignment)
+		}
+		value := strings.Trim(match[2], `'"`)
+		if match[2] == "?" {
+			if len(args) == 0 {
+				return nil, fmt.Errorf("simulation: missing argument for %s", match[1])
+			}
+			value = fmt.Sprintf("%v", args[0])
+			args = args[1:]
+		}
+		switch match[1] {
+		case "master_host":
+			masterKey.Hostname = value
+		case "master_port":
+			masterKey.Port, _ = strconv.Atoi(value)
+		case "master_user":
+			instance.MasterUser = value
+		case "master_auto_position":
+			instance.AutoPosition = (value == "1")
+		case "master_log_pos":
+			logPos, _ = strconv.ParseInt(value, 10, 64)
+		}
+	}
+	if !masterKey.Equals(&instance.MasterKey) {
+		instance.relayed = map[string]int64{}
+		instance.ReadMasterPos = 0
+		instance.ExecMasterPos = 0
+		instance.LastIOError = ""
+		instance.LastSQLError = ""
+	}
+	if logPos >= 0 {
+		instance.ReadMasterPos = logPos
+		instance.ExecMasterPos = logPos
+	}
+	instance.MasterKey = masterKey
+	return nil, nil
+}
+
+func resetSlave(this *FakeTopology, instance *FakeInstance, args []interface{}, submatch []string) (*fakeResult, error) {
+	if instance.IOThread != "No" || instance.SQLThread != "No" {
+		return nil, errReplicationRunning()
+	}
+	instance.relayed = map[string]int64{}
+	instance.ReadMasterPos = 0
+	instance.ExecMasterPos = 0
+	instance.LastIOError = ""
+	instance.LastSQLError = ""
+	if submatch[1] != "" {
+		// reset slave all
+		instance.MasterKey = inst.InstanceKey{}
+		instance.MasterUser = ""
+		instance.AutoPosition = false
+	}
+	return nil, nil
+}
+
+func noop(this *FakeTopology, instance *FakeInstance, args []interface{}, submatch []string) (*fakeResult, error) {
+	return nil, nil
+}
+
+func singleRow(columns []string, values ...interface{}) *fakeResult {
+	return &fakeResult{columns: columns, rows: [][]interface{}{values}}
+}
+
+func slaveStatus(this *FakeTopology, instance *FakeInstance, args []interface{}, submatch []string) (*fakeResult, error) {
+	result := &fakeResult{
+		columns: []string{
+			"Slave_IO_State", "Master_Host", "Master_User", "Master_Port", "Master_Log_File", "Read_Master_Log_Pos",
+			"Relay_Log_File", "Relay_Log_Pos", "Relay_Master_Log_File", "Slave_IO_Running", "Slave_SQL_Running",
+			"Last_IO_Error", "Last_SQL_Error", "Exec_Master_Log_Pos", "Seconds_Behind_Master", "Master_SSL_Allowed",
+			"SQL_Delay", "Master_UUID", "Retrieved_Gtid_Set", "Executed_Gtid_Set", "Auto_Position",
+		},
+	}
+	if !instance.IsReplica() {
+		return result, nil
+	}
+	result.rows = append(result.rows, []interface{}{
+		"", instance.MasterKey.Hostname, instance.MasterUser, int64(instance.MasterKey.Port), fakeBinlogFile, instance.ReadMasterPos,
+		"relay-bin.000002", instance.ExecMasterPos, fakeBinlogFile, instance.IOThread, instance.SQLThread,
+		instance.LastIOError, instance.LastSQLError, instance.ExecMasterPos, instance.secondsBehindMaster(), "No",
+		instance.SQLDelay, this.masterUUID(instance), gtidSetString(instance.relayed), instance.ExecutedGtidSet(), boolInt(instance.AutoPosition),
+	})
+	return result, nil
+}
+
+var fakeStatementHandlers = []fakeStatementHandler{
+	// Discovery
+	{regexp.MustCompile(`^show variables like 'maxscale%'$`), func(this *FakeTopology, instance *FakeInstance, args []interface{}, submatch []string) (*fakeResult, error) {
+		return &fakeResult{columns: []string{"Variable_name", "Value"}}, nil
+	}},
+	{regexp.MustCompile(`^show global status like 'uptime'$`), func(this *FakeTopology, instance *FakeInstance, args []interface{}, submatch []string) (*fakeResult, error) {
+		return singleRow([]string{"Variable_name", "Value"}, "Uptime", int64(86400)), nil
+	}},
+	{regexp.MustCompile(`^select @@global.hostname, ifnull\(@@global.report_host, ''\), @@global.server_id`), func(this *FakeTopology, instance *FakeInstance, args []interface{}, submatch []string) (*fakeResult, error) {
+		return singleRow([]string{"hostname", "report_host", "server_id", "version", "version_comment", "read_only", "binlog_format", "log_bin", "log_slave_updates"},
+			instance.Key.Hostname, "", int64(instance.ServerID), instance.Version, "MySQL Community Server (GPL)", boolInt(instance.ReadOnly), "ROW", boolInt(instance.LogBinEnabled), boolInt(instance.LogSlaveUpdates)), nil
+	}},
+	{regexp.MustCompile(`^show master status$`), func(this *FakeTopology, instance *FakeInstance, args []interface{}, submatch []string) (*fakeResult, error) {
+		result := &fakeResult{columns: []string{"File", "Position", "Binlog_Do_DB", "Binlog_Ignore_DB", "Executed_Gtid_Set"}}
+		if instance.LogBinEnabled {
+			result.rows = append(result.rows, []interface{}{fakeBinlogFile, instance.BinlogPos(), "", "", instance.ExecutedGtidSet()})
+		}
+		return result, nil
+	}},
+	{regexp.MustCompile(`^show binary logs$`), func(this *FakeTopology, instance *FakeInstance, args []interface{}, submatch []string) (*fakeResult, error) {
+		if !instance.LogBinEnabled {
+			return nil, fmt.Errorf("Error 1381: You are not using binary logging")
+		}
+		return singleRow([]string{"Log_name", "File_size"}, fakeBinlogFile, instance.BinlogPos()), nil
+	}},
+	{regexp.MustCompile(`^select @@global.sql_mode, @@global.lower_case_table_names`), func(this *FakeTopology, instance *FakeInstance, args []interface{}, submatch []string) (*fakeResult, error) {
+		return singleRow([]string{"sql_mode", "lower_case_table_names", "character_set_server", "time_zone", "system_time_zone"},
+			"ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ENGINE_SUBSTITUTION", int64(0), "utf8mb4", "SYSTEM", "UTC"), nil
+	}},
+	{regexp.MustCompile(`^show global status like 'rpl_semi_sync_%_status'$`), func(this *FakeTopology, instance *FakeInstance, args []interface{}, submatch []string) (*fakeResult, error) {
+		return &fakeResult{columns: []string{"Variable_name", "Value"}}, nil
+	}},
+	{regexp.MustCompile(`^select @@global.gtid_mode, @@global.server_uuid, @@global.gtid_executed`), func(this *FakeTopology, instance *FakeInstance, args []interface{}, submatch []string) (*fakeResult, error) {
+		return singleRow([]string{"gtid_mode", "server_uuid", "gtid_executed", "gtid_purged", "master_info_repository", "binlog_row_image"},
+			instance.GTIDMode, instance.ServerUUID, instance.ExecutedGtidSet(), "", int64(0), "FULL"), nil
+	}},
+	{regexp.MustCompile(`^show slave status$`), slaveStatus},
+	{regexp.MustCompile(`^show slave hosts$`), func(this *FakeTopology, instance *FakeInstance, args []interface{}, submatch []string) (*fakeResult, error) {
+		result := &fakeResult{columns: []string{"Server_id", "Host", "Port", "Master_id", "Slave_UUID"}}
+		for _, replica := range this.replicasOf(instance) {
+			result.rows = append(result.rows, []interface{}{int64(replica.ServerID), replica.Key.Hostname, int64(replica.Key.Port), int64(instance.ServerID), replica.ServerUUID})
+		}
+		return result, nil
+	}},
+	{regexp.MustCompile(`^select substring_index\(host, ':', 1\) as slave_hostname from information_schema.processlist`), func(this *FakeTopology, instance *FakeInstance, args []interface{}, submatch []string) (*fakeResult, error) {
+		result := &fakeResult{columns: []string{"slave_hostname"}}
+		for _, replica := range this.replicasOf(instance) {
+			result.rows = append(result.rows, []interface{}{replica.Key.Hostname})
+		}
+		return result, nil
+	}},
+	{regexp.MustCompile(`^select gtid_subtract\(\?, \?\)$`), func(this *FakeTopology, instance *FakeInstance, args []interface{}, submatch []string) (*fakeResult, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("simulation: gtid_subtract expects 2 arguments")
+		}
+		return singleRow([]string{"gtid_subtract"}, gtidSubtract(fmt.Sprintf("%v", args[0]), fmt.Sprintf("%v", args[1]))), nil
+	}},
+	{regexp.MustCompile(`^select ifnull\(max\(user_name\), ''\) as user, ifnull\(max\(user_password\), ''\) as password from mysql.slave_master_info$`), func(this *FakeTopology, instance *FakeInstance, args []interface{}, submatch []string) (*fakeResult, error) {
+		return singleRow([]string{"user", "password"}, instance.MasterUser, "repl"), nil
+	}},
+	{regexp.MustCompile(`^show grants for current_user\(\)$`), func(this *FakeTopology, instance *FakeInstance, args []interface{}, submatch []string) (*fakeResult, error) {
+		return singleRow([]string{"Grants for orchestrator@%"}, "GRANT SUPER, PROCESS, REPLICATION SLAVE, REPLICATION CLIENT, RELOAD ON *.* TO 'orchestrator'@'%'"), nil
+	}},
+	{regexp.MustCompile(`^select processlist.id, processlist.user, processlist.host, .* from information_schema.innodb_trx`), func(this *FakeTopology, instance *FakeInstance, args []interface{}, submatch []string) (*fakeResult, error) {
+		result := &fakeResult{columns: []string{"id", "user", "host", "db", "command", "time", "state", "info", "trx_started"}}
+		for _, processId := range instance.WriteTransactions {
+			result.rows = append(result.rows, []interface{}{processId, "app", "app-1:40000", "test", "Sleep", int64(60), "", "", "2019-01-01 00:00:00"})
+		}
+		return result, nil
+	}},
+	{regexp.MustCompile(`^select master_pos_wait\(\?, \?\)$`), func(this *FakeTopology, instance *FakeInstance, args []interface{}, submatch []string) (*fakeResult, error) {
+		return singleRow([]string{"master_pos_wait"}, int64(0)), nil
+	}},
+
+	// Replication control
+	{regexp.MustCompile(`^stop slave$`), func(this *FakeTopology, instance *FakeInstance, args []interface{}, submatch []string) (*fakeResult, error) {
+		instance.IOThread = "No"
+		instance.SQLThread = "No"
+		return nil, nil
+	}},
+	{regexp.MustCompile(`^start slave$`), func(this *FakeTopology, instance *FakeInstance, args []interface{}, submatch []string) (*fakeResult, error) {
+		if !instance.IsReplica() {
+			return nil, errNotReplica()
+		}
+		instance.IOThread = "Connecting"
+		instance.SQLThread = "Yes"
+		return nil, nil
+	}},
+	{regexp.MustCompile(`^start slave until master_log_file=\?, master_log_pos=\?$`), func(this *FakeTopology, instance *FakeInstance, args []interface{}, submatch []string) (*fakeResult, error) {
+		if !instance.IsReplica() {
+			return nil, errNotReplica()
+		}
+		var untilPos int64
+		if len(args) == 2 {
+			fmt.Sscanf(fmt.Sprintf("%v", args[1]), "%d", &untilPos)
+		}
+		// Transactions are not split in a simulation: the SQL thread applies all it can, then stops at
+		// the requested position.
+		instance.IOThread = "Connecting"
+		instance.SQLThread = "Yes"
+		this.replicate()
+		instance.SQLThread = "No"
+		if untilPos < instance.ExecMasterPos {
+			instance.ExecMasterPos = untilPos
+		}
+		return nil, nil
+	}},
+	{regexp.MustCompile(`^(stop|start) slave (io|sql)_thread$`), func(this *FakeTopology, instance *FakeInstance, args []interface{}, submatch []string) (*fakeResult, error) {
+		if !instance.IsReplica() {
+			return nil, errNotReplica()
+		}
+		state := "No"
+		if submatch[1] == "start" {
+			state = "Yes"
+		}
+		if submatch[2] == "io" {
+			if state == "Yes" {
+				state = "Connecting"
+			}
+			instance.IOThread = state
+		} else {
+			instance.SQLThread = state
+		}
+		return nil, nil
+	}},
+	{regexp.MustCompile(`^change master to (.*)$`), changeMasterTo},
+	{regexp.MustCompile(`^reset slave( /\*!50603 all \*/| all)?$`), resetSlave},
+	{regexp.MustCompile(`^reset master$`), func(this *FakeTopology, instance *FakeInstance, args []interface{}, submatch []string) (*fakeResult, error) {
+		instance.executed = map[string]int64{}
+		return nil, nil
+	}},
+	{regexp.MustCompile(`^set global gtid_purged := \?$`), func(this *FakeTopology, instance *FakeInstance, args []interface{}, submatch []string) (*fakeResult, error) {
+		if len(args) == 1 {
+			mergeGtidSets(instance.executed, parseGtidSet(fmt.Sprintf("%v", args[0])))
+		}
+		return nil, nil
+	}},
+
+	// Server settings
+	{regexp.MustCompile(`^set global read_only = \?$`), func(this *FakeTopology, instance *FakeInstance, args []interface{}, submatch []string) (*fakeResult, error) {
+		if len(args) == 1 {
+			instance.ReadOnly = boolValue(args[0])
+			instance.SuperReadOnly = instance.SuperReadOnly && instance.ReadOnly
+		}
+		return nil, nil
+	}},
+	{regexp.MustCompile(`^set global super_read_only = \?$`), func(this *FakeTopology, instance *FakeInstance, args []interface{}, submatch []string) (*fakeResult, error) {
+		if len(args) == 1 {
+			instance.SuperReadOnly = boolValue(args[0])
+			instance.ReadOnly = instance.ReadOnly || instance.SuperReadOnly
+		}
+		return nil, nil
+	}},
+	{regexp.MustCompile(`^set @@global.rpl_semi_sync_(master|slave)_enabled=\?$`), noop},
+	{regexp.MustCompile(`^flush binary logs$`), noop},
+	{regexp.MustCompile(`^purge binary logs to \?$`), noop},
+	{regexp.MustCompile(`^kill( query)? \?$`), func(this *FakeTopology, instance *FakeInstance, args []interface{}, submatch []string) (*fakeResult, error) {
+		if len(args) == 1 {
+			processId, _ := strconv.ParseInt(fmt.Sprintf("%v", args[0]), 10, 64)
+			for i, id := range instance.WriteTransactions {
+				if id == processId {
+					instance.WriteTransactions = append(instance.WriteTransactions[:i], instance.WriteTransactions[i+1:]...)
+					break
+				}
+			}
+		}
+		return nil, nil
+	}},
+	{regexp.MustCompile(`^set global sql_slave_skip_counter := 1$`), noop},
+}
@@ -0,0 +1,406 @@
+/*
+   Copyright 2019 GitHub Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+/*
+Package simulation runs orchestrator's discovery, analysis and recovery against in-memory topologies,
+so that failure scenarios can be tested in pure Go, without MySQL servers. The orchestrator backend is
+an in-memory sqlite database.
+
+A scenario reads as a script:
+
+	scenario := simulation.NewScenario(t)
+	defer scenario.Close()
+
+	scenario.Build(`
+		db-1
+		  db-2
+		  db-3
+		    db-4
+	`)
+	scenario.Discover()
+	scenario.KillInstance("db-1")
+	scenario.Discover()
+	scenario.ExpectAnalysis("db-1", inst.DeadMaster)
+	scenario.Recover("db-1")
+	scenario.ExpectMaster("db-2")
+	scenario.ExpectReplicating("db-3", "db-2")
+
+Since orchestrator's configuration and backend are global, scenarios must not run in parallel.
+*/
+package simulation
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/db"
+	"github.com/github/orchestrator/go/inst"
+	"github.com/github/orchestrator/go/logic"
+	"github.com/openark/golib/sqlutils"
+)
+
+const defaultPort = 3306
+
+// Scenario scripts failures on a FakeTopology and asserts on orchestrator's analysis and recovery
+type Scenario struct {
+	t        testing.TB
+	Topology *FakeTopology
+}
+
+// NewScenario sets up orchestrator for simulation: an in-memory backend, cleared of any data, and an empty
+// fake topology. Call Close() when done.
+func NewScenario(t testing.TB) *Scenario {
+	config.Config.BackendDB = "sqlite3"
+	config.Config.SQLite3DataFile = ":memory:"
+	config.Config.HostnameResolveMethod = "none"
+	config.Config.MySQLHostnameResolveMethod = "none"
+	config.Config.DiscoverByShowSlaveHosts = true
+	config.Config.RecoverMasterClusterFilters = []string{"*"}
+	config.Config.RecoverIntermediateMasterClusterFilters = []string{"*"}
+	config.MarkConfigurationLoaded()
+	initRuntimeCLIFlags()
+
+	scenario := &Scenario{
+		t:        t,
+		Topology: NewFakeTopology(),
+	}
+	if err := resetBackend(); err != nil {
+		t.Fatalf("simulation: cannot reset backend: %+v", err)
+	}
+	db.SetTopologyConnector(scenario.Topology.Connect)
+	return scenario
+}
+
+// Close detaches orchestrator from the simulated topology
+func (this *Scenario) Close() {
+	db.SetTopologyConnector(nil)
+	this.Topology.Close()
+}
+
+// initRuntimeCLIFlags sets command line flags, which are otherwise set by the orchestrator binary, to their defaults
+func initRuntimeCLIFlags() {
+	falseValue := func() *bool { value := false; return &value }
+	emptyValue := func() *string { value := ""; return &value }
+	flags := &config.RuntimeCLIFlags
+	for _, flag := range []**bool{&flags.Noop, &flags.SkipUnresolve, &flags.SkipUnresolveCheck, &flags.GrabElection, &flags.Version,
+		&flags.SkipBinlogSearch, &flags.SkipContinuousRegistration, &flags.EnableDatabaseUpdate, &flags.IgnoreRaftSetup} {
+		if *flag == nil {
+			*flag = falseValue()
+		}
+	}
+	for _, flag := range []**string{&flags.BinlogFile, &flags.Statement, &flags.PromotionRule, &flags.Tag, &flags.EventType,
+		&flags.GTID, &flags.DesiredTopology} {
+		if *flag == nil {
+			*flag = emptyValue()
+		}
+	}
+}
+
+// resetBackend deletes all data from the orchestrator backend, keeping the schema
+func resetBackend() error {
+	if _, err := db.OpenOrchestrator(); err != nil {
+		return err
+	}
+	tableNames := []string{}
+	query := `select name from sqlite_master where type = 'table' and name != 'orchestrator_db_deployments'`
+	err := db.QueryOrchestrator(query, sqlutils.Args(), func(m sqlutils.RowMap) error {
+		tableNames = append(tableNames, m.GetString("name"))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, tableName := range tableNames {
+		if _, err := db.ExecOrchestrator(fmt.Sprintf("delete from %s", tableName)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Key parses "host" or "host:port" into an instance key. Port defaults to 3306.
+func Key(hostPort string) inst.InstanceKey {
+	tokens := strings.SplitN(strings.TrimSpace(hostPort), ":", 2)
+	key := inst.InstanceKey{Hostname: tokens[0], Port: defaultPort}
+	if len(tokens) == 2 {
+		fmt.Sscanf(tokens[1], "%d", &key.Port)
+	}
+	return key
+}
+
+// Build builds servers from an indented tree, one server per line. A server replicates from the
+// closest less-indented server above it. Servers with no indentation are writable masters.
+func (this *Scenario) Build(spec string) {
+	type level struct {
+		indent int
+		key    inst.InstanceKey
+	}
+	stack := []level{}
+	for _, line := range strings.Split(spec, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " \t"))
+		key := Key(line)
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) == 0 {
+			this.Topology.AddInstance(key)
+		} else {
+			this.Topology.AddReplica(key, stack[len(stack)-1].key)
+		}
+		stack = append(stack, level{indent: indent, key: key})
+	}
+}
+
+// update applies given function on a server, failing the test on unknown server
+func (this *Scenario) update(hostPort string, f func(instance *FakeInstance)) {
+	if err := this.Topology.Update(Key(hostPort), f); err != nil {
+		this.t.Fatalf("%+v", err)
+	}
+}
+
+// Instance returns the state of given server
+func (this *Scenario) Instance(hostPort string) FakeInstance {
+	instance, err := this.Topology.Get(Key(hostPort))
+	if err != nil {
+		this.t.Fatalf("%+v", err)
+	}
+	return instance
+}
+
+// KillInstance takes a server down: connections to it are refused and its replicas' IO threads fail to connect
+func (this *Scenario) KillInstance(hostPort string) {
+	this.update(hostPort, func(instance *FakeInstance) { instance.Alive = false })
+}
+
+// StartInstance brings a server back up. As with skip-slave-start, replication is not started.
+func (this *Scenario) StartInstance(hostPort string) {
+	this.update(hostPort, func(instance *FakeInstance) {
+		instance.Alive = true
+		instance.IOThread = "No"
+		instance.SQLThread = "No"
+	})
+}
+
+// Write applies given number of transactions on a server
+func (this *Scenario) Write(hostPort string, transactions int64) {
+	this.update(hostPort, func(instance *FakeInstance) { instance.write(transactions) })
+}
+
+// OpenWriteTransaction starts a long running write transaction on a server, by given process id.
+// It remains open until killed.
+func (this *Scenario) OpenWriteTransaction(hostPort string, processId int64) {
+	this.update(hostPort, func(instance *FakeInstance) {
+		instance.WriteTransactions = append(instance.WriteTransactions, processId)
+	})
+}
+
+// SetReplicationLag makes a replica's SQL thread stop applying events, and report given lag.
+// A zero lag lets the replica catch up.
+func (this *Scenario) SetReplicationLag(hostPort string, lagSeconds int64) {
+	this.update(hostPort, func(instance *FakeInstance) {
+		instance.LagSeconds = lagSeconds
+		instance.SQLThreadStuck = (lagSeconds > 0)
+	})
+}
+
+// BreakIOThread stops a replica's IO thread with given error, e.g. a broken replication user
+func (this *Scenario) BreakIOThread(hostPort string, errorMessage string) {
+	this.update(hostPort, func(instance *FakeInstance) { instance.brokenIO = errorMessage })
+}
+
+// BreakSQLThread stops a replica's SQL thread with given error, e.g. a duplicate key error
+func (this *Scenario) BreakSQLThread(hostPort string, errorMessage string) {
+	this.update(hostPort, func(instance *FakeInstance) {
+		instance.SQLThread = "No"
+		instance.LastSQLError = errorMessage
+	})
+}
+
+// RepairReplication clears injected replication errors and restarts replication
+func (this *Scenario) RepairReplication(hostPort string) {
+	this.update(hostPort, func(instance *FakeInstance) {
+		instance.brokenIO = ""
+		instance.LastSQLError = ""
+		instance.IOThread = "Connecting"
+		instance.SQLThread = "Yes"
+	})
+}
+
+// discoveryOrder returns all servers, masters before their replicas
+func (this *Scenario) discoveryOrder() (keys []inst.InstanceKey) {
+	this.Topology.mutex.Lock()
+	defer this.Topology.mutex.Unlock()
+
+	depth := func(instance *FakeInstance) (depth int) {
+		for visited := map[inst.InstanceKey]bool{}; instance != nil && instance.IsReplica() && !visited[instance.Key]; depth++ {
+			visited[instance.Key] = true
+			instance = this.Topology.instances[instance.MasterKey]
+		}
+		return depth
+	}
+	depths := map[inst.InstanceKey]int{}
+	for key, instance := range this.Topology.instances {
+		keys = append(keys, key)
+		depths[key] = depth(instance)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if depths[keys[i]] == depths[keys[j]] {
+			return keys[i].StringCode() < keys[j].StringCode()
+		}
+		return depths[keys[i]] < depths[keys[j]]
+	})
+	return keys
+}
+
+// Discover lets time pass, then polls all servers, as orchestrator's continuous discovery would.
+// Servers which are down are then seen by orchestrator as unreachable.
+func (this *Scenario) Discover() {
+	_, err := db.ExecOrchestrator(`
+			update database_instance set
+				last_checked = database_instance.last_checked - interval ? second,
+				last_attempted_check = database_instance.last_attempted_check - interval ? second,
+				last_seen = database_instance.last_seen - interval ? second
+		`, config.Config.InstancePollSeconds, config.Config.InstancePollSeconds, config.Config.InstancePollSeconds,
+	)
+	if err != nil {
+		this.t.Fatalf("simulation: cannot age backend data: %+v", err)
+	}
+	for _, key := range this.discoveryOrder() {
+		key := key
+		inst.ReadTopologyInstance(&key)
+	}
+}
+
+// AgeInstance makes orchestrator's backend data of given server appear older, as if the server was last
+// seen (and checked) given number of seconds earlier.
+func (this *Scenario) AgeInstance(hostPort string, seconds int) {
+	key := Key(hostPort)
+	_, err := db.ExecOrchestrator(`
+			update database_instance set
+				last_checked = database_instance.last_checked - interval ? second,
+				last_attempted_check = database_instance.last_attempted_check - interval ? second,
+				last_seen = database_instance.last_seen - interval ? second
+			where
+				hostname = ? and port = ?
+		`, seconds, seconds, seconds, key.Hostname, key.Port,
+	)
+	if err != nil {
+		this.t.Fatalf("simulation: cannot age backend data: %+v", err)
+	}
+}
+
+// Analysis returns orchestrator's current replication analysis, including entries with no problem
+func (this *Scenario) Analysis() []inst.ReplicationAnalysis {
+	analysis, err := inst.GetReplicationAnalysis("", &inst.ReplicationAnalysisHints{IncludeDowntimed: true, IncludeNoProblem: true})
+	if err != nil {
+		this.t.Fatalf("simulation: cannot get analysis: %+v", err)
+	}
+	return analysis
+}
+
+// analysisEntry returns the analysis of given server; NoProblem when none found
+func (this *Scenario) analysisEntry(hostPort string) inst.ReplicationAnalysis {
+	key := Key(hostPort)
+	for _, entry := range this.Analysis() {
+		if entry.AnalyzedInstanceKey.Equals(&key) {
+			return entry
+		}
+	}
+	return inst.ReplicationAnalysis{AnalyzedInstanceKey: key, Analysis: inst.NoProblem}
+}
+
+// ExpectAnalysis asserts the analysis of given server
+func (this *Scenario) ExpectAnalysis(hostPort string, expected inst.AnalysisCode) {
+	this.t.Helper()
+	if analysis := this.analysisEntry(hostPort).Analysis; analysis != expected {
+		this.t.Errorf("simulation: expected analysis %s on %s, got %s", expected, hostPort, analysis)
+	}
+}
+
+// Recover runs recovery on given server's current analysis, with no hooks, waiting for the recovery
+// to complete. The topology is then re-discovered.
+func (this *Scenario) Recover(hostPort string) *logic.TopologyRecovery {
+	return this.RecoverWithCandidate(hostPort, "")
+}
+
+// RecoverWithCandidate runs recovery suggesting a candidate for promotion, same as Recover()
+func (this *Scenario) RecoverWithCandidate(hostPort string, candidateHostPort string) *logic.TopologyRecovery {
+	this.t.Helper()
+	var candidateKey *inst.InstanceKey
+	if candidateHostPort != "" {
+		key := Key(candidateHostPort)
+		candidateKey = &key
+	}
+	entry := this.analysisEntry(hostPort)
+	recoveryAttempted, topologyRecovery, err := logic.ForceExecuteRecovery(entry, candidateKey, true)
+	if err != nil {
+		this.t.Errorf("simulation: recovery of %s (%s) failed: %+v", hostPort, entry.Analysis, err)
+	}
+	if !recoveryAttempted {
+		this.t.Errorf("simulation: recovery of %s (%s) not attempted", hostPort, entry.Analysis)
+	}
+	this.Discover()
+	return topologyRecovery
+}
+
+// RecoverWithHooks runs recovery on given server's current analysis, executing configured hooks, and
+// returns the recovery error, if any. The topology is then re-discovered.
+func (this *Scenario) RecoverWithHooks(hostPort string) (*logic.TopologyRecovery, error) {
+	this.t.Helper()
+	entry := this.analysisEntry(hostPort)
+	_, topologyRecovery, err := logic.ForceExecuteRecovery(entry, nil, false)
+	this.Discover()
+	return topologyRecovery, err
+}
+
+// ExpectMaster asserts given server is a writable master, not replicating from any server
+func (this *Scenario) ExpectMaster(hostPort string) {
+	this.t.Helper()
+	instance := this.Instance(hostPort)
+	if instance.IsReplica() {
+		this.t.Errorf("simulation: expected %s to be a master; it replicates from %+v", hostPort, instance.MasterKey.StringCode())
+	}
+	if instance.ReadOnly {
+		this.t.Errorf("simulation: expected master %s to be writable", hostPort)
+	}
+}
+
+// ExpectReplicating asserts given server successfully replicates from given master
+func (this *Scenario) ExpectReplicating(hostPort string, masterHostPort string) {
+	this.t.Helper()
+	instance := this.Instance(hostPort)
+	masterKey := Key(masterHostPort)
+	if !instance.MasterKey.Equals(&masterKey) {
+		this.t.Errorf("simulation: expected %s to replicate from %s; it replicates from %s", hostPort, masterHostPort, instance.MasterKey.StringCode())
+	}
+	if instance.IOThread != "Yes" || instance.SQLThread != "Yes" {
+		this.t.Errorf("simulation: expected %s replication to run; IO thread: %s, SQL thread: %s", hostPort, instance.IOThread, instance.SQLThread)
+	}
+}
+
+// ExpectNoUnsupportedStatements asserts the simulation handled all statements orchestrator issued
+func (this *Scenario) ExpectNoUnsupportedStatements() {
+	this.t.Helper()
+	if statements := this.Topology.UnsupportedStatements(); len(statements) > 0 {
+		this.t.Errorf("simulation: unsupported statements: %+v", statements)
+	}
+}
@@ -0,0 +1,410 @@
+package simulation
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/github/orchestrator/go/config"
+	"github.com/github/orchestrator/go/inst"
+	"github.com/github/orchestrator/go/logic"
+	"github.com/openark/golib/math"
+	test "github.com/openark/golib/tests"
+)
+
+func TestNoProblem(t *testing.T) {
+	scenario := NewScenario(t)
+	defer scenario.Close()
+
+	scenario.Build(`
+		db-1
+		  db-2
+		  db-3
+	`)
+	scenario.Write("db-1", 10)
+	scenario.Discover()
+	scenario.ExpectAnalysis("db-1", inst.NoProblem)
+	scenario.ExpectAnalysis("db-2", inst.NoProblem)
+	scenario.ExpectReplicating("db-2", "db-1")
+	scenario.ExpectNoUnsupportedStatements()
+
+	instance, _, err := inst.ReadInstance(&inst.InstanceKey{Hostname: "db-2", Port: 3306})
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(instance.MasterKey.Hostname, "db-1")
+	test.S(t).ExpectTrue(instance.ReadOnly)
+	master := scenario.Instance("db-1")
+	test.S(t).ExpectEquals(instance.ExecutedGtidSet, master.ExecutedGtidSet())
+}
+
+func TestDeadMasterRecovery(t *testing.T) {
+	scenario := NewScenario(t)
+	defer scenario.Close()
+
+	scenario.Build(`
+		db-1
+		  db-2
+		  db-3
+		  db-4
+	`)
+	scenario.Write("db-1", 10)
+	scenario.Discover()
+	scenario.KillInstance("db-1")
+	scenario.Discover()
+	scenario.ExpectAnalysis("db-1", inst.DeadMaster)
+
+	topologyRecovery := scenario.Recover("db-1")
+	test.S(t).ExpectTrue(topologyRecovery != nil)
+	test.S(t).ExpectTrue(topologyRecovery.SuccessorKey != nil)
+
+	successor := topologyRecovery.SuccessorKey.Hostname
+	scenario.ExpectMaster(successor)
+	for _, replica := range []string{"db-2", "db-3", "db-4"} {
+		if replica != successor {
+			scenario.ExpectReplicating(replica, successor)
+		}
+	}
+	scenario.ExpectAnalysis(successor, inst.NoProblem)
+	scenario.ExpectNoUnsupportedStatements()
+}
+
+func TestDeadMasterRecoveryWithCandidate(t *testing.T) {
+	scenario := NewScenario(t)
+	defer scenario.Close()
+
+	scenario.Build(`
+		db-1
+		  db-2
+		  db-3
+	`)
+	scenario.Write("db-1", 5)
+	scenario.Discover()
+	scenario.KillInstance("db-1")
+	scenario.Discover()
+
+	topologyRecovery := scenario.RecoverWithCandidate("db-1", "db-3")
+	test.S(t).ExpectEquals(topologyRecovery.SuccessorKey.Hostname, "db-3")
+	scenario.ExpectMaster("db-3")
+	scenario.ExpectReplicating("db-2", "db-3")
+	scenario.ExpectNoUnsupportedStatements()
+}
+
+func TestDeadMasterRecoveryVetoedCandidate(t *testing.T) {
+	scenario := NewScenario(t)
+	defer scenario.Close()
+
+	scenario.Build(`
+		db-1
+		  db-2
+		  db-3
+	`)
+	scenario.Write("db-1", 5)
+	scenario.Discover()
+	scenario.KillInstance("db-1")
+	scenario.Discover()
+
+	masterKey := Key("db-1")
+	regroupCandidate, _, _, _, _, err := inst.GetCandidateReplica(&masterKey, false)
+	test.S(t).ExpectNil(err)
+	otherReplica := math.TernaryString(regroupCandidate.Key.Hostname == "db-2", "db-3", "db-2")
+
+	defer func(processes []string) { config.Config.PreFailoverProcesses = processes }(config.Config.PreFailoverProcesses)
+	config.Config.PreFailoverProcesses = []string{fmt.Sprintf(`echo '{"veto_candidate": "%s:3306"}'`, regroupCandidate.Key.Hostname)}
+
+	topologyRecovery, err := scenario.RecoverWithHooks("db-1")
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(topologyRecovery.SuccessorKey.Hostname, otherReplica)
+	scenario.ExpectMaster(otherReplica)
+	scenario.ExpectReplicating(regroupCandidate.Key.Hostname, otherReplica)
+}
+
+func TestDeadMasterRecoveryAllCandidatesVetoed(t *testing.T) {
+	scenario := NewScenario(t)
+	defer scenario.Close()
+
+	scenario.Build(`
+		db-1
+		  db-2
+		  db-3
+	`)
+	scenario.Write("db-1", 5)
+	scenario.Discover()
+	scenario.KillInstance("db-1")
+	scenario.Discover()
+
+	defer func(processes []string) { config.Config.PreFailoverProcesses = processes }(config.Config.PreFailoverProcesses)
+	config.Config.PreFailoverProcesses = []string{`echo '{"veto_candidates": ["db-2:3306", "db-3:3306"]}'`}
+
+	_, err := scenario.RecoverWithHooks("db-1")
+	test.S(t).ExpectNotNil(err)
+	// Replicas are not regrouped below a vetoed server
+	test.S(t).ExpectEquals(scenario.Instance("db-2").MasterKey.Hostname, "db-1")
+	test.S(t).ExpectEquals(scenario.Instance("db-3").MasterKey.Hostname, "db-1")
+}
+
+func TestGracefulMasterTakeoverDrainTimeout(t *testing.T) {
+	scenario := NewScenario(t)
+	defer scenario.Close()
+
+	defer func(mode string, timeoutSeconds int) {
+		config.Config.GracefulMasterTakeoverDrainMode = mode
+		config.Config.GracefulMasterTakeoverDrainTimeoutSeconds = timeoutSeconds
+	}(config.Config.GracefulMasterTakeoverDrainMode, config.Config.GracefulMasterTakeoverDrainTimeoutSeconds)
+	config.Config.GracefulMasterTakeoverDrainMode = "wait"
+	config.Config.GracefulMasterTakeoverDrainTimeoutSeconds = 1
+
+	scenario.Build(`
+		db-1
+		  db-2
+	`)
+	scenario.Write("db-1", 5)
+	scenario.Discover()
+	scenario.OpenWriteTransaction("db-1", 17)
+
+	_, _, err := logic.GracefulMasterTakeover("db-1:3306", nil)
+	test.S(t).ExpectNotNil(err)
+	scenario.Discover()
+	scenario.ExpectMaster("db-1")
+	scenario.ExpectReplicating("db-2", "db-1")
+	test.S(t).ExpectEquals(len(scenario.Instance("db-1").WriteTransactions), 1)
+
+	// The aborted takeover is recorded, along with the reason
+	recoveries, err := logic.ReadRecentRecoveries("db-1:3306", "", false, 0)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(recoveries), 1)
+	test.S(t).ExpectFalse(recoveries[0].IsSuccessful)
+	test.S(t).ExpectTrue(recoveries[0].Acknowledged)
+	steps, err := logic.ReadTopologyRecoverySteps(recoveries[0].UID)
+	test.S(t).ExpectNil(err)
+	abortReason := ""
+	for _, step := range steps {
+		if strings.Contains(step.Message, "aborted prior to promotion") {
+			abortReason = step.Message
+		}
+	}
+	test.S(t).ExpectTrue(strings.Contains(abortReason, "write transactions still running"))
+}
+
+func TestGracefulMasterTakeoverDrainKill(t *testing.T) {
+	scenario := NewScenario(t)
+	defer scenario.Close()
+
+	defer func(mode string, timeoutSeconds int) {
+		config.Config.GracefulMasterTakeoverDrainMode = mode
+		config.Config.GracefulMasterTakeoverDrainTimeoutSeconds = timeoutSeconds
+	}(config.Config.GracefulMasterTakeoverDrainMode, config.Config.GracefulMasterTakeoverDrainTimeoutSeconds)
+	config.Config.GracefulMasterTakeoverDrainMode = "kill"
+	config.Config.GracefulMasterTakeoverDrainTimeoutSeconds = 1
+
+	scenario.Build(`
+		db-1
+		  db-2
+	`)
+	scenario.Write("db-1", 5)
+	scenario.Discover()
+	scenario.OpenWriteTransaction("db-1", 17)
+
+	topologyRecovery, _, err := logic.GracefulMasterTakeover("db-1:3306", nil)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(topologyRecovery.SuccessorKey.Hostname, "db-2")
+	scenario.Discover()
+	scenario.ExpectMaster("db-2")
+	test.S(t).ExpectEquals(len(scenario.Instance("db-1").WriteTransactions), 0)
+	test.S(t).ExpectTrue(scenario.Instance("db-1").ReadOnly)
+	scenario.ExpectNoUnsupportedStatements()
+}
+
+func TestDeadMasterLaggingReplicaNotPromoted(t *testing.T) {
+	scenario := NewScenario(t)
+	defer scenario.Close()
+
+	// A lagging replica never catches up; shorten the wait for its relay logs to be applied
+	defer func(seconds int) { config.Config.ReasonableReplicationLagSeconds = seconds }(config.Config.ReasonableReplicationLagSeconds)
+	config.Config.ReasonableReplicationLagSeconds = 1
+
+	scenario.Build(`
+		db-1
+		  db-2
+		  db-3
+	`)
+	scenario.Write("db-1", 10)
+	scenario.SetReplicationLag("db-2", 300)
+	scenario.Write("db-1", 10)
+	scenario.Discover()
+	lagging, upToDate := scenario.Instance("db-2"), scenario.Instance("db-3")
+	test.S(t).ExpectTrue(lagging.transactionsCount() < upToDate.transactionsCount())
+
+	scenario.KillInstance("db-1")
+	scenario.Discover()
+	scenario.ExpectAnalysis("db-1", inst.DeadMaster)
+
+	topologyRecovery := scenario.Recover("db-1")
+	test.S(t).ExpectEquals(topologyRecovery.SuccessorKey.Hostname, "db-3")
+	scenario.ExpectMaster("db-3")
+	test.S(t).ExpectEquals(scenario.Instance("db-2").MasterKey.Hostname, "db-3")
+	scenario.ExpectNoUnsupportedStatements()
+}
+
+func TestDeadMasterWithoutReplicas(t *testing.T) {
+	scenario := NewScenario(t)
+	defer scenario.Close()
+
+	scenario.Build(`
+		db-1
+		  db-2
+	`)
+	scenario.Discover()
+	scenario.KillInstance("db-2")
+	scenario.Discover()
+	scenario.ExpectAnalysis("db-1", inst.MasterSingleSlaveDead)
+	scenario.KillInstance("db-1")
+	scenario.Discover()
+	scenario.ExpectAnalysis("db-1", inst.DeadMasterAndSlaves)
+}
+
+func TestBrokenIOThread(t *testing.T) {
+	scenario := NewScenario(t)
+	defer scenario.Close()
+
+	scenario.Build(`
+		db-1
+		  db-2
+		  db-3
+	`)
+	scenario.Discover()
+	scenario.BreakIOThread("db-2", "error connecting to master 'repl@db-1:3306' - retry-time: 60 retries: 1")
+	scenario.Discover()
+	scenario.ExpectAnalysis("db-1", inst.NoProblem)
+
+	instance, _, err := inst.ReadInstance(&inst.InstanceKey{Hostname: "db-2", Port: 3306})
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectTrue(instance.Slave_IO_Running == false)
+	test.S(t).ExpectTrue(instance.LastIOError != "")
+
+	scenario.BreakIOThread("db-3", "error connecting to master 'repl@db-1:3306' - retry-time: 60 retries: 1")
+	scenario.Discover()
+	scenario.ExpectAnalysis("db-1", inst.AllMasterSlavesNotReplicating)
+
+	scenario.RepairReplication("db-2")
+	scenario.RepairReplication("db-3")
+	scenario.Discover()
+	scenario.ExpectAnalysis("db-1", inst.NoProblem)
+	scenario.ExpectReplicating("db-2", "db-1")
+}
+
+func TestIntermediateMasterRecovery(t *testing.T) {
+	scenario := NewScenario(t)
+	defer scenario.Close()
+
+	scenario.Build(`
+		db-1
+		  db-2
+		    db-4
+		    db-5
+		  db-3
+	`)
+	scenario.Write("db-1", 3)
+	scenario.Discover()
+	scenario.KillInstance("db-2")
+	scenario.Discover()
+	scenario.ExpectAnalysis("db-2", inst.DeadIntermediateMaster)
+
+	scenario.Recover("db-2")
+	for _, replica := range []string{"db-4", "db-5"} {
+		if masterKey := scenario.Instance(replica).MasterKey; masterKey.Hostname == "db-2" {
+			t.Errorf("expected %s to be relocated away from dead db-2", replica)
+		}
+	}
+	scenario.ExpectNoUnsupportedStatements()
+}
+
+func TestGtidSubtract(t *testing.T) {
+	test.S(t).ExpectEquals(gtidSubtract("a:1-10,\nb:1-5", "a:1-7"), "a:8-10,\nb:1-5")
+	test.S(t).ExpectEquals(gtidSubtract("a:1-10", "a:1-9"), "a:10")
+	test.S(t).ExpectEquals(gtidSubtract("a:1-10", "a:1-10"), "")
+}
+
+func TestGarbageReport(t *testing.T) {
+	scenario := NewScenario(t)
+	defer scenario.Close()
+
+	scenario.Build(`
+		db-1
+		  db-2
+		  db-3
+	`)
+	scenario.Discover()
+	scenario.KillInstance("db-3")
+	scenario.AgeInstance("db-3", 30*3600)
+
+	db3Key := Key("db-3")
+	forgottenKey := Key("db-9")
+	test.S(t).ExpectNil(inst.BeginDowntime(inst.NewDowntime(&db3Key, "test", "decommissioned", time.Hour)))
+	test.S(t).ExpectNil(inst.RegisterCandidateInstance(inst.NewCandidateDatabaseInstance(&forgottenKey, inst.PreferPromoteRule)))
+
+	report, err := inst.ReadGarbageReport(24)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(report.StaleInstances), 1)
+	test.S(t).ExpectEquals(report.StaleInstances[0].Key, db3Key)
+	test.S(t).ExpectTrue(report.StaleInstances[0].HoursSinceLastSeen >= 29)
+	test.S(t).ExpectEquals(len(report.GhostClusters), 0)
+	test.S(t).ExpectEquals(len(report.OrphanedRows), 2)
+
+	forgottenCount, err := inst.ForgetGarbage(report)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(forgottenCount, 3)
+	_, found, _ := inst.ReadInstance(&db3Key)
+	test.S(t).ExpectFalse(found)
+
+	report, err = inst.ReadGarbageReport(24)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(report.StaleInstances), 0)
+	test.S(t).ExpectEquals(len(report.OrphanedRows), 0)
+
+	scenario.KillInstance("db-1")
+	scenario.Discover()
+	report, err = inst.ReadGarbageReport(24)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(report.StaleInstances), 0)
+	test.S(t).ExpectEquals(len(report.GhostClusters), 1)
+	test.S(t).ExpectTrue(report.GhostClusters[0].HasMaster)
+	test.S(t).ExpectEquals(report.GhostClusters[0].CountInstances, 2)
+}
+
+func TestApplyLongRunningQueriesSample(t *testing.T) {
+	scenario := NewScenario(t)
+	defer scenario.Close()
+
+	scenario.Build(`
+		db-1
+		  db-2
+	`)
+	scenario.Discover()
+
+	// As applied by raft members, upon a sample published by the leader
+	applier := logic.NewCommandApplier()
+	sample := inst.LongRunningQueriesSample{
+		Key:       Key("db-1"),
+		Processes: [](*inst.Process){{Id: 7, User: "app", Command: "Query", Time: 120, Info: "select sleep(120)"}},
+	}
+	value, err := json.Marshal(sample)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectNil(applier.ApplyCommand("write-long-running-queries", value))
+
+	masterKey := Key("db-1")
+	clusterName := masterKey.StringCode()
+	processes, err := inst.ReadClusterLongRunningQueries(clusterName)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(processes), 1)
+	test.S(t).ExpectEquals(processes[0].Id, int64(7))
+	test.S(t).ExpectEquals(processes[0].InstanceHostname, "db-1")
+
+	// A later sample replaces an earlier one
+	sample.Processes = [](*inst.Process){}
+	value, _ = json.Marshal(sample)
+	test.S(t).ExpectNil(applier.ApplyCommand("write-long-running-queries", value))
+	processes, err = inst.ReadClusterLongRunningQueries(clusterName)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(processes), 0)
+}